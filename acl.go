@@ -0,0 +1,121 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend/config"
+)
+
+const (
+	// ACLRead is the access required to the prefixes watched by the subscribers
+	ACLRead = "read"
+	// ACLWrite is the access required to the registration prefix
+	ACLWrite = "write"
+)
+
+// aclProbeKey is the key under a prefix used to check the write permissions. It is never written.
+const aclProbeKey = "krakend-etcd-acl-probe"
+
+// WriteChecker is implemented by the clients able to check if their credentials can write under a prefix
+// without modifying it
+type WriteChecker interface {
+	// CheckWrite returns an error if the credentials are not allowed to write under the prefix
+	CheckWrite(prefix string) error
+}
+
+// ACLEntry is the result of checking the access to a prefix
+type ACLEntry struct {
+	Prefix string
+	Access string
+	Err    error
+}
+
+// Denied returns true if the credentials of the client are not allowed to access the prefix
+func (e ACLEntry) Denied() bool {
+	return e.Err != nil && ErrorCode(e.Err) == ErrorCodePermissionDenied
+}
+
+// ACLReport contains the results of checking the access to every prefix
+type ACLReport []ACLEntry
+
+// Denied returns the entries of the prefixes the credentials are not allowed to access
+func (r ACLReport) Denied() ACLReport {
+	denied := ACLReport{}
+	for _, e := range r {
+		if e.Denied() {
+			denied = append(denied, e)
+		}
+	}
+	return denied
+}
+
+// Err returns an error describing all the denied prefixes, or nil if there are none. The other errors
+// are not related to the permissions, so they are left to Verify.
+func (r ACLReport) Err() error {
+	denied := r.Denied()
+	if len(denied) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(denied))
+	for i, e := range denied {
+		msgs[i] = fmt.Sprintf("%s (%s): %s", e.Prefix, e.Access, e.Err.Error())
+	}
+	return fmt.Errorf("the etcd credentials are not allowed to access the prefixes: %s", strings.Join(msgs, ", "))
+}
+
+// CheckACL checks that the credentials of the client can read every prefix used by the backends of the
+// service config relying on the etcd subscriber and, if the registration prefix is not empty, write under
+// it, so a wrong role mapping is detected at startup instead of as PermissionDenied errors at runtime.
+func CheckACL(c Client, cfg config.ServiceConfig, registrationPrefix string) ACLReport {
+	report := ACLReport{}
+	backendPrefixes(c, cfg, func(prefix string, options BackendOptions, err error) {
+		if err == nil {
+			_, err = options.scope(c).GetEntries(prefix)
+		}
+		report = append(report, ACLEntry{Prefix: prefix, Access: ACLRead, Err: err})
+	})
+	if registrationPrefix == "" {
+		return report
+	}
+	entry := ACLEntry{Prefix: registrationPrefix, Access: ACLWrite, Err: ErrNotWriteCheckable}
+	if w, ok := c.(WriteChecker); ok {
+		entry.Err = w.CheckWrite(registrationPrefix)
+	}
+	return append(report, entry)
+}
+
+// CheckWrite implements the etcd WriteChecker interface. The put of a probe key under the prefix is
+// conditioned to an impossible index, so it is always rejected, after checking the permissions.
+func (c *client) CheckWrite(prefix string) error {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	key := strings.TrimSuffix(prefix, "/") + "/" + aclProbeKey
+	_, err := c.keysAPI.Set(ctx, key, "", &etcd.SetOptions{PrevIndex: math.MaxUint64})
+	if e, ok := err.(etcd.Error); ok && e.Code != etcd.ErrorCodeUnauthorized {
+		return nil
+	}
+	return countError(err)
+}
+
+// CheckWrite implements the etcd WriteChecker interface. The put of a probe key under the prefix is part
+// of a transaction whose condition never holds, so it is never applied, but etcd checks the permissions
+// of every operation of the transaction anyway.
+func (c *clientv3) CheckWrite(prefix string) error {
+	if c.client == nil {
+		return ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+	key := prefix + aclProbeKey
+	_, err := c.client.Txn(ctx).
+		If(etcdv3.Compare(etcdv3.CreateRevision(key), "<", 0)).
+		Then(etcdv3.OpPut(key, "")).
+		Commit()
+	return countError(err)
+}
@@ -0,0 +1,129 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	"github.com/devopsfaith/krakend-etcd/internal/rpctypes"
+	"github.com/devopsfaith/krakend/config"
+)
+
+type dummyWriteCheckerClient struct {
+	dummyClient
+	checkWrite func(string) error
+}
+
+func (c dummyWriteCheckerClient) CheckWrite(prefix string) error { return c.checkWrite(prefix) }
+
+func TestCheckACL(t *testing.T) {
+	c := dummyWriteCheckerClient{
+		dummyClient: dummyClient{
+			getEntries: func(prefix string) ([]string, error) {
+				switch prefix {
+				case "/services/ok":
+					return []string{"10.0.0.1:8080"}, nil
+				case "/services/empty":
+					return []string{}, nil
+				case "/services/down":
+					return nil, fmt.Errorf("random fail")
+				}
+				return nil, rpctypes.ErrPermissionDenied
+			},
+			watchPrefix: func(string, chan struct{}) {},
+		},
+		checkWrite: func(prefix string) error {
+			if prefix != "/registry/" {
+				t.Errorf("unexpected prefix: %s", prefix)
+			}
+			return rpctypes.ErrPermissionDenied
+		},
+	}
+	cfg := config.ServiceConfig{
+		Endpoints: []*config.EndpointConfig{
+			{
+				Backend: []*config.Backend{
+					{SD: SDName, Host: []string{"/services/ok"}},
+					{SD: SDName, Host: []string{"/services/empty"}},
+					{SD: SDName, Host: []string{"/services/down"}},
+					{SD: SDName, Host: []string{"/private/api"}},
+					{SD: SDName, Host: []string{"/services/ok"}},
+				},
+			},
+		},
+	}
+
+	report := CheckACL(c, cfg, "/registry/")
+	if len(report) != 5 {
+		t.Fatalf("unexpected report size: %d", len(report))
+	}
+	if e := report[4]; e.Prefix != "/registry/" || e.Access != ACLWrite {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	denied := report.Denied()
+	if len(denied) != 2 {
+		t.Fatalf("unexpected number of denied prefixes: %d", len(denied))
+	}
+	if denied[0].Prefix != "/private/api" || denied[0].Access != ACLRead || denied[1].Prefix != "/registry/" {
+		t.Errorf("unexpected denied prefixes: %+v", denied)
+	}
+
+	expected := "the etcd credentials are not allowed to access the prefixes: /private/api (read): " +
+		rpctypes.ErrPermissionDenied.Error() + ", /registry/ (write): " + rpctypes.ErrPermissionDenied.Error()
+	if err := report.Err(); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := report[:3].Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if report := CheckACL(c, cfg, ""); len(report) != 4 {
+		t.Errorf("unexpected report size: %d", len(report))
+	}
+}
+
+func TestCheckACL_notWriteCheckable(t *testing.T) {
+	c := dummyClient{
+		getEntries:  func(string) ([]string, error) { return []string{}, nil },
+		watchPrefix: func(string, chan struct{}) {},
+	}
+	report := CheckACL(c, config.ServiceConfig{}, "/registry/")
+	if len(report) != 1 || report[0].Err != ErrNotWriteCheckable {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if err := report.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type aclKeysAPI struct {
+	fakeKeysAPI
+	err error
+}
+
+func (a *aclKeysAPI) Set(_ context.Context, _, _ string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	if opts == nil || opts.PrevIndex != math.MaxUint64 {
+		return nil, fmt.Errorf("unexpected options: %+v", opts)
+	}
+	return nil, a.err
+}
+
+func TestClient_CheckWrite(t *testing.T) {
+	for i, tc := range []struct {
+		err    error
+		denied bool
+	}{
+		{err: etcd.Error{Code: etcd.ErrorCodeTestFailed}},
+		{err: etcd.Error{Code: etcd.ErrorCodeKeyNotFound}},
+		{err: etcd.Error{Code: etcd.ErrorCodeUnauthorized}, denied: true},
+	} {
+		c := &client{keysAPI: &aclKeysAPI{err: tc.err}, ctx: context.Background()}
+		err := c.CheckWrite("/registry")
+		if denied := (ACLEntry{Err: err}).Denied(); denied != tc.denied {
+			t.Errorf("#%d: unexpected result: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package etcd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoAdvertiseAddress is the error returned when the address to advertise can not be resolved
+var ErrNoAdvertiseAddress = fmt.Errorf("unable to resolve the address to advertise")
+
+// Address is an address an instance is registered with, instead of the one it binds to. e.g. the ip of
+// its pod or the external address of its load balancer.
+type Address struct {
+	// Name distinguishes the addresses of the instance (e.g. "internal" and "external") and it is appended
+	// to the key of the instance when it is not empty
+	Name string
+	// URL is the address to advertise, e.g. "https://api.example.com" or "10.0.0.1:8080". The missing
+	// scheme and port are taken from the bind address.
+	URL string
+	// Env is the environment variable holding the host to advertise when the URL is not defined, e.g.
+	// the POD_IP or NODE_IP exposed by the Kubernetes downward API
+	Env string
+}
+
+// ResolveAddress returns the url advertising the bind address (e.g. "http://0.0.0.0:8080") as declared
+// by the received Address. Without a URL nor an Env variable set, the bind address is advertised as it is
+// or, if it binds all the interfaces, with the ip of the first non loopback interface.
+func ResolveAddress(bind string, a Address) (string, error) {
+	scheme, host, port := splitInstanceURL(bind)
+	advertised := a.URL
+	if advertised == "" && a.Env != "" {
+		advertised = os.Getenv(a.Env)
+	}
+	if advertised != "" {
+		s, h, p := splitInstanceURL(advertised)
+		if s != "" {
+			scheme = s
+		}
+		if p != "" || s != "" {
+			port = p
+		}
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		detected, err := interfaceIP()
+		if err != nil {
+			return "", err
+		}
+		host = detected
+	}
+	url := joinAuthority(host, port)
+	if scheme != "" {
+		url = scheme + "://" + url
+	}
+	return url, nil
+}
+
+// interfaceIP returns the ip of the first non loopback interface, preferring the IPv4 ones
+func interfaceIP() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	ipv6 := ""
+	for _, addr := range addrs {
+		n, ok := addr.(*net.IPNet)
+		if !ok || n.IP.IsLoopback() || n.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if n.IP.To4() != nil {
+			return n.IP.String(), nil
+		}
+		if ipv6 == "" {
+			ipv6 = n.IP.String()
+		}
+	}
+	if ipv6 == "" {
+		return "", ErrNoAdvertiseAddress
+	}
+	return ipv6, nil
+}
+
+// RegisterAddresses registers the instance once for every address, under the key followed by the name
+// of the address, with the url of the instance replaced by the resolved address (see ResolveAddress).
+// Without addresses, the bind one is advertised under the key. All the addresses are tried and the first
+// error is returned.
+func RegisterAddresses(r Registrar, key, format string, i Instance, bind string, addresses []Address, ttl time.Duration) error {
+	if len(addresses) == 0 {
+		addresses = []Address{{}}
+	}
+	var firstErr error
+	for _, a := range addresses {
+		url, err := ResolveAddress(bind, a)
+		if err == nil {
+			instance := i
+			instance.URL = url
+			err = RegisterInstance(r, addressKey(key, a), format, instance, ttl)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// addressKey returns the key of the instance registered with the address
+func addressKey(key string, a Address) string {
+	if a.Name == "" {
+		return key
+	}
+	return strings.TrimRight(key, "/") + "/" + a.Name
+}
@@ -0,0 +1,79 @@
+package etcd
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveAddress(t *testing.T) {
+	os.Setenv("KRAKEND_ETCD_TEST_POD_IP", "10.1.2.3")
+	defer os.Unsetenv("KRAKEND_ETCD_TEST_POD_IP")
+
+	for _, tc := range []struct {
+		bind     string
+		address  Address
+		expected string
+	}{
+		{bind: "http://10.0.0.1:8080", expected: "http://10.0.0.1:8080"},
+		{bind: "http://0.0.0.0:8080", address: Address{URL: "10.0.0.2"}, expected: "http://10.0.0.2:8080"},
+		{bind: "http://0.0.0.0:8080", address: Address{URL: "10.0.0.2:9090"}, expected: "http://10.0.0.2:9090"},
+		{bind: "http://0.0.0.0:8080", address: Address{URL: "https://api.example.com"}, expected: "https://api.example.com"},
+		{bind: "http://0.0.0.0:8080", address: Address{Env: "KRAKEND_ETCD_TEST_POD_IP"}, expected: "http://10.1.2.3:8080"},
+		{bind: ":8080", address: Address{URL: "fe80::1%eth0"}, expected: "[fe80::1%25eth0]:8080"},
+	} {
+		url, err := ResolveAddress(tc.bind, tc.address)
+		if err != nil || url != tc.expected {
+			t.Errorf("unexpected address for %s %+v: %s %v", tc.bind, tc.address, url, err)
+		}
+	}
+}
+
+func TestResolveAddress_unspecified(t *testing.T) {
+	url, err := ResolveAddress("http://0.0.0.0:8080", Address{Env: "KRAKEND_ETCD_TEST_UNDEFINED"})
+	if err == ErrNoAdvertiseAddress {
+		t.Skip("no network interfaces")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port := splitAuthority(strings.TrimPrefix(url, "http://"))
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() || ip.IsLoopback() || port != "8080" {
+		t.Errorf("unexpected address: %s", url)
+	}
+}
+
+func TestRegisterAddresses(t *testing.T) {
+	r := &mapRegistrar{entries: map[string]string{}}
+	err := RegisterAddresses(r, "/gateways/gw-1/", EntryFormatRaw, Instance{Name: "gateway"}, "http://0.0.0.0:8080", []Address{
+		{Name: "internal", URL: "10.0.0.1"},
+		{Name: "external", URL: "https://api.example.com"},
+	}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"/gateways/gw-1/internal": "http://10.0.0.1:8080",
+		"/gateways/gw-1/external": "https://api.example.com",
+	}
+	if !reflect.DeepEqual(r.entries, expected) {
+		t.Errorf("unexpected registrations: %v", r.entries)
+	}
+}
+
+type mapRegistrar struct {
+	entries map[string]string
+}
+
+func (r *mapRegistrar) Register(key, value string, _ time.Duration) error {
+	r.entries[key] = value
+	return nil
+}
+
+func (r *mapRegistrar) Deregister(key string) error {
+	delete(r.entries, key)
+	return nil
+}
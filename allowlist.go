@@ -0,0 +1,57 @@
+package etcd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrPrefixNotAllowed is the error wrapped by the PrefixNotAllowedErrors
+var ErrPrefixNotAllowed = fmt.Errorf("prefix not allowed")
+
+// PrefixNotAllowedError is the error returned by the clients reading a prefix outside their
+// ClientOptions.PrefixAllowlist
+type PrefixNotAllowedError struct {
+	Prefix string
+}
+
+// Error implements the error interface
+func (e *PrefixNotAllowedError) Error() string {
+	return fmt.Sprintf("%s: %s is outside the prefix allowlist", ErrPrefixNotAllowed.Error(), e.Prefix)
+}
+
+// Unwrap returns ErrPrefixNotAllowed
+func (*PrefixNotAllowedError) Unwrap() error {
+	return ErrPrefixNotAllowed
+}
+
+// allowed returns a PrefixNotAllowedError if the options declare a prefix allowlist and the received
+// prefix does not start with any of its entries
+func (o ClientOptions) allowed(prefix string) error {
+	if len(o.PrefixAllowlist) == 0 {
+		return nil
+	}
+	for _, p := range o.PrefixAllowlist {
+		if strings.HasPrefix(prefix, p) {
+			return nil
+		}
+	}
+	addMetric(MetricRejectedPrefixes, 1)
+	return &PrefixNotAllowedError{Prefix: prefix}
+}
+
+// parsePrefixAllowlist parses the list of allowed prefixes: ["/services/public/", "/services/team-a/"]
+func parsePrefixAllowlist(v interface{}) ([]string, bool) {
+	tmp, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	allowlist := make([]string, len(tmp))
+	for i, p := range tmp {
+		s, ok := p.(string)
+		if !ok || s == "" {
+			return nil, false
+		}
+		allowlist[i] = s
+	}
+	return allowlist, true
+}
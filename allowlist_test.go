@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+func TestClient_prefixAllowlist(t *testing.T) {
+	options := ClientOptions{PrefixAllowlist: []string{"/services/public/"}}
+	for _, c := range []ScopedClient{
+		&client{keysAPI: &fakeKeysAPI{getres: &getResult{resp: &etcd.Response{Node: &etcd.Node{}}}}, ctx: context.Background(), options: options},
+		&clientv3{client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{}}}, ctx: context.Background(), timeout: time.Second, options: options},
+	} {
+		before := Metrics()[MetricRejectedPrefixes]
+		if _, err := c.GetEntries("/services/public/api"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		scoped := c.WithOptions(ClientOptions{Consistency: ConsistencySerializable})
+		_, err := scoped.GetEntries("/services/private/api")
+		if !errors.Is(err, ErrPrefixNotAllowed) || err.(*PrefixNotAllowedError).Prefix != "/services/private/api" {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		ch := make(chan struct{}, 1)
+		done := make(chan struct{})
+		go func() {
+			c.WatchPrefix("/services/private/api", ch)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the watch of the prefix should be rejected")
+		}
+		if len(ch) != 0 {
+			t.Error("the rejected watch should not notify")
+		}
+		if v := Metrics()[MetricRejectedPrefixes] - before; v != 2 {
+			t.Errorf("unexpected rejected prefixes: %d", v)
+		}
+	}
+}
+
+func TestParseOptions_prefixAllowlist(t *testing.T) {
+	options, err := parseOptionsMap(map[string]interface{}{"prefix_allowlist": []interface{}{"/services/public/", "/services/team-a/"}})
+	if err != nil || len(options.PrefixAllowlist) != 2 || options.PrefixAllowlist[1] != "/services/team-a/" {
+		t.Errorf("unexpected options: %+v %v", options, err)
+	}
+	for _, v := range []interface{}{"/services/", []interface{}{""}, []interface{}{42.0}} {
+		if _, err := parseOptionsMap(map[string]interface{}{"prefix_allowlist": v}); err == nil || err.(*ConfigError).Path != "prefix_allowlist" {
+			t.Errorf("unexpected error parsing %v: %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package etcd
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+// BackendOptions defines the discovery options that can be declared by each backend, under the
+// Namespace key of its extra config. All values are optional.
+type BackendOptions struct {
+	// DefaultScheme is added to the discovered entries without a scheme. e.g. "http"
+	DefaultScheme string
+	// DefaultPort is added to the discovered entries without a port. e.g. "8080"
+	DefaultPort string
+	// Overrides replaces the gateway level client options for this backend. It is declared under
+	// the "options" key and accepts the same fields, but only the read related ones are applied.
+	// See ScopedClient.
+	Overrides ClientOptions
+	// Shards is the number of sharded sub-prefixes to read. See ShardedClient.
+	Shards int
+	// ShardFormat is the format of the sharded sub-prefixes. See ShardedClient.
+	ShardFormat string
+	// ShardParallelism is the maximum number of shards to read concurrently. See ShardedClient.
+	ShardParallelism int
+	// DedupHosts removes the repeated hosts, like the ones registered in several mirrored clusters
+	DedupHosts bool
+	// RemovalGrace keeps the removed hosts in the list for this period, tolerating the lag of the
+	// mirrored clusters
+	RemovalGrace time.Duration
+	// KeyLayout is the layout of the keys storing the entries. With KeyLayoutSkyDNS, the backend
+	// host can be declared as a domain name and the entries are decoded as SkyDNS records.
+	KeyLayout string
+	// TrailingSlash appends a slash to the prefix, so it only matches the keys of the directory (e.g.
+	// "/services/api" would also match "/services/api-v2/1")
+	TrailingSlash bool
+	// ChurnThreshold is the number of hosts added or removed during a minute that triggers the churn
+	// handlers. See RegisterChurnHandler.
+	ChurnThreshold int
+	// MinHosts is the number of hosts the backend is expected to have. The hosts missing are published
+	// as the MetricMissingHosts gauge of the prefix.
+	MinHosts int
+	// NegativeTTL is the period the prefixes that could not be resolved are not retried, unless
+	// a watch event reveals their creation. Defaults to DefaultNegativeTTL.
+	NegativeTTL time.Duration
+	// ReadThroughTimeout is the time the requests to a subscriber without hosts wait for its first read.
+	// Defaults to DefaultReadThroughTimeout.
+	ReadThroughTimeout time.Duration
+	// Tenant is the tenant owning the backend, whose quota limits its discovery. See SetTenantQuotas.
+	Tenant string
+	// RefreshWeight is the share of the refreshes of the backend when they are queued. Defaults to 1.
+	// See SetRefreshConcurrency.
+	RefreshWeight float64
+	// AllowedCIDRs are the networks the hosts must belong to. The hosts outside them, or declared with a
+	// name instead of an IP address, are discarded.
+	AllowedCIDRs []net.IPNet
+	// DeniedCIDRs are the networks whose hosts are discarded
+	DeniedCIDRs []net.IPNet
+	// PortMap replaces the registered ports of the hosts with the reachable ones, for the environments
+	// where they differ (e.g. NodePort services or NAT). e.g. {"8080": "31080"}
+	PortMap map[string]string
+	// Priority is the priority class of the backend (PriorityCritical, PriorityStandard or
+	// PriorityBestEffort), controlling the order of its refreshes, the delay of its read retries and
+	// whether its reads can be deferred during the brownouts of the registry
+	Priority string
+}
+
+const (
+	// KeyLayoutPrefix makes the subscribers use the backend host as the prefix to watch. This is the default.
+	KeyLayoutPrefix = "prefix"
+	// KeyLayoutSkyDNS makes the subscribers translate the backend host into a SkyDNS prefix, so
+	// "api.example.com" watches "/skydns/com/example/api", and decode the entries as SkyDNS records
+	KeyLayoutSkyDNS = "skydns"
+)
+
+func parseBackendOptions(e config.ExtraConfig) (BackendOptions, error) {
+	options := BackendOptions{}
+	v, ok := e[Namespace]
+	if !ok {
+		return options, nil
+	}
+	tmp, ok := v.(map[string]interface{})
+	if !ok {
+		return options, badConfig(Namespace)
+	}
+
+	if o, ok := tmp["default_scheme"].(string); ok {
+		options.DefaultScheme = o
+	}
+
+	switch o := tmp["default_port"].(type) {
+	case string:
+		options.DefaultPort = o
+	case float64:
+		options.DefaultPort = fmt.Sprintf("%d", int(o))
+	case int:
+		options.DefaultPort = fmt.Sprintf("%d", o)
+	}
+
+	if o, ok := tmp["options"]; ok {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			return options, badConfig(Namespace + ".options")
+		}
+		overrides, err := parseOptionsMap(m)
+		if err != nil {
+			return options, withPath(Namespace+".options", err)
+		}
+		options.Overrides = overrides
+	}
+
+	if o, ok := tmp["shards"].(float64); ok {
+		options.Shards = int(o)
+	}
+
+	if o, ok := tmp["shard_format"].(string); ok {
+		options.ShardFormat = o
+	}
+
+	if o, ok := tmp["shard_parallelism"].(float64); ok {
+		options.ShardParallelism = int(o)
+	}
+
+	if o, ok := tmp["dedup_hosts"].(bool); ok {
+		options.DedupHosts = o
+	}
+
+	if o, ok := tmp["removal_grace"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			options.RemovalGrace = d
+		}
+	}
+
+	if o, ok := tmp["key_layout"]; ok {
+		options.KeyLayout = parseEnum(o, "", KeyLayoutPrefix, KeyLayoutSkyDNS)
+	}
+	if o, ok := tmp["trailing_slash"].(bool); ok {
+		options.TrailingSlash = o
+	}
+	if options.KeyLayout == KeyLayoutSkyDNS && options.Overrides.EntryFormat == "" {
+		options.Overrides.EntryFormat = EntryFormatSkyDNS
+	}
+
+	if o, ok := tmp["churn_threshold"].(float64); ok {
+		options.ChurnThreshold = int(o)
+	}
+
+	if o, ok := tmp["min_hosts"].(float64); ok {
+		options.MinHosts = int(o)
+	}
+
+	if o, ok := tmp["negative_ttl"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			options.NegativeTTL = d
+		}
+	}
+
+	if o, ok := tmp["read_through_timeout"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			options.ReadThroughTimeout = d
+		}
+	}
+
+	if o, ok := tmp["tenant"].(string); ok {
+		options.Tenant = o
+	}
+
+	if o, ok := tmp["refresh_weight"].(float64); ok {
+		options.RefreshWeight = o
+	}
+
+	if o, ok := tmp["priority"]; ok {
+		options.Priority = parseEnum(o, "", PriorityCritical, PriorityStandard, PriorityBestEffort)
+		if options.Priority == "" {
+			return options, badConfig(Namespace + ".priority")
+		}
+	}
+
+	for key, field := range map[string]*[]net.IPNet{
+		"allowed_cidrs": &options.AllowedCIDRs,
+		"denied_cidrs":  &options.DeniedCIDRs,
+	} {
+		o, ok := tmp[key]
+		if !ok {
+			continue
+		}
+		networks, ok := parseCIDRs(o)
+		if !ok {
+			return options, badConfig(Namespace + "." + key)
+		}
+		*field = networks
+	}
+
+	if o, ok := tmp["port_map"]; ok {
+		ports, ok := parsePortMap(o)
+		if !ok {
+			return options, badConfig(Namespace + ".port_map")
+		}
+		options.PortMap = ports
+	}
+	return options, nil
+}
+
+// parsePortMap parses the port remapping rules: {"8080": "31080", "8443": 31443}
+func parsePortMap(v interface{}) (map[string]string, bool) {
+	tmp, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	ports := make(map[string]string, len(tmp))
+	for from, o := range tmp {
+		to := ""
+		switch p := o.(type) {
+		case string:
+			to = p
+		case float64:
+			to = fmt.Sprintf("%d", int(p))
+		}
+		if !validPort(from) || !validPort(to) {
+			return nil, false
+		}
+		ports[from] = to
+	}
+	return ports, true
+}
+
+// validPort returns true if the port is a number between 1 and 65535
+func validPort(port string) bool {
+	p, err := strconv.Atoi(port)
+	return err == nil && p > 0 && p <= 65535
+}
+
+// scope returns a client applying the backend overrides, if the received client supports them,
+// and reading the sharded sub-prefixes, if defined
+func (o BackendOptions) scope(c Client) Client {
+	if sc, ok := c.(ScopedClient); ok && !reflect.DeepEqual(o.Overrides, ClientOptions{}) {
+		c = sc.WithOptions(o.Overrides)
+	}
+	if o.Shards > 0 {
+		c = NewShardedClient(c, o.Shards, o.ShardFormat, o.ShardParallelism)
+	}
+	return c
+}
+
+// scoped returns true if the backend reads its prefix with a client other than the received one. See scope.
+func (o BackendOptions) scoped() bool {
+	return !reflect.DeepEqual(o.Overrides, ClientOptions{}) || o.Shards > 0
+}
+
+// prefix returns the etcd prefix to watch for the received backend host, collapsing the repeated
+// slashes. The prefixes without a leading slash are rejected with ErrBadPrefix, since they would
+// silently match no keys. The prefix is rewritten with the rules of its tenant set for the client (see
+// SetRewriteRules), so the one returned may differ from the configured one.
+func (o BackendOptions) prefix(c Client, host string) (string, error) {
+	prefix := host
+	if o.KeyLayout == KeyLayoutSkyDNS {
+		prefix = SkyDNSPrefix(host)
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		return "", ErrBadPrefix
+	}
+	for strings.Contains(prefix, "//") {
+		prefix = strings.Replace(prefix, "//", "/", -1)
+	}
+	prefix = settingsOf(c).prefix(o.Tenant, prefix)
+	if o.TrailingSlash && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix, nil
+}
+
+// key returns the identifier of the subscribers sharing the prefix and the options. The schema of the
+// entries is identified by its source instead of its address, so the backends declaring the same one
+// share their subscriber.
+func (o BackendOptions) key(prefix string) string {
+	schema := ""
+	if o.Overrides.EntrySchema != nil {
+		schema = o.Overrides.EntrySchema.canonical()
+		o.Overrides.EntrySchema = nil
+	}
+	return fmt.Sprintf("%s%+v%s", prefix, o, schema)
+}
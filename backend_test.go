@@ -0,0 +1,124 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestParseBackendOptions(t *testing.T) {
+	options, err := parseBackendOptions(config.ExtraConfig{
+		Namespace: map[string]interface{}{
+			"default_scheme": "https",
+			"default_port":   "8443",
+			"options": map[string]interface{}{
+				"header_timeout": "500ms",
+				"filter":         "node-*",
+				"entry_format":   "json",
+				"consistency":    "serializable",
+				"dial_timeout":   "1s",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.DefaultScheme != "https" {
+		t.Errorf("unexpected default scheme: %s", options.DefaultScheme)
+	}
+	if options.DefaultPort != "8443" {
+		t.Errorf("unexpected default port: %s", options.DefaultPort)
+	}
+	expected := ClientOptions{
+		DialTimeout:             time.Second,
+		HeaderTimeoutPerRequest: 500 * time.Millisecond,
+		Filter:                  "node-*",
+		EntryFormat:             EntryFormatJSON,
+		Consistency:             ConsistencySerializable,
+	}
+	if !reflect.DeepEqual(options.Overrides, expected) {
+		t.Errorf("unexpected overrides: %+v", options.Overrides)
+	}
+
+	if options, err := parseBackendOptions(config.ExtraConfig{}); err != nil || !reflect.DeepEqual(options, BackendOptions{}) {
+		t.Errorf("unexpected options: %+v, %v", options, err)
+	}
+}
+
+func TestBackendOptions_scope(t *testing.T) {
+	base := &clientv3{
+		ctx:     context.Background(),
+		timeout: 3 * time.Second,
+		options: ClientOptions{
+			DialTimeout:             3 * time.Second,
+			HeaderTimeoutPerRequest: 3 * time.Second,
+			HostSource:              HostSourceKeySuffix,
+		},
+	}
+
+	if c := (BackendOptions{}).scope(base); c != base {
+		t.Error("the client should not be replaced when there are no overrides")
+	}
+
+	c, ok := BackendOptions{
+		Overrides: ClientOptions{
+			DialTimeout:             time.Second,
+			HeaderTimeoutPerRequest: time.Second,
+			Consistency:             ConsistencySerializable,
+		},
+	}.scope(base).(*clientv3)
+	if !ok {
+		t.Fatal("unexpected client type")
+	}
+	if c == base {
+		t.Fatal("the client should be replaced when there are overrides")
+	}
+	if c.timeout != time.Second {
+		t.Errorf("unexpected timeout: %v", c.timeout)
+	}
+	expected := ClientOptions{
+		DialTimeout:             3 * time.Second,
+		HeaderTimeoutPerRequest: time.Second,
+		HostSource:              HostSourceKeySuffix,
+		Consistency:             ConsistencySerializable,
+	}
+	if !reflect.DeepEqual(c.options, expected) {
+		t.Errorf("unexpected options: %+v", c.options)
+	}
+	if base.timeout != 3*time.Second || base.options.Consistency != "" {
+		t.Error("the original client has been modified")
+	}
+
+	d := dummyClient{}
+	if _, ok := (BackendOptions{Overrides: ClientOptions{Filter: "*"}}).scope(d).(dummyClient); !ok {
+		t.Error("the client should not be replaced when it does not support overrides")
+	}
+}
+
+func TestBackendOptions_prefix(t *testing.T) {
+	for _, tc := range []struct {
+		host     string
+		options  BackendOptions
+		expected string
+		err      error
+	}{
+		{host: "/services/api", expected: "/services/api"},
+		{host: "//services///api/", expected: "/services/api/"},
+		{host: "/services/api", options: BackendOptions{TrailingSlash: true}, expected: "/services/api/"},
+		{host: "/services/api/", options: BackendOptions{TrailingSlash: true}, expected: "/services/api/"},
+		{host: "services/api", err: ErrBadPrefix},
+		{host: "http://10.0.0.1:8080", err: ErrBadPrefix},
+	} {
+		prefix, err := tc.options.prefix(nil, tc.host)
+		if prefix != tc.expected || err != tc.err {
+			t.Errorf("unexpected prefix for %s: %s %v", tc.host, prefix, err)
+		}
+	}
+
+	if _, err := NewBackendSubscriber(context.Background(), dummyClient{}, &config.Backend{Host: []string{"services/api"}}); err != ErrBadPrefix {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
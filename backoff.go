@@ -0,0 +1,188 @@
+package etcd
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBackoffBase is the default delay before the first retry
+	DefaultBackoffBase = time.Second
+	// DefaultBackoffMax is the default maximum delay between retries
+	DefaultBackoffMax = 30 * time.Second
+	// DefaultBackoffFactor is the default growth of the delays of the exponential backoff
+	DefaultBackoffFactor = 2.0
+
+	// BackoffExponential multiplies the delay by the factor after every failed attempt. This is the default.
+	BackoffExponential = "exponential"
+	// BackoffDecorrelatedJitter picks every delay at random between the base and three times the
+	// previous one, spreading the retries of the gateways failing at once
+	BackoffDecorrelatedJitter = "decorrelated_jitter"
+	// BackoffConstant waits the base delay before every retry
+	BackoffConstant = "constant"
+)
+
+// Backoff computes the delays between the consecutive attempts of a failing operation, like the
+// reconnections of the watches and the retries of the failed reads of the subscribers
+type Backoff interface {
+	// Delay returns the delay before the retry number attempt (1 for the first one), given the
+	// previous delay (zero before the first retry)
+	Delay(attempt int, previous time.Duration) time.Duration
+}
+
+// jitteredBackoff is implemented by the built-in backoffs spreading their delays with the jitter, so the
+// clients with their own jitter apply it instead of the one set with SetJitter
+type jitteredBackoff interface {
+	delay(attempt int, previous time.Duration, jitter func(time.Duration) time.Duration) time.Duration
+}
+
+// ExponentialBackoff multiplies the base delay by the factor after every failed attempt, up to the max.
+// The delays are spread with the jitter set with SetJitter.
+type ExponentialBackoff struct {
+	Base   time.Duration
+	Max    time.Duration
+	Factor float64
+}
+
+// Delay implements the Backoff interface
+func (b ExponentialBackoff) Delay(attempt int, previous time.Duration) time.Duration {
+	return b.delay(attempt, previous, Jitter)
+}
+
+func (b ExponentialBackoff) delay(attempt int, _ time.Duration, jitter func(time.Duration) time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := float64(b.Base) * math.Pow(b.Factor, float64(attempt-1))
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	return jitter(time.Duration(d))
+}
+
+// DecorrelatedJitterBackoff picks every delay at random between the base and three times the previous
+// one, up to the max
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay implements the Backoff interface
+func (b DecorrelatedJitterBackoff) Delay(_ int, previous time.Duration) time.Duration {
+	if previous < b.Base {
+		previous = b.Base
+	}
+	d := b.Base + time.Duration(rand.Float64()*float64(3*previous-b.Base))
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// ConstantBackoff waits the same period before every retry, spread with the jitter set with SetJitter
+type ConstantBackoff struct {
+	Period time.Duration
+}
+
+// Delay implements the Backoff interface
+func (b ConstantBackoff) Delay(attempt int, previous time.Duration) time.Duration {
+	return b.delay(attempt, previous, Jitter)
+}
+
+func (b ConstantBackoff) delay(_ int, _ time.Duration, jitter func(time.Duration) time.Duration) time.Duration {
+	return jitter(b.Period)
+}
+
+var (
+	backoff      Backoff = defaultBackoff()
+	backoffMutex         = &sync.RWMutex{}
+)
+
+func defaultBackoff() Backoff {
+	return ExponentialBackoff{Base: DefaultBackoffBase, Max: DefaultBackoffMax, Factor: DefaultBackoffFactor}
+}
+
+// SetBackoff sets the strategy computing the delays of the reconnections of the watches and of the
+// retries of the failed reads. A nil one restores the default: an exponential backoff from
+// DefaultBackoffBase to DefaultBackoffMax. The clients created by New with a backoff config use their own.
+func SetBackoff(b Backoff) {
+	if b == nil {
+		b = defaultBackoff()
+	}
+	backoffMutex.Lock()
+	backoff = b
+	backoffMutex.Unlock()
+}
+
+// GetBackoff returns the backoff strategy used by the etcd integration
+func GetBackoff() Backoff {
+	backoffMutex.RLock()
+	defer backoffMutex.RUnlock()
+	return backoff
+}
+
+// parseBackoff parses the backoff config:
+// {"strategy": "decorrelated_jitter", "base": "500ms", "max": "1m", "factor": 2}
+func parseBackoff(v interface{}) (Backoff, error) {
+	path := Namespace + ".backoff"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, badConfig(path)
+	}
+	base, max, factor := DefaultBackoffBase, DefaultBackoffMax, DefaultBackoffFactor
+	if o, ok := cfg["base"]; ok {
+		d, err := parseDuration(o)
+		if err != nil || d <= 0 {
+			return nil, badConfig(path + ".base")
+		}
+		base = d
+	}
+	if o, ok := cfg["max"]; ok {
+		d, err := parseDuration(o)
+		if err != nil || d < base {
+			return nil, badConfig(path + ".max")
+		}
+		max = d
+	}
+	if o, ok := cfg["factor"]; ok {
+		f, ok := o.(float64)
+		if !ok || f < 1 {
+			return nil, badConfig(path + ".factor")
+		}
+		factor = f
+	}
+
+	strategy, _ := cfg["strategy"].(string)
+	switch strategy {
+	case "", BackoffExponential:
+		return ExponentialBackoff{Base: base, Max: max, Factor: factor}, nil
+	case BackoffDecorrelatedJitter:
+		return DecorrelatedJitterBackoff{Base: base, Max: max}, nil
+	case BackoffConstant:
+		return ConstantBackoff{Period: base}, nil
+	}
+	return nil, badConfig(path + ".strategy")
+}
+
+// retrier tracks the consecutive failures of an operation, returning the delays of its retries with the
+// backoff and the jitter of the settings
+type retrier struct {
+	settings *clientSettings
+	attempt  int
+	previous time.Duration
+}
+
+// next returns the delay before the next retry
+func (r *retrier) next() time.Duration {
+	r.attempt++
+	r.previous = r.settings.delay(r.attempt, r.previous)
+	return r.previous
+}
+
+// reset restarts the backoff once the operation succeeds
+func (r *retrier) reset() {
+	r.attempt = 0
+	r.previous = 0
+}
@@ -0,0 +1,133 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+
+	b := ExponentialBackoff{Base: time.Second, Max: 10 * time.Second, Factor: 2}
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if d := b.Delay(i+1, 0); d != expected {
+			t.Errorf("unexpected delay of the attempt %d: %s", i+1, d)
+		}
+	}
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	b := DecorrelatedJitterBackoff{Base: time.Second, Max: 20 * time.Second}
+	var previous time.Duration
+	for i := 1; i < 100; i++ {
+		d := b.Delay(i, previous)
+		max := 3 * previous
+		if max < 3*time.Second {
+			max = 3 * time.Second
+		}
+		if max > b.Max {
+			max = b.Max
+		}
+		if d < b.Base || d > max {
+			t.Errorf("unexpected delay of the attempt %d: %s (previous %s)", i, d, previous)
+		}
+		previous = d
+	}
+}
+
+func TestParseBackoff(t *testing.T) {
+	for i, tc := range []struct {
+		cfg      interface{}
+		expected Backoff
+		path     string
+	}{
+		{cfg: map[string]interface{}{}, expected: defaultBackoff()},
+		{
+			cfg:      map[string]interface{}{"strategy": "exponential", "base": "100ms", "max": "5s", "factor": 3.0},
+			expected: ExponentialBackoff{Base: 100 * time.Millisecond, Max: 5 * time.Second, Factor: 3},
+		},
+		{
+			cfg:      map[string]interface{}{"strategy": "decorrelated_jitter", "base": "500ms", "max": "1m"},
+			expected: DecorrelatedJitterBackoff{Base: 500 * time.Millisecond, Max: time.Minute},
+		},
+		{cfg: map[string]interface{}{"strategy": "constant", "base": "2s"}, expected: ConstantBackoff{Period: 2 * time.Second}},
+		{cfg: "exponential", path: Namespace + ".backoff"},
+		{cfg: map[string]interface{}{"strategy": "linear"}, path: Namespace + ".backoff.strategy"},
+		{cfg: map[string]interface{}{"base": "0s"}, path: Namespace + ".backoff.base"},
+		{cfg: map[string]interface{}{"base": "10s", "max": "1s"}, path: Namespace + ".backoff.max"},
+		{cfg: map[string]interface{}{"factor": 0.5}, path: Namespace + ".backoff.factor"},
+	} {
+		b, err := parseBackoff(tc.cfg)
+		if tc.path != "" {
+			if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+				t.Errorf("unexpected error parsing the config %d: %v", i, err)
+			}
+			continue
+		}
+		if err != nil || b != tc.expected {
+			t.Errorf("unexpected backoff parsing the config %d: %+v %v", i, b, err)
+		}
+	}
+}
+
+func TestSubscriber_backoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+	SetBackoff(ConstantBackoff{Period: 10 * time.Millisecond})
+	defer SetBackoff(nil)
+
+	mutex := &sync.Mutex{}
+	watches, reads := 0, 0
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			reads++
+			if reads == 2 {
+				return nil, errors.New("unavailable")
+			}
+			return []string{"http://10.0.0.1"}, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			mutex.Lock()
+			watches++
+			first := watches == 1
+			mutex.Unlock()
+			ch <- struct{}{}
+			if first {
+				// the first watch stops right away
+				return
+			}
+			<-ctx.Done()
+		},
+	}
+	before := Metrics()
+	s, err := NewSubscriber(ctx, c, "/services/backoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	if watches != 2 || reads != 4 {
+		t.Errorf("unexpected calls: %d watches, %d reads", watches, reads)
+	}
+	mutex.Unlock()
+	if _, meta, err := s.HostsWithMeta(); meta.Stale || err != nil {
+		t.Errorf("unexpected meta: %+v %v", meta, err)
+	}
+	metrics := Metrics()
+	if v := metrics[MetricWatchReconnects] - before[MetricWatchReconnects]; v != 1 {
+		t.Errorf("unexpected reconnects: %d", v)
+	}
+	if v := metrics[MetricReadRetries] - before[MetricReadRetries]; v != 1 {
+		t.Errorf("unexpected retries: %d", v)
+	}
+}
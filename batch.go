@@ -0,0 +1,225 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// maxTxnOps is the default limit of operations in a transaction of the etcd servers (--max-txn-ops)
+const maxTxnOps = 128
+
+// BatchRegistrar is implemented by the registrars able to store several entries with a single write
+type BatchRegistrar interface {
+	Registrar
+	// RegisterAll stores all the entries, with as few writes as possible. If the ttl is not zero, all of
+	// them are attached to the same lease, so they expire together.
+	RegisterAll(entries map[string]string, ttl time.Duration) error
+}
+
+// BatchClient is implemented by the clients able to read several prefixes at once
+type BatchClient interface {
+	Client
+	// GetEntriesBatch returns the entries of every prefix, read concurrently with a deadline shared by
+	// all of them. The prefixes failing are not in the returned map and the first of their errors, in
+	// the order of the prefixes, is returned.
+	GetEntriesBatch(prefixes []string) (map[string][]string, error)
+}
+
+// batchReader is implemented by the clients reading the prefixes of a batch concurrently, returning the
+// error of every failed prefix
+type batchReader interface {
+	readBatch(prefixes []string) (map[string][]string, map[string]error)
+}
+
+// GetEntriesBatch reads all the prefixes with a single call if the client is a BatchClient, or one by one
+// otherwise. The BatchClient reads run concurrently under a deadline shared by all the prefixes, so the
+// tools resolving many prefixes (e.g. the startup checks) are bounded by a single request timeout. The
+// errors are reported like the BatchClient ones.
+func GetEntriesBatch(c Client, prefixes []string) (map[string][]string, error) {
+	if bc, ok := c.(BatchClient); ok {
+		return bc.GetEntriesBatch(prefixes)
+	}
+	entries, errs := readBatch(c, prefixes)
+	return entries, firstBatchError(prefixes, errs)
+}
+
+// readBatch reads all the prefixes like GetEntriesBatch, returning the error of every failed prefix
+func readBatch(c Client, prefixes []string) (map[string][]string, map[string]error) {
+	if br, ok := c.(batchReader); ok {
+		return br.readBatch(prefixes)
+	}
+	entries := make(map[string][]string, len(prefixes))
+	errs := map[string]error{}
+	for _, prefix := range prefixes {
+		e, err := c.GetEntries(prefix)
+		if err != nil {
+			errs[prefix] = err
+			continue
+		}
+		entries[prefix] = e
+	}
+	return entries, errs
+}
+
+// firstBatchError returns the error of the first failed prefix, in the order of the prefixes
+func firstBatchError(prefixes []string, errs map[string]error) error {
+	for _, prefix := range prefixes {
+		if err, ok := errs[prefix]; ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEntriesBatch implements the etcd BatchClient interface. The deadline is the request timeout.
+func (c *client) GetEntriesBatch(prefixes []string) (map[string][]string, error) {
+	entries, errs := c.readBatch(prefixes)
+	return entries, firstBatchError(prefixes, errs)
+}
+
+func (c *client) readBatch(prefixes []string) (map[string][]string, map[string]error) {
+	return readConcurrently(c, prefixes, c.options.HeaderTimeoutPerRequest)
+}
+
+// GetEntriesBatch implements the etcd BatchClient interface. The deadline is the request timeout.
+func (c *clientv3) GetEntriesBatch(prefixes []string) (map[string][]string, error) {
+	entries, errs := c.readBatch(prefixes)
+	return entries, firstBatchError(prefixes, errs)
+}
+
+func (c *clientv3) readBatch(prefixes []string) (map[string][]string, map[string]error) {
+	return readConcurrently(c, prefixes, c.timeout)
+}
+
+// batchRead is the result of the read of a prefix of a batch
+type batchRead struct {
+	prefix  string
+	entries []string
+	err     error
+}
+
+// readConcurrently reads the prefixes concurrently, failing the ones not read before the timeout with
+// context.DeadlineExceeded. The reads still obey the MaxConcurrentGets of the client.
+func readConcurrently(c Client, prefixes []string, timeout time.Duration) (map[string][]string, map[string]error) {
+	pending := map[string]struct{}{}
+	results := make(chan batchRead, len(prefixes))
+	for _, prefix := range prefixes {
+		if _, ok := pending[prefix]; ok {
+			continue
+		}
+		pending[prefix] = struct{}{}
+		go func(prefix string) {
+			entries, err := c.GetEntries(prefix)
+			results <- batchRead{prefix: prefix, entries: entries, err: err}
+		}(prefix)
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		deadline = GetClock().After(timeout)
+	}
+	entries := make(map[string][]string, len(pending))
+	errs := make(map[string]error, len(pending))
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			delete(pending, r.prefix)
+			if r.err != nil {
+				errs[r.prefix] = r.err
+				continue
+			}
+			entries[r.prefix] = r.entries
+		case <-deadline:
+			for prefix := range pending {
+				errs[prefix] = context.DeadlineExceeded
+			}
+			pending = nil
+		}
+	}
+	return entries, errs
+}
+
+// RegisterAll stores the entries with a single write if the registrar is a BatchRegistrar, or one by one
+// otherwise. In that case, all the entries are tried and the first error is returned.
+func RegisterAll(r Registrar, entries map[string]string, ttl time.Duration) error {
+	if br, ok := r.(BatchRegistrar); ok {
+		return br.RegisterAll(entries, ttl)
+	}
+	var firstErr error
+	for _, key := range sortedKeys(entries) {
+		if err := r.Register(key, entries[key], ttl); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// RegisterAll implements the etcd BatchRegistrar interface, with a single lease and transactions of up to
+// maxTxnOps puts, so the large batches are not rejected by the servers. The batches fitting in a single
+// transaction are stored atomically; a failed transaction stops the writes of the following ones.
+func (c *clientv3) RegisterAll(entries map[string]string, ttl time.Duration) error {
+	if c.client == nil {
+		return ErrNilClient
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+
+	opts, _, err := c.leaseOptions(ctx, ttl)
+	if err != nil {
+		return countError(err)
+	}
+	return c.putAll(ctx, entries, opts...)
+}
+
+// putAll stores the entries with the received options, in transactions of up to maxTxnOps puts
+func (c *clientv3) putAll(ctx context.Context, entries map[string]string, opts ...etcdv3.OpOption) error {
+	keys := sortedKeys(entries)
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxTxnOps {
+			n = maxTxnOps
+		}
+		ops := make([]etcdv3.Op, 0, n)
+		for _, key := range keys[:n] {
+			ops = append(ops, etcdv3.OpPut(key, entries[key], opts...))
+		}
+		if _, err := c.client.Txn(ctx).Then(ops...).Commit(); err != nil {
+			return countError(err)
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// leaseOptions returns the put options attaching the entries to a new lease with the received ttl, if any,
+// along with the id of the lease
+func (c *clientv3) leaseOptions(ctx context.Context, ttl time.Duration) ([]etcdv3.OpOption, etcdv3.LeaseID, error) {
+	if ttl <= 0 {
+		return nil, etcdv3.NoLease, nil
+	}
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := c.client.Grant(ctx, seconds)
+	if err != nil {
+		return nil, etcdv3.NoLease, err
+	}
+	return []etcdv3.OpOption{etcdv3.WithLease(lease.ID)}, lease.ID, nil
+}
+
+func sortedKeys(entries map[string]string) []string {
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+type fakeTxnKV struct {
+	etcdv3.KV
+	commits *int
+	ops     *int
+	failed  bool
+}
+
+func (f fakeTxnKV) Txn(context.Context) etcdv3.Txn { return fakeTxn(f) }
+
+type fakeTxn fakeTxnKV
+
+func (f fakeTxn) If(...etcdv3.Cmp) etcdv3.Txn  { return f }
+func (f fakeTxn) Else(...etcdv3.Op) etcdv3.Txn { return f }
+func (f fakeTxn) Then(ops ...etcdv3.Op) etcdv3.Txn {
+	*f.ops += len(ops)
+	return f
+}
+func (f fakeTxn) Commit() (*etcdv3.TxnResponse, error) {
+	*f.commits++
+	return &etcdv3.TxnResponse{Succeeded: !f.failed}, nil
+}
+
+type fakeLease struct {
+	etcdv3.Lease
+	grants    *int
+	revokes   *int
+	keepAlive chan *etcdv3.LeaseKeepAliveResponse
+}
+
+func (f fakeLease) KeepAlive(context.Context, etcdv3.LeaseID) (<-chan *etcdv3.LeaseKeepAliveResponse, error) {
+	return f.keepAlive, nil
+}
+
+func (f fakeLease) Revoke(context.Context, etcdv3.LeaseID) (*etcdv3.LeaseRevokeResponse, error) {
+	*f.revokes++
+	return &etcdv3.LeaseRevokeResponse{}, nil
+}
+
+func (f fakeLease) Grant(_ context.Context, ttl int64) (*etcdv3.LeaseGrantResponse, error) {
+	*f.grants++
+	return &etcdv3.LeaseGrantResponse{ID: 42, TTL: ttl}, nil
+}
+
+func TestClientV3_RegisterAll(t *testing.T) {
+	commits, ops, grants := 0, 0, 0
+	c := &clientv3{
+		client: &etcdv3.Client{
+			KV:    fakeTxnKV{commits: &commits, ops: &ops},
+			Lease: fakeLease{grants: &grants},
+		},
+		ctx:     context.Background(),
+		timeout: time.Second,
+	}
+
+	entries := map[string]string{
+		"/services/api/http":  "http://10.0.0.1:8080",
+		"/services/api/https": "https://10.0.0.1:8443",
+		"/services/debug/1":   "http://10.0.0.1:8090",
+	}
+	if err := RegisterAll(c, entries, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if commits != 1 || ops != 3 || grants != 1 {
+		t.Errorf("unexpected writes: %d commits, %d ops, %d leases", commits, ops, grants)
+	}
+
+	if err := c.RegisterAll(map[string]string{}, time.Second); err != nil || commits != 1 {
+		t.Errorf("unexpected result for an empty batch: %v, %d commits", err, commits)
+	}
+	// the large batches are split in several transactions sharing the lease
+	commits, ops, grants = 0, 0, 0
+	entries = map[string]string{}
+	for i := 0; i < 2*maxTxnOps+1; i++ {
+		entries[fmt.Sprintf("/services/api/%d", i)] = fmt.Sprintf("http://10.0.0.%d", i)
+	}
+	if err := c.RegisterAll(entries, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if commits != 3 || ops != 2*maxTxnOps+1 || grants != 1 {
+		t.Errorf("unexpected writes: %d commits, %d ops, %d leases", commits, ops, grants)
+	}
+}
+
+func TestRegisterAll_fallback(t *testing.T) {
+	r := dummyRegistrar{}
+	entries := map[string]string{"/services/api/1": "http://10.0.0.1", "/services/api/2": "http://10.0.0.2"}
+	if err := RegisterAll(r, entries, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]string(r), entries) {
+		t.Errorf("unexpected entries: %v", r)
+	}
+}
+
+func TestClientV3_GetEntriesBatch(t *testing.T) {
+	c := &clientv3{
+		client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{
+			Header: &etcdv3.ResponseHeader{Revision: 50},
+			Kvs:    []*mvccpb.KeyValue{{Key: []byte("/services/a/1"), Value: []byte("http://10.0.0.1")}},
+			Count:  1,
+		}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+	}
+	entries, err := GetEntriesBatch(c, []string{"/services/a/", "/services/b/", "/services/a/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"/services/a/": {"http://10.0.0.1"}, "/services/b/": {"http://10.0.0.1"}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
+
+func TestGetEntriesBatch_deadline(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	block := make(chan struct{})
+	defer close(block)
+	c := dummyClient{getEntries: func(prefix string) ([]string, error) {
+		switch prefix {
+		case "/services/slow/":
+			<-block
+		case "/services/broken/":
+			return nil, unavailable
+		}
+		return []string{"http://10.0.0.1"}, nil
+	}}
+
+	prefixes := []string{"/services/api/", "/services/slow/", "/services/broken/"}
+	entries, errs := readConcurrently(c, prefixes, 50*time.Millisecond)
+	if err := firstBatchError(prefixes, errs); err != context.DeadlineExceeded {
+		t.Errorf("the first failed prefix should time out: %v", err)
+	}
+	if !reflect.DeepEqual(errs, map[string]error{"/services/slow/": context.DeadlineExceeded, "/services/broken/": unavailable}) {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if !reflect.DeepEqual(entries, map[string][]string{"/services/api/": {"http://10.0.0.1"}}) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	entries, err := GetEntriesBatch(c, []string{"/services/api/", "/services/broken/"})
+	if err != unavailable || len(entries) != 1 {
+		t.Errorf("unexpected result of the sequential reads: %v %v", entries, err)
+	}
+}
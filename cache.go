@@ -0,0 +1,216 @@
+package etcd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is the default period the hosts stored in the shared cache are valid
+const DefaultCacheTTL = 30 * time.Second
+
+// cacheKeyPrefix is prepended to the hashed keys of the shared cache
+const cacheKeyPrefix = "krakend-etcd:"
+
+// ErrCacheMiss is returned by the caches when the key is not stored or has expired
+var ErrCacheMiss = errors.New("etcd: cache miss")
+
+// Cache is a store of the discovery cache shared by several gateways. The subscribers store the hosts
+// of every read and the new ones start with the stored hosts, when available, instead of reading them
+// from etcd, so a fleet of gateways scaling out does not read all its prefixes at once. The keys are
+// hashed, so they are safe for any backend.
+type Cache interface {
+	// Get returns the value stored under the key, or ErrCacheMiss
+	Get(key string) ([]byte, error)
+	// Set stores the value under the key for the ttl
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+// CacheFactory creates a Cache from its config
+type CacheFactory func(cfg map[string]interface{}) (Cache, error)
+
+const (
+	// CacheMemory is the type of the caches storing the hosts in memory. See MemoryCache.
+	CacheMemory = "memory"
+	// CacheRedis is the type of the caches storing the hosts in a Redis server. See RedisCache.
+	CacheRedis = "redis"
+	// CacheMemcached is the type of the caches storing the hosts in a memcached server. See MemcachedCache.
+	CacheMemcached = "memcached"
+)
+
+var (
+	cacheFactories = map[string]CacheFactory{
+		CacheMemory:    func(map[string]interface{}) (Cache, error) { return NewMemoryCache(), nil },
+		CacheRedis:     newRedisCache,
+		CacheMemcached: newMemcachedCache,
+	}
+	cacheFactoriesMutex = &sync.RWMutex{}
+
+	sharedCache      Cache
+	sharedCacheTTL   = DefaultCacheTTL
+	sharedCacheMutex = &sync.RWMutex{}
+)
+
+// RegisterCacheFactory registers a factory for the caches of the given type, so they can be declared in
+// the config. Registering an existing type replaces it.
+func RegisterCacheFactory(name string, f CacheFactory) {
+	cacheFactoriesMutex.Lock()
+	cacheFactories[name] = f
+	cacheFactoriesMutex.Unlock()
+}
+
+func getCacheFactory(name string) (CacheFactory, bool) {
+	cacheFactoriesMutex.RLock()
+	f, ok := cacheFactories[name]
+	cacheFactoriesMutex.RUnlock()
+	return f, ok
+}
+
+// SetCache sets the cache shared by the subscribers, storing the hosts for the ttl (DefaultCacheTTL if it
+// is not positive). A nil cache disables it, which is the default. The clients created by New with a cache
+// config use their own.
+func SetCache(c Cache, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	sharedCacheMutex.Lock()
+	sharedCache = c
+	sharedCacheTTL = ttl
+	sharedCacheMutex.Unlock()
+}
+
+func getCache() (Cache, time.Duration) {
+	sharedCacheMutex.RLock()
+	defer sharedCacheMutex.RUnlock()
+	return sharedCache, sharedCacheTTL
+}
+
+// parseCache parses the cache config: {"type": "redis", "ttl": "30s", ...}
+func parseCache(v interface{}) (Cache, time.Duration, error) {
+	path := Namespace + ".cache"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, 0, badConfig(path)
+	}
+	name, _ := cfg["type"].(string)
+	f, ok := getCacheFactory(name)
+	if !ok {
+		return nil, 0, badConfig(path + ".type")
+	}
+	c, err := f(cfg)
+	if err != nil {
+		return nil, 0, withPath(path, err)
+	}
+	var ttl time.Duration
+	if o, ok := cfg["ttl"]; ok {
+		if ttl, err = parseDuration(o); err != nil {
+			return nil, 0, badConfig(path + ".ttl")
+		}
+	}
+	return c, ttl, nil
+}
+
+// cacheKey returns the key of the shared cache for the state key of a subscriber. See sharedStateKey.
+func cacheKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return cacheKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// cachedState returns the state stored in the shared cache of the settings for the state key, if any
+func cachedState(settings *clientSettings, key string) (PrefixState, bool) {
+	c, _ := settings.sharedCache()
+	if c == nil {
+		return PrefixState{}, false
+	}
+	value, err := c.Get(cacheKey(key))
+	if err != nil {
+		if err != ErrCacheMiss {
+			addMetric(MetricCacheErrors, 1)
+		}
+		addMetric(MetricCacheMisses, 1)
+		return PrefixState{}, false
+	}
+	var state PrefixState
+	if err := json.Unmarshal(value, &state); err != nil || state.Key != key {
+		addMetric(MetricCacheErrors, 1)
+		addMetric(MetricCacheMisses, 1)
+		return PrefixState{}, false
+	}
+	addMetric(MetricCacheHits, 1)
+	return state, true
+}
+
+// shareState stores the state of a subscriber in the shared cache of the settings, in the background
+func shareState(settings *clientSettings, state PrefixState) {
+	c, ttl := settings.sharedCache()
+	if c == nil {
+		return
+	}
+	value, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	go func() {
+		if err := c.Set(cacheKey(state.Key), value, ttl); err != nil {
+			addMetric(MetricCacheErrors, 1)
+		}
+	}()
+}
+
+// share stores the state of the subscriber in the shared cache, if any
+func (s *Subscriber) share() {
+	if c, _ := s.settings.sharedCache(); c == nil {
+		return
+	}
+	hosts, meta, _ := s.HostsWithMeta()
+	shareState(s.settings, PrefixState{
+		Key:         s.stateKey,
+		Prefix:      s.prefix,
+		Hosts:       hosts,
+		Revision:    meta.Revision,
+		LastRefresh: meta.LastRefresh,
+	})
+}
+
+// MemoryCache is a Cache storing the values in memory. It is only shared by the clients of the same
+// process, so it is mostly useful for testing.
+type MemoryCache struct {
+	mutex   *sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache returns an empty MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{mutex: &sync.Mutex{}, entries: map[string]memoryCacheEntry{}}
+}
+
+// Get implements the Cache interface
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	if GetClock().Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, ErrCacheMiss
+	}
+	return e.value, nil
+}
+
+// Set implements the Cache interface
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mutex.Lock()
+	c.entries[key] = memoryCacheEntry{value: value, expires: GetClock().Now().Add(ttl)}
+	c.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,180 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestMemoryCache(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	c := NewMemoryCache()
+	if _, err := c.Get("a"); err != ErrCacheMiss {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := c.Set("a", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("a"); err != nil || string(v) != "value" {
+		t.Errorf("unexpected value: %s %v", v, err)
+	}
+	clock.Advance(2 * time.Minute)
+	if _, err := c.Get("a"); err != ErrCacheMiss {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCachedSubscriber_sharedCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cache := NewMemoryCache()
+	SetCache(cache, time.Minute)
+	defer SetCache(nil, 0)
+
+	mutex := &sync.Mutex{}
+	reads := 0
+	newClient := func() Client {
+		return dummyClient{
+			getEntries: func(string) ([]string, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				reads++
+				return []string{"http://10.0.0.1"}, nil
+			},
+			watchPrefix: func(_ string, ch chan struct{}) {
+				ch <- struct{}{}
+				<-ctx.Done()
+			},
+		}
+	}
+	cfg := &config.Backend{Host: []string{"/services/cached"}}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+	hits := Metrics()[MetricCacheHits]
+	if _, err := cachedSubscriber(ctx, newClient(), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	key := sharedStateKey(newClient(), "/services/cached", BackendOptions{})
+	var state PrefixState
+	for i := 0; i < 100; i++ {
+		var ok bool
+		if state, ok = cachedState(nil, key); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if state.Prefix != "/services/cached" || len(state.Hosts) != 1 {
+		t.Fatalf("unexpected cached state: %+v", state)
+	}
+
+	// another gateway
+	subscribers = map[string]sd.Subscriber{}
+	mutex.Lock()
+	reads = 0
+	mutex.Unlock()
+	s, err := cachedSubscriber(ctx, newClient(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, _ := s.Hosts()
+	if !reflect.DeepEqual(hosts, []string{"http://10.0.0.1"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+	mutex.Lock()
+	if reads != 0 {
+		t.Errorf("unexpected reads: %d", reads)
+	}
+	mutex.Unlock()
+	if v := Metrics()[MetricCacheHits] - hits; v < 2 {
+		t.Errorf("unexpected cache hits: %d", v)
+	}
+}
+
+func TestSharedStateKey(t *testing.T) {
+	schema := func(raw string) *Schema {
+		s, err := CompileSchema([]byte(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	prod := &clientv3{options: ClientOptions{EntryFormat: "json"}}
+	options := BackendOptions{Overrides: ClientOptions{EntrySchema: schema(`{"type": "object", "required": ["host"]}`)}}
+
+	// the schemas are identified by their content, not by their address
+	key := sharedStateKey(prod, "/services/api/", options)
+	same := BackendOptions{Overrides: ClientOptions{EntrySchema: schema(`{"required":["host"],"type":"object"}`)}}
+	if sharedStateKey(prod, "/services/api/", same) != key {
+		t.Errorf("the same schema should get the same key: %s", key)
+	}
+	if options.key("/services/api/") != same.key("/services/api/") {
+		t.Error("the same schema should get the same subscriber key")
+	}
+
+	for _, other := range []string{
+		sharedStateKey(&clientv3{options: ClientOptions{EntryFormat: "raw"}}, "/services/api/", options),
+		sharedStateKey(prod, "/services/api/", BackendOptions{}),
+		sharedStateKey(prod, "/services/api/", BackendOptions{DefaultPort: "8080", Overrides: options.Overrides}),
+		sharedStateKey(prod, "/services/web/", options),
+		sharedStateKey(&client{machines: []string{"http://etcd.staging:2379"}, options: prod.options}, "/services/api/", options),
+	} {
+		if other == key {
+			t.Errorf("unexpected key collision: %s", key)
+		}
+	}
+
+	// the endpoints identify the cluster, whatever their order
+	a := &client{machines: []string{"http://etcd-1:2379", "http://etcd-2:2379"}}
+	b := &client{machines: []string{"http://etcd-2:2379", "http://etcd-1:2379"}}
+	if sharedStateKey(a, "/services/api/", BackendOptions{}) != sharedStateKey(b, "/services/api/", BackendOptions{}) {
+		t.Error("the order of the endpoints should not change the key")
+	}
+}
+
+func TestNew_cache(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "redis", path: Namespace + ".cache"},
+		{cfg: map[string]interface{}{"type": "couchbase"}, path: Namespace + ".cache.type"},
+		{cfg: map[string]interface{}{"type": "redis"}, path: Namespace + ".cache.address"},
+		{cfg: map[string]interface{}{"type": "memory", "ttl": 30}, path: Namespace + ".cache.ttl"},
+	} {
+		_, err := New(context.Background(), map[string]interface{}{
+			Namespace: map[string]interface{}{"machines": []interface{}{"http://127.0.0.1:2379"}, "cache": tc.cfg},
+		})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+
+	client, err := New(context.Background(), map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"machines": []interface{}{"http://127.0.0.1:2379"},
+			"cache":    map[string]interface{}{"type": "memcached", "address": "127.0.0.1:11211", "ttl": "1m"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, ttl := settingsOf(client).sharedCache(); ttl != time.Minute {
+		t.Errorf("unexpected cache: %T %v", c, ttl)
+	} else if _, ok := c.(*MemcachedCache); !ok {
+		t.Errorf("unexpected cache: %T", c)
+	}
+	if c, _ := getCache(); c != nil {
+		t.Errorf("the cache of the client should not be shared by the process: %T", c)
+	}
+}
@@ -0,0 +1,142 @@
+package etcd
+
+import (
+	"context"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// CASRegistrar is a Registrar able to write conditionally, so the tools sharing a key space (registrars,
+// config writers...) do not overwrite the entries of the concurrent writers. The v2 clients implement it
+// with the conditional writes of the keys API and the v3 clients with transactions.
+type CASRegistrar interface {
+	Registrar
+	// PutIfAbsent stores the value under the key only if it does not exist. It returns false if the key
+	// was already there. If the ttl is not zero, the entry will be removed by etcd once it expires.
+	PutIfAbsent(key, value string, ttl time.Duration) (bool, error)
+	// CompareAndDelete removes the key only if it holds the expected value. It returns false if the key
+	// was missing or it held another value.
+	CompareAndDelete(key, expected string) (bool, error)
+}
+
+// SwapRegistrar is a CASRegistrar also able to replace a value only if the key still holds the expected
+// one, like the leaders renewing their leadership. The v2 and v3 clients implement it.
+type SwapRegistrar interface {
+	CASRegistrar
+	// CompareAndSwap stores the value under the key only if it holds the expected value. It returns false
+	// if the key was missing or it held another value. If the ttl is not zero, the entry will be removed
+	// by etcd once it expires.
+	CompareAndSwap(key, expected, value string, ttl time.Duration) (bool, error)
+}
+
+// PutIfAbsent implements the etcd CASRegistrar interface. The lease granted for a rejected entry is
+// revoked right away.
+func (c *clientv3) PutIfAbsent(key, value string, ttl time.Duration) (bool, error) {
+	if c.client == nil {
+		return false, ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+
+	opts, lease, err := c.leaseOptions(ctx, ttl)
+	if err != nil {
+		return false, countError(err)
+	}
+	ok, err := c.putIf(ctx, etcdv3.Compare(etcdv3.CreateRevision(key), "=", 0), key, value, opts...)
+	if !ok && lease != etcdv3.NoLease {
+		c.client.Revoke(ctx, lease)
+	}
+	return ok, err
+}
+
+// CompareAndDelete implements the etcd CASRegistrar interface.
+func (c *clientv3) CompareAndDelete(key, expected string) (bool, error) {
+	if c.client == nil {
+		return false, ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+
+	resp, err := c.client.Txn(ctx).
+		If(etcdv3.Compare(etcdv3.Value(key), "=", expected)).
+		Then(etcdv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, countError(err)
+	}
+	return resp.Succeeded, nil
+}
+
+// CompareAndSwap implements the etcd SwapRegistrar interface. The lease granted for a rejected entry is
+// revoked right away.
+func (c *clientv3) CompareAndSwap(key, expected, value string, ttl time.Duration) (bool, error) {
+	if c.client == nil {
+		return false, ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+
+	opts, lease, err := c.leaseOptions(ctx, ttl)
+	if err != nil {
+		return false, countError(err)
+	}
+	ok, err := c.putIf(ctx, etcdv3.Compare(etcdv3.Value(key), "=", expected), key, value, opts...)
+	if !ok && lease != etcdv3.NoLease {
+		c.client.Revoke(ctx, lease)
+	}
+	return ok, err
+}
+
+// putIf stores the entry with the received options only if the comparison holds
+func (c *clientv3) putIf(ctx context.Context, cmp etcdv3.Cmp, key, value string, opts ...etcdv3.OpOption) (bool, error) {
+	resp, err := c.client.Txn(ctx).If(cmp).Then(etcdv3.OpPut(key, value, opts...)).Commit()
+	if err != nil {
+		return false, countError(err)
+	}
+	return resp.Succeeded, nil
+}
+
+// PutIfAbsent implements the etcd CASRegistrar interface, setting the key with prevExist=false.
+func (c *client) PutIfAbsent(key, value string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	_, err := c.keysAPI.Set(ctx, key, value, &etcd.SetOptions{TTL: ttl, PrevExist: etcd.PrevNoExist})
+	return casResult(err, etcd.ErrorCodeNodeExist)
+}
+
+// CompareAndDelete implements the etcd CASRegistrar interface, deleting the key with its prevValue.
+func (c *client) CompareAndDelete(key, expected string) (bool, error) {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	_, err := c.keysAPI.Delete(ctx, key, &etcd.DeleteOptions{PrevValue: expected})
+	return casResult(err, etcd.ErrorCodeTestFailed, etcd.ErrorCodeKeyNotFound)
+}
+
+// CompareAndSwap implements the etcd SwapRegistrar interface, setting the key with its prevValue.
+func (c *client) CompareAndSwap(key, expected, value string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	_, err := c.keysAPI.Set(ctx, key, value, &etcd.SetOptions{TTL: ttl, PrevValue: expected})
+	return casResult(err, etcd.ErrorCodeTestFailed, etcd.ErrorCodeKeyNotFound)
+}
+
+// casResult returns false, without an error, if the conditional write failed with one of the codes of a
+// failed condition
+func casResult(err error, codes ...int) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if e, ok := err.(etcd.Error); ok {
+		for _, code := range codes {
+			if e.Code == code {
+				return false, nil
+			}
+		}
+	}
+	return false, countError(err)
+}
@@ -0,0 +1,144 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+func TestClientV3_PutIfAbsent(t *testing.T) {
+	for _, tc := range []struct {
+		failed  bool
+		revokes int
+	}{
+		{failed: false, revokes: 0},
+		{failed: true, revokes: 1},
+	} {
+		commits, ops, grants, revokes := 0, 0, 0, 0
+		var c CASRegistrar = &clientv3{
+			client: &etcdv3.Client{
+				KV:    fakeTxnKV{commits: &commits, ops: &ops, failed: tc.failed},
+				Lease: fakeLease{grants: &grants, revokes: &revokes},
+			},
+			ctx:     context.Background(),
+			timeout: time.Second,
+		}
+
+		ok, err := c.PutIfAbsent("/services/api/1", "http://10.0.0.1", 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == tc.failed {
+			t.Errorf("unexpected result: %v", ok)
+		}
+		if commits != 1 || grants != 1 || revokes != tc.revokes {
+			t.Errorf("unexpected writes: %d commits, %d leases, %d revokes", commits, grants, revokes)
+		}
+	}
+}
+
+func TestClientV3_CompareAndDelete(t *testing.T) {
+	for _, failed := range []bool{false, true} {
+		commits, ops := 0, 0
+		c := &clientv3{
+			client:  &etcdv3.Client{KV: fakeTxnKV{commits: &commits, ops: &ops, failed: failed}},
+			ctx:     context.Background(),
+			timeout: time.Second,
+		}
+
+		ok, err := c.CompareAndDelete("/services/api/1", "http://10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == failed || commits != 1 || ops != 1 {
+			t.Errorf("unexpected result: %v, %d commits, %d ops", ok, commits, ops)
+		}
+	}
+
+	if _, err := (&clientv3{}).CompareAndDelete("/services/api/1", ""); err != ErrNilClient {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClientV3_CompareAndSwap(t *testing.T) {
+	for _, tc := range []struct {
+		failed  bool
+		revokes int
+	}{
+		{failed: false, revokes: 0},
+		{failed: true, revokes: 1},
+	} {
+		commits, ops, grants, revokes := 0, 0, 0, 0
+		var c SwapRegistrar = &clientv3{
+			client: &etcdv3.Client{
+				KV:    fakeTxnKV{commits: &commits, ops: &ops, failed: tc.failed},
+				Lease: fakeLease{grants: &grants, revokes: &revokes},
+			},
+			ctx:     context.Background(),
+			timeout: time.Second,
+		}
+
+		ok, err := c.CompareAndSwap("/gateways/leader", "gw-1", "gw-1", 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok == tc.failed || ops != 1 {
+			t.Errorf("unexpected result: %v, %d ops", ok, ops)
+		}
+		if commits != 1 || grants != 1 || revokes != tc.revokes {
+			t.Errorf("unexpected writes: %d commits, %d leases, %d revokes", commits, grants, revokes)
+		}
+	}
+}
+
+type casKeysAPI struct {
+	fakeKeysAPI
+	set *etcd.SetOptions
+	del *etcd.DeleteOptions
+	err error
+}
+
+func (a *casKeysAPI) Set(_ context.Context, _, _ string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	a.set = opts
+	return &etcd.Response{}, a.err
+}
+
+func (a *casKeysAPI) Delete(_ context.Context, _ string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	a.del = opts
+	return &etcd.Response{}, a.err
+}
+
+func TestClient_CAS(t *testing.T) {
+	keys := &casKeysAPI{}
+	c := &client{keysAPI: keys, ctx: context.Background()}
+
+	if ok, err := c.PutIfAbsent("/registry/a", "1", time.Second); !ok || err != nil || keys.set.PrevExist != etcd.PrevNoExist || keys.set.TTL != time.Second {
+		t.Errorf("unexpected result: %v %v %+v", ok, err, keys.set)
+	}
+	if ok, err := c.CompareAndSwap("/registry/a", "1", "2", 0); !ok || err != nil || keys.set.PrevValue != "1" {
+		t.Errorf("unexpected result: %v %v %+v", ok, err, keys.set)
+	}
+	if ok, err := c.CompareAndDelete("/registry/a", "2"); !ok || err != nil || keys.del.PrevValue != "2" {
+		t.Errorf("unexpected result: %v %v %+v", ok, err, keys.del)
+	}
+
+	keys.err = etcd.Error{Code: etcd.ErrorCodeNodeExist}
+	if ok, err := c.PutIfAbsent("/registry/a", "1", 0); ok || err != nil {
+		t.Errorf("unexpected result: %v %v", ok, err)
+	}
+	keys.err = etcd.Error{Code: etcd.ErrorCodeTestFailed}
+	if ok, err := c.CompareAndSwap("/registry/a", "1", "2", 0); ok || err != nil {
+		t.Errorf("unexpected result: %v %v", ok, err)
+	}
+	keys.err = etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	if ok, err := c.CompareAndDelete("/registry/a", "2"); ok || err != nil {
+		t.Errorf("unexpected result: %v %v", ok, err)
+	}
+	keys.err = etcd.Error{Code: etcd.ErrorCodeUnauthorized}
+	if ok, err := c.PutIfAbsent("/registry/a", "1", 0); ok || err == nil {
+		t.Errorf("unexpected result: %v %v", ok, err)
+	}
+}
@@ -0,0 +1,143 @@
+package etcd
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// churnWindow is the period the churn rate is computed over
+const churnWindow = time.Minute
+
+// ChurnEvent describes a prefix whose churn exceeded the threshold declared by its backend
+type ChurnEvent struct {
+	// Prefix is the watched prefix
+	Prefix string
+	// Rate is the number of hosts added or removed during the last minute
+	Rate int
+	// Threshold is the churn_threshold of the backend
+	Threshold int
+}
+
+// ChangeEvent describes a change of the hosts of a watched prefix
+type ChangeEvent struct {
+	// Prefix is the watched prefix
+	Prefix string `json:"prefix"`
+	// Added are the hosts not present in the previous list
+	Added []string `json:"added"`
+	// Removed are the hosts of the previous list not present anymore
+	Removed []string `json:"removed"`
+	// Hosts is the current list
+	Hosts []string `json:"hosts"`
+}
+
+var (
+	churnHandlers      = []func(ChurnEvent){}
+	churnHandlersMutex = &sync.RWMutex{}
+
+	changeHandlers      = []func(ChangeEvent){}
+	changeHandlersMutex = &sync.RWMutex{}
+)
+
+// RegisterChangeHandler registers a function to call every time the hosts of a watched prefix change.
+// The handlers are called synchronously by the subscribers, so they should not block.
+func RegisterChangeHandler(h func(ChangeEvent)) {
+	changeHandlersMutex.Lock()
+	changeHandlers = append(changeHandlers, h)
+	changeHandlersMutex.Unlock()
+}
+
+func notifyChange(e ChangeEvent) {
+	changeHandlersMutex.RLock()
+	defer changeHandlersMutex.RUnlock()
+	for _, h := range changeHandlers {
+		h(e)
+	}
+}
+
+// RegisterChurnHandler registers a function to call every time the churn of a prefix exceeds the
+// threshold declared by its backend. It is called again only after the rate falls below the threshold.
+// Registration storms usually precede outages, so it is a good place for raising an alert.
+func RegisterChurnHandler(h func(ChurnEvent)) {
+	churnHandlersMutex.Lock()
+	churnHandlers = append(churnHandlers, h)
+	churnHandlersMutex.Unlock()
+}
+
+func notifyChurn(e ChurnEvent) {
+	churnHandlersMutex.RLock()
+	defer churnHandlersMutex.RUnlock()
+	for _, h := range churnHandlers {
+		h(e)
+	}
+}
+
+// churnTracker counts the hosts added and removed from a prefix during the last minute
+type churnTracker struct {
+	prefix    string
+	threshold int
+	previous  map[string]struct{}
+	samples   []churnSample
+	exceeded  bool
+}
+
+type churnSample struct {
+	at      time.Time
+	changes int
+}
+
+func newChurnTracker(prefix string, threshold int) *churnTracker {
+	return &churnTracker{prefix: prefix, threshold: threshold}
+}
+
+// track compares the received hosts with the previous ones, notifying the change handlers, updating the
+// churn metrics and notifying the churn handlers if the threshold is exceeded. It returns the current
+// churn rate. The first set of hosts is the baseline, so it is not considered churn.
+func (c *churnTracker) track(hosts []string, now time.Time) int {
+	current := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		current[h] = struct{}{}
+	}
+	added, removed := []string{}, []string{}
+	if c.previous != nil {
+		for h := range current {
+			if _, ok := c.previous[h]; !ok {
+				added = append(added, h)
+			}
+		}
+		for h := range c.previous {
+			if _, ok := current[h]; !ok {
+				removed = append(removed, h)
+			}
+		}
+	}
+	c.previous = current
+
+	changes := len(added) + len(removed)
+	if changes > 0 {
+		c.samples = append(c.samples, churnSample{at: now, changes: changes})
+		addMetric(MetricChurn, int64(changes))
+		sort.Strings(added)
+		sort.Strings(removed)
+		notifyChange(ChangeEvent{Prefix: c.prefix, Added: added, Removed: removed, Hosts: hosts})
+	}
+	rate := 0
+	samples := c.samples[:0]
+	for _, s := range c.samples {
+		if now.Sub(s.at) < churnWindow {
+			samples = append(samples, s)
+			rate += s.changes
+		}
+	}
+	c.samples = samples
+	setMetric(MetricChurnRate+"."+c.prefix, int64(rate))
+
+	if c.threshold <= 0 {
+		return rate
+	}
+	if rate > c.threshold && !c.exceeded {
+		notifyChurn(ChurnEvent{Prefix: c.prefix, Rate: rate, Threshold: c.threshold})
+	}
+	c.exceeded = rate > c.threshold
+	return rate
+}
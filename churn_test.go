@@ -0,0 +1,52 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChurnTracker(t *testing.T) {
+	events := []ChurnEvent{}
+	RegisterChurnHandler(func(e ChurnEvent) { events = append(events, e) })
+	defer func() {
+		churnHandlersMutex.Lock()
+		churnHandlers = churnHandlers[:0]
+		churnHandlersMutex.Unlock()
+	}()
+
+	c := newChurnTracker("/services/churn", 3)
+	now := time.Now()
+
+	if rate := c.track([]string{"a", "b"}, now); rate != 0 {
+		t.Errorf("the baseline should not be churn: %d", rate)
+	}
+	if rate := c.track([]string{"a", "c"}, now.Add(10*time.Second)); rate != 2 {
+		t.Errorf("unexpected rate: %d", rate)
+	}
+	if len(events) != 0 {
+		t.Errorf("unexpected events: %v", events)
+	}
+	if rate := c.track([]string{"d", "e"}, now.Add(20*time.Second)); rate != 6 {
+		t.Errorf("unexpected rate: %d", rate)
+	}
+	if rate := c.track([]string{"d"}, now.Add(30*time.Second)); rate != 7 {
+		t.Errorf("unexpected rate: %d", rate)
+	}
+	expected := []ChurnEvent{{Prefix: "/services/churn", Rate: 6, Threshold: 3}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events: %v", events)
+	}
+	if v := Metrics()[MetricChurnRate+"./services/churn"]; v != 7 {
+		t.Errorf("unexpected metric: %d", v)
+	}
+
+	// the changes older than a minute are forgotten
+	if rate := c.track([]string{"d"}, now.Add(90*time.Second)); rate != 0 {
+		t.Errorf("unexpected rate: %d", rate)
+	}
+	c.track([]string{"x", "y", "z"}, now.Add(100*time.Second))
+	if len(events) != 2 || events[1].Rate != 4 {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
@@ -0,0 +1,69 @@
+package etcd
+
+import (
+	"net"
+	"strings"
+)
+
+// inNetworks returns false if the host of the url is in any of the denied networks or, when the allowed
+// ones are declared, if it is not in any of them. The hosts declared with a name instead of an IP
+// address are only accepted when there are no allowed networks, since they are not resolved.
+func (o BackendOptions) inNetworks(url string) bool {
+	if len(o.AllowedCIDRs) == 0 && len(o.DeniedCIDRs) == 0 {
+		return true
+	}
+	ip := hostIP(url)
+	if ip == nil {
+		return len(o.AllowedCIDRs) == 0
+	}
+	for _, n := range o.DeniedCIDRs {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(o.AllowedCIDRs) == 0 {
+		return true
+	}
+	for _, n := range o.AllowedCIDRs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostIP returns the IP address of the host of the url, or nil if it is not an IP literal
+func hostIP(url string) net.IP {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	if i := strings.Index(url, "/"); i >= 0 {
+		url = url[:i]
+	}
+	h, _ := splitAuthority(url)
+	if i := strings.Index(h, "%"); i >= 0 {
+		h = h[:i]
+	}
+	return net.ParseIP(h)
+}
+
+// parseCIDRs parses a list of networks in the CIDR notation: ["10.0.0.0/8", "fd00::/8"]
+func parseCIDRs(v interface{}) ([]net.IPNet, bool) {
+	tmp, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	networks := make([]net.IPNet, len(tmp))
+	for i, c := range tmp {
+		s, ok := c.(string)
+		if !ok {
+			return nil, false
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, false
+		}
+		networks[i] = *n
+	}
+	return networks, true
+}
@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestBackendOptions_inNetworks(t *testing.T) {
+	options, err := parseBackendOptions(config.ExtraConfig{Namespace: map[string]interface{}{
+		"allowed_cidrs": []interface{}{"10.0.0.0/8", "fd00::/8"},
+		"denied_cidrs":  []interface{}{"10.0.99.0/24"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := Metrics()[MetricOutOfRangeHosts]
+	hosts := options.normalizeHosts([]Host{
+		{URL: "http://10.0.0.1:8080"},
+		{URL: "http://10.0.99.1:8080"},
+		{URL: "http://192.168.0.1:8080/api"},
+		{URL: "https://[fd00::1]:8443"},
+		{URL: "http://[fe80::1%25eth0]:8080"},
+		{URL: "http://api.example.com"},
+	})
+	if expected := []string{"http://10.0.0.1:8080", "https://[fd00::1]:8443"}; !reflect.DeepEqual(hostURLs(hosts), expected) {
+		t.Errorf("unexpected hosts: %v", hostURLs(hosts))
+	}
+	if v := Metrics()[MetricOutOfRangeHosts] - before; v != 4 {
+		t.Errorf("unexpected out of range hosts: %d", v)
+	}
+
+	denied := BackendOptions{DeniedCIDRs: options.DeniedCIDRs}
+	if hosts := denied.normalize([]string{"10.0.99.1:8080", "api.example.com", "192.168.0.1"}); !reflect.DeepEqual(hosts, []string{"api.example.com", "192.168.0.1"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestParseBackendOptions_cidrs(t *testing.T) {
+	for _, v := range []interface{}{"10.0.0.0/8", []interface{}{"10.0.0.1"}, []interface{}{8.0}} {
+		_, err := parseBackendOptions(config.ExtraConfig{Namespace: map[string]interface{}{"denied_cidrs": v}})
+		if err == nil || err.(*ConfigError).Path != Namespace+".denied_cidrs" {
+			t.Errorf("unexpected error parsing %v: %v", v, err)
+		}
+	}
+
+	cfg := config.ExtraConfig{Namespace: map[string]interface{}{"allowed_cidrs": []interface{}{"10.0.0.0/8"}}}
+	a, _ := parseBackendOptions(cfg)
+	b, _ := parseBackendOptions(cfg)
+	if a.key("/services/api/") != b.key("/services/api/") {
+		t.Error("the backends with the same networks should share their subscriber")
+	}
+}
@@ -2,18 +2,28 @@ package etcd
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
-	"net"
 	"net/http"
+	"path"
+	"strings"
+	"time"
 
-	etcd "github.com/coreos/etcd/client"
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
 )
 
 type client struct {
-	keysAPI etcd.KeysAPI
-	ctx     context.Context
+	keysAPI    etcd.KeysAPI
+	etcdClient etcd.Client
+	machines   []string
+	ctx        context.Context
+	options    ClientOptions
+	// fallback is shared by the scoped copies. See ConsistencyFallback.
+	fallback *consistencyFallback
+	// limits is shared by the scoped copies. See ClientOptions.MaxWatchers and MaxConcurrentGets.
+	limits *clientLimits
+	// correlationID tags the requests of the client. See CorrelatedClient.
+	correlationID string
+	// writes is shared by the scoped copies. See localWrites.
+	writes *localWrites
 }
 
 // NewClient returns Client with a connection to the named machines. It will
@@ -31,75 +41,261 @@ func NewClient(ctx context.Context, machines []string, options ClientOptions) (C
 		options.HeaderTimeoutPerRequest = defaultTTL
 	}
 
+	tlsCfg, err := newTLSConfig(ctx, options)
+	if err != nil {
+		return nil, err
+	}
 	transport := etcd.DefaultTransport
-	if options.Cert != "" && options.Key != "" {
-		tlsCert, err := tls.LoadX509KeyPair(options.Cert, options.Key)
-		if err != nil {
-			return nil, err
-		}
-		tlsCfg := &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-		}
-		if caCertCt, err := ioutil.ReadFile(options.CACert); err == nil {
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM(caCertCt)
-			tlsCfg.RootCAs = caCertPool
-		}
+	if tlsCfg != nil || options.Dialer != nil {
 		transport = &http.Transport{
 			TLSClientConfig: tlsCfg,
-			Dial: func(network, address string) (net.Conn, error) {
-				return (&net.Dialer{
-					Timeout:   options.DialTimeout,
-					KeepAlive: options.DialKeepAlive,
-				}).Dial(network, address)
-			},
+			DialContext:     dialContext(options),
 		}
 	}
 
 	ce, err := etcd.New(etcd.Config{
 		Endpoints:               machines,
-		Transport:               transport,
+		Transport:               correlationTransport{transport},
 		HeaderTimeoutPerRequest: options.HeaderTimeoutPerRequest,
+		Username:                options.Username,
+		Password:                options.Password,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &client{
-		keysAPI: etcd.NewKeysAPI(ce),
-		ctx:     ctx,
+		keysAPI:    etcd.NewKeysAPI(ce),
+		etcdClient: ce,
+		machines:   machines,
+		ctx:        ctx,
+		options:    options,
+		fallback:   newConsistencyFallback(),
+		limits:     newClientLimits(options),
+		writes:     newLocalWrites(),
 	}, nil
 }
 
+// WithOptions implements the etcd ScopedClient interface.
+func (c *client) WithOptions(options ClientOptions) Client {
+	return &client{
+		keysAPI:       c.keysAPI,
+		etcdClient:    c.etcdClient,
+		machines:      c.machines,
+		ctx:           c.ctx,
+		options:       c.options.merge(options),
+		fallback:      c.fallback,
+		limits:        c.limits,
+		writes:        c.writes,
+		correlationID: c.correlationID,
+	}
+}
+
 // GetEntries implements the etcd Client interface.
 func (c *client) GetEntries(key string) ([]string, error) {
-	resp, err := c.keysAPI.Get(c.ctx, key, &etcd.GetOptions{Recursive: true})
+	hosts, err := c.GetHosts(key)
 	if err != nil {
 		return nil, err
 	}
+	return hostURLs(hosts), nil
+}
+
+// GetHosts implements the etcd HostsClient interface.
+func (c *client) GetHosts(key string) ([]Host, error) {
+	hosts, _, err := c.GetHostsWithRevision(key)
+	return hosts, err
+}
+
+// GetHostsWithRevision implements the etcd RevisionClient interface.
+func (c *client) GetHostsWithRevision(key string) ([]Host, int64, error) {
+	quorum := c.options.Consistency == ConsistencyLinearizable
+	fallback := c.options.Consistency == ConsistencyFallback
+	if fallback {
+		quorum = !c.fallback.serializable(GetClock().Now())
+	}
+	resp, err := c.get(key, quorum)
+	if fallback && quorum {
+		if err == nil {
+			c.fallback.succeeded()
+		} else if c.fallback.failed(err, GetClock().Now()) {
+			countError(err)
+			resp, err = c.get(key, false)
+		}
+	}
+	if err != nil {
+		return nil, 0, countError(err)
+	}
 
 	// Special case. Note that it's possible that len(resp.Node.Nodes) == 0 and
-	// resp.Node.Value is also empty, in which case the key is empty and we
-	// should not return any entries.
-	if len(resp.Node.Nodes) == 0 && resp.Node.Value != "" {
-		return []string{resp.Node.Value}, nil
+	// the host is also empty, in which case the key is empty and we should not
+	// return any entries.
+	if len(resp.Node.Nodes) == 0 && !resp.Node.Dir {
+		limiter := &entryLimiter{options: c.options, prefix: key}
+		admitted, err := limiter.admit(resp.Node.Key, resp.Node.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !admitted {
+			return []Host{}, int64(resp.Index), nil
+		}
+		if hosts, ok := decodeEntry(c.options, resp.Node.Key, resp.Node.Value); ok && len(hosts) > 0 && hosts[0].URL != "" {
+			size := payload{}
+			size.add(len(resp.Node.Key) + len(resp.Node.Value))
+			size.publish(key, hosts)
+			return hosts, int64(resp.Index), nil
+		}
+	}
+
+	nodes := leafNodes(resp.Node)
+	entries := make([]Host, 0, len(nodes))
+	size := payload{}
+	limiter := &entryLimiter{options: c.options, prefix: key}
+	for _, node := range nodes {
+		size.add(len(node.Key) + len(node.Value))
+		if ok, err := limiter.admit(node.Key, node.Value); err != nil {
+			return nil, 0, err
+		} else if !ok {
+			continue
+		}
+		if hosts, ok := decodeEntry(c.options, node.Key, node.Value); ok {
+			entries = append(entries, hosts...)
+		}
+	}
+	size.publish(key, entries)
+	return entries, int64(resp.Index), nil
+}
+
+// CountEntries implements the etcd CountClient interface. The v2 API can not count the keys, so
+// the prefix is read.
+func (c *client) CountEntries(prefix string) (int64, error) {
+	resp, err := c.get(prefix, c.options.Consistency == ConsistencyLinearizable)
+	if err != nil {
+		return 0, countError(err)
 	}
+	if !resp.Node.Dir {
+		return 1, nil
+	}
+	return int64(len(leafNodes(resp.Node))), nil
+}
+
+// leafNodes returns the nodes holding a value under the received one, flattening the nested directories.
+// The hidden nodes (the ones whose key starts with an underscore) and their children are skipped.
+func leafNodes(n *etcd.Node) []*etcd.Node {
+	nodes := []*etcd.Node{}
+	var walk func(*etcd.Node)
+	walk = func(n *etcd.Node) {
+		for _, child := range n.Nodes {
+			if child == nil || strings.HasPrefix(path.Base(child.Key), "_") {
+				continue
+			}
+			if child.Dir {
+				walk(child)
+				continue
+			}
+			nodes = append(nodes, child)
+		}
+	}
+	walk(n)
+	return nodes
+}
 
-	entries := make([]string, len(resp.Node.Nodes))
-	for i, node := range resp.Node.Nodes {
-		entries[i] = node.Value
+// get reads the key recursively, through the quorum if required
+func (c *client) get(key string, quorum bool) (*etcd.Response, error) {
+	if err := c.options.allowed(key); err != nil {
+		return nil, err
+	}
+	ctx := c.requestContext()
+	release, err := c.limits.acquireGet(ctx, key)
+	if err != nil {
+		return nil, err
 	}
-	return entries, nil
+	defer release()
+	if c.options.HeaderTimeoutPerRequest > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.options.HeaderTimeoutPerRequest)
+		defer cancel()
+	}
+	return c.keysAPI.Get(ctx, key, &etcd.GetOptions{Recursive: true, Quorum: quorum})
 }
 
 // WatchPrefix implements the etcd Client interface.
 func (c *client) WatchPrefix(prefix string, ch chan struct{}) {
-	watch := c.keysAPI.Watcher(prefix, &etcd.WatcherOptions{AfterIndex: 0, Recursive: true})
-	ch <- struct{}{} // make sure caller invokes GetEntries
+	c.watchPrefix(prefix, ch, nil)
+}
+
+// watchPrefix watches the prefix. The initial notification is replaced by the read of the prefix sent
+// to the snapshot channel, if any, and the watch starts right after its index.
+func (c *client) watchPrefix(prefix string, ch chan struct{}, snapshot chan<- WatchSnapshot) {
+	if err := c.options.allowed(prefix); err != nil {
+		logError(prefix, "etcd: unable to watch the prefix", err)
+		return
+	}
+	release, err := c.limits.acquireWatch(c.ctx, prefix)
+	if err != nil {
+		return
+	}
+	defer release()
+	var index uint64
+	if snapshot != nil {
+		hosts, header, err := c.GetHostsWithHeader(prefix)
+		if !sendSnapshot(c.ctx, snapshot, WatchSnapshot{Hosts: hosts, Header: header, Err: err}) {
+			return
+		}
+		if err == nil {
+			index = uint64(header.Revision)
+		}
+	}
+	watch := c.keysAPI.Watcher(prefix, &etcd.WatcherOptions{AfterIndex: index, Recursive: true})
+	addMetric(MetricWatchRanges, 1)
+	defer addMetric(MetricWatchRanges, -1)
+	if snapshot == nil {
+		ch <- struct{}{} // make sure caller invokes GetEntries
+	}
 	for {
-		if _, err := watch.Next(c.ctx); err != nil {
+		resp, err := watch.Next(c.ctx)
+		if err != nil {
+			if c.ctx.Err() == nil {
+				countError(err)
+			}
 			return
 		}
+		if c.options.IgnoreTouches && touchResponse(resp) {
+			continue
+		}
 		ch <- struct{}{}
 	}
 }
+
+// Register implements the etcd Registrar interface.
+func (c *client) Register(key, value string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	resp, err := c.keysAPI.Set(ctx, key, value, &etcd.SetOptions{TTL: ttl})
+	if err == nil && resp != nil {
+		hosts, _ := decodeEntry(c.options, key, value)
+		c.writes.put(key, hosts, int64(resp.Index))
+	}
+	return countError(err)
+}
+
+// Deregister implements the etcd Registrar interface.
+func (c *client) Deregister(key string) error {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	resp, err := c.keysAPI.Delete(ctx, key, nil)
+	if err == nil && resp != nil {
+		c.writes.delete(key, int64(resp.Index))
+	}
+	return countError(err)
+}
+
+// Ping implements the etcd Pinger interface. Any answer of the cluster, even an error, means it is healthy.
+func (c *client) Ping() error {
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	_, err := c.keysAPI.Get(ctx, "/", nil)
+	if _, ok := err.(etcd.Error); ok {
+		return nil
+	}
+	return countError(err)
+}
@@ -7,7 +7,7 @@ import (
 	"testing"
 	"time"
 
-	etcd "github.com/coreos/etcd/client"
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
 )
 
 func TestNewClient_withDefaults(t *testing.T) {
@@ -270,3 +270,81 @@ func TestGetEntries(t *testing.T) {
 		}
 	}
 }
+
+func TestGetEntries_keySuffix(t *testing.T) {
+	input := getResult{&etcd.Response{
+		Action: "get",
+		Node: &etcd.Node{
+			Key: "/services/api",
+			Dir: true,
+			Nodes: []*etcd.Node{
+				{Key: "/services/api/10.0.0.1:8080"},
+				{Key: "/services/api/10.0.0.2:8080"},
+			},
+		},
+	}, nil}
+	c := &client{
+		keysAPI: &fakeKeysAPI{getres: &input},
+		ctx:     context.Background(),
+		options: ClientOptions{HostSource: HostSourceKeySuffix},
+	}
+	resp, err := c.GetEntries("/services/api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"10.0.0.1:8080", "10.0.0.2:8080"}; !reflect.DeepEqual(want, resp) {
+		t.Fatalf("want %v, have %v", want, resp)
+	}
+}
+
+func TestGetEntries_nestedTree(t *testing.T) {
+	input := getResult{&etcd.Response{
+		Action: "get",
+		Node: &etcd.Node{
+			Key: "/services/api",
+			Dir: true,
+			Nodes: []*etcd.Node{
+				{Key: "/services/api/1", Value: "http://10.0.0.1"},
+				{Key: "/services/api/_lock", Value: "gateway-1"},
+				{Key: "/services/api/eu", Dir: true, Nodes: []*etcd.Node{
+					{Key: "/services/api/eu/2", Value: "http://10.0.0.2"},
+					{Key: "/services/api/eu/west", Dir: true, Nodes: []*etcd.Node{
+						{Key: "/services/api/eu/west/3", Value: "http://10.0.0.3"},
+						{Key: "/services/api/eu/west/_meta", Value: "{}"},
+					}},
+					{Key: "/services/api/eu/empty", Dir: true},
+				}},
+				{Key: "/services/api/_hidden", Dir: true, Nodes: []*etcd.Node{
+					{Key: "/services/api/_hidden/4", Value: "http://10.0.0.4"},
+				}},
+			},
+		},
+	}, nil}
+	c := &client{
+		keysAPI: &fakeKeysAPI{getres: &input},
+		ctx:     context.Background(),
+	}
+	resp, err := c.GetEntries("/services/api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"http://10.0.0.1", "http://10.0.0.2", "http://10.0.0.3"}; !reflect.DeepEqual(want, resp) {
+		t.Fatalf("want %v, have %v", want, resp)
+	}
+	if n, err := c.CountEntries("/services/api"); err != nil || n != 3 {
+		t.Errorf("unexpected count: %d %v", n, err)
+	}
+}
+
+func TestRegistrar(t *testing.T) {
+	r, ok := newFakeClient(nil, nil, nil).(Registrar)
+	if !ok {
+		t.Fatal("the client should implement the Registrar interface")
+	}
+	if err := r.Register("/services/api/1", "http://10.0.0.1:8080", time.Second); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Deregister("/services/api/1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -2,18 +2,28 @@ package etcd
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
 	"time"
 
-	etcdv3 "github.com/coreos/etcd/clientv3"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"google.golang.org/grpc"
 )
 
 type clientv3 struct {
 	client  *etcdv3.Client
 	ctx     context.Context
 	timeout time.Duration
+	options ClientOptions
+	mux     *watchMux
+	// fallback is shared by the scoped copies. See ConsistencyFallback.
+	fallback *consistencyFallback
+	// limits is shared by the scoped copies. See ClientOptions.MaxWatchers and MaxConcurrentGets.
+	limits *clientLimits
+	// correlationID tags the requests of the client. See CorrelatedClient.
+	correlationID string
+	// writes is shared by the scoped copies. See localWrites.
+	writes *localWrites
+	// leases is shared by the scoped copies. See leaseTracker.
+	leases *leaseTracker
 }
 
 // NewClient returns Client with a connection to the named machines. It will
@@ -31,20 +41,14 @@ func NewClientV3(ctx context.Context, machines []string, options ClientOptions)
 		options.HeaderTimeoutPerRequest = defaultTTL
 	}
 
-	var tlsCfg *tls.Config
-	if options.Cert != "" && options.Key != "" {
-		tlsCert, err := tls.LoadX509KeyPair(options.Cert, options.Key)
-		if err != nil {
-			return nil, err
-		}
-		tlsCfg = &tls.Config{
-			Certificates: []tls.Certificate{tlsCert},
-		}
-		if caCertCt, err := ioutil.ReadFile(options.CACert); err == nil {
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM(caCertCt)
-			tlsCfg.RootCAs = caCertPool
-		}
+	tlsCfg, err := newTLSConfig(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialOptions []grpc.DialOption
+	if options.Dialer != nil {
+		dialOptions = append(dialOptions, grpc.WithContextDialer(options.Dialer))
 	}
 
 	ce, err := etcdv3.New(etcdv3.Config{
@@ -53,57 +57,361 @@ func NewClientV3(ctx context.Context, machines []string, options ClientOptions)
 		DialKeepAliveTime:    options.DialKeepAlive,
 		DialKeepAliveTimeout: options.HeaderTimeoutPerRequest,
 		TLS:                  tlsCfg,
+		Username:             options.Username,
+		Password:             options.Password,
+		DialOptions:          dialOptions,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	c := &clientv3{
+		client:   ce,
+		ctx:      ctx,
+		timeout:  options.HeaderTimeoutPerRequest,
+		options:  options,
+		fallback: newConsistencyFallback(),
+		limits:   newClientLimits(options),
+		writes:   newLocalWrites(),
+		leases:   newLeaseTracker(),
+	}
+	if options.WatchRoot != "" {
+		c.mux = newWatchMux(ctx, ce, options)
+	}
+	return c, nil
+}
+
+// WithOptions implements the etcd ScopedClient interface.
+func (c *clientv3) WithOptions(options ClientOptions) Client {
+	merged := c.options.merge(options)
+	timeout := c.timeout
+	if options.HeaderTimeoutPerRequest != 0 {
+		timeout = options.HeaderTimeoutPerRequest
+	}
 	return &clientv3{
-		client:  ce,
-		ctx:     ctx,
-		timeout: options.HeaderTimeoutPerRequest,
-	}, nil
+		client:        c.client,
+		ctx:           c.ctx,
+		timeout:       timeout,
+		options:       merged,
+		mux:           c.mux,
+		fallback:      c.fallback,
+		limits:        c.limits,
+		writes:        c.writes,
+		leases:        c.leases,
+		correlationID: c.correlationID,
+	}
 }
 
 // GetEntries implements the etcd Client interface.
 func (c *clientv3) GetEntries(key string) ([]string, error) {
+	hosts, err := c.GetHosts(key)
+	if err != nil {
+		return nil, err
+	}
+	return hostURLs(hosts), nil
+}
 
-	if c.client == nil {
-		return nil, ErrNilClient
+// GetHosts implements the etcd HostsClient interface.
+func (c *clientv3) GetHosts(key string) ([]Host, error) {
+	hosts, _, err := c.GetHostsWithRevision(key)
+	return hosts, err
+}
+
+// GetHostsWithRevision implements the etcd RevisionClient interface.
+func (c *clientv3) GetHostsWithRevision(key string) ([]Host, int64, error) {
+	hosts, header, err := c.getHosts(key, 0)
+	return hosts, header.Revision, err
+}
+
+// get reads the prefix at the received revision, or at the latest one if it is zero. The limited
+// responses are completed with the remaining pages, read at the revision of the first one, so the
+// returned keys are always the whole prefix.
+func (c *clientv3) get(key string, rev int64, serializable bool) (*etcdv3.GetResponse, error) {
+	if err := c.options.allowed(key); err != nil {
+		return nil, err
+	}
+	release, err := c.limits.acquireGet(c.requestContext(), key)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+	resp, err := c.getPage(key, key, rev, serializable)
+	if err != nil {
+		return nil, err
+	}
+	if rev == 0 && resp.Header != nil {
+		rev = resp.Header.Revision
+	}
+	for resp.More && len(resp.Kvs) > 0 {
+		from := string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+		next, err := c.getPage(key, from, rev, serializable)
+		if err != nil {
+			return nil, err
+		}
+		resp.Kvs = append(resp.Kvs, next.Kvs...)
+		resp.More = next.More
+	}
+	return resp, nil
+}
 
+// getPage reads the keys of the prefix starting at the from key, up to the page size
+func (c *clientv3) getPage(prefix, from string, rev int64, serializable bool) (*etcdv3.GetResponse, error) {
 	// set the timeout for this requisition
-	timeoutCtx, cancel := context.WithTimeout(c.ctx, c.timeout)
-	resp, err := c.client.Get(timeoutCtx, key, etcdv3.WithPrefix())
-	cancel()
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+	opts := []etcdv3.OpOption{etcdv3.WithRange(etcdv3.GetPrefixRangeEnd(prefix))}
+	if from == prefix {
+		opts = []etcdv3.OpOption{etcdv3.WithPrefix()}
+	}
+	if c.options.PageSize > 0 {
+		opts = append(opts, etcdv3.WithLimit(int64(c.options.PageSize)))
+	}
+	if serializable {
+		opts = append(opts, etcdv3.WithSerializable())
+	}
+	if rev > 0 {
+		opts = append(opts, etcdv3.WithRev(rev))
+	}
+	return c.client.Get(ctx, from, opts...)
+}
 
+// CountEntries implements the etcd CountClient interface.
+func (c *clientv3) CountEntries(prefix string) (int64, error) {
+	if c.client == nil {
+		return 0, ErrNilClient
+	}
+	if err := c.options.allowed(prefix); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+	opts := []etcdv3.OpOption{etcdv3.WithPrefix(), etcdv3.WithCountOnly()}
+	if c.options.Consistency == ConsistencySerializable {
+		opts = append(opts, etcdv3.WithSerializable())
+	}
+	resp, err := c.client.Get(ctx, prefix, opts...)
 	if err != nil {
-		return nil, err
+		return 0, countError(err)
+	}
+	return resp.Count, nil
+}
+
+// getHosts reads the hosts of the prefix at the received revision, or at the latest one if it is zero,
+// along with the header of the response
+func (c *clientv3) getHosts(key string, rev int64) ([]Host, ResponseHeader, error) {
+
+	if c.client == nil {
+		return nil, ResponseHeader{}, ErrNilClient
 	}
 
+	serializable := c.options.Consistency == ConsistencySerializable
+	fallback := c.options.Consistency == ConsistencyFallback
+	if fallback {
+		serializable = c.fallback.serializable(GetClock().Now())
+	}
+	resp, err := c.get(key, rev, serializable)
+	if fallback && !serializable {
+		if err == nil {
+			c.fallback.succeeded()
+		} else if c.fallback.failed(err, GetClock().Now()) {
+			countError(err)
+			resp, err = c.get(key, rev, true)
+		}
+	}
+	if err != nil {
+		return nil, ResponseHeader{}, countError(err)
+	}
+	header := newResponseHeader(resp.Header)
+
 	// Special case. Note that it's possible that len(resp.Node.Nodes) == 0 and
 	// resp.Node.Value is also empty, in which case the key is empty and we
 	// should not return any entries.
-	if len(resp.Kvs) == 0 || resp.Count != int64(len(resp.Kvs)) {
-		return nil, nil
+	if len(resp.Kvs) == 0 {
+		payload{}.publish(key, nil)
+		return nil, header, nil
+	}
+
+	size := payload{}
+	for _, ev := range resp.Kvs {
+		size.add(len(ev.Key) + len(ev.Value))
+	}
+
+	var expiring map[int64]time.Duration
+	if c.options.LeaseMargin > 0 {
+		leases := []int64{}
+		for _, ev := range resp.Kvs {
+			if ev.Lease != 0 {
+				leases = append(leases, ev.Lease)
+			}
+		}
+		tracker := c.leases
+		if tracker == nil {
+			tracker = newLeaseTracker()
+		}
+		expiring = tracker.expiring(leases, c.options.LeaseMargin, c.leaseTTL())
+		if len(expiring) > 0 {
+			// the entries discarded are read again once their leases should have expired, since their
+			// renewals would not trigger any watch event
+			delay := c.options.LeaseMargin
+			for _, remaining := range expiring {
+				if remaining < delay {
+					delay = remaining
+				}
+			}
+			if delay < time.Second {
+				delay = time.Second
+			}
+			tracker.schedule(c.ctx, key, delay)
+		}
 	}
 
-	entries := make([]string, resp.Count)
-	for i, ev := range resp.Kvs {
-		entries[i] = string(ev.Value[:])
+	flags := map[string]string{}
+	for _, ev := range resp.Kvs {
+		if _, ok := maintenanceEntry(string(ev.Key)); ok {
+			flags[string(ev.Key)] = string(ev.Value)
+		}
+	}
+	maintenance := maintenanceKeys(flags)
+
+	entries := make([]Host, 0, resp.Count)
+	limiter := &entryLimiter{options: c.options, prefix: key}
+	for _, ev := range resp.Kvs {
+		if _, ok := flags[string(ev.Key)]; ok {
+			continue
+		}
+		if _, ok := maintenance[string(ev.Key)]; ok {
+			continue
+		}
+		if _, ok := expiring[ev.Lease]; ok && ev.Lease != 0 {
+			addMetric(MetricExpiringEntries, 1)
+			continue
+		}
+		if ok, err := limiter.admit(string(ev.Key), string(ev.Value)); err != nil {
+			return nil, ResponseHeader{}, err
+		} else if !ok {
+			continue
+		}
+		if hosts, ok := decodeEntry(c.options, string(ev.Key), string(ev.Value)); ok {
+			entries = append(entries, hosts...)
+		}
 	}
-	return entries, nil
+	size.publish(key, entries)
+	return entries, header, nil
 }
 
-// WatchPrefix implements the etcd Client interface.
+// WatchPrefix implements the etcd Client interface. The prefixes under the watch root, if defined,
+// share a single watch range.
 func (c *clientv3) WatchPrefix(prefix string, ch chan struct{}) {
+	c.watchPrefix(prefix, ch, nil)
+}
+
+// watchPrefix watches the prefix. The initial notification is replaced by the read of the prefix sent
+// to the snapshot channel, if any, and the watch starts right after its revision.
+func (c *clientv3) watchPrefix(prefix string, ch chan struct{}, snapshot chan<- WatchSnapshot) {
 
 	if c.client == nil {
 		return
 	}
-	watch := c.client.Watch(c.ctx, prefix, etcdv3.WithPrefix())
-	ch <- struct{}{} // make sure caller invokes GetEntries
-	for _ = range watch {
+	if err := c.options.allowed(prefix); err != nil {
+		logError(prefix, "etcd: unable to watch the prefix", err)
+		return
+	}
+	if c.mux != nil && c.mux.covers(prefix) {
+		c.mux.follow(prefix, ch, func() bool {
+			if snapshot == nil {
+				ch <- struct{}{} // make sure caller invokes GetEntries
+				return true
+			}
+			hosts, header, err := c.getHosts(prefix, 0)
+			return sendSnapshot(c.ctx, snapshot, WatchSnapshot{Hosts: hosts, Header: header, Err: err})
+		})
+		return
+	}
+	release, err := c.limits.acquireWatch(c.ctx, prefix)
+	if err != nil {
+		return
+	}
+	defer release()
+	opts := watchOptions(c.options)
+	if snapshot != nil {
+		hosts, header, err := c.getHosts(prefix, 0)
+		if !sendSnapshot(c.ctx, snapshot, WatchSnapshot{Hosts: hosts, Header: header, Err: err}) {
+			return
+		}
+		if err == nil && header.Revision > 0 {
+			opts = append(opts, etcdv3.WithRev(header.Revision+1))
+		}
+	}
+	watch := c.client.Watch(c.ctx, prefix, opts...)
+	addMetric(MetricWatchRanges, 1)
+	defer addMetric(MetricWatchRanges, -1)
+	if snapshot == nil {
+		ch <- struct{}{} // make sure caller invokes GetEntries
+	}
+	for resp := range watch {
+		if err := resp.Err(); err != nil {
+			countError(err)
+		}
+		if c.options.IgnoreTouches && onlyTouches(resp, c.options.LeaseMargin > 0) {
+			continue
+		}
 		ch <- struct{}{}
 	}
 }
+
+// Register implements the etcd Registrar interface. The entries with a ttl are attached to a new lease.
+func (c *clientv3) Register(key, value string, ttl time.Duration) error {
+	if c.client == nil {
+		return ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+
+	opts, _, err := c.leaseOptions(ctx, ttl)
+	if err != nil {
+		return countError(err)
+	}
+	return c.put(ctx, key, value, opts...)
+}
+
+// put stores the entry with the received options, tracking it as a write of the client
+func (c *clientv3) put(ctx context.Context, key, value string, opts ...etcdv3.OpOption) error {
+	resp, err := c.client.Put(ctx, key, value, opts...)
+	if err == nil && resp != nil {
+		hosts, _ := decodeEntry(c.options, key, value)
+		c.writes.put(key, hosts, newResponseHeader(resp.Header).Revision)
+	}
+	return countError(err)
+}
+
+// Deregister implements the etcd Registrar interface.
+func (c *clientv3) Deregister(key string) error {
+	if c.client == nil {
+		return ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+	resp, err := c.client.Delete(ctx, key)
+	if err == nil && resp != nil {
+		c.writes.delete(key, newResponseHeader(resp.Header).Revision)
+	}
+	return countError(err)
+}
+
+// Ping implements the etcd Pinger interface. Like the v2 one, a cluster rejecting the probe because of
+// the permissions of the client (e.g. an RBAC role without access to "/") is answering, so it is healthy.
+func (c *clientv3) Ping() error {
+	if c.client == nil {
+		return ErrNilClient
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+	_, err := c.client.Get(ctx, "/", etcdv3.WithCountOnly())
+	if err = countError(err); ErrorCode(err) == ErrorCodePermissionDenied {
+		return nil
+	}
+	return err
+}
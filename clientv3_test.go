@@ -2,8 +2,15 @@ package etcd
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+	"github.com/devopsfaith/krakend-etcd/internal/rpctypes"
 )
 
 func TestNewClient_withDefaultsV3(t *testing.T) {
@@ -84,3 +91,101 @@ func TestGetEntriesV3(t *testing.T) {
 		t.Errorf("expected client error")
 	}
 }
+
+// pagedKV emulates a server limiting its responses to pageSize keys, starting at the requested one
+type pagedKV struct {
+	etcdv3.KV
+	kvs      []*mvccpb.KeyValue
+	pageSize int
+	requests *[]string
+}
+
+func (f pagedKV) Get(_ context.Context, key string, _ ...etcdv3.OpOption) (*etcdv3.GetResponse, error) {
+	*f.requests = append(*f.requests, key)
+	i := sort.Search(len(f.kvs), func(i int) bool { return string(f.kvs[i].Key) >= key })
+	end := i + f.pageSize
+	if end > len(f.kvs) {
+		end = len(f.kvs)
+	}
+	return &etcdv3.GetResponse{
+		Header: &etcdv3.ResponseHeader{Revision: 50},
+		Kvs:    f.kvs[i:end],
+		More:   end < len(f.kvs),
+		Count:  int64(len(f.kvs) - i),
+	}, nil
+}
+
+func TestGetEntriesV3_paginated(t *testing.T) {
+	kvs := []*mvccpb.KeyValue{}
+	expected := []string{}
+	for i := 0; i < 5; i++ {
+		host := fmt.Sprintf("http://10.0.0.%d", i)
+		kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(fmt.Sprintf("/services/api/%d", i)), Value: []byte(host)})
+		expected = append(expected, host)
+	}
+	requests := []string{}
+	c := &clientv3{
+		client:  &etcdv3.Client{KV: pagedKV{kvs: kvs, pageSize: 2, requests: &requests}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+		options: ClientOptions{PageSize: 2},
+	}
+
+	hosts, revision, err := c.GetHostsWithRevision("/services/api/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hostURLs(hosts), expected) || revision != 50 {
+		t.Errorf("unexpected hosts: %v %d", hostURLs(hosts), revision)
+	}
+	if want := []string{"/services/api/", "/services/api/1\x00", "/services/api/3\x00"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("unexpected requests: %q", requests)
+	}
+}
+
+func TestCountEntriesV3(t *testing.T) {
+	c := &clientv3{
+		client:  &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{Header: &etcdv3.ResponseHeader{}, Count: 1200}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+	}
+	var cc CountClient = c
+	if n, err := cc.CountEntries("/services/api/"); err != nil || n != 1200 {
+		t.Errorf("unexpected count: %d %v", n, err)
+	}
+}
+
+func TestPingV3(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected error
+	}{
+		{err: nil},
+		{err: rpctypes.ErrPermissionDenied},
+		{err: rpctypes.ErrAuthFailed},
+		{err: context.DeadlineExceeded, expected: context.DeadlineExceeded},
+		{err: rpctypes.ErrNoLeader, expected: rpctypes.ErrNoLeader},
+	} {
+		c := &clientv3{
+			client:  &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{Header: &etcdv3.ResponseHeader{}}, err: tc.err}},
+			ctx:     context.Background(),
+			timeout: time.Second,
+		}
+		if err := c.Ping(); err != tc.expected {
+			t.Errorf("unexpected error pinging with %v: %v", tc.err, err)
+		}
+	}
+}
+
+func TestRegistrarV3(t *testing.T) {
+	r, ok := newFakeClientV3(context.Background()).(Registrar)
+	if !ok {
+		t.Fatal("the client should implement the Registrar interface")
+	}
+	if err := r.Register("/services/api/1", "http://10.0.0.1:8080", time.Second); err != ErrNilClient {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Deregister("/services/api/1"); err != ErrNilClient {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
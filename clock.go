@@ -0,0 +1,86 @@
+package etcd
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultJitter is the default maximum fraction of the period randomly added to the periodic tasks
+// (probes, refreshes, retries and negative entries), so the gateways of a fleet do not run them at once
+const DefaultJitter = 0.2
+
+// Clock is the source of time of the subscribers, caches and periodic tasks of the etcd integration.
+// The tests can replace it with a fake one, advancing the time at will.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After returns a channel receiving the current time once the duration has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+var (
+	clock      Clock = systemClock{}
+	jitter           = DefaultJitter
+	clockMutex       = &sync.RWMutex{}
+)
+
+// SetClock sets the clock used by the etcd integration. The system clock is used by default.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	clockMutex.Lock()
+	clock = c
+	clockMutex.Unlock()
+}
+
+// GetClock returns the clock used by the etcd integration, so the packages extending it (like the
+// Kubernetes bridge) share the same source of time
+func GetClock() Clock {
+	clockMutex.RLock()
+	defer clockMutex.RUnlock()
+	return clock
+}
+
+// SetJitter sets the maximum fraction of the period randomly added to the periodic tasks. The values
+// are limited to the [0, 1] range and 0 disables the jitter. DefaultJitter is used by default. The
+// clients created by New with a jitter config apply their own to the retries of their subscribers and
+// to their negative entries.
+func SetJitter(fraction float64) {
+	clockMutex.Lock()
+	jitter = jitterFraction(fraction)
+	clockMutex.Unlock()
+}
+
+// jitterFraction limits the fraction of the jitter to the [0, 1] range
+func jitterFraction(fraction float64) float64 {
+	if fraction < 0 {
+		return 0
+	}
+	if fraction > 1 {
+		return 1
+	}
+	return fraction
+}
+
+// Jitter returns the received period plus a random fraction of it, up to the one set with SetJitter
+func Jitter(d time.Duration) time.Duration {
+	clockMutex.RLock()
+	fraction := jitter
+	clockMutex.RUnlock()
+	return jitterWith(fraction, d)
+}
+
+// jitterWith returns the received period plus a random fraction of it, up to the received one
+func jitterWith(fraction float64, d time.Duration) time.Duration {
+	if fraction == 0 || d <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Float64()*fraction*float64(d))
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
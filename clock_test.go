@@ -0,0 +1,176 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves forward when advanced, firing the channels returned by After on their deadline
+type fakeClock struct {
+	mutex   *sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{mutex: &sync.Mutex{}, now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+func TestJitter(t *testing.T) {
+	defer SetJitter(DefaultJitter)
+
+	for i := 0; i < 100; i++ {
+		if d := Jitter(10 * time.Second); d < 10*time.Second || d > 12*time.Second {
+			t.Errorf("unexpected period: %v", d)
+		}
+	}
+
+	SetJitter(0)
+	if d := Jitter(10 * time.Second); d != 10*time.Second {
+		t.Errorf("unexpected period: %v", d)
+	}
+
+	SetJitter(5)
+	for i := 0; i < 100; i++ {
+		if d := Jitter(10 * time.Second); d > 20*time.Second {
+			t.Errorf("unexpected period: %v", d)
+		}
+	}
+}
+
+func TestNew_jitter(t *testing.T) {
+	defer SetJitter(DefaultJitter)
+
+	for _, v := range []interface{}{"10%", -0.1, 1.5} {
+		_, err := New(context.Background(), map[string]interface{}{
+			Namespace: map[string]interface{}{"machines": []interface{}{"http://127.0.0.1:2379"}, "jitter": v},
+		})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != Namespace+".jitter" {
+			t.Errorf("unexpected error for %v: %v", v, err)
+		}
+	}
+}
+
+func TestCacheNegative_fakeClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+
+	c := dummyClient{watchPrefix: func(_ string, _ chan struct{}) { <-ctx.Done() }}
+	expected := errors.New("key not found")
+
+	subscribersMutex.Lock()
+	negativeCache = map[string]negativeEntry{}
+	cacheNegative(ctx, c, "/services/clock", "clock", 5*time.Second, expected)
+	subscribersMutex.Unlock()
+
+	clock.Advance(4 * time.Second)
+	subscribersMutex.Lock()
+	err, ok := negativeResult("clock", clock.Now())
+	subscribersMutex.Unlock()
+	if !ok || err != expected {
+		t.Errorf("unexpected result: %v %v", err, ok)
+	}
+
+	clock.Advance(2 * time.Second)
+	subscribersMutex.Lock()
+	_, ok = negativeResult("clock", clock.Now())
+	subscribersMutex.Unlock()
+	if ok {
+		t.Error("the negative entry should have expired")
+	}
+}
+
+func TestSubscriber_removalGraceFakeClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	mutex := &sync.Mutex{}
+	entries := []string{"http://10.0.0.1", "http://10.0.0.2"}
+	notify := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return entries, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			ch <- struct{}{}
+			for range notify {
+				ch <- struct{}{}
+			}
+		},
+	}
+	s, err := NewSubscriberWithOptions(ctx, c, "/services/clock", BackendOptions{RemovalGrace: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	entries = []string{"http://10.0.0.1"}
+	mutex.Unlock()
+	notify <- struct{}{}
+	notify <- struct{}{}
+
+	clock.Advance(10 * time.Second)
+	if hosts, _ := s.Hosts(); len(hosts) != 2 {
+		t.Errorf("unexpected hosts during the grace period: %v", hosts)
+	}
+
+	for i := 0; i < 100; i++ {
+		clock.Advance(30 * time.Second)
+		if hosts, _ := s.Hosts(); reflect.DeepEqual(hosts, []string{"http://10.0.0.1"}) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	hosts, _ := s.Hosts()
+	t.Errorf("unexpected hosts after the grace period: %v", hosts)
+}
@@ -0,0 +1,109 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// ErrUnexpectedCluster is the error returned when the client is connected to a cluster other than the
+// expected one, like a production gateway pointed to the staging etcd
+var ErrUnexpectedCluster = fmt.Errorf("unexpected etcd cluster")
+
+// ClusterIdentifier is implemented by the clients able to report the id of the cluster they are
+// connected to. Only the v3 clients implement it.
+type ClusterIdentifier interface {
+	ClusterID() (uint64, error)
+}
+
+// UnexpectedClusterError is the ErrUnexpectedCluster returned along with the ids involved, so
+// errors.Is(err, ErrUnexpectedCluster) still holds
+type UnexpectedClusterError struct {
+	Expected uint64
+	Actual   uint64
+}
+
+// Error implements the error interface
+func (e *UnexpectedClusterError) Error() string {
+	return fmt.Sprintf("%s: connected to %s, expected %s", ErrUnexpectedCluster.Error(), formatID(e.Actual), formatID(e.Expected))
+}
+
+// Unwrap returns ErrUnexpectedCluster
+func (*UnexpectedClusterError) Unwrap() error {
+	return ErrUnexpectedCluster
+}
+
+// expectedCluster is the cluster a client must be connected to, declared with expected_cluster_id
+type expectedCluster struct {
+	id     uint64
+	strict bool
+}
+
+// parseExpectedCluster parses the expected_cluster_id and strict_cluster_id entries of the config. The
+// id is written in hexadecimal, as printed by etcdctl, so it is not rounded by the JSON parsers.
+func parseExpectedCluster(cfg map[string]interface{}, path string) (expectedCluster, error) {
+	o, ok := cfg["expected_cluster_id"]
+	if !ok {
+		return expectedCluster{}, nil
+	}
+	s, ok := o.(string)
+	if !ok {
+		return expectedCluster{}, badConfig(path + ".expected_cluster_id")
+	}
+	id, err := strconv.ParseUint(s, 16, 64)
+	if err != nil || id == 0 {
+		return expectedCluster{}, badConfig(path + ".expected_cluster_id")
+	}
+	strict, _ := cfg["strict_cluster_id"].(bool)
+	return expectedCluster{id: id, strict: strict}, nil
+}
+
+// verifyCluster compares the id of the cluster the client is connected to with the expected one. A
+// different cluster is logged and published as the MetricUnexpectedCluster gauge, unless strict is
+// set, in which case the error is returned. The clients not implementing ClusterIdentifier and the
+// clusters not answering are not checked.
+func verifyCluster(c Client, expected expectedCluster) error {
+	if expected.id == 0 {
+		return nil
+	}
+	ci, ok := c.(ClusterIdentifier)
+	if !ok {
+		return nil
+	}
+	id, err := ci.ClusterID()
+	if err != nil {
+		getLogger().Warning("etcd: unable to check the cluster id:", "expected="+formatID(expected.id), "error="+err.Error())
+		return nil
+	}
+	if id == expected.id {
+		return nil
+	}
+	err = &UnexpectedClusterError{Expected: expected.id, Actual: id}
+	if expected.strict {
+		return err
+	}
+	setMetric(MetricUnexpectedCluster, 1)
+	getLogger().Error("etcd:", err.Error())
+	return nil
+}
+
+// ClusterID implements the etcd ClusterIdentifier interface. The id reported by the first endpoint
+// answering is returned.
+func (c *clientv3) ClusterID() (uint64, error) {
+	if c.client == nil {
+		return 0, ErrNilClient
+	}
+	var err error
+	for _, endpoint := range c.client.Endpoints() {
+		ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+		var resp *etcdv3.StatusResponse
+		resp, err = c.client.Status(ctx, endpoint)
+		cancel()
+		if err == nil && resp.Header != nil {
+			return resp.Header.ClusterId, nil
+		}
+	}
+	return 0, err
+}
@@ -0,0 +1,61 @@
+package etcd
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type dummyClusterClient struct {
+	dummyClient
+	id  uint64
+	err error
+}
+
+func (d dummyClusterClient) ClusterID() (uint64, error) { return d.id, d.err }
+
+func TestVerifyCluster(t *testing.T) {
+	l := &dummyLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+	defer setMetric(MetricUnexpectedCluster, 0)
+
+	expected := expectedCluster{id: 0xcafe, strict: true}
+	if err := verifyCluster(dummyClusterClient{id: 0xcafe}, expected); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verifyCluster(dummyClusterClient{err: errors.New("unavailable")}, expected); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verifyCluster(dummyClient{}, expected); err != nil {
+		t.Errorf("the clients not reporting their cluster should not be checked: %v", err)
+	}
+	err := verifyCluster(dummyClusterClient{id: 0xf00d}, expected)
+	if ue, ok := err.(*UnexpectedClusterError); !ok || ue.Actual != 0xf00d || ue.Expected != 0xcafe || !errors.Is(err, ErrUnexpectedCluster) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	expected.strict = false
+	if err := verifyCluster(dummyClusterClient{id: 0xf00d}, expected); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if v := Metrics()[MetricUnexpectedCluster]; v != 1 {
+		t.Errorf("unexpected gauge: %v", v)
+	}
+}
+
+func TestParseExpectedCluster(t *testing.T) {
+	cluster, err := parseExpectedCluster(map[string]interface{}{"expected_cluster_id": "cdf818194e3a8c32", "strict_cluster_id": true}, Namespace)
+	if err != nil || cluster.id != 0xcdf818194e3a8c32 || !cluster.strict {
+		t.Errorf("unexpected cluster: %+v %v", cluster, err)
+	}
+	if cluster, err := parseExpectedCluster(map[string]interface{}{}, Namespace); err != nil || cluster.id != 0 {
+		t.Errorf("unexpected cluster: %+v %v", cluster, err)
+	}
+	for _, v := range []interface{}{1234.0, "production", "0"} {
+		_, err := parseExpectedCluster(map[string]interface{}{"expected_cluster_id": v}, Namespace)
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != Namespace+".expected_cluster_id" {
+			t.Errorf("unexpected error for %v: %v", v, err)
+		}
+	}
+}
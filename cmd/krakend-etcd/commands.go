@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+	"github.com/devopsfaith/krakend/config"
+)
+
+func list(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("list")
+	defaultScheme := fs.String("default-scheme", "", "Scheme added to the hosts without one")
+	defaultPort := fs.String("default-port", "", "Port added to the hosts without one")
+	hostSource := fs.String("host-source", "", "Source of the hosts: value or key_suffix")
+	entryFormat := fs.String("entry-format", "", "Format of the entries: raw or json")
+	filter := fs.String("filter", "", "Glob pattern the last segment of the keys must match")
+	keys := fs.Bool("keys", false, "Print every key under the prefixes along with the hosts decoded from it")
+	fs.Parse(args)
+
+	cfg, err := conn.serviceConfig()
+	if err != nil {
+		return err
+	}
+	c, err := conn.client(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	backends := etcdBackends(cfg)
+	if fs.NArg() > 0 {
+		backends = []*config.Backend{}
+		for _, prefix := range fs.Args() {
+			backends = append(backends, &config.Backend{
+				Host: []string{prefix},
+				ExtraConfig: config.ExtraConfig{
+					etcd.Namespace: map[string]interface{}{
+						"default_scheme": *defaultScheme,
+						"default_port":   *defaultPort,
+						"options": map[string]interface{}{
+							"host_source":  *hostSource,
+							"entry_format": *entryFormat,
+							"filter":       *filter,
+						},
+					},
+				},
+			})
+		}
+	}
+
+	if *keys {
+		return listKeys(c, etcd.ClientOptions{HostSource: *hostSource, EntryFormat: *entryFormat, Filter: *filter}, backends)
+	}
+
+	for _, b := range backends {
+		s, err := etcd.NewBackendSubscriber(ctx, c, b)
+		if err != nil {
+			fmt.Printf("%v: %s\n", b.Host, err.Error())
+			continue
+		}
+		hosts, meta, _ := s.HostsWithMeta()
+		header := etcd.ResponseHeader{ClusterID: meta.ClusterID, MemberID: meta.MemberID, Revision: meta.Revision}
+		fmt.Printf("%s (%d hosts, %s)\n", b.Host[0], len(hosts), header)
+		for _, h := range hosts {
+			fmt.Printf("\t%s\n", h.URL)
+		}
+	}
+	return nil
+}
+
+// listKeys prints the entries of the prefixes of the backends, along with the hosts decoded from each one
+// with the options
+func listKeys(c etcd.Client, options etcd.ClientOptions, backends []*config.Backend) error {
+	kc, ok := c.(etcd.KeyValueClient)
+	if !ok {
+		return fmt.Errorf("the client is not able to list the keys")
+	}
+	for _, b := range backends {
+		raw, err := kc.GetKeyValues(b.Host[0])
+		if err != nil {
+			fmt.Printf("%v: %s\n", b.Host, err.Error())
+			continue
+		}
+		kvs := etcd.DecodeKeyValues(options, raw)
+		fmt.Printf("%s (%d keys)\n", b.Host[0], len(kvs))
+		for _, kv := range kvs {
+			hosts := "-"
+			if len(kv.Hosts) > 0 {
+				hosts = strings.Join(kv.Hosts, ", ")
+			}
+			fmt.Printf("\t%s\t%s\n", kv.Key, hosts)
+		}
+	}
+	return nil
+}
+
+func register(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("register")
+	ttl := fs.Duration("ttl", 0, "Time to live of the entry. Zero means no expiration")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: krakend-etcd register [flags] <key> <value>")
+	}
+
+	r, err := conn.registrar(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Register(fs.Arg(0), fs.Arg(1), *ttl)
+}
+
+func deregister(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("deregister")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: krakend-etcd deregister [flags] <key>")
+	}
+
+	r, err := conn.registrar(ctx)
+	if err != nil {
+		return err
+	}
+	return r.Deregister(fs.Arg(0))
+}
+
+func maintenance(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("maintenance")
+	restore := fs.Bool("clear", false, "Put the host back in rotation")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: krakend-etcd maintenance [flags] <key>")
+	}
+
+	r, err := conn.registrar(ctx)
+	if err != nil {
+		return err
+	}
+	if *restore {
+		return etcd.ClearMaintenance(r, fs.Arg(0))
+	}
+	return etcd.SetMaintenance(r, fs.Arg(0))
+}
+
+func validate(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("validate")
+	fs.Parse(args)
+
+	if *conn.configFile == "" {
+		return fmt.Errorf("usage: krakend-etcd validate -c <config file>")
+	}
+
+	cfg, err := conn.serviceConfig()
+	if err != nil {
+		return err
+	}
+	c, err := conn.client(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	report := etcd.Verify(c, cfg)
+	for _, p := range report {
+		switch {
+		case p.Err != nil:
+			fmt.Printf("KO\t%s: %s\n", p.Prefix, p.Err.Error())
+		case len(p.Hosts) == 0:
+			fmt.Printf("KO\t%s: no hosts\n", p.Prefix)
+		default:
+			fmt.Printf("OK\t%s: %d hosts\n", p.Prefix, len(p.Hosts))
+		}
+	}
+
+	ns, _ := cfg.ExtraConfig[etcd.Namespace].(map[string]interface{})
+	registrationPrefix, _ := ns["registration_prefix"].(string)
+	acl := etcd.CheckACL(c, cfg, registrationPrefix)
+	for _, e := range acl.Denied() {
+		fmt.Printf("DENIED\t%s (%s): %s\n", e.Prefix, e.Access, e.Err.Error())
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d prefixes failed the validation", len(failed))
+	}
+	if denied := acl.Denied(); len(denied) > 0 {
+		return fmt.Errorf("%d prefixes are not accessible with the configured credentials", len(denied))
+	}
+	return nil
+}
+
+func simulate(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("simulate")
+	fs.Parse(args)
+
+	cfg, err := conn.serviceConfig()
+	if err != nil {
+		return err
+	}
+	extra, err := conn.extraConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	var report etcd.Report
+	if fs.NArg() > 0 {
+		report, err = etcd.Simulate(ctx, extra, fs.Args())
+	} else {
+		cfg.ExtraConfig[etcd.Namespace] = extra[etcd.Namespace]
+		report, err = etcd.SimulateService(ctx, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range report {
+		if p.Err != nil {
+			fmt.Printf("%s: %s\n", p.Prefix, p.Err.Error())
+			continue
+		}
+		fmt.Printf("%s (%d hosts)\n", p.Prefix, len(p.Hosts))
+		for _, h := range p.Hosts {
+			fmt.Printf("\t%s\n", h)
+		}
+	}
+	return report.Err()
+}
+
+func status(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("status")
+	fs.Parse(args)
+
+	cfg, err := conn.serviceConfig()
+	if err != nil {
+		return err
+	}
+	c, err := conn.client(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	infos, err := etcd.Inspect(c)
+	if err != nil {
+		return err
+	}
+	unhealthy := 0
+	for _, info := range infos {
+		if info.Name != "" {
+			fmt.Printf("%s\n", info.Name)
+		}
+		for _, e := range info.Endpoints {
+			if e.Err != nil {
+				fmt.Printf("KO\t%s: %s\n", e.Endpoint, e.Err.Error())
+				continue
+			}
+			state := "OK"
+			if len(e.Alarms) > 0 {
+				state = "KO"
+			}
+			leader := ""
+			if e.Leader {
+				leader = ", leader"
+			}
+			fmt.Printf("%s\t%s: version %s, db size %d bytes%s", state, e.Endpoint, e.Version, e.DBSize, leader)
+			if len(e.Alarms) > 0 {
+				fmt.Printf(", alarms %s", strings.Join(e.Alarms, ","))
+			}
+			fmt.Println()
+		}
+		if !info.Healthy() {
+			unhealthy++
+		}
+	}
+
+	if unhealthy > 0 {
+		return fmt.Errorf("%d clusters are not healthy", unhealthy)
+	}
+	return nil
+}
+
+func record(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("record")
+	output := fs.String("o", "", "Path of the file to write the events into")
+	duration := fs.Duration("duration", 0, "Time to record. The recording goes on until it is interrupted if it is zero")
+	fs.Parse(args)
+	if *output == "" {
+		return fmt.Errorf("usage: krakend-etcd record -c <config file> -o <output file> [-duration <duration>]")
+	}
+
+	cfg, err := conn.serviceConfig()
+	if err != nil {
+		return err
+	}
+	c, err := conn.client(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	recorder := etcd.NewRecorder(c, f)
+	backends := etcdBackends(cfg)
+	for _, b := range backends {
+		if _, err := etcd.NewBackendSubscriber(ctx, recorder, b); err != nil {
+			fmt.Printf("%v: %s\n", b.Host, err.Error())
+		}
+	}
+	fmt.Printf("recording %d backends into %s\n", len(backends), *output)
+	<-ctx.Done()
+	return nil
+}
+
+func migrate(ctx context.Context, args []string) error {
+	fs, conn := newFlagSet("migrate")
+	sourceMachines := fs.String("source-etcd", "", "Comma-separated list of the etcd servers to copy the entries from. Defaults to the destination ones")
+	sourceVersion := fs.String("source-version", "", "Version of the etcd client reading the entries (v2 or v3). Defaults to the destination one")
+	sourceFormat := fs.String("source-format", "", "Format of the entries to copy: raw or json")
+	format := fs.String("format", "", "Format of the written entries: raw or json. The values are copied as they are if empty")
+	flatten := fs.Bool("flatten", false, "Join the segments of the relative paths of the keys with dashes")
+	ttl := fs.Duration("ttl", 0, "Time to live of the written entries")
+	dryRun := fs.Bool("dry-run", false, "Print the entries to write without writing them")
+	verify := fs.Bool("verify", true, "Read the written entries, checking their values")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: krakend-etcd migrate [flags] <from prefix> <to prefix>")
+	}
+
+	cfg, err := conn.serviceConfig()
+	if err != nil {
+		return err
+	}
+	dst, err := conn.client(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	r, ok := dst.(etcd.Registrar)
+	if !ok {
+		return fmt.Errorf("the etcd client does not support writes")
+	}
+	src := dst
+	if *sourceMachines != "" || *sourceVersion != "" {
+		machines := *conn.machines
+		if *sourceMachines != "" {
+			machines = *sourceMachines
+		}
+		version := *conn.version
+		if *sourceVersion != "" {
+			version = *sourceVersion
+		}
+		source := connection{configFile: conn.configFile, machines: &machines, version: &version, timeout: conn.timeout}
+		if src, err = source.client(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	kv, ok := src.(etcd.KeyValueClient)
+	if !ok {
+		return etcd.ErrNotVerifiable
+	}
+
+	report, err := etcd.Migrate(kv, r, etcd.Migration{
+		From:    fs.Arg(0),
+		To:      fs.Arg(1),
+		Flatten: *flatten,
+		Source:  etcd.ClientOptions{EntryFormat: *sourceFormat},
+		Format:  *format,
+		TTL:     *ttl,
+		DryRun:  *dryRun,
+		Verify:  *verify && !*dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range report {
+		if e.Err != nil {
+			fmt.Printf("KO\t%s -> %s: %s\n", e.From, e.To, e.Err.Error())
+			continue
+		}
+		fmt.Printf("OK\t%s -> %s: %s\n", e.From, e.To, e.Value)
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d entries could not be migrated", len(failed))
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Command krakend-etcd inspects and seeds the etcd discovery tree used by the KrakenD gateways.
+//
+//	$ krakend-etcd list -c krakend.json
+//	$ krakend-etcd list -etcd http://127.0.0.1:2379 -default-scheme http /services/api
+//	$ krakend-etcd register -etcd http://127.0.0.1:2379 -ttl 30s /services/api/1 http://10.0.0.1:8080
+//	$ krakend-etcd deregister -etcd http://127.0.0.1:2379 /services/api/1
+//	$ krakend-etcd maintenance -etcd http://127.0.0.1:2379 -version v3 /services/api/1
+//	$ krakend-etcd validate -c krakend.json
+//	$ krakend-etcd simulate -c proposed.json
+//	$ krakend-etcd status -c krakend.json
+//	$ krakend-etcd record -c krakend.json -o events.jsonl -duration 1h
+//	$ krakend-etcd migrate -etcd http://127.0.0.1:2379 -version v3 -source-version v2 -format json -dry-run /services/api /services/api-v3
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+	"github.com/devopsfaith/krakend/config"
+)
+
+const usage = `Usage: krakend-etcd <command> [flags] [args]
+
+Commands:
+  list        print the hosts of the given prefixes (or of all the etcd backends in the config) as the gateway sees them
+  register    store a test host under the given key, with an optional ttl
+  deregister  remove the given key
+  maintenance remove the host stored under the given key from rotation (or put it back with -clear)
+  validate    check the etcd config of a krakend.json file against the live cluster
+  simulate    print the hosts a proposed krakend.json file would resolve, without serving it
+  status      print the version, db size and alarms (NOSPACE, CORRUPT) of every endpoint (v3 only)
+  record      watch the etcd backends in the config, writing their changes into a file to replay them later
+  migrate     copy the entries of a prefix into another one, transforming their layout
+
+Run 'krakend-etcd <command> -h' for the flags of each command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "list":
+		err = list(ctx, args)
+	case "register":
+		err = register(ctx, args)
+	case "deregister":
+		err = deregister(ctx, args)
+	case "maintenance":
+		err = maintenance(ctx, args)
+	case "validate":
+		err = validate(ctx, args)
+	case "simulate":
+		err = simulate(ctx, args)
+	case "status":
+		err = status(ctx, args)
+	case "record":
+		err = record(ctx, args)
+	case "migrate":
+		err = migrate(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err.Error())
+		cancel()
+		os.Exit(1)
+	}
+}
+
+// connection holds the flags shared by all the commands
+type connection struct {
+	configFile *string
+	machines   *string
+	version    *string
+	timeout    *time.Duration
+}
+
+func newFlagSet(name string) (*flag.FlagSet, connection) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, connection{
+		configFile: fs.String("c", "", "Path to the KrakenD configuration filename"),
+		machines:   fs.String("etcd", "", "Comma-separated list of etcd servers (with port and schema). It overrides the ones in the config"),
+		version:    fs.String("version", "", "Version of the etcd client (v2 or v3). It overrides the one in the config"),
+		timeout:    fs.Duration("timeout", 0, "Timeout of every request to etcd. It overrides the one in the config"),
+	}
+}
+
+// serviceConfig returns the parsed config file, or an empty one if no file was defined
+func (c connection) serviceConfig() (config.ServiceConfig, error) {
+	if *c.configFile == "" {
+		return config.ServiceConfig{ExtraConfig: config.ExtraConfig{}}, nil
+	}
+	cfg, err := config.NewParser().Parse(*c.configFile)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.ExtraConfig == nil {
+		cfg.ExtraConfig = config.ExtraConfig{}
+	}
+	return cfg, nil
+}
+
+// client returns an etcd client built from the service config, overridden by the connection flags
+func (c connection) client(ctx context.Context, cfg config.ServiceConfig) (etcd.Client, error) {
+	extra, err := c.extraConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return etcd.New(ctx, extra)
+}
+
+// extraConfig returns the etcd config of the service config, overridden by the connection flags
+func (c connection) extraConfig(cfg config.ServiceConfig) (config.ExtraConfig, error) {
+	ns, _ := cfg.ExtraConfig[etcd.Namespace].(map[string]interface{})
+	if ns == nil {
+		if *c.configFile != "" && *c.machines == "" {
+			return nil, etcd.ErrNoConfig
+		}
+		ns = map[string]interface{}{}
+	}
+
+	if *c.machines != "" {
+		machines := []interface{}{}
+		for _, m := range strings.Split(*c.machines, ",") {
+			machines = append(machines, strings.TrimSpace(m))
+		}
+		ns["machines"] = machines
+	}
+	if *c.version != "" {
+		ns["client_version"] = *c.version
+	}
+	if *c.timeout != 0 {
+		options, _ := ns["options"].(map[string]interface{})
+		if options == nil {
+			options = map[string]interface{}{}
+		}
+		options["header_timeout"] = c.timeout.String()
+		ns["options"] = options
+	}
+
+	return config.ExtraConfig{etcd.Namespace: ns}, nil
+}
+
+// registrar returns the client as an etcd Registrar
+func (c connection) registrar(ctx context.Context) (etcd.Registrar, error) {
+	cfg, err := c.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := c.client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := client.(etcd.Registrar)
+	if !ok {
+		return nil, fmt.Errorf("the etcd client does not support writes")
+	}
+	return r, nil
+}
+
+// etcdBackends returns all the backends of the service config using the etcd subscriber
+func etcdBackends(cfg config.ServiceConfig) []*config.Backend {
+	backends := []*config.Backend{}
+	for _, e := range cfg.Endpoints {
+		for _, b := range e.Backend {
+			if b.SD == etcd.SDName {
+				backends = append(backends, b)
+			}
+		}
+	}
+	return backends
+}
@@ -0,0 +1,115 @@
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Host is a discovered instance
+type Host struct {
+	// URL is the address of the instance, as used by the proxy. e.g. "http://10.0.0.1:8080"
+	URL string
+	// Metadata contains the extra fields of the record describing the instance, if any
+	Metadata map[string]interface{}
+	// Maintenance is true if the instance must be removed from rotation
+	Maintenance bool
+	// Priority is the tier of the instance. The subscribers only use the hosts with the lowest
+	// priority available, so zero (the default) is the primary tier.
+	Priority int
+	// TLS holds the hints to verify the certificate of the instance, if its record declares them
+	TLS *HostTLS
+}
+
+// Codec decodes the value of an entry into the hosts it describes
+type Codec interface {
+	Decode([]byte) ([]Host, error)
+}
+
+// CodecFunc is a function implementing the Codec interface
+type CodecFunc func([]byte) ([]Host, error)
+
+// Decode implements the Codec interface
+func (f CodecFunc) Decode(b []byte) ([]Host, error) { return f(b) }
+
+// ErrBadRecord is the error returned by the codecs when a record does not describe a host
+var ErrBadRecord = errors.New("the record does not contain a host")
+
+var (
+	codecs = map[string]Codec{
+		EntryFormatRaw:      CodecFunc(decodeRaw),
+		EntryFormatJSON:     CodecFunc(decodeJSON),
+		EntryFormatYAML:     CodecFunc(decodeYAML),
+		EntryFormatProtobuf: CodecFunc(decodeProtobuf),
+		EntryFormatGoMicro:  CodecFunc(decodeGoMicro),
+		EntryFormatSkyDNS:   CodecFunc(decodeSkyDNS),
+	}
+	codecsMutex = &sync.RWMutex{}
+)
+
+// RegisterCodec registers a codec for the entry format with the given name, replacing any previous one.
+// It allows to support custom registration formats without forking the clients.
+func RegisterCodec(name string, c Codec) {
+	codecsMutex.Lock()
+	codecs[name] = c
+	codecsMutex.Unlock()
+}
+
+func getCodec(name string) (Codec, bool) {
+	if name == "" {
+		name = EntryFormatRaw
+	}
+	codecsMutex.RLock()
+	c, ok := codecs[name]
+	codecsMutex.RUnlock()
+	return c, ok
+}
+
+func decodeRaw(b []byte) ([]Host, error) {
+	return []Host{{URL: string(b)}}, nil
+}
+
+// record is the description of a host shared by the json, yaml and protobuf entry formats
+type record struct {
+	Host        string                 `json:"host"`
+	Port        json.Number            `json:"port"`
+	Scheme      string                 `json:"scheme"`
+	Metadata    map[string]interface{} `json:"metadata"`
+	Maintenance bool                   `json:"maintenance"`
+	Priority    json.Number            `json:"priority"`
+	TLS         *HostTLS               `json:"tls"`
+}
+
+func (r record) toHost() (Host, error) {
+	if r.Host == "" {
+		return Host{}, ErrBadRecord
+	}
+	host, _ := splitAuthority(r.Host)
+	host = joinAuthority(host, r.Port.String())
+	if r.Scheme != "" {
+		host = fmt.Sprintf("%s://%s", r.Scheme, host)
+	}
+	priority := 0
+	if r.Priority != "" {
+		p, err := strconv.Atoi(r.Priority.String())
+		if err != nil {
+			return Host{}, err
+		}
+		priority = p
+	}
+	return Host{URL: host, Metadata: r.Metadata, Maintenance: r.Maintenance, Priority: priority, TLS: r.TLS}, nil
+}
+
+func decodeJSON(b []byte) ([]Host, error) {
+	var r record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	h, err := r.toHost()
+	if err != nil {
+		return nil, err
+	}
+	return []Host{h}, nil
+}
@@ -0,0 +1,153 @@
+package etcd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	hosts, err := decodeYAML([]byte(`---
+# registered by the deployer
+host: "10.0.0.1"
+port: 8080 # the main listener
+scheme: http
+metadata:
+  zone: eu-west-1a
+  version: '1.2.3'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Host{{
+		URL:      "http://10.0.0.1:8080",
+		Metadata: map[string]interface{}{"zone": "eu-west-1a", "version": "1.2.3"},
+	}}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+
+	for _, doc := range []string{
+		"port: 8080",
+		"host 10.0.0.1",
+		"  host: 10.0.0.1",
+	} {
+		if _, err := decodeYAML([]byte(doc)); err == nil {
+			t.Errorf("expecting an error decoding %q", doc)
+		}
+	}
+}
+
+// encodeHostMessage encodes a protobuf Host message
+func encodeHostMessage(host string, port uint64, scheme string, metadata [][2]string) []byte {
+	b := []byte{}
+	b = appendProtobufBytes(b, 1, []byte(host))
+	b = append(b, 2<<3)
+	for port >= 0x80 {
+		b = append(b, byte(port)|0x80)
+		port >>= 7
+	}
+	b = append(b, byte(port))
+	b = appendProtobufBytes(b, 3, []byte(scheme))
+	for _, kv := range metadata {
+		entry := appendProtobufBytes(appendProtobufBytes(nil, 1, []byte(kv[0])), 2, []byte(kv[1]))
+		b = appendProtobufBytes(b, 4, entry)
+	}
+	// unknown fixed64 field
+	b = append(b, 5<<3|1, 1, 2, 3, 4, 5, 6, 7, 8)
+	return b
+}
+
+func appendProtobufBytes(b []byte, field byte, data []byte) []byte {
+	b = append(b, field<<3|2, byte(len(data)))
+	return append(b, data...)
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	msg := encodeHostMessage("2001:db8::1", 8443, "https", [][2]string{{"zone", "eu"}})
+	hosts, err := decodeProtobuf(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Host{{
+		URL:      "https://[2001:db8::1]:8443",
+		Metadata: map[string]interface{}{"zone": "eu"},
+	}}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+
+	for _, msg := range [][]byte{
+		msg[:len(msg)-3],
+		{0x0a, 0x05, 'a'},
+		{0x0b},
+		encodeHostMessage("", 80, "", nil),
+	} {
+		if _, err := decodeProtobuf(msg); err == nil {
+			t.Errorf("expecting an error decoding %v", msg)
+		}
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec("csv", CodecFunc(func(b []byte) ([]Host, error) {
+		hosts := []Host{}
+		for _, h := range strings.Split(string(b), ",") {
+			hosts = append(hosts, Host{URL: h})
+		}
+		return hosts, nil
+	}))
+	defer func() {
+		codecsMutex.Lock()
+		delete(codecs, "csv")
+		codecsMutex.Unlock()
+	}()
+
+	urls, ok := decodeEntryURLs(ClientOptions{EntryFormat: "csv"}, "/services/api/1", "10.0.0.1,10.0.0.2")
+	if !ok || !reflect.DeepEqual(urls, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("unexpected result: %v, %v", urls, ok)
+	}
+
+	if _, ok := decodeEntryURLs(ClientOptions{EntryFormat: "unknown"}, "/services/api/1", "10.0.0.1"); ok {
+		t.Error("the entries with an unknown format should be discarded")
+	}
+}
+
+func TestDecodeGoMicro(t *testing.T) {
+	hosts, err := decodeGoMicro([]byte(`{
+		"name": "api",
+		"version": "1.0.0",
+		"metadata": {"team": "payments", "zone": "eu"},
+		"endpoints": [],
+		"nodes": [
+			{"id": "api-1", "address": "10.0.0.1:8080", "metadata": {"protocol": "http", "zone": "eu-west-1a"}},
+			{"id": "api-2", "address": "10.0.0.2", "port": 9090}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Host{
+		{
+			URL:      "http://10.0.0.1:8080",
+			Metadata: map[string]interface{}{"team": "payments", "zone": "eu-west-1a", "protocol": "http", "id": "api-1"},
+		},
+		{
+			URL:      "10.0.0.2:9090",
+			Metadata: map[string]interface{}{"team": "payments", "zone": "eu", "id": "api-2"},
+		},
+	}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+
+	for _, doc := range []string{
+		`{"name": "api", "nodes": []}`,
+		`{"name": "api", "nodes": [{"id": "api-1"}]}`,
+		`{"name": "api"`,
+	} {
+		if _, err := decodeGoMicro([]byte(doc)); err == nil {
+			t.Errorf("expecting an error decoding %q", doc)
+		}
+	}
+}
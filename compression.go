@@ -0,0 +1,101 @@
+package etcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+const (
+	// ValueEncodingAuto makes the clients detect the compressed values by their magic bytes. This is the default.
+	ValueEncodingAuto = "auto"
+	// ValueEncodingNone disables the decompression of the values
+	ValueEncodingNone = "none"
+	// ValueEncodingGzip makes the clients decompress every value with gzip
+	ValueEncodingGzip = "gzip"
+
+	// maxDecompressedSize limits the size of a decompressed value
+	maxDecompressedSize = 10 << 20
+)
+
+// Decompressor decompresses a value stored in etcd
+type Decompressor func([]byte) ([]byte, error)
+
+type compression struct {
+	magic      []byte
+	decompress Decompressor
+}
+
+var (
+	compressions = map[string]compression{
+		ValueEncodingGzip: {[]byte{0x1f, 0x8b}, gunzip},
+	}
+	compressionsMutex = &sync.RWMutex{}
+)
+
+// RegisterDecompressor registers a decompressor for the value encoding with the given name. If the magic
+// bytes are not empty, the values starting with them are decompressed automatically. It allows to support
+// other formats without adding their dependencies to this package. e.g. zstd, with the magic bytes
+// 0x28 0xb5 0x2f 0xfd
+func RegisterDecompressor(name string, magic []byte, d Decompressor) {
+	compressionsMutex.Lock()
+	compressions[name] = compression{magic, d}
+	compressionsMutex.Unlock()
+}
+
+// decompressValue returns the decompressed value, according to the value encoding
+func decompressValue(encoding, value string) (string, error) {
+	if encoding == ValueEncodingNone {
+		return value, nil
+	}
+
+	compressionsMutex.RLock()
+	defer compressionsMutex.RUnlock()
+
+	if encoding != "" && encoding != ValueEncodingAuto {
+		c, ok := compressions[encoding]
+		if !ok {
+			return "", fmt.Errorf("unknown value encoding: %s", encoding)
+		}
+		return decompress(c.decompress, value)
+	}
+
+	for _, c := range compressions {
+		if len(c.magic) > 0 && bytes.HasPrefix([]byte(value), c.magic) {
+			return decompress(c.decompress, value)
+		}
+	}
+	return value, nil
+}
+
+func decompress(d Decompressor, value string) (string, error) {
+	b, err := d([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// readLimited reads the whole reader, failing if the content exceeds the maxDecompressedSize
+func readLimited(r io.Reader) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDecompressedSize {
+		return nil, fmt.Errorf("the decompressed value exceeds %d bytes", maxDecompressedSize)
+	}
+	return b, nil
+}
@@ -0,0 +1,84 @@
+package etcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func gzipValue(t *testing.T, value string) string {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write([]byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+func TestDecompressValue(t *testing.T) {
+	record := `{"host":"10.0.0.1","port":8080}`
+	compressed := gzipValue(t, record)
+
+	for _, tc := range []struct {
+		encoding string
+		value    string
+		expected string
+		err      bool
+	}{
+		{"", compressed, record, false},
+		{ValueEncodingAuto, compressed, record, false},
+		{ValueEncodingGzip, compressed, record, false},
+		{ValueEncodingNone, compressed, compressed, false},
+		{"", record, record, false},
+		{ValueEncodingGzip, record, "", true},
+		{"unknown", record, "", true},
+	} {
+		v, err := decompressValue(tc.encoding, tc.value)
+		if (err != nil) != tc.err {
+			t.Errorf("unexpected error with the %s encoding: %v", tc.encoding, err)
+			continue
+		}
+		if v != tc.expected {
+			t.Errorf("unexpected value with the %s encoding: %s", tc.encoding, v)
+		}
+	}
+
+	if _, err := decompressValue(ValueEncodingGzip, gzipValue(t, strings.Repeat("a", maxDecompressedSize+1))); err == nil {
+		t.Error("expecting an error for oversized values")
+	}
+}
+
+func TestRegisterDecompressor(t *testing.T) {
+	RegisterDecompressor("reverse", []byte("!!"), func(b []byte) ([]byte, error) {
+		r := make([]byte, 0, len(b))
+		for i := len(b) - 1; i > 1; i-- {
+			r = append(r, b[i])
+		}
+		return r, nil
+	})
+	defer func() {
+		compressionsMutex.Lock()
+		delete(compressions, "reverse")
+		compressionsMutex.Unlock()
+	}()
+
+	if v, err := decompressValue("", "!!tsoh"); err != nil || v != "host" {
+		t.Errorf("unexpected result: %s, %v", v, err)
+	}
+	if v, err := decompressValue("reverse", "!!tsoh"); err != nil || v != "host" {
+		t.Errorf("unexpected result: %s, %v", v, err)
+	}
+}
+
+func TestDecodeEntry_compressed(t *testing.T) {
+	value := gzipValue(t, `{"host":"10.0.0.1","port":8080,"scheme":"http"}`)
+	host, ok := decodeURL(ClientOptions{EntryFormat: EntryFormatJSON}, "/services/api/1", value)
+	if !ok || host != "http://10.0.0.1:8080" {
+		t.Errorf("unexpected result: %s, %v", host, ok)
+	}
+	if _, ok := decodeURL(ClientOptions{ValueEncoding: ValueEncodingGzip}, "/services/api/1", "10.0.0.1"); ok {
+		t.Error("the entry should be discarded")
+	}
+}
@@ -2,7 +2,9 @@ package etcd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/devopsfaith/krakend/config"
@@ -29,18 +31,178 @@ type Client interface {
 	WatchPrefix(prefix string, ch chan struct{})
 }
 
+// HostsClient is a Client able to return the decoded hosts stored under a prefix, along with their
+// metadata and priority.
+type HostsClient interface {
+	Client
+	// GetHosts queries the given prefix in etcd and returns the hosts described by all the keys
+	// found, recursively, underneath that prefix.
+	GetHosts(prefix string) ([]Host, error)
+}
+
+// RevisionClient is a HostsClient also reporting the revision of the cluster the hosts were read at
+type RevisionClient interface {
+	HostsClient
+	// GetHostsWithRevision returns the same hosts than GetHosts, along with the revision of the
+	// cluster (the index, for the v2 clients) they were read at.
+	GetHostsWithRevision(prefix string) ([]Host, int64, error)
+}
+
+// CountClient is a Client able to return the number of keys stored under a prefix without reading them
+type CountClient interface {
+	Client
+	// CountEntries returns the number of keys found, recursively, underneath the given prefix
+	CountEntries(prefix string) (int64, error)
+}
+
+// Registrar is implemented by the clients able to write entries into etcd.
+type Registrar interface {
+	// Register stores the value under the given key. If the ttl is not zero, the entry will
+	// be removed by etcd once it expires.
+	Register(key, value string, ttl time.Duration) error
+
+	// Deregister removes the given key from etcd.
+	Deregister(key string) error
+}
+
+// ScopedClient is a Client able to return a copy of itself with some overridden options. Only the
+// options related to the reads (HeaderTimeoutPerRequest, HostSource, Filter, EntryFormat,
+// EntrySchema, Consistency, ValueEncoding, LeaseMargin, MultiValue, PageSize, MaxValueBytes,
+// MaxEntriesPerPrefix and LimitPolicy) can be overridden, since the copy
+// shares the connection with the original client.
+type ScopedClient interface {
+	Client
+	WithOptions(ClientOptions) Client
+}
+
 // ClientOptions defines options for the etcd client. All values are optional.
 // If any duration is not specified, a default of 3 seconds will be used.
 type ClientOptions struct {
 	Cert                    string
 	Key                     string
 	CACert                  string
+	Username                string
+	Password                string
+	SPIFFESocket            string
+	SPIFFEServerID          string
+	TLSProvider             TLSProvider
+	Dialer                  Dialer
 	DialTimeout             time.Duration
 	DialKeepAlive           time.Duration
 	DialKeepAliveTimeout    time.Duration
 	HeaderTimeoutPerRequest time.Duration
+	HostSource              string
+	Filter                  string
+	EntryFormat             string
+	Consistency             string
+	WatchRoot               string
+	ValueEncoding           string
+	EntrySchema             *Schema
+	LeaseMargin             time.Duration
+	IgnoreTouches           bool
+	MaxWatchers             ConcurrencyLimit
+	MaxConcurrentGets       ConcurrencyLimit
+	// MultiValue expands the values holding several entries into several hosts: JSON arrays of urls
+	// (or of records, with the json entry format) and comma separated lists of urls
+	MultiValue bool
+	// PageSize is the maximum number of keys returned by every request of the v3 reads. The larger
+	// prefixes are read in several pages, all of them at the revision of the first one. Zero reads
+	// the whole prefix at once.
+	PageSize int
+	// PrefixAllowlist restricts the prefixes the client can read and watch to the ones starting with any
+	// of its entries, whatever the backends declare. The scoped copies keep it. Empty allows all of them.
+	PrefixAllowlist []string
+	// MaxValueBytes is the maximum size of the values read, in bytes. Zero does not limit them.
+	MaxValueBytes int
+	// MaxEntriesPerPrefix is the maximum number of entries read from a prefix. Zero does not limit them.
+	MaxEntriesPerPrefix int
+	// LimitPolicy is the LimitPolicyTruncate or LimitPolicyReject handling of the entries exceeding the
+	// MaxValueBytes or the MaxEntriesPerPrefix
+	LimitPolicy string
+	// settings are the ones declared in the extra config read by New. See clientSettings.
+	settings *clientSettings
 }
 
+// merge returns a copy of the options with the read related options overridden by the non zero
+// values of the received ones
+func (o ClientOptions) merge(override ClientOptions) ClientOptions {
+	if override.HeaderTimeoutPerRequest != 0 {
+		o.HeaderTimeoutPerRequest = override.HeaderTimeoutPerRequest
+	}
+	if override.HostSource != "" {
+		o.HostSource = override.HostSource
+	}
+	if override.Filter != "" {
+		o.Filter = override.Filter
+	}
+	if override.EntryFormat != "" {
+		o.EntryFormat = override.EntryFormat
+	}
+	if override.Consistency != "" {
+		o.Consistency = override.Consistency
+	}
+	if override.ValueEncoding != "" {
+		o.ValueEncoding = override.ValueEncoding
+	}
+	if override.EntrySchema != nil {
+		o.EntrySchema = override.EntrySchema
+	}
+	if override.LeaseMargin != 0 {
+		o.LeaseMargin = override.LeaseMargin
+	}
+	if override.MultiValue {
+		o.MultiValue = override.MultiValue
+	}
+	if override.PageSize != 0 {
+		o.PageSize = override.PageSize
+	}
+	if override.MaxValueBytes != 0 {
+		o.MaxValueBytes = override.MaxValueBytes
+	}
+	if override.MaxEntriesPerPrefix != 0 {
+		o.MaxEntriesPerPrefix = override.MaxEntriesPerPrefix
+	}
+	if override.LimitPolicy != "" {
+		o.LimitPolicy = override.LimitPolicy
+	}
+	return o
+}
+
+const (
+	// HostSourceValue makes the clients use the value stored under each key as the host. This is the default.
+	HostSourceValue = "value"
+	// HostSourceKeySuffix makes the clients use the last segment of each key as the host, ignoring its value.
+	// e.g. "/services/api/10.0.0.1:8080" will be resolved as "10.0.0.1:8080"
+	HostSourceKeySuffix = "key_suffix"
+
+	// EntryFormatRaw makes the clients use the entries as they are stored. This is the default.
+	EntryFormatRaw = "raw"
+	// EntryFormatJSON makes the clients decode every entry as a JSON record with the fields
+	// host, port, scheme and metadata. e.g. {"host": "10.0.0.1", "port": 8080, "scheme": "http"}
+	EntryFormatJSON = "json"
+	// EntryFormatYAML makes the clients decode every entry as a YAML record with the same fields
+	// than the JSON one
+	EntryFormatYAML = "yaml"
+	// EntryFormatProtobuf makes the clients decode every entry as a protobuf Host message. See
+	// decodeProtobuf for its definition.
+	EntryFormatProtobuf = "protobuf"
+	// EntryFormatGoMicro makes the clients decode every entry as a service record written by the
+	// go-micro etcd registry, returning a host for each of its nodes
+	EntryFormatGoMicro = "go-micro"
+	// EntryFormatSkyDNS makes the clients decode every entry as a SkyDNS service record
+	EntryFormatSkyDNS = "skydns"
+
+	// ConsistencyLinearizable makes the clients read the entries through the cluster quorum
+	ConsistencyLinearizable = "linearizable"
+	// ConsistencySerializable makes the clients read the entries from the local state of the
+	// contacted member, trading consistency for latency and availability
+	ConsistencySerializable = "serializable"
+	// ConsistencyFallback makes the clients read the entries through the cluster quorum, falling back to
+	// serializable reads while the linearizable ones fail, e.g. during the leader elections. The
+	// linearizable reads are tried again every DefaultFallbackPeriod and restored once they succeed.
+	ConsistencyFallback = "linearizable_fallback"
+)
+
 // Namespace is the key to use to store and access the custom config data
 const Namespace = "github_com/devopsfaith/krakend-etcd"
 
@@ -53,9 +215,48 @@ var (
 	ErrNoMachines = fmt.Errorf("unable to create the etcd client without a set of servers")
 	// ErrNilClient is the error to be nil client
 	ErrNilClient = fmt.Errorf("nil etcd client")
+	// ErrNoPrefix is the error to be returned when a backend does not declare the prefix to watch
+	ErrNoPrefix = fmt.Errorf("unable to create the etcd subscriber without a prefix")
+	// ErrBadPrefix is the error to be returned when a backend declares a prefix without a leading slash
+	ErrBadPrefix = fmt.Errorf("unable to create the etcd subscriber: the prefix must start with a slash")
+	// ErrNotInspectable is the error to be returned when the client is not able to report the health of its cluster
+	ErrNotInspectable = fmt.Errorf("the etcd client does not report the status of the cluster")
+	// ErrNotWriteCheckable is the error to be returned when the client is not able to check its write permissions
+	ErrNotWriteCheckable = fmt.Errorf("the etcd client does not check the write permissions")
 )
 
-// New creates an etcd client with the config extracted from the extra config param
+// ConfigError is the ErrBadConfig returned along with the path of the offending key, so
+// errors.Is(err, ErrBadConfig) still holds
+type ConfigError struct {
+	// Path is the dotted path of the key in the extra config, e.g. "github_com/devopsfaith/krakend-etcd.options.cert"
+	Path string
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: bad value at %s", ErrBadConfig.Error(), e.Path)
+}
+
+// Unwrap returns ErrBadConfig
+func (*ConfigError) Unwrap() error {
+	return ErrBadConfig
+}
+
+func badConfig(path string) error {
+	return &ConfigError{Path: path}
+}
+
+// withPath prefixes the path of the received error with the parent key, if it is a ConfigError
+func withPath(parent string, err error) error {
+	if ce, ok := err.(*ConfigError); ok {
+		return badConfig(parent + "." + ce.Path)
+	}
+	return err
+}
+
+// New creates an etcd client with the config extracted from the extra config param. If the config
+// declares a list of clusters, the returned client is a MultiClusterClient. If it declares a replay file,
+// the returned client is a ReplayClient reproducing the events recorded in it.
 func New(ctx context.Context, e config.ExtraConfig) (Client, error) {
 	v, ok := e[Namespace]
 	if !ok {
@@ -63,21 +264,133 @@ func New(ctx context.Context, e config.ExtraConfig) (Client, error) {
 	}
 	tmp, ok := v.(map[string]interface{})
 	if !ok {
-		return nil, ErrBadConfig
+		return nil, badConfig(Namespace)
 	}
-	machines, err := parseMachines(tmp)
+	version, err := parseVersion(tmp)
 	if err != nil {
 		return nil, err
 	}
-	version, err := parseVersion(tmp)
+	options, err := parseOptions(tmp)
+	if err != nil {
+		return nil, withPath(Namespace, err)
+	}
+
+	strict, _ := tmp["strict_version"].(bool)
+	cluster, err := parseExpectedCluster(tmp, Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// the logger is shared by the whole process, so its sampling is too
+	if o, ok := tmp["log_sampling"]; ok {
+		burst, period, err := parseLogSampling(o)
+		if err != nil {
+			return nil, err
+		}
+		SetLogSampling(burst, period)
+	}
+
+	settings, err := parseSettings(tmp)
+	if err != nil {
+		return nil, err
+	}
+	options.settings = settings
+
+	if o, ok := tmp["replay"]; ok {
+		c, err := parseReplay(ctx, o)
+		if err != nil {
+			return nil, err
+		}
+		c.settings = settings
+		return c, nil
+	}
+
+	if _, ok := tmp["clusters"]; ok {
+		return newMultiClusterClient(ctx, tmp, version, strict, cluster, options)
+	}
+
+	machines, err := parseMachines(tmp)
 	if err != nil {
 		return nil, err
 	}
+	return newClient(ctx, version, strict, cluster, machines, options)
+}
 
+// newClient creates the client for the version and checks the version of the servers and the id of
+// their cluster
+func newClient(ctx context.Context, version string, strict bool, cluster expectedCluster, machines []string, options ClientOptions) (Client, error) {
+	var c Client
+	var err error
 	if version == "v3" {
-		return NewClientV3(ctx, machines, parseOptions(tmp))
+		c, err = NewClientV3(ctx, machines, options)
+	} else {
+		c, err = NewClient(ctx, machines, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyVersion(c, version, strict); err != nil {
+		return nil, err
+	}
+	if err := verifyCluster(c, cluster); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newMultiClusterClient(ctx context.Context, cfg map[string]interface{}, version string, strict bool, cluster expectedCluster, options ClientOptions) (Client, error) {
+	cls, ok := cfg["clusters"].([]interface{})
+	if !ok || len(cls) == 0 {
+		return nil, badConfig(Namespace + ".clusters")
+	}
+	clusters := make([]Cluster, len(cls))
+	for i, cl := range cls {
+		tmp, ok := cl.(map[string]interface{})
+		if !ok {
+			return nil, badConfig(fmt.Sprintf("%s.clusters[%d]", Namespace, i))
+		}
+		machines, err := parseMachines(tmp)
+		if err != nil {
+			return nil, err
+		}
+		clusterOptions := options
+		if o, ok := tmp["dialer"]; ok {
+			d, ok := parseDialer(o)
+			if !ok {
+				return nil, badConfig(fmt.Sprintf("%s.clusters[%d].dialer", Namespace, i))
+			}
+			clusterOptions.Dialer = d
+		}
+		clusterID := cluster
+		if _, ok := tmp["expected_cluster_id"]; ok {
+			if clusterID, err = parseExpectedCluster(tmp, fmt.Sprintf("%s.clusters[%d]", Namespace, i)); err != nil {
+				return nil, err
+			}
+		}
+		c, err := newClient(ctx, version, strict, clusterID, machines, clusterOptions)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := tmp["name"].(string)
+		if !ok {
+			name = fmt.Sprintf("cluster-%d", i)
+		}
+		clusters[i] = Cluster{Name: name, Client: c}
+	}
+
+	interval := DefaultProbeInterval
+	if o, ok := cfg["probe_interval"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			interval = d
+		}
+	}
+	margin := DefaultSwitchMargin
+	if o, ok := cfg["switch_margin"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			margin = d
+		}
 	}
-	return NewClient(ctx, machines, parseOptions(tmp))
+	return NewMultiClusterClient(ctx, clusters, interval, margin), nil
 }
 
 func parseVersion(cfg map[string]interface{}) (string, error) {
@@ -113,24 +426,62 @@ func parseMachines(cfg map[string]interface{}) ([]string, error) {
 	return result, nil
 }
 
-func parseOptions(cfg map[string]interface{}) ClientOptions {
-	options := ClientOptions{}
+func parseOptions(cfg map[string]interface{}) (ClientOptions, error) {
 	v, ok := cfg["options"]
 	if !ok {
-		return options
+		return ClientOptions{}, nil
+	}
+	tmp, ok := v.(map[string]interface{})
+	if !ok {
+		return ClientOptions{}, badConfig("options")
 	}
-	tmp := v.(map[string]interface{})
+	options, err := parseOptionsMap(tmp)
+	return options, withPath("options", err)
+}
 
-	if o, ok := tmp["cert"]; ok {
-		options.Cert = o.(string)
+// parseOptionsMap parses the client options, accepting the variants of their keys. See
+// normalizeOptionKeys. The paths of the returned ConfigErrors are relative to the received map.
+func parseOptionsMap(tmp map[string]interface{}) (ClientOptions, error) {
+	options := ClientOptions{}
+	tmp = normalizeOptionKeys(tmp)
+
+	for key, field := range map[string]*string{
+		"cert":             &options.Cert,
+		"key":              &options.Key,
+		"cacert":           &options.CACert,
+		"username":         &options.Username,
+		"password":         &options.Password,
+		"spiffe_socket":    &options.SPIFFESocket,
+		"spiffe_server_id": &options.SPIFFEServerID,
+	} {
+		o, ok := tmp[key]
+		if !ok {
+			continue
+		}
+		s, ok := o.(string)
+		if !ok {
+			return options, badConfig(key)
+		}
+		*field = s
+	}
+	if options.SPIFFESocket != "" && options.SPIFFEServerID == "" {
+		return options, badConfig("spiffe_server_id")
 	}
 
-	if o, ok := tmp["key"]; ok {
-		options.Key = o.(string)
+	if o, ok := tmp["tls_provider"]; ok {
+		p, err := parseTLSProvider(o)
+		if err != nil {
+			return options, err
+		}
+		options.TLSProvider = p
 	}
 
-	if o, ok := tmp["cacert"]; ok {
-		options.CACert = o.(string)
+	if o, ok := tmp["dialer"]; ok {
+		d, ok := parseDialer(o)
+		if !ok {
+			return options, badConfig("dialer")
+		}
+		options.Dialer = d
 	}
 
 	if o, ok := tmp["dial_timeout"]; ok {
@@ -150,7 +501,137 @@ func parseOptions(cfg map[string]interface{}) ClientOptions {
 			options.HeaderTimeoutPerRequest = d
 		}
 	}
-	return options
+
+	if o, ok := tmp["host_source"]; ok {
+		options.HostSource = parseEnum(o, HostSourceValue, HostSourceKeySuffix)
+	}
+
+	if o, ok := tmp["filter"].(string); ok {
+		options.Filter = o
+	}
+
+	if o, ok := tmp["entry_format"].(string); ok {
+		options.EntryFormat = o
+	}
+
+	if o, ok := tmp["consistency"]; ok {
+		options.Consistency = parseEnum(o, "", ConsistencyLinearizable, ConsistencySerializable, ConsistencyFallback)
+	}
+
+	if o, ok := tmp["watch_root"].(string); ok {
+		options.WatchRoot = o
+	}
+
+	if o, ok := tmp["value_encoding"].(string); ok {
+		options.ValueEncoding = o
+	}
+
+	if o, ok := tmp["ignore_touches"].(bool); ok {
+		options.IgnoreTouches = o
+	}
+
+	if o, ok := tmp["multi_value"].(bool); ok {
+		options.MultiValue = o
+	}
+
+	for key, field := range map[string]*ConcurrencyLimit{
+		"max_watchers":        &options.MaxWatchers,
+		"max_concurrent_gets": &options.MaxConcurrentGets,
+	} {
+		o, ok := tmp[key]
+		if !ok {
+			continue
+		}
+		limit, ok := parseConcurrencyLimit(o)
+		if !ok {
+			return options, badConfig(key)
+		}
+		*field = limit
+	}
+
+	if o, ok := tmp["page_size"]; ok {
+		n, ok := o.(float64)
+		if !ok || n < 0 {
+			return options, badConfig("page_size")
+		}
+		options.PageSize = int(n)
+	}
+
+	for key, field := range map[string]*int{
+		"max_value_bytes":        &options.MaxValueBytes,
+		"max_entries_per_prefix": &options.MaxEntriesPerPrefix,
+	} {
+		o, ok := tmp[key]
+		if !ok {
+			continue
+		}
+		n, ok := parseEntryLimit(o)
+		if !ok {
+			return options, badConfig(key)
+		}
+		*field = n
+	}
+
+	if o, ok := tmp["limit_policy"]; ok {
+		options.LimitPolicy = parseEnum(o, LimitPolicyTruncate, LimitPolicyReject)
+	}
+
+	if o, ok := tmp["prefix_allowlist"]; ok {
+		allowlist, ok := parsePrefixAllowlist(o)
+		if !ok {
+			return options, badConfig("prefix_allowlist")
+		}
+		options.PrefixAllowlist = allowlist
+	}
+
+	if o, ok := tmp["lease_margin"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			options.LeaseMargin = d
+		}
+	}
+
+	schema, err := parseSchema(tmp)
+	if err != nil {
+		return options, err
+	}
+	options.EntrySchema = schema
+	return options, nil
+}
+
+// parseSchema compiles the inline entry schema or the one stored in the entry schema file
+func parseSchema(cfg map[string]interface{}) (*Schema, error) {
+	if o, ok := cfg["entry_schema"].(map[string]interface{}); ok {
+		raw, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		return CompileSchema(raw)
+	}
+	if o, ok := cfg["entry_schema_file"].(string); ok {
+		raw, err := ioutil.ReadFile(o)
+		if err != nil {
+			return nil, err
+		}
+		return CompileSchema(raw)
+	}
+	return nil, nil
+}
+
+// parseEnum returns the received value if it is one of the allowed ones or the default value otherwise
+func parseEnum(v interface{}, defaultValue string, allowed ...string) string {
+	s, ok := v.(string)
+	if !ok {
+		return defaultValue
+	}
+	if s == defaultValue {
+		return s
+	}
+	for _, a := range allowed {
+		if s == a {
+			return s
+		}
+	}
+	return defaultValue
 }
 
 func parseDuration(v interface{}) (time.Duration, error) {
@@ -0,0 +1,121 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestNew_badConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: []interface{}{}, path: Namespace},
+		{cfg: map[string]interface{}{"options": []interface{}{"cert"}}, path: Namespace + ".options"},
+		{cfg: map[string]interface{}{"options": map[string]interface{}{"cert": 42.0}}, path: Namespace + ".options.cert"},
+		{cfg: map[string]interface{}{"options": map[string]interface{}{"cacert": true}}, path: Namespace + ".options.cacert"},
+		{cfg: map[string]interface{}{"options": map[string]interface{}{"spiffe_socket": "unix:///tmp/agent.sock"}}, path: Namespace + ".options.spiffe_server_id"},
+		{cfg: map[string]interface{}{"clusters": "a,b"}, path: Namespace + ".clusters"},
+		{cfg: map[string]interface{}{"clusters": []interface{}{"a"}}, path: Namespace + ".clusters[0]"},
+	} {
+		_, err := New(context.Background(), config.ExtraConfig{Namespace: tc.cfg})
+		if !errors.Is(err, ErrBadConfig) {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+			continue
+		}
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected path for %v: %v", tc.cfg, err)
+		}
+	}
+}
+
+func TestParseBackendOptions_badConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "prefix", path: Namespace},
+		{cfg: map[string]interface{}{"options": 1.0}, path: Namespace + ".options"},
+		{cfg: map[string]interface{}{"options": map[string]interface{}{"key": []interface{}{}}}, path: Namespace + ".options.key"},
+	} {
+		_, err := parseBackendOptions(config.ExtraConfig{Namespace: tc.cfg})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+}
+
+func FuzzParseConfig(f *testing.F) {
+	for _, seed := range []string{
+		`{"machines":["http://127.0.0.1:2379"],"client_version":"v3","options":{"dial_timeout":"5s","cert":"a.crt"}}`,
+		`{"options":[1,2]}`,
+		`{"options":{"entry_schema":{"required":["host"]},"lease_margin":3}}`,
+		`{"default_port":8080,"shards":4,"options":{"key":null},"key_layout":"skydns","removal_grace":"1s"}`,
+		`{"clusters":[{"name":"a","machines":["http://a"]},"b"],"probe_interval":{}}`,
+		`"v3"`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return
+		}
+		if _, err := parseBackendOptions(config.ExtraConfig{Namespace: v}); errors.Is(err, ErrBadConfig) && !isConfigError(err) {
+			t.Errorf("bad config error without path: %v", err)
+		}
+		tmp, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		parseVersion(tmp)
+		parseMachines(tmp)
+		if _, err := parseOptions(tmp); errors.Is(err, ErrBadConfig) && !isConfigError(err) {
+			t.Errorf("bad config error without path: %v", err)
+		}
+	})
+}
+
+func isConfigError(err error) bool {
+	_, ok := err.(*ConfigError)
+	return ok
+}
+
+func FuzzParseMachines(f *testing.F) {
+	for _, seed := range []string{
+		`{"machines":["http://127.0.0.1:2379","http://127.0.0.2:2379"]}`,
+		`{"machines":[1,null,"http://a"]}`,
+		`{"machines":"http://a"}`,
+		`{}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var cfg map[string]interface{}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return
+		}
+		machines, err := parseMachines(cfg)
+		if err == nil && len(machines) == 0 {
+			t.Error("no machines returned without an error")
+		}
+	})
+}
+
+func FuzzParseDuration(f *testing.F) {
+	for _, seed := range []string{"5s", "1h30m", "-1ms", "1.5µs", "", "10", "9223372036854775807ns", "1e9s"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if _, err := parseDuration(s); err != nil && s == "0" {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if _, err := parseDuration([]byte(s)); err == nil {
+			t.Error("only strings should be parsed")
+		}
+	})
+}
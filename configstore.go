@@ -0,0 +1,396 @@
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxPublishAttempts is the number of times a publication is retried when a concurrent publisher claims
+// the same revision
+const maxPublishAttempts = 10
+
+// DefaultConfigSchemaVersion is the newest schema version of the gateway config supported by a
+// ConfigStore when none is defined
+const DefaultConfigSchemaVersion = 3
+
+// ErrNotVersionable is the error returned when the client is not able to store the config versions
+var ErrNotVersionable = errors.New("the etcd client does not support the config versions")
+
+// ErrUnknownConfigVersion is the error returned when the requested config version is not stored
+var ErrUnknownConfigVersion = errors.New("unknown config version")
+
+// ErrNoConfigVersion is the error returned when no config version has been published
+var ErrNoConfigVersion = errors.New("no config published")
+
+// ErrConfigConflict is the error returned when a config can not be published because of the concurrent
+// publishers
+var ErrConfigConflict = errors.New("too many concurrent config publications")
+
+// ErrUnsupportedSchema is the error returned when a config declares a schema version newer than the one
+// supported by the gateway
+var ErrUnsupportedSchema = errors.New("unsupported config schema version")
+
+// ErrStaleConfig is the error returned when the current config of a signed store is older than the minimum
+// revision of the gateway
+var ErrStaleConfig = errors.New("stale config revision")
+
+// StaleConfigError is the ErrStaleConfig returned along with the revisions involved, so
+// errors.Is(err, ErrStaleConfig) still holds
+type StaleConfigError struct {
+	Revision int64
+	Minimum  int64
+}
+
+// Error implements the error interface
+func (e *StaleConfigError) Error() string {
+	return fmt.Sprintf("%s: revision %d is older than the minimum revision %d", ErrStaleConfig.Error(), e.Revision, e.Minimum)
+}
+
+// Unwrap returns ErrStaleConfig
+func (*StaleConfigError) Unwrap() error {
+	return ErrStaleConfig
+}
+
+// SchemaVersionError is the ErrUnsupportedSchema returned along with the versions involved, so
+// errors.Is(err, ErrUnsupportedSchema) still holds
+type SchemaVersionError struct {
+	Revision  int64
+	Version   int
+	Supported int
+}
+
+// Error implements the error interface
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("%s: revision %d declares the schema version %d (supported: %d)", ErrUnsupportedSchema.Error(), e.Revision, e.Version, e.Supported)
+}
+
+// Unwrap returns ErrUnsupportedSchema
+func (*SchemaVersionError) Unwrap() error {
+	return ErrUnsupportedSchema
+}
+
+// ConfigStoreOptions defines the options of a ConfigStore. All values are optional.
+type ConfigStoreOptions struct {
+	// SchemaVersion is the newest schema version (the "version" field of the config) the gateway
+	// supports. DefaultConfigSchemaVersion if it is not defined.
+	SchemaVersion int
+	// Keep is the number of versions kept by Publish, removing the oldest ones. All the versions are kept
+	// if it is not defined.
+	Keep int
+	// Signer signs the configs published, storing the signature of every version under
+	// <prefix>/signatures/<revision>
+	Signer Signer
+	// Verifier verifies the signature of the configs before loading them, refusing the ones unsigned or
+	// not verified with a SignatureError, and the ones older than the minimum revision with a
+	// StaleConfigError. The signatures are not checked if it is not defined.
+	Verifier Verifier
+	// MinRevision is the initial minimum revision loaded by the stores with a Verifier, e.g. the last
+	// revision applied by the gateway before a restart. See SetMinRevision.
+	MinRevision int64
+}
+
+// ConfigVersion describes a stored version of the config
+type ConfigVersion struct {
+	Revision      int64 `json:"revision"`
+	SchemaVersion int   `json:"schema_version"`
+	Size          int   `json:"size"`
+	Signed        bool  `json:"signed"`
+	Current       bool  `json:"current"`
+}
+
+// configClient is a client able to store the config versions
+type configClient interface {
+	SwapRegistrar
+	KeyValueClient
+}
+
+// ConfigStore keeps the versions of a gateway config under a prefix, so a bad config can be rolled back.
+// Every version is stored under <prefix>/versions/<revision> and <prefix>/current holds the revision
+// served, so the rollbacks of the unsigned stores only rewrite that key.
+type ConfigStore struct {
+	client      configClient
+	prefix      string
+	options     ConfigStoreOptions
+	mutex       *sync.Mutex
+	minRevision int64
+}
+
+// NewConfigStore returns a ConfigStore keeping the versions of the config under the prefix. The client must
+// be a SwapRegistrar and a KeyValueClient, like the v2 and v3 clients.
+func NewConfigStore(c Client, prefix string, options ConfigStoreOptions) (*ConfigStore, error) {
+	cc, ok := c.(configClient)
+	if !ok {
+		return nil, ErrNotVersionable
+	}
+	if options.SchemaVersion <= 0 {
+		options.SchemaVersion = DefaultConfigSchemaVersion
+	}
+	return &ConfigStore{
+		client:      cc,
+		prefix:      strings.TrimRight(prefix, "/") + "/",
+		options:     options,
+		mutex:       &sync.Mutex{},
+		minRevision: options.MinRevision,
+	}, nil
+}
+
+// MinRevision returns the minimum revision loaded by the store, if it has a Verifier
+func (s *ConfigStore) MinRevision() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.minRevision
+}
+
+// SetMinRevision raises the minimum revision loaded by the store, if it has a Verifier, so an old config
+// and its valid signature written again as the current one (a replay) are refused. The ConfigReloader
+// raises it to every revision applied. Lower revisions are ignored.
+func (s *ConfigStore) SetMinRevision(revision int64) {
+	s.mutex.Lock()
+	if revision > s.minRevision {
+		s.minRevision = revision
+	}
+	s.mutex.Unlock()
+}
+
+// Publish stores the config as a new version and makes it the current one, returning its revision. The
+// config must be a JSON document. The concurrent publishers do not overwrite each other: the version is
+// created only if its revision is free, retrying with the next one otherwise, and the current revision
+// is only moved forward. It fails with ErrConfigConflict after maxPublishAttempts conflicts.
+func (s *ConfigStore) Publish(config []byte) (int64, error) {
+	if _, err := configSchemaVersion(config); err != nil {
+		return 0, err
+	}
+	var versions []ConfigVersion
+	var revision int64
+	for attempt := 0; ; attempt++ {
+		if attempt == maxPublishAttempts {
+			return 0, ErrConfigConflict
+		}
+		var err error
+		if versions, err = s.read(); err != nil {
+			return 0, err
+		}
+		revision = 1
+		if len(versions) > 0 {
+			revision = versions[len(versions)-1].Revision + 1
+		}
+		created, err := s.client.PutIfAbsent(s.versionKey(revision), string(config), 0)
+		if err != nil {
+			return 0, err
+		}
+		if created {
+			break
+		}
+	}
+	if s.options.Signer != nil {
+		sig, err := s.options.Signer.Sign(signedConfig(s.prefix, revision, config))
+		if err != nil {
+			return 0, err
+		}
+		value, _ := json.Marshal(sig)
+		if err := s.client.Register(s.signatureKey(revision), string(value), 0); err != nil {
+			return 0, err
+		}
+	}
+	if err := s.advance(revision); err != nil {
+		return 0, err
+	}
+
+	if s.options.Keep > 0 {
+		for i := 0; i < len(versions)+1-s.options.Keep; i++ {
+			if err := s.client.Deregister(s.versionKey(versions[i].Revision)); err != nil {
+				getLogger().Warning("etcd: unable to remove the config version", versions[i].Revision, err.Error())
+			}
+			if versions[i].Signed {
+				s.client.Deregister(s.signatureKey(versions[i].Revision))
+			}
+		}
+	}
+	return revision, nil
+}
+
+// advance makes the revision the current one, unless a concurrent publisher already made a newer one the
+// current one
+func (s *ConfigStore) advance(revision int64) error {
+	key := s.prefix + "current"
+	value := strconv.FormatInt(revision, 10)
+	for attempt := 0; attempt < maxPublishAttempts; attempt++ {
+		kvs, err := s.client.GetKeyValues(key)
+		if err != nil {
+			return err
+		}
+		var swapped bool
+		if raw, ok := kvs[key]; ok {
+			if current, err := strconv.ParseInt(raw, 10, 64); err == nil && current >= revision {
+				return nil
+			}
+			swapped, err = s.client.CompareAndSwap(key, raw, value, 0)
+		} else {
+			swapped, err = s.client.PutIfAbsent(key, value, 0)
+		}
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return ErrConfigConflict
+}
+
+// ListVersions returns the stored versions of the config, sorted by revision
+func (s *ConfigStore) ListVersions() ([]ConfigVersion, error) {
+	return s.read()
+}
+
+// Rollback makes the stored version with the given revision the current one. It fails with a
+// SchemaVersionError if the version is not supported by the gateway. The stores with a Signer publish the
+// version again as a new revision, since the gateways verifying the signatures refuse to load a revision
+// older than the ones they applied.
+func (s *ConfigStore) Rollback(revision int64) error {
+	versions, err := s.read()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if v.Revision != revision {
+			continue
+		}
+		if v.SchemaVersion > s.options.SchemaVersion {
+			return &SchemaVersionError{Revision: revision, Version: v.SchemaVersion, Supported: s.options.SchemaVersion}
+		}
+		if s.options.Signer == nil {
+			return s.client.Register(s.prefix+"current", strconv.FormatInt(revision, 10), 0)
+		}
+		kvs, err := s.client.GetKeyValues(s.prefix)
+		if err != nil {
+			return err
+		}
+		config, ok := kvs[s.versionKey(revision)]
+		if !ok {
+			return ErrUnknownConfigVersion
+		}
+		_, err = s.Publish([]byte(config))
+		return err
+	}
+	return ErrUnknownConfigVersion
+}
+
+// Load returns the current version of the config and its revision. It refuses to load the configs
+// declaring a schema version newer than the one supported, returning a SchemaVersionError, and, with a
+// Verifier, the configs without a valid signature, returning a SignatureError, or older than the minimum
+// revision, returning a StaleConfigError. The revision of the rejected configs is returned along with
+// the error.
+func (s *ConfigStore) Load() ([]byte, int64, error) {
+	kvs, err := s.client.GetKeyValues(s.prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	raw, ok := kvs[s.prefix+"current"]
+	if !ok {
+		return nil, 0, ErrNoConfigVersion
+	}
+	revision, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, 0, ErrUnknownConfigVersion
+	}
+	config, ok := kvs[s.versionKey(revision)]
+	if !ok {
+		return nil, 0, ErrUnknownConfigVersion
+	}
+	if s.options.Verifier != nil {
+		if min := s.MinRevision(); revision < min {
+			return nil, revision, &StaleConfigError{Revision: revision, Minimum: min}
+		}
+		if err := s.verify(revision, []byte(config), kvs); err != nil {
+			return nil, revision, err
+		}
+	}
+	version, err := configSchemaVersion([]byte(config))
+	if err != nil {
+		return nil, revision, err
+	}
+	if version > s.options.SchemaVersion {
+		return nil, revision, &SchemaVersionError{Revision: revision, Version: version, Supported: s.options.SchemaVersion}
+	}
+	return []byte(config), revision, nil
+}
+
+// read returns the stored versions, sorted by revision
+func (s *ConfigStore) read() ([]ConfigVersion, error) {
+	kvs, err := s.client.GetKeyValues(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	current, _ := strconv.ParseInt(kvs[s.prefix+"current"], 10, 64)
+	versions := []ConfigVersion{}
+	for key, value := range kvs {
+		if !strings.HasPrefix(key, s.prefix+"versions/") {
+			continue
+		}
+		revision, err := strconv.ParseInt(keySuffix(key), 10, 64)
+		if err != nil {
+			continue
+		}
+		schema, _ := configSchemaVersion([]byte(value))
+		versions = append(versions, ConfigVersion{
+			Revision:      revision,
+			SchemaVersion: schema,
+			Size:          len(value),
+			Signed:        kvs[s.signatureKey(revision)] != "",
+			Current:       revision == current,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Revision < versions[j].Revision })
+	return versions, nil
+}
+
+// versionKey returns the key of a version. The revisions are padded so the keys sort by revision.
+func (s *ConfigStore) versionKey(revision int64) string {
+	return fmt.Sprintf("%sversions/%020d", s.prefix, revision)
+}
+
+// signatureKey returns the key of the signature of a version
+func (s *ConfigStore) signatureKey(revision int64) string {
+	return fmt.Sprintf("%ssignatures/%020d", s.prefix, revision)
+}
+
+// verify verifies the stored signature of a version, signed along with its prefix and revision, so it
+// does not verify the config moved to another revision or store
+func (s *ConfigStore) verify(revision int64, config []byte, kvs map[string]string) error {
+	raw, ok := kvs[s.signatureKey(revision)]
+	if !ok {
+		return &SignatureError{Revision: revision, Reason: "missing signature"}
+	}
+	var sig Signature
+	if err := json.Unmarshal([]byte(raw), &sig); err != nil {
+		return &SignatureError{Revision: revision, Reason: "malformed signature"}
+	}
+	if err := s.options.Verifier.Verify(signedConfig(s.prefix, revision, config), sig); err != nil {
+		return &SignatureError{Revision: revision, Reason: err.Error()}
+	}
+	return nil
+}
+
+// signedConfig returns the document signed for a version: its prefix, revision and config. The prefix
+// is prepended with its length, so the fields can not be shifted from one to another.
+func signedConfig(prefix string, revision int64, config []byte) []byte {
+	header := fmt.Sprintf("krakend-etcd/config/v1\n%d:%s\n%d\n", len(prefix), prefix, revision)
+	return append([]byte(header), config...)
+}
+
+// configSchemaVersion returns the schema version declared by the config
+func configSchemaVersion(config []byte) (int, error) {
+	var c struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(config, &c); err != nil {
+		return 0, err
+	}
+	return c.Version, nil
+}
@@ -0,0 +1,211 @@
+package etcd
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewConfigStore(t *testing.T) {
+	if _, err := NewConfigStore(dummyClient{}, "/gateways/config", ConfigStoreOptions{}); err != ErrNotVersionable {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigStore(t *testing.T) {
+	s, err := NewConfigStore(newMemoryPeerClient(), "/gateways/config", ConfigStoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Load(); err != ErrNoConfigVersion {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := s.Publish([]byte("not json")); err == nil {
+		t.Error("the malformed configs should be rejected")
+	}
+
+	for i, config := range []string{`{"version":2}`, `{"version":3,"name":"a"}`, `{"version":4}`} {
+		rev, err := s.Publish([]byte(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev != int64(i+1) {
+			t.Errorf("unexpected revision: %d", rev)
+		}
+	}
+
+	versions, err := s.ListVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ConfigVersion{
+		{Revision: 1, SchemaVersion: 2, Size: 13},
+		{Revision: 2, SchemaVersion: 3, Size: 24},
+		{Revision: 3, SchemaVersion: 4, Size: 13, Current: true},
+	}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("unexpected versions: %+v", versions)
+	}
+
+	// the configs newer than the supported schema are not loaded
+	_, _, err = s.Load()
+	var schemaErr *SchemaVersionError
+	if !errors.As(err, &schemaErr) || !errors.Is(err, ErrUnsupportedSchema) || schemaErr.Revision != 3 || schemaErr.Version != 4 {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := s.Rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	config, rev, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev != 2 || string(config) != `{"version":3,"name":"a"}` {
+		t.Errorf("unexpected config: %d %s", rev, config)
+	}
+
+	if err := s.Rollback(3); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := s.Rollback(7); err != ErrUnknownConfigVersion {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigStore_keep(t *testing.T) {
+	s, _ := NewConfigStore(newMemoryPeerClient(), "/gateways/config", ConfigStoreOptions{Keep: 2})
+	for i := 0; i < 4; i++ {
+		if _, err := s.Publish([]byte(`{"version":3}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, _ := s.ListVersions()
+	if len(versions) != 2 || versions[0].Revision != 3 || !versions[1].Current {
+		t.Errorf("unexpected versions: %+v", versions)
+	}
+}
+
+func TestConfigStore_signatures(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	c := newMemoryPeerClient()
+	publisher, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{Signer: Ed25519Signer{ID: "k1", Key: key}})
+	gateway, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{
+		Verifier: Ed25519Verifier{"k1": key.Public().(ed25519.PublicKey)},
+	})
+
+	rev, err := publisher.Publish([]byte(`{"version":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, loaded, err := gateway.Load(); err != nil || loaded != rev {
+		t.Errorf("unexpected result: %d %v", loaded, err)
+	}
+	if versions, _ := gateway.ListVersions(); len(versions) != 1 || !versions[0].Signed {
+		t.Errorf("unexpected versions: %+v", versions)
+	}
+
+	// the configs written without the signing key are rejected
+	c.Register(publisher.versionKey(rev), `{"version":3,"endpoints":[{"endpoint":"/evil"}]}`, 0)
+	_, _, err = gateway.Load()
+	var sigErr *SignatureError
+	if !errors.As(err, &sigErr) || !errors.Is(err, ErrBadSignature) || sigErr.Revision != rev {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	unsigned, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{})
+	unsigned.Publish([]byte(`{"version":3}`))
+	if _, _, err := gateway.Load(); err == nil || err.Error() != "invalid signature: revision 2: missing signature" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the signatures of the removed versions are removed too
+	pruning, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{Keep: 1, Signer: HMACKey{ID: "k1", Key: []byte("secret")}})
+	pruning.Publish([]byte(`{"version":3}`))
+	if c.get(publisher.signatureKey(1)) != "" {
+		t.Errorf("the signature should be removed: %v", c.entries)
+	}
+}
+
+func TestConfigStore_replays(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	c := newMemoryPeerClient()
+	publisher, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{Signer: Ed25519Signer{ID: "k1", Key: key}})
+	gateway, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{
+		Verifier: Ed25519Verifier{"k1": key.Public().(ed25519.PublicKey)},
+	})
+	publisher.Publish([]byte(`{"version":3,"name":"v1"}`))
+	publisher.Publish([]byte(`{"version":3,"name":"v2"}`))
+
+	// the signatures are bound to the revision, so a version copied to another one is rejected
+	c.Register(publisher.versionKey(3), c.get(publisher.versionKey(1)), 0)
+	c.Register(publisher.signatureKey(3), c.get(publisher.signatureKey(1)), 0)
+	c.Register("/gateways/config/current", "3", 0)
+	if _, _, err := gateway.Load(); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	c.Deregister(publisher.versionKey(3))
+	c.Deregister(publisher.signatureKey(3))
+
+	// the revisions older than the minimum are rejected, even with a valid signature
+	gateway.SetMinRevision(2)
+	gateway.SetMinRevision(1)
+	c.Register("/gateways/config/current", "1", 0)
+	_, rev, err := gateway.Load()
+	var staleErr *StaleConfigError
+	if !errors.As(err, &staleErr) || rev != 1 || staleErr.Minimum != 2 {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the signed stores roll back publishing the version again
+	if err := publisher.Rollback(1); err != nil {
+		t.Fatal(err)
+	}
+	config, rev, err := gateway.Load()
+	if err != nil || rev != 3 || string(config) != `{"version":3,"name":"v1"}` {
+		t.Errorf("unexpected config: %d %s %v", rev, config, err)
+	}
+}
+
+// racingConfigClient publishes a config with the same revision right before the first version written
+type racingConfigClient struct {
+	*memoryPeerClient
+	raced bool
+}
+
+func (c *racingConfigClient) PutIfAbsent(key, value string, ttl time.Duration) (bool, error) {
+	if !c.raced && strings.Contains(key, "/versions/") {
+		c.raced = true
+		c.memoryPeerClient.PutIfAbsent(key, `{"version":3,"name":"concurrent"}`, 0)
+		c.memoryPeerClient.PutIfAbsent("/gateways/config/current", "1", 0)
+	}
+	return c.memoryPeerClient.PutIfAbsent(key, value, ttl)
+}
+
+func TestConfigStore_concurrentPublish(t *testing.T) {
+	c := &racingConfigClient{memoryPeerClient: newMemoryPeerClient()}
+	s, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{})
+
+	rev, err := s.Publish([]byte(`{"version":3,"name":"mine"}`))
+	if err != nil || rev != 2 {
+		t.Fatalf("unexpected publication: %d %v", rev, err)
+	}
+	if v := c.get(s.versionKey(1)); v != `{"version":3,"name":"concurrent"}` {
+		t.Errorf("the concurrent version should not be overwritten: %s", v)
+	}
+	if config, current, _ := s.Load(); current != 2 || string(config) != `{"version":3,"name":"mine"}` {
+		t.Errorf("unexpected current config: %d %s", current, config)
+	}
+
+	// the current revision is not moved backwards
+	c.Register("/gateways/config/current", "5", 0)
+	if rev, err := s.Publish([]byte(`{"version":3}`)); err != nil || rev != 3 {
+		t.Errorf("unexpected publication: %d %v", rev, err)
+	}
+	if c.get("/gateways/config/current") != "5" {
+		t.Errorf("the current revision should not change: %s", c.get("/gateways/config/current"))
+	}
+}
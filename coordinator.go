@@ -0,0 +1,238 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultShardTTL is the ttl of the membership of the gateways coordinating their shards when none is
+// defined
+const DefaultShardTTL = 15 * time.Second
+
+// ErrNotShardable is the error returned when the client is not able to coordinate the shards
+var ErrNotShardable = errors.New("the etcd client does not support the shard coordination")
+
+// ErrNoShards is the error returned when the number of shards to assign is not positive
+var ErrNoShards = errors.New("the number of shards must be positive")
+
+// ShardOptions defines the options of a ShardCoordinator
+type ShardOptions struct {
+	// Shards is the number of shards to assign, from 0 to Shards-1. Required.
+	Shards int
+	// TTL is the ttl of the membership of the gateway, so the shards of a gateway that stops are
+	// reassigned once it expires. The membership is refreshed every third of the ttl (plus the jitter).
+	// DefaultShardTTL if it is not defined.
+	TTL time.Duration
+	// OnAssign is called with the shards of the gateway every time they change
+	OnAssign func(shards []int)
+}
+
+// shardClient is a client able to coordinate the shards
+type shardClient interface {
+	Client
+	SwapRegistrar
+	KeyValueClient
+}
+
+// ShardCoordinator assigns the shards of a partitioned workload (e.g. the per-tenant routing shards) to
+// the gateways of a fleet. The gateways register their membership under <prefix>/members/<id> and the
+// assignment is stored as JSON under <prefix>/assignment. Every gateway watches the prefix and, when the
+// members change, rebalances the assignment with a transaction, so only one of the concurrent
+// rebalances succeeds. The rebalances move as few shards as possible.
+type ShardCoordinator struct {
+	client     shardClient
+	prefix     string
+	id         string
+	options    ShardOptions
+	mutex      *sync.RWMutex
+	assignment map[string][]int
+}
+
+// NewShardCoordinator returns a ShardCoordinator assigning the shards under the prefix to the gateway
+// with the given id and its peers. The client must be a SwapRegistrar and a KeyValueClient, like the v3
+// clients.
+func NewShardCoordinator(c Client, prefix, id string, options ShardOptions) (*ShardCoordinator, error) {
+	sc, ok := c.(shardClient)
+	if !ok {
+		return nil, ErrNotShardable
+	}
+	if id == "" {
+		return nil, ErrMissingPeerID
+	}
+	if options.Shards <= 0 {
+		return nil, ErrNoShards
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultShardTTL
+	}
+	return &ShardCoordinator{
+		client:     sc,
+		prefix:     strings.TrimRight(prefix, "/") + "/",
+		id:         id,
+		options:    options,
+		mutex:      &sync.RWMutex{},
+		assignment: map[string][]int{},
+	}, nil
+}
+
+// Shards returns the shards assigned to the gateway
+func (s *ShardCoordinator) Shards() []int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]int{}, s.assignment[s.id]...)
+}
+
+// Assignment returns the shards assigned to every member
+func (s *ShardCoordinator) Assignment() map[string][]int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	assignment := make(map[string][]int, len(s.assignment))
+	for id, shards := range s.assignment {
+		assignment[id] = append([]int{}, shards...)
+	}
+	return assignment
+}
+
+// Run registers the membership of the gateway and keeps the assignment balanced until the context is
+// canceled, when the membership is removed so the peers take over its shards
+func (s *ShardCoordinator) Run(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.join(ctx)
+	}()
+	newPrefixLoop(s.client, s.prefix).run(ctx, func() (bool, error) {
+		return true, s.rebalance()
+	})
+	<-done
+	return ctx.Err()
+}
+
+// join registers the membership of the gateway every third of the ttl until the context is canceled
+func (s *ShardCoordinator) join(ctx context.Context) {
+	key := s.prefix + "members/" + s.id
+	for {
+		if err := s.client.Register(key, s.id, s.options.TTL); err != nil {
+			getLogger().Warning("etcd: unable to register the shard member", key+":", err.Error())
+		}
+		select {
+		case <-GetClock().After(Jitter(s.options.TTL / 3)):
+		case <-ctx.Done():
+			s.client.Deregister(key)
+			return
+		}
+	}
+}
+
+// rebalance reads the members and the assignment, replacing the assignment if it does not match the
+// members. Only the registered members rebalance, and the transaction rejects the assignment if another
+// member replaced it first: the watch will notify the new one.
+func (s *ShardCoordinator) rebalance() error {
+	kvs, err := s.client.GetKeyValues(s.prefix)
+	if err != nil {
+		return err
+	}
+	members := []string{}
+	for key := range kvs {
+		if strings.HasPrefix(key, s.prefix+"members/") {
+			members = append(members, keySuffix(key))
+		}
+	}
+	sort.Strings(members)
+
+	key := s.prefix + "assignment"
+	raw, stored := kvs[key]
+	current := map[string][]int{}
+	if stored {
+		if err := json.Unmarshal([]byte(raw), &current); err != nil {
+			getLogger().Warning("etcd: discarding the malformed shard assignment", key+":", err.Error())
+			current = map[string][]int{}
+		}
+	}
+
+	next := balanceShards(s.options.Shards, members, current)
+	if i := sort.SearchStrings(members, s.id); i < len(members) && members[i] == s.id && !reflect.DeepEqual(next, current) {
+		value, _ := json.Marshal(next)
+		var ok bool
+		if stored {
+			ok, err = s.client.CompareAndSwap(key, raw, string(value), 0)
+		} else {
+			ok, err = s.client.PutIfAbsent(key, string(value), 0)
+		}
+		if err != nil {
+			return err
+		}
+		if ok {
+			addMetric(MetricShardRebalances, 1)
+			current = next
+		}
+	}
+	s.setAssignment(current)
+	return nil
+}
+
+// setAssignment stores the assignment, notifying the changes of the shards of the gateway
+func (s *ShardCoordinator) setAssignment(assignment map[string][]int) {
+	s.mutex.Lock()
+	previous := s.assignment[s.id]
+	s.assignment = assignment
+	shards := append([]int{}, assignment[s.id]...)
+	s.mutex.Unlock()
+
+	if len(previous) == len(shards) && (len(shards) == 0 || reflect.DeepEqual(previous, shards)) {
+		return
+	}
+	setMetric(MetricAssignedShards+"."+s.prefix, int64(len(shards)))
+	if s.options.OnAssign != nil {
+		s.options.OnAssign(shards)
+	}
+}
+
+// balanceShards returns the assignment of the shards to the members closest to the previous one: every
+// member keeps its shards up to its quota (the shards divided by the members, plus one for the first
+// members when they are not divisible) and the rest are given to the members below their quota
+func balanceShards(total int, members []string, previous map[string][]int) map[string][]int {
+	assignment := make(map[string][]int, len(members))
+	if len(members) == 0 {
+		return assignment
+	}
+
+	assigned := make([]bool, total)
+	quotas := make(map[string]int, len(members))
+	for i, id := range members {
+		quotas[id] = total / len(members)
+		if i < total%len(members) {
+			quotas[id]++
+		}
+		kept := []int{}
+		for _, shard := range previous[id] {
+			if len(kept) == quotas[id] {
+				break
+			}
+			if shard >= 0 && shard < total && !assigned[shard] {
+				assigned[shard] = true
+				kept = append(kept, shard)
+			}
+		}
+		assignment[id] = kept
+	}
+
+	free := 0
+	for _, id := range members {
+		for len(assignment[id]) < quotas[id] {
+			for assigned[free] {
+				free++
+			}
+			assigned[free] = true
+			assignment[id] = append(assignment[id], free)
+		}
+		sort.Ints(assignment[id])
+	}
+	return assignment
+}
@@ -0,0 +1,139 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBalanceShards(t *testing.T) {
+	for i, tc := range []struct {
+		total    int
+		members  []string
+		previous map[string][]int
+		expected map[string][]int
+	}{
+		{
+			total:    5,
+			members:  []string{"gw-a", "gw-b"},
+			previous: map[string][]int{},
+			expected: map[string][]int{"gw-a": {0, 1, 2}, "gw-b": {3, 4}},
+		},
+		{
+			// the new member takes the shards over the quota of the others
+			total:    6,
+			members:  []string{"gw-a", "gw-b", "gw-c"},
+			previous: map[string][]int{"gw-a": {0, 1, 2}, "gw-b": {3, 4, 5}},
+			expected: map[string][]int{"gw-a": {0, 1}, "gw-b": {3, 4}, "gw-c": {2, 5}},
+		},
+		{
+			// the shards of the missing members are given to the rest
+			total:    6,
+			members:  []string{"gw-a", "gw-c"},
+			previous: map[string][]int{"gw-a": {0, 1}, "gw-b": {3, 4}, "gw-c": {2, 5}},
+			expected: map[string][]int{"gw-a": {0, 1, 3}, "gw-c": {2, 4, 5}},
+		},
+		{
+			// the removed and duplicated shards are discarded
+			total:    3,
+			members:  []string{"gw-a", "gw-b", "gw-c", "gw-d"},
+			previous: map[string][]int{"gw-a": {7}, "gw-b": {1}, "gw-c": {1}},
+			expected: map[string][]int{"gw-a": {0}, "gw-b": {1}, "gw-c": {2}, "gw-d": {}},
+		},
+		{
+			total:    3,
+			members:  []string{},
+			previous: map[string][]int{"gw-a": {0, 1, 2}},
+			expected: map[string][]int{},
+		},
+	} {
+		if res := balanceShards(tc.total, tc.members, tc.previous); !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("#%d: unexpected assignment: %v", i, res)
+		}
+	}
+}
+
+func TestNewShardCoordinator(t *testing.T) {
+	for _, tc := range []struct {
+		client Client
+		id     string
+		shards int
+		err    error
+	}{
+		{client: dummyClient{}, id: "gw-a", shards: 4, err: ErrNotShardable},
+		{client: newMemoryPeerClient(), id: "", shards: 4, err: ErrMissingPeerID},
+		{client: newMemoryPeerClient(), id: "gw-a", shards: 0, err: ErrNoShards},
+	} {
+		if _, err := NewShardCoordinator(tc.client, "/gateways/shards", tc.id, ShardOptions{Shards: tc.shards}); err != tc.err {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestShardCoordinator_rebalance(t *testing.T) {
+	c := newMemoryPeerClient()
+	assigned := [][]int{}
+	a, _ := NewShardCoordinator(c, "/gateways/shards", "gw-a", ShardOptions{
+		Shards:   4,
+		OnAssign: func(shards []int) { assigned = append(assigned, shards) },
+	})
+	b, _ := NewShardCoordinator(c, "/gateways/shards", "gw-b", ShardOptions{Shards: 4})
+
+	c.Register("/gateways/shards/members/gw-a", "gw-a", 0)
+	if err := a.rebalance(); err != nil {
+		t.Fatal(err)
+	}
+	if shards := a.Shards(); !reflect.DeepEqual(shards, []int{0, 1, 2, 3}) {
+		t.Errorf("unexpected shards: %v", shards)
+	}
+
+	// the members not registered yet do not rebalance
+	b.rebalance()
+	if len(b.Shards()) != 0 || c.get("/gateways/shards/assignment") != `{"gw-a":[0,1,2,3]}` {
+		t.Errorf("unexpected assignment: %s", c.get("/gateways/shards/assignment"))
+	}
+
+	c.Register("/gateways/shards/members/gw-b", "gw-b", 0)
+	b.rebalance()
+	a.rebalance()
+	if c.get("/gateways/shards/assignment") != `{"gw-a":[0,1],"gw-b":[2,3]}` {
+		t.Errorf("unexpected assignment: %s", c.get("/gateways/shards/assignment"))
+	}
+	if !reflect.DeepEqual(a.Assignment(), b.Assignment()) || !reflect.DeepEqual(b.Shards(), []int{2, 3}) {
+		t.Errorf("unexpected assignments: %v %v", a.Assignment(), b.Assignment())
+	}
+
+	// the shards of the members leaving are taken over
+	c.Deregister("/gateways/shards/members/gw-b")
+	a.rebalance()
+	if !reflect.DeepEqual(a.Shards(), []int{0, 1, 2, 3}) {
+		t.Errorf("unexpected shards: %v", a.Shards())
+	}
+	if len(assigned) != 3 {
+		t.Errorf("unexpected notifications: %v", assigned)
+	}
+}
+
+func TestShardCoordinator_Run(t *testing.T) {
+	c := newMemoryPeerClient()
+	defer close(c.stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := NewShardCoordinator(c, "/gateways/shards", "gw-a", ShardOptions{
+		Shards: 2,
+		OnAssign: func(shards []int) {
+			if len(shards) == 2 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(ctx); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.get("/gateways/shards/members/gw-a") != "" || c.get("/gateways/shards/assignment") == "" {
+		t.Errorf("the gateway should leave the members once the context is canceled: %v", c.entries)
+	}
+}
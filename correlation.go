@@ -0,0 +1,141 @@
+package etcd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderCorrelationID is the header (v2) or the gRPC metadata key (v3, in lower case) carrying the
+// correlation id of the requests sent to etcd
+const HeaderCorrelationID = "X-Request-Id"
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of the context carrying the received correlation id, usually the
+// one of the gateway request triggering the discovery
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation id carried by the context, if any
+func CorrelationID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationKey{}).(string)
+	return id, ok && id != ""
+}
+
+// CorrelatedClient is a Client able to return a copy of itself tagging its requests with a correlation
+// id, so the etcd server logs can be matched with the gateway traces. The watches are not tagged, since
+// they outlive the requests creating them.
+type CorrelatedClient interface {
+	Client
+	// WithCorrelationID returns a copy of the client tagging its requests with the received id
+	WithCorrelationID(id string) Client
+}
+
+// Correlate returns the client tagging its requests with the correlation id carried by the context. The
+// received client is returned if the context has no correlation id or the client does not support it.
+func Correlate(ctx context.Context, c Client) Client {
+	id, ok := CorrelationID(ctx)
+	if !ok {
+		return c
+	}
+	if cc, ok := c.(CorrelatedClient); ok {
+		return cc.WithCorrelationID(id)
+	}
+	return c
+}
+
+// WithCorrelationID implements the etcd CorrelatedClient interface. The id is sent as the
+// HeaderCorrelationID header.
+func (c *client) WithCorrelationID(id string) Client {
+	return &client{
+		keysAPI:       c.keysAPI,
+		etcdClient:    c.etcdClient,
+		machines:      c.machines,
+		ctx:           c.ctx,
+		options:       c.options,
+		fallback:      c.fallback,
+		limits:        c.limits,
+		writes:        c.writes,
+		correlationID: id,
+	}
+}
+
+// requestContext returns the parent context of the requests, carrying the correlation id of the client
+func (c *client) requestContext() context.Context {
+	if c.correlationID == "" {
+		return c.ctx
+	}
+	return WithCorrelationID(c.ctx, c.correlationID)
+}
+
+// WithCorrelationID implements the etcd CorrelatedClient interface. The id is sent as gRPC metadata.
+func (c *clientv3) WithCorrelationID(id string) Client {
+	return &clientv3{
+		client:        c.client,
+		ctx:           c.ctx,
+		timeout:       c.timeout,
+		options:       c.options,
+		mux:           c.mux,
+		fallback:      c.fallback,
+		limits:        c.limits,
+		writes:        c.writes,
+		leases:        c.leases,
+		correlationID: id,
+	}
+}
+
+// requestContext returns the parent context of the requests, carrying the correlation id of the client
+func (c *clientv3) requestContext() context.Context {
+	if c.correlationID == "" {
+		return c.ctx
+	}
+	return metadata.AppendToOutgoingContext(c.ctx, strings.ToLower(HeaderCorrelationID), c.correlationID)
+}
+
+// WithCorrelationID implements the etcd CorrelatedClient interface, tagging the requests of all the
+// clusters supporting it
+func (c *MultiClusterClient) WithCorrelationID(id string) Client {
+	clients := make([]Client, len(c.clients))
+	for i, cl := range c.clients {
+		clients[i] = cl
+		if cc, ok := cl.(CorrelatedClient); ok {
+			clients[i] = cc.WithCorrelationID(id)
+		}
+	}
+	return &MultiClusterClient{clients: clients, set: c.set}
+}
+
+// WithCorrelationID implements the etcd CorrelatedClient interface, if the wrapped client supports it
+func (c *ShardedClient) WithCorrelationID(id string) Client {
+	cp := *c
+	if cc, ok := c.Client.(CorrelatedClient); ok {
+		cp.Client = cc.WithCorrelationID(id)
+	}
+	return &cp
+}
+
+// correlationTransport adds the correlation id carried by the context of the v2 requests as the
+// HeaderCorrelationID header
+type correlationTransport struct {
+	etcd.CancelableTransport
+}
+
+func (t correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id, ok := CorrelationID(req.Context())
+	if !ok {
+		return t.CancelableTransport.RoundTrip(req)
+	}
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set(HeaderCorrelationID, id)
+	return t.CancelableTransport.RoundTrip(r)
+}
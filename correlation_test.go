@@ -0,0 +1,129 @@
+package etcd
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+type dummyTransport struct {
+	headers *[]string
+}
+
+func (t dummyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	*t.headers = append(*t.headers, req.Header.Get(HeaderCorrelationID))
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (dummyTransport) CancelRequest(_ *http.Request) {}
+
+// dummyCorrelatedClient records the correlation ids of the copies reading the entries
+type dummyCorrelatedClient struct {
+	dummyClient
+	id    string
+	mutex *sync.Mutex
+	ids   *[]string
+}
+
+func (c dummyCorrelatedClient) GetEntries(key string) ([]string, error) {
+	c.mutex.Lock()
+	*c.ids = append(*c.ids, c.id)
+	c.mutex.Unlock()
+	return c.dummyClient.GetEntries(key)
+}
+
+func (c dummyCorrelatedClient) WithCorrelationID(id string) Client {
+	c.id = id
+	return c
+}
+
+func TestCorrelationTransport(t *testing.T) {
+	headers := []string{}
+	transport := correlationTransport{dummyTransport{headers: &headers}}
+
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:2379/v2/keys/services/api", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transport.RoundTrip(req.WithContext(WithCorrelationID(context.Background(), "abc-123"))); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(headers, []string{"", "abc-123"}) {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+	if v := req.Header.Get(HeaderCorrelationID); v != "" {
+		t.Errorf("the original request has been modified: %s", v)
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "abc-123")
+
+	v2 := Correlate(ctx, &client{ctx: context.Background()}).(*client)
+	if id, ok := CorrelationID(v2.requestContext()); !ok || id != "abc-123" {
+		t.Errorf("unexpected correlation id: %s", id)
+	}
+
+	v3 := Correlate(ctx, &clientv3{ctx: context.Background()}).(*clientv3)
+	md, _ := metadata.FromOutgoingContext(v3.requestContext())
+	if ids := md.Get(HeaderCorrelationID); !reflect.DeepEqual(ids, []string{"abc-123"}) {
+		t.Errorf("unexpected metadata: %v", md)
+	}
+	if scoped := v3.WithOptions(ClientOptions{Filter: "*"}).(*clientv3); scoped.correlationID != "abc-123" {
+		t.Errorf("the scoped client lost the correlation id")
+	}
+	if c := (&clientv3{ctx: context.Background()}); c.requestContext() != c.ctx {
+		t.Error("unexpected request context")
+	}
+
+	sharded := Correlate(ctx, NewShardedClient(&clientv3{ctx: context.Background()}, 4, "", 0)).(*ShardedClient)
+	if c := sharded.Client.(*clientv3); c.correlationID != "abc-123" || sharded.Shards != 4 {
+		t.Errorf("unexpected sharded client: %+v", sharded)
+	}
+
+	if _, ok := Correlate(ctx, dummyClient{}).(dummyClient); !ok {
+		t.Error("unexpected client")
+	}
+	if Correlate(context.Background(), v2) != Client(v2) {
+		t.Error("unexpected client")
+	}
+}
+
+func TestNewSubscriberWithOptions_correlation(t *testing.T) {
+	ctx, cancel := context.WithCancel(WithCorrelationID(context.Background(), "abc-123"))
+	defer cancel()
+
+	ids := []string{}
+	notify := make(chan struct{})
+	c := dummyCorrelatedClient{
+		dummyClient: dummyClient{
+			getEntries: func(string) ([]string, error) { return []string{"http://10.0.0.1"}, nil },
+			watchPrefix: func(_ string, ch chan struct{}) {
+				ch <- struct{}{}
+				for range notify {
+					ch <- struct{}{}
+				}
+			},
+		},
+		mutex: &sync.Mutex{},
+		ids:   &ids,
+	}
+	if _, err := NewSubscriberWithOptions(ctx, c, "/services/correlation", BackendOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// the notifications are served after the reads triggered by the previous ones
+	notify <- struct{}{}
+	notify <- struct{}{}
+	notify <- struct{}{}
+	cancel()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(ids) < 2 || ids[0] != "abc-123" || ids[1] != "" {
+		t.Errorf("unexpected correlation ids: %v", ids)
+	}
+}
@@ -0,0 +1,62 @@
+package etcd
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Dialer opens the connections to the etcd servers, so the embedders can route the etcd traffic through
+// tunnels, jump hosts or the network shims of their tests. The address is the host:port of the server.
+type Dialer func(ctx context.Context, address string) (net.Conn, error)
+
+var (
+	dialers      = map[string]Dialer{}
+	dialersMutex = &sync.RWMutex{}
+)
+
+// RegisterDialer registers a dialer with the given name, so it can be declared in the config with the
+// dialer option, for all the clusters or for some of them. Registering an existing name replaces it.
+func RegisterDialer(name string, d Dialer) {
+	dialersMutex.Lock()
+	dialers[name] = d
+	dialersMutex.Unlock()
+}
+
+func getDialer(name string) (Dialer, bool) {
+	dialersMutex.RLock()
+	d, ok := dialers[name]
+	dialersMutex.RUnlock()
+	return d, ok
+}
+
+// parseDialer returns the registered dialer named by the value
+func parseDialer(v interface{}) (Dialer, bool) {
+	name, ok := v.(string)
+	if !ok {
+		return nil, false
+	}
+	return getDialer(name)
+}
+
+// WithDialer returns a copy of the options opening the connections with the dialer
+func (o ClientOptions) WithDialer(d Dialer) ClientOptions {
+	o.Dialer = d
+	return o
+}
+
+// dialContext returns the function opening the connections of the v2 clients: the Dialer, if any, bounded
+// by the DialTimeout, or a net.Dialer
+func dialContext(options ClientOptions) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if options.Dialer == nil {
+		return (&net.Dialer{
+			Timeout:   options.DialTimeout,
+			KeepAlive: options.DialKeepAlive,
+		}).DialContext
+	}
+	return func(ctx context.Context, _, address string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, options.DialTimeout)
+		defer cancel()
+		return options.Dialer(ctx, address)
+	}
+}
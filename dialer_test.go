@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var addresses []string
+	d := func(ctx context.Context, address string) (net.Conn, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("the dial should be bounded by the dial timeout")
+		}
+		addresses = append(addresses, address)
+		return (&net.Dialer{}).DialContext(ctx, "tcp", l.Addr().String())
+	}
+
+	dial := dialContext(ClientOptions{DialTimeout: time.Second}.WithDialer(d))
+	conn, err := dial(context.Background(), "tcp", "etcd.internal:2379")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if len(addresses) != 1 || addresses[0] != "etcd.internal:2379" {
+		t.Errorf("unexpected addresses: %v", addresses)
+	}
+
+	conn, err = dialContext(ClientOptions{DialTimeout: time.Second})(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if len(addresses) != 1 {
+		t.Errorf("unexpected addresses: %v", addresses)
+	}
+}
+
+func TestNew_dialer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	RegisterDialer("tunnel", func(ctx context.Context, address string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	})
+
+	c, err := New(ctx, map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"machines": []interface{}{"http://127.0.0.1:2379"},
+			"options":  map[string]interface{}{"dialer": "tunnel"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl, ok := c.(*client); !ok || cl.options.Dialer == nil {
+		t.Errorf("the client should use the dialer: %T", c)
+	}
+
+	c, err = New(ctx, map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"clusters": []interface{}{
+				map[string]interface{}{"name": "eu", "machines": []interface{}{"http://eu:2379"}, "dialer": "tunnel"},
+				map[string]interface{}{"name": "us", "machines": []interface{}{"http://us:2379"}},
+			},
+			"probe_interval": "1h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc, ok := c.(*MultiClusterClient)
+	if !ok {
+		t.Fatalf("unexpected client type: %T", c)
+	}
+	if cl, ok := mc.clients[0].(*client); !ok || cl.options.Dialer == nil {
+		t.Error("the eu cluster should use the dialer")
+	}
+	if cl, ok := mc.clients[1].(*client); !ok || cl.options.Dialer != nil {
+		t.Error("the us cluster should not use the dialer")
+	}
+
+	for _, tc := range []struct {
+		cfg  map[string]interface{}
+		path string
+	}{
+		{
+			cfg: map[string]interface{}{
+				"machines": []interface{}{"http://127.0.0.1:2379"},
+				"options":  map[string]interface{}{"dialer": "ssh"},
+			},
+			path: Namespace + ".options.dialer",
+		},
+		{
+			cfg: map[string]interface{}{
+				"clusters": []interface{}{map[string]interface{}{"machines": []interface{}{"http://eu:2379"}, "dialer": 1}},
+			},
+			path: Namespace + ".clusters[0].dialer",
+		},
+	} {
+		_, err := New(ctx, map[string]interface{}{Namespace: tc.cfg})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+}
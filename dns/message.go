@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	typeA    = 1
+	typeAAAA = 28
+	typeSRV  = 33
+	typeANY  = 255
+	classIN  = 1
+
+	rcodeSuccess  = 0
+	rcodeFormat   = 1
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+	rcodeNotImpl  = 4
+
+	headerSize = 12
+)
+
+var errMalformed = errors.New("dns: malformed message")
+
+// question is the first question of a query. Queries with several questions are answered
+// with the first one, as most servers do.
+type question struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	// raw is the question as received, so it can be echoed in the response
+	raw []byte
+}
+
+// parseQuery returns the header and the first question of the query
+func parseQuery(b []byte) ([]byte, question, error) {
+	if len(b) < headerSize {
+		return nil, question{}, errMalformed
+	}
+	header := b[:headerSize]
+	if binary.BigEndian.Uint16(header[4:]) == 0 {
+		return header, question{}, errMalformed
+	}
+
+	labels := []string{}
+	i := headerSize
+	for {
+		if i >= len(b) {
+			return header, question{}, errMalformed
+		}
+		l := int(b[i])
+		i++
+		if l == 0 {
+			break
+		}
+		// compression pointers are not allowed in the question of a query
+		if l > 63 || i+l > len(b) {
+			return header, question{}, errMalformed
+		}
+		labels = append(labels, string(b[i:i+l]))
+		i += l
+	}
+	if i+4 > len(b) {
+		return header, question{}, errMalformed
+	}
+	return header, question{
+		name:   strings.ToLower(strings.Join(labels, ".")),
+		qtype:  binary.BigEndian.Uint16(b[i:]),
+		qclass: binary.BigEndian.Uint16(b[i+2:]),
+		raw:    b[headerSize : i+4],
+	}, nil
+}
+
+// resource is a record of the answer or the additional sections
+type resource struct {
+	name  string
+	rtype uint16
+	ttl   uint32
+	data  []byte
+}
+
+// newResponse encodes the response to the query with the received header and question
+func newResponse(header []byte, q question, rcode int, answers, extra []resource) []byte {
+	b := make([]byte, headerSize, 512)
+	copy(b, header[:2])
+	// QR and AA set, opcode and RD copied from the query
+	b[2] = 0x84 | header[2]&0x79
+	b[3] = byte(rcode)
+	if q.raw != nil {
+		binary.BigEndian.PutUint16(b[4:], 1)
+		b = append(b, q.raw...)
+	}
+	binary.BigEndian.PutUint16(b[6:], uint16(len(answers)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(extra)))
+	for _, r := range append(answers, extra...) {
+		b = appendName(b, r.name)
+		b = appendUint16(b, r.rtype)
+		b = appendUint16(b, classIN)
+		b = append(b, byte(r.ttl>>24), byte(r.ttl>>16), byte(r.ttl>>8), byte(r.ttl))
+		b = appendUint16(b, uint16(len(r.data)))
+		b = append(b, r.data...)
+	}
+	return b
+}
+
+// srvData encodes the data of a SRV record
+func srvData(priority, weight, port uint16, target string) []byte {
+	b := appendUint16(nil, priority)
+	b = appendUint16(b, weight)
+	b = appendUint16(b, port)
+	return appendName(b, target)
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, l := range strings.Split(strings.Trim(name, "."), ".") {
+		if l == "" {
+			continue
+		}
+		b = append(b, byte(len(l)))
+		b = append(b, l...)
+	}
+	return append(b, 0)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
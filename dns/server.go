@@ -0,0 +1,249 @@
+// Package dns serves the hosts discovered by the etcd subscribers as DNS records, so the sidecars and
+// the legacy clients colocated with the gateway can reuse the same view of the registry.
+//
+//	s := dns.NewServer("etcd.local", 5*time.Second)
+//	s.Add("api", subscriber)
+//	err := s.ListenAndServe(ctx, "127.0.0.1:8053")
+//
+// With the example above, "api.etcd.local" resolves to the A and AAAA records of the discovered IPs
+// and its SRV records point to the hosts and ports. Every discovered IP is also reachable as a name
+// like "10-0-0-1.api.etcd.local", since SRV targets must be names. Only UDP is supported.
+package dns
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsfaith/krakend/sd"
+)
+
+const maxUDPSize = 512
+
+// Server is a DNS responder serving the hosts of a set of subscribers under a domain
+type Server struct {
+	domain      string
+	ttl         uint32
+	subscribers map[string]sd.Subscriber
+	mutex       *sync.RWMutex
+}
+
+// NewServer returns a DNS responder authoritative for the received domain. The ttl of the records
+// should be short, since the discovered hosts can change at any moment.
+func NewServer(domain string, ttl time.Duration) *Server {
+	return &Server{
+		domain:      strings.ToLower(strings.Trim(domain, ".")),
+		ttl:         uint32(ttl / time.Second),
+		subscribers: map[string]sd.Subscriber{},
+		mutex:       &sync.RWMutex{},
+	}
+}
+
+// Add serves the hosts of the subscriber under the received name, relative to the domain of the server
+func (s *Server) Add(name string, subscriber sd.Subscriber) {
+	s.mutex.Lock()
+	s.subscribers[strings.ToLower(strings.Trim(name, "."))] = subscriber
+	s.mutex.Unlock()
+}
+
+// ListenAndServe answers the queries received on the UDP address until the context is canceled
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, conn)
+}
+
+// Serve answers the queries received on the connection until the context is canceled
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		if resp := s.Answer(buf[:n]); resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// Answer returns the response to the received query, or nil if it can not be answered at all
+func (s *Server) Answer(query []byte) []byte {
+	header, q, err := parseQuery(query)
+	if header == nil {
+		return nil
+	}
+	if err != nil {
+		return newResponse(header, question{}, rcodeFormat, nil, nil)
+	}
+	if opcode := (header[2] >> 3) & 0xf; opcode != 0 || q.qclass != classIN {
+		return newResponse(header, q, rcodeNotImpl, nil, nil)
+	}
+
+	name, ok := s.relativeName(q.name)
+	if !ok {
+		return newResponse(header, q, rcodeNXDomain, nil, nil)
+	}
+	service := name
+	hosts, ok, err := s.hosts(service)
+	if err != nil {
+		return newResponse(header, q, rcodeServFail, nil, nil)
+	}
+	if !ok {
+		// it could be the name of a discovered ip
+		i := strings.Index(name, ".")
+		if i < 0 {
+			return newResponse(header, q, rcodeNXDomain, nil, nil)
+		}
+		service = name[i+1:]
+		hosts, ok, err = s.hosts(service)
+		if err != nil {
+			return newResponse(header, q, rcodeServFail, nil, nil)
+		}
+		if !ok {
+			return newResponse(header, q, rcodeNXDomain, nil, nil)
+		}
+		ip := net.ParseIP(strings.Replace(name[:i], "-", ".", -1))
+		if ip == nil {
+			ip = net.ParseIP(strings.Replace(name[:i], "-", ":", -1))
+		}
+		hosts = filterIP(hosts, ip)
+		if len(hosts) == 0 {
+			return newResponse(header, q, rcodeNXDomain, nil, nil)
+		}
+	}
+
+	answers, extra := []resource{}, []resource{}
+	for _, h := range hosts {
+		if q.qtype == typeSRV || q.qtype == typeANY {
+			target := h.host
+			if h.ip != nil {
+				target = ipName(h.ip) + "." + service + "." + s.domain
+				if q.qtype == typeSRV {
+					extra = append(extra, s.ipResource(target, h.ip))
+				}
+			}
+			answers = append(answers, resource{name: q.name, rtype: typeSRV, ttl: s.ttl, data: srvData(10, 10, h.port, target)})
+		}
+		if h.ip != nil && (q.qtype == typeANY || q.qtype == typeA && h.ip.To4() != nil || q.qtype == typeAAAA && h.ip.To4() == nil) {
+			answers = append(answers, s.ipResource(q.name, h.ip))
+		}
+	}
+
+	// keep the response under the UDP limit, preferring the answers to the additional records
+	resp := newResponse(header, q, rcodeSuccess, answers, extra)
+	for len(resp) > maxUDPSize && len(extra) > 0 {
+		extra = extra[:len(extra)-1]
+		resp = newResponse(header, q, rcodeSuccess, answers, extra)
+	}
+	for len(resp) > maxUDPSize && len(answers) > 0 {
+		answers = answers[:len(answers)-1]
+		resp = newResponse(header, q, rcodeSuccess, answers, extra)
+		resp[2] |= 0x02 // truncated
+	}
+	return resp
+}
+
+// relativeName returns the query name without the domain of the server
+func (s *Server) relativeName(name string) (string, bool) {
+	if !strings.HasSuffix(name, "."+s.domain) {
+		return "", false
+	}
+	return strings.TrimSuffix(name, "."+s.domain), true
+}
+
+// hosts returns the parsed hosts of the subscriber with the received name, and the error of the
+// subscriber, if any, so the failed lookups are not answered as empty services
+func (s *Server) hosts(name string) ([]host, bool, error) {
+	s.mutex.RLock()
+	subscriber, ok := s.subscribers[name]
+	s.mutex.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	raw, err := subscriber.Hosts()
+	if err != nil {
+		return nil, true, err
+	}
+	hosts := make([]host, 0, len(raw))
+	for _, r := range raw {
+		if h, ok := parseHost(r); ok {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, true, nil
+}
+
+func (s *Server) ipResource(name string, ip net.IP) resource {
+	if ip4 := ip.To4(); ip4 != nil {
+		return resource{name: name, rtype: typeA, ttl: s.ttl, data: ip4}
+	}
+	return resource{name: name, rtype: typeAAAA, ttl: s.ttl, data: ip.To16()}
+}
+
+// host is a discovered host, split in its parts
+type host struct {
+	host string
+	ip   net.IP
+	port uint16
+}
+
+// parseHost splits the received host. The port defaults to the one of its scheme.
+func parseHost(raw string) (host, bool) {
+	if !strings.Contains(raw, "://") {
+		raw = "//" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return host{}, false
+	}
+	h := host{host: u.Hostname(), ip: net.ParseIP(u.Hostname())}
+	switch p := u.Port(); {
+	case p != "":
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			return host{}, false
+		}
+		h.port = uint16(port)
+	case u.Scheme == "https":
+		h.port = 443
+	default:
+		h.port = 80
+	}
+	return h, true
+}
+
+// ipName returns the name of the ip, replacing the separators with dashes
+func ipName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return strings.Replace(ip4.String(), ".", "-", -1)
+	}
+	return strings.Replace(ip.String(), ":", "-", -1)
+}
+
+func filterIP(hosts []host, ip net.IP) []host {
+	result := []host{}
+	for _, h := range hosts {
+		if ip != nil && h.ip != nil && h.ip.Equal(ip) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
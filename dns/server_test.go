@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func newTestResolver(t *testing.T, s *Server) (*net.Resolver, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Serve(ctx, conn)
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}, cancel
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("etcd.local.", 5*time.Second)
+	s.Add("api", sd.FixedSubscriber{"http://10.0.0.1:8080", "10.0.0.2:9090", "https://[fd00::1]", "http://backend.example.com:8080"})
+	s.Add("empty", sd.FixedSubscriber{})
+
+	r, cancel := newTestResolver(t, s)
+	defer cancel()
+	ctx, done := context.WithTimeout(context.Background(), 5*time.Second)
+	defer done()
+
+	ips, err := r.LookupHost(ctx, "api.etcd.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ips)
+	if expected := []string{"10.0.0.1", "10.0.0.2", "fd00::1"}; !reflect.DeepEqual(ips, expected) {
+		t.Errorf("unexpected ips: %v", ips)
+	}
+
+	_, srvs, err := r.LookupSRV(ctx, "", "", "api.etcd.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []string{}
+	for _, srv := range srvs {
+		targets = append(targets, net.JoinHostPort(srv.Target, strconv.Itoa(int(srv.Port))))
+	}
+	sort.Strings(targets)
+	expected := []string{
+		"10-0-0-1.api.etcd.local.:8080",
+		"10-0-0-2.api.etcd.local.:9090",
+		"backend.example.com.:8080",
+		"fd00--1.api.etcd.local.:443",
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("unexpected targets: %v", targets)
+	}
+
+	ips, err = r.LookupHost(ctx, "10-0-0-2.api.etcd.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ips, []string{"10.0.0.2"}) {
+		t.Errorf("unexpected ips: %v", ips)
+	}
+
+	for _, name := range []string{"unknown.etcd.local", "10-0-0-9.api.etcd.local", "api.example.com"} {
+		if _, err := r.LookupHost(ctx, name); err == nil {
+			t.Errorf("expecting an error resolving %s", name)
+		}
+	}
+}
+
+func TestServer_Answer_malformed(t *testing.T) {
+	s := NewServer("etcd.local", time.Second)
+	if resp := s.Answer([]byte{1, 2, 3}); resp != nil {
+		t.Errorf("unexpected response: %v", resp)
+	}
+	resp := s.Answer([]byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 3, 'a', 'p'})
+	if len(resp) != headerSize || resp[3]&0xf != rcodeFormat {
+		t.Errorf("unexpected response: %v", resp)
+	}
+}
+
+func TestServer_Answer_failedSubscriber(t *testing.T) {
+	s := NewServer("etcd.local", time.Second)
+	s.Add("api", sd.SubscriberFunc(func() ([]string, error) { return nil, errors.New("etcd is down") }))
+	for _, name := range []string{"api", "10-0-0-1.api"} {
+		query := []byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+		for _, label := range strings.Split(name+".etcd.local", ".") {
+			query = append(append(query, byte(len(label))), label...)
+		}
+		query = append(query, 0, 0, typeA, 0, classIN)
+		resp := s.Answer(query)
+		if len(resp) < headerSize || resp[3]&0xf != rcodeServFail {
+			t.Errorf("unexpected response to %s: %v", name, resp)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package etcd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDrainPeriod is the time the instances keep serving once deregistered, when none is defined
+const DefaultDrainPeriod = 5 * time.Second
+
+// DrainOptions defines the options of a Drainer. All values are optional.
+type DrainOptions struct {
+	// Period is the time the instance keeps serving once deregistered, so the watches of its peers
+	// propagate the removal before it stops. DefaultDrainPeriod if it is not defined.
+	Period time.Duration
+	// Maintenance puts the registration in maintenance (see SetMaintenance) during the drain period,
+	// deleting it once the period ends, instead of deleting it right away
+	Maintenance bool
+}
+
+// Drainer removes the registration of an instance (e.g. the gateway itself) before it stops, so its
+// peers stop sending it traffic while it still serves the requests in flight
+type Drainer struct {
+	registrar Registrar
+	key       string
+	options   DrainOptions
+	mutex     *sync.Mutex
+	before    []func(context.Context)
+	after     []func(context.Context)
+}
+
+// NewDrainer returns a drainer removing the registration stored under the key with the received registrar
+func NewDrainer(r Registrar, key string, options DrainOptions) *Drainer {
+	if options.Period <= 0 {
+		options.Period = DefaultDrainPeriod
+	}
+	return &Drainer{
+		registrar: r,
+		key:       key,
+		options:   options,
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// BeforeDeregister registers a function to call when the drain starts, before the registration is
+// removed. e.g. stopping the Heartbeat refreshing it.
+func (d *Drainer) BeforeDeregister(f func(context.Context)) {
+	d.mutex.Lock()
+	d.before = append(d.before, f)
+	d.mutex.Unlock()
+}
+
+// AfterDrain registers a function to call once the drain period ends. e.g. shutting down the router.
+func (d *Drainer) AfterDrain(f func(context.Context)) {
+	d.mutex.Lock()
+	d.after = append(d.after, f)
+	d.mutex.Unlock()
+}
+
+// Drain calls the BeforeDeregister functions, removes (or puts in maintenance) the registration, waits
+// for the drain period and calls the AfterDrain functions. If the context is canceled during the
+// period, the AfterDrain functions are called right away and the error of the context is returned.
+// The failed removals are logged and left to expire.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mutex.Lock()
+	before, after := d.before, d.after
+	d.mutex.Unlock()
+
+	for _, f := range before {
+		f(ctx)
+	}
+	if d.options.Maintenance {
+		d.logFailure(SetMaintenance(d.registrar, d.key))
+	} else {
+		d.logFailure(d.registrar.Deregister(d.key))
+	}
+
+	var err error
+	select {
+	case <-GetClock().After(d.options.Period):
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if d.options.Maintenance {
+		d.logFailure(d.registrar.Deregister(d.key))
+		d.logFailure(ClearMaintenance(d.registrar, d.key))
+	}
+	for _, f := range after {
+		f(ctx)
+	}
+	return err
+}
+
+// DrainOnSignal blocks until the process receives one of the signals (SIGTERM and SIGINT if none is
+// received) and drains the registration. It returns the error of the context, without draining, if it is
+// canceled first.
+func (d *Drainer) DrainOnSignal(ctx context.Context, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	select {
+	case <-ch:
+		return d.Drain(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Drainer) logFailure(err error) {
+	if err != nil {
+		getLogger().Warning("etcd: unable to deregister", d.key+":", err.Error())
+	}
+}
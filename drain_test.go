@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sequenceRegistrar struct {
+	mutex *sync.Mutex
+	steps *[]string
+}
+
+func (r sequenceRegistrar) step(s string) {
+	r.mutex.Lock()
+	*r.steps = append(*r.steps, s)
+	r.mutex.Unlock()
+}
+
+func (r sequenceRegistrar) Register(key, _ string, _ time.Duration) error {
+	r.step("register " + key)
+	return nil
+}
+
+func (r sequenceRegistrar) Deregister(key string) error {
+	r.step("deregister " + key)
+	return nil
+}
+
+func TestDrainer_Drain(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	for _, tc := range []struct {
+		options  DrainOptions
+		expected []string
+	}{
+		{
+			expected: []string{"before", "deregister /gateways/gw-1", "after"},
+		},
+		{
+			options: DrainOptions{Maintenance: true},
+			expected: []string{
+				"before",
+				"register /gateways/gw-1" + MaintenanceSuffix,
+				"deregister /gateways/gw-1",
+				"deregister /gateways/gw-1" + MaintenanceSuffix,
+				"after",
+			},
+		},
+	} {
+		r := sequenceRegistrar{mutex: &sync.Mutex{}, steps: &[]string{}}
+		d := NewDrainer(r, "/gateways/gw-1", tc.options)
+		d.BeforeDeregister(func(context.Context) { r.step("before") })
+		d.AfterDrain(func(context.Context) { r.step("after") })
+
+		done := make(chan error)
+		go func() { done <- d.Drain(context.Background()) }()
+
+		// the registration is removed (or put in maintenance) before the drain period
+		for i := 0; ; i++ {
+			r.mutex.Lock()
+			n := len(*r.steps)
+			r.mutex.Unlock()
+			if n == 2 {
+				break
+			}
+			if i == 1000 {
+				t.Fatal("the registration was not removed")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := advanceUntil(clock, DefaultDrainPeriod, done); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(*r.steps, tc.expected) {
+			t.Errorf("unexpected steps: %v", *r.steps)
+		}
+	}
+}
+
+func TestDrainer_Drain_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := sequenceRegistrar{mutex: &sync.Mutex{}, steps: &[]string{}}
+	d := NewDrainer(r, "/gateways/gw-1", DrainOptions{Period: time.Hour})
+	drained := false
+	d.AfterDrain(func(context.Context) { drained = true })
+
+	if err := d.Drain(ctx); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !drained {
+		t.Error("the after drain functions should be called when the context is canceled")
+	}
+}
+
+// advanceUntil advances the clock by the period until the result is received, since the goroutine sending
+// it may not be waiting for the clock yet (or other goroutines may be waiting for it too)
+func advanceUntil(clock *fakeClock, period time.Duration, result <-chan error) error {
+	for {
+		select {
+		case err := <-result:
+			return err
+		case <-time.After(10 * time.Millisecond):
+			clock.Advance(period)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package etcd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// envelopePrefix marks the values stored as an Envelope
+const envelopePrefix = "etcd-envelope:v1:"
+
+const (
+	// dataKeySize is the size of the data keys generated by Seal (AES-256)
+	dataKeySize = 32
+	// maxDataKeys limits the number of unwrapped data keys kept in memory
+	maxDataKeys = 1024
+)
+
+// KeyManagerMaster is the type of the key managers wrapping the data keys with a local master key. See MasterKey.
+const KeyManagerMaster = "master_key"
+
+// ErrNoKeyManager is returned when decrypting a value without a key manager
+var ErrNoKeyManager = errors.New("etcd: no key manager to decrypt the value")
+
+// Envelope is a value encrypted with AES-GCM using a random data key, stored along with the data key
+// wrapped by a key manager, so the master key never leaves the key manager and it can be rotated without
+// encrypting the values again.
+type Envelope struct {
+	// KeyID identifies the master key wrapping the data key
+	KeyID      string `json:"kid"`
+	DataKey    []byte `json:"key"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KeyManager wraps and unwraps the data keys of the envelopes. The KMS plugins implement it, calling their
+// service, and register a factory with RegisterKeyManagerFactory.
+type KeyManager interface {
+	// Wrap encrypts the data key, returning it along with the id of the master key used
+	Wrap(dataKey []byte) (string, []byte, error)
+	// Unwrap decrypts the data key wrapped with the identified master key
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// KeyManagerFactory creates a KeyManager from its config
+type KeyManagerFactory func(cfg map[string]interface{}) (KeyManager, error)
+
+var (
+	keyManagerFactories = map[string]KeyManagerFactory{
+		KeyManagerMaster: newMasterKey,
+	}
+	keyManagerFactoriesMutex = &sync.RWMutex{}
+)
+
+// keyRing is a key manager along with the data keys it unwrapped, kept in memory so the key manager is
+// not called for every read of the same entry
+type keyRing struct {
+	mutex    *sync.RWMutex
+	manager  KeyManager
+	dataKeys map[string][]byte
+}
+
+func newKeyRing(k KeyManager) *keyRing {
+	return &keyRing{mutex: &sync.RWMutex{}, manager: k, dataKeys: map[string][]byte{}}
+}
+
+// dataKeyRing holds the key manager set with SetKeyManager, used by the clients without their own
+var dataKeyRing = newKeyRing(nil)
+
+// RegisterKeyManagerFactory registers a factory for the key managers of the given type, so they can be
+// declared in the config. Registering an existing type replaces it.
+func RegisterKeyManagerFactory(name string, f KeyManagerFactory) {
+	keyManagerFactoriesMutex.Lock()
+	keyManagerFactories[name] = f
+	keyManagerFactoriesMutex.Unlock()
+}
+
+func getKeyManagerFactory(name string) (KeyManagerFactory, bool) {
+	keyManagerFactoriesMutex.RLock()
+	f, ok := keyManagerFactories[name]
+	keyManagerFactoriesMutex.RUnlock()
+	return f, ok
+}
+
+// SetKeyManager sets the key manager unwrapping the data keys of the encrypted values. A nil key manager
+// disables the decryption, which is the default, so the encrypted entries are discarded. The clients
+// created by New with an encryption config use their own key manager.
+func SetKeyManager(k KeyManager) {
+	dataKeyRing.mutex.Lock()
+	dataKeyRing.manager = k
+	dataKeyRing.dataKeys = map[string][]byte{}
+	dataKeyRing.mutex.Unlock()
+}
+
+// parseKeyManager parses the encryption config: {"type": "master_key", "key_id": "k1", "key": "<base64>"}
+func parseKeyManager(v interface{}) (KeyManager, error) {
+	path := Namespace + ".encryption"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, badConfig(path)
+	}
+	name, _ := cfg["type"].(string)
+	f, ok := getKeyManagerFactory(name)
+	if !ok {
+		return nil, badConfig(path + ".type")
+	}
+	k, err := f(cfg)
+	if err != nil {
+		return nil, withPath(path, err)
+	}
+	return k, nil
+}
+
+// Seal encrypts the value with a new data key wrapped by the key manager, returning it in the format
+// decrypted by the clients. The registrars storing sensitive values use it before writing them.
+func Seal(k KeyManager, value []byte) (string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := k.Wrap(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce, ciphertext, err := sealAESGCM(dataKey, value)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(Envelope{KeyID: keyID, DataKey: wrapped, Nonce: nonce, Ciphertext: ciphertext})
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + string(b), nil
+}
+
+// decryptValue returns the plaintext of the values stored as an Envelope, unwrapping their data keys
+// with the key ring, and the rest of the values as they are
+func decryptValue(r *keyRing, value string) (string, error) {
+	if !strings.HasPrefix(value, envelopePrefix) {
+		return value, nil
+	}
+	var e Envelope
+	if err := json.Unmarshal([]byte(value[len(envelopePrefix):]), &e); err != nil {
+		return "", err
+	}
+	dataKey, err := r.unwrap(e.KeyID, e.DataKey)
+	if err != nil {
+		return "", err
+	}
+	b, err := openAESGCM(dataKey, e.Nonce, e.Ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// unwrap returns the unwrapped data key, keeping it in memory so the key manager is not called for every
+// read of the same entry
+func (r *keyRing) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	id := keyID + ":" + string(wrapped)
+	r.mutex.RLock()
+	k := r.manager
+	dataKey, ok := r.dataKeys[id]
+	r.mutex.RUnlock()
+	if ok {
+		return dataKey, nil
+	}
+	if k == nil {
+		return nil, ErrNoKeyManager
+	}
+	dataKey, err := k.Unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.Lock()
+	if r.manager == k {
+		if len(r.dataKeys) >= maxDataKeys {
+			r.dataKeys = map[string][]byte{}
+		}
+		r.dataKeys[id] = dataKey
+	}
+	r.mutex.Unlock()
+	return dataKey, nil
+}
+
+func sealAESGCM(key, plaintext []byte) ([]byte, []byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func openAESGCM(key, nonce, ciphertext []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("etcd: bad nonce size: %d", len(nonce))
+	}
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// MasterKey is a KeyManager wrapping the data keys with AES-GCM and a local master key. The master keys
+// of a KMS are safer, since they never leave it.
+type MasterKey struct {
+	ID  string
+	key []byte
+}
+
+// NewMasterKey returns a MasterKey with the given id. The key must have 16, 24 or 32 bytes.
+func NewMasterKey(id string, key []byte) (*MasterKey, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return &MasterKey{ID: id, key: key}, nil
+}
+
+// Wrap implements the KeyManager interface. The wrapped key is the nonce followed by the ciphertext.
+func (m *MasterKey) Wrap(dataKey []byte) (string, []byte, error) {
+	nonce, ciphertext, err := sealAESGCM(m.key, dataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return m.ID, append(nonce, ciphertext...), nil
+}
+
+// Unwrap implements the KeyManager interface
+func (m *MasterKey) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != m.ID {
+		return nil, fmt.Errorf("etcd: unknown master key: %s", keyID)
+	}
+	aead, err := newAESGCM(m.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("etcd: bad wrapped key size: %d", len(wrapped))
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+// newMasterKey creates a MasterKey from the base64 encoded key, declared inline (key) or in a file
+// (key_file), so it can be mounted as a secret
+func newMasterKey(cfg map[string]interface{}) (KeyManager, error) {
+	encoded, _ := cfg["key"].(string)
+	if path, ok := cfg["key_file"].(string); ok {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, badConfig("key_file")
+		}
+		encoded = strings.TrimSpace(string(b))
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) == 0 {
+		return nil, badConfig("key")
+	}
+	id, _ := cfg["key_id"].(string)
+	m, err := NewMasterKey(id, key)
+	if err != nil {
+		return nil, badConfig("key")
+	}
+	return m, nil
+}
@@ -0,0 +1,139 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type countingKeyManager struct {
+	KeyManager
+	unwraps int
+}
+
+func (k *countingKeyManager) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	k.unwraps++
+	return k.KeyManager.Unwrap(keyID, wrapped)
+}
+
+func TestSeal(t *testing.T) {
+	defer SetKeyManager(nil)
+
+	m, err := NewMasterKey("k1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := Seal(m, []byte(`{"host": "10.0.0.1", "port": 8080}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(value, envelopePrefix) || strings.Contains(value, "10.0.0.1") {
+		t.Errorf("unexpected sealed value: %s", value)
+	}
+
+	options := ClientOptions{EntryFormat: EntryFormatJSON}
+	before := Metrics()[MetricDecryptionFailures]
+	if _, ok := decodeEntry(options, "/services/api/1", value); ok {
+		t.Error("the entry should be discarded without a key manager")
+	}
+	if v := Metrics()[MetricDecryptionFailures] - before; v != 1 {
+		t.Errorf("unexpected decryption failures: %d", v)
+	}
+
+	k := &countingKeyManager{KeyManager: m}
+	SetKeyManager(k)
+	for i := 0; i < 2; i++ {
+		hosts, ok := decodeEntry(options, "/services/api/1", value)
+		if !ok || !reflect.DeepEqual(hosts, []Host{{URL: "10.0.0.1:8080"}}) {
+			t.Errorf("unexpected hosts: %v", hosts)
+		}
+	}
+	if k.unwraps != 1 {
+		t.Errorf("the data key should be unwrapped once. unwraps: %d", k.unwraps)
+	}
+
+	if hosts, ok := decodeEntry(ClientOptions{}, "/services/api/2", "10.0.0.2:8080"); !ok || len(hosts) != 1 {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+
+	other, _ := NewMasterKey("k2", bytes.Repeat([]byte{2}, 32))
+	SetKeyManager(other)
+	if _, ok := decodeEntry(options, "/services/api/1", value); ok {
+		t.Error("the entry should be discarded with another master key")
+	}
+}
+
+func TestNewMasterKey(t *testing.T) {
+	if _, err := NewMasterKey("k1", []byte("short")); err == nil {
+		t.Error("expecting an error")
+	}
+	m, err := NewMasterKey("k1", bytes.Repeat([]byte{1}, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, wrapped, err := m.Wrap([]byte("data key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Unwrap("k2", wrapped); err == nil {
+		t.Error("expecting an error")
+	}
+	if _, err := m.Unwrap(id, wrapped[:4]); err == nil {
+		t.Error("expecting an error")
+	}
+	if key, err := m.Unwrap(id, wrapped); err != nil || string(key) != "data key" {
+		t.Errorf("unexpected key: %q %v", key, err)
+	}
+}
+
+func TestNew_encryption(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "master_key", path: Namespace + ".encryption"},
+		{cfg: map[string]interface{}{"type": "vault"}, path: Namespace + ".encryption.type"},
+		{cfg: map[string]interface{}{"type": "master_key", "key": "not base64"}, path: Namespace + ".encryption.key"},
+		{cfg: map[string]interface{}{"type": "master_key", "key": "c2hvcnQ="}, path: Namespace + ".encryption.key"},
+		{cfg: map[string]interface{}{"type": "master_key", "key_file": "unknown.key"}, path: Namespace + ".encryption.key_file"},
+	} {
+		_, err := New(context.Background(), map[string]interface{}{
+			Namespace: map[string]interface{}{"machines": []interface{}{"http://127.0.0.1:2379"}, "encryption": tc.cfg},
+		})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+
+	f, err := ioutil.TempFile("", "master.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(key + "\n")
+	f.Close()
+
+	c, err := New(context.Background(), map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"machines":   []interface{}{"http://127.0.0.1:2379"},
+			"encryption": map[string]interface{}{"type": "master_key", "key_id": "k1", "key_file": f.Name()},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := NewMasterKey("k1", bytes.Repeat([]byte{1}, 32))
+	value, _ := Seal(m, []byte("10.0.0.1:8080"))
+	if v, err := decryptValue(settingsOf(c).keyRing(), value); err != nil || v != "10.0.0.1:8080" {
+		t.Errorf("unexpected value: %q %v", v, err)
+	}
+	if _, err := decryptValue(dataKeyRing, value); err != ErrNoKeyManager {
+		t.Errorf("the key manager of the client should not be used by the process: %v", err)
+	}
+}
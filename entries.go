@@ -0,0 +1,310 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// decodeEntry returns the hosts in rotation described by the received key-value pair, according to the
+// client options. The returned flag is false if the entry should be discarded.
+func decodeEntry(options ClientOptions, key, value string) ([]Host, bool) {
+	hosts, ok := decodeHosts(options, key, value)
+	if !ok {
+		return nil, false
+	}
+	return inRotation(hosts), true
+}
+
+// decodeHosts returns all the hosts described by the received key-value pair, including the ones in
+// maintenance
+func decodeHosts(options ClientOptions, key, value string) ([]Host, bool) {
+	if options.Filter != "" {
+		if ok, err := path.Match(options.Filter, keySuffix(key)); !ok || err != nil {
+			return nil, false
+		}
+	}
+	if options.HostSource == HostSourceKeySuffix {
+		return []Host{{URL: keySuffix(key)}}, true
+	}
+	value, err := decryptValue(options.settings.keyRing(), value)
+	if err != nil {
+		addMetric(MetricDecryptionFailures, 1)
+		return nil, false
+	}
+	value, err = decompressValue(options.ValueEncoding, value)
+	if err != nil {
+		return nil, false
+	}
+
+	codec, ok := getCodec(options.EntryFormat)
+	if !ok {
+		addMetric(MetricRejectedEntries, 1)
+		return nil, false
+	}
+	values := []string{value}
+	if options.MultiValue {
+		if values, ok = splitValues(options.EntryFormat, value); !ok {
+			addMetric(MetricRejectedEntries, 1)
+			return nil, false
+		}
+	}
+
+	result := []Host{}
+	for _, v := range values {
+		if options.EntrySchema != nil && options.EntryFormat == EntryFormatJSON {
+			var doc interface{}
+			if err := json.Unmarshal([]byte(v), &doc); err != nil || options.EntrySchema.Validate(doc) != nil {
+				addMetric(MetricRejectedEntries, 1)
+				return nil, false
+			}
+		}
+		hosts, err := codec.Decode([]byte(v))
+		if err != nil {
+			addMetric(MetricRejectedEntries, 1)
+			return nil, false
+		}
+		result = append(result, hosts...)
+	}
+	return result, true
+}
+
+// splitValues splits a value holding several entries: a JSON array (of urls for the raw format, or of
+// records for the json one) or, for the raw format, a comma separated list of urls. The other values
+// are returned as a single entry.
+func splitValues(format, value string) ([]string, bool) {
+	raw := format == "" || format == EntryFormatRaw
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "[") && (raw || format == EntryFormatJSON) {
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &items); err != nil {
+			return nil, false
+		}
+		values := make([]string, len(items))
+		for i, item := range items {
+			values[i] = string(item)
+			if raw {
+				if err := json.Unmarshal(item, &values[i]); err != nil {
+					return nil, false
+				}
+			}
+		}
+		return values, true
+	}
+	if !raw {
+		return []string{value}, true
+	}
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values, true
+}
+
+// inRotation returns the hosts not in maintenance
+func inRotation(hosts []Host) []Host {
+	result := make([]Host, 0, len(hosts))
+	for _, h := range hosts {
+		if !h.Maintenance {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// decodeEntryURLs returns the urls of the hosts described by the received key-value pair
+func decodeEntryURLs(options ClientOptions, key, value string) ([]string, bool) {
+	hosts, ok := decodeEntry(options, key, value)
+	if !ok {
+		return nil, false
+	}
+	return hostURLs(hosts), true
+}
+
+// hostURLs returns the urls of the received hosts
+func hostURLs(hosts []Host) []string {
+	if hosts == nil {
+		return nil
+	}
+	urls := make([]string, len(hosts))
+	for i, h := range hosts {
+		urls[i] = h.URL
+	}
+	return urls
+}
+
+// getHosts returns the hosts stored under the prefix, with their metadata and the revision they were
+// read at if the client supports them
+func getHosts(c Client, prefix string) ([]Host, int64, error) {
+	hosts, header, err := getHostsWithHeader(c, prefix)
+	return hosts, header.Revision, err
+}
+
+// getHostsWithHeader returns the hosts stored under the prefix like getHosts, along with the header of
+// the response they were read from if the client supports it
+func getHostsWithHeader(c Client, prefix string) ([]Host, ResponseHeader, error) {
+	if hc, ok := c.(HeaderClient); ok {
+		return hc.GetHostsWithHeader(prefix)
+	}
+	if rc, ok := c.(RevisionClient); ok {
+		hosts, revision, err := rc.GetHostsWithRevision(prefix)
+		return hosts, ResponseHeader{Revision: revision}, err
+	}
+	if hc, ok := c.(HostsClient); ok {
+		hosts, err := hc.GetHosts(prefix)
+		return hosts, ResponseHeader{}, err
+	}
+	entries, err := c.GetEntries(prefix)
+	if err != nil {
+		return nil, ResponseHeader{}, err
+	}
+	hosts := make([]Host, len(entries))
+	for i, e := range entries {
+		hosts[i] = Host{URL: e}
+	}
+	return hosts, ResponseHeader{}, nil
+}
+
+// keySuffix returns the last segment of the received key
+func keySuffix(key string) string {
+	key = strings.TrimRight(key, "/")
+	if key == "" {
+		return ""
+	}
+	return path.Base(key)
+}
+
+// normalize applies the backend options to every discovered host
+func (o BackendOptions) normalize(hosts []string) []string {
+	result := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		h = mapPort(normalizeHost(h, o.DefaultScheme, o.DefaultPort), o.PortMap)
+		if !o.inNetworks(h) {
+			continue
+		}
+		result = append(result, h)
+	}
+	if o.DedupHosts {
+		return dedupHosts(result)
+	}
+	return result
+}
+
+// normalizeHosts applies the backend options to the urls of every discovered host
+func (o BackendOptions) normalizeHosts(hosts []Host) []Host {
+	result := make([]Host, 0, len(hosts))
+	seen := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		h.URL = mapPort(normalizeHost(h.URL, o.DefaultScheme, o.DefaultPort), o.PortMap)
+		if !o.inNetworks(h.URL) {
+			addMetric(MetricOutOfRangeHosts, 1)
+			continue
+		}
+		if _, ok := seen[h.URL]; ok && o.DedupHosts {
+			continue
+		}
+		seen[h.URL] = struct{}{}
+		result = append(result, h)
+	}
+	return result
+}
+
+// normalizeHost adds the default scheme and port to the received host if they are missing and
+// wraps any IPv6 literal in brackets, so the result can be parsed as an URL
+func normalizeHost(host, scheme, port string) string {
+	if host == "" {
+		return host
+	}
+	prefix := ""
+	if i := strings.Index(host, "://"); i >= 0 {
+		prefix, host = host[:i+3], host[i+3:]
+	} else if scheme != "" {
+		prefix = scheme + "://"
+	}
+
+	authority, suffix := host, ""
+	if i := strings.Index(host, "/"); i >= 0 {
+		authority, suffix = host[:i], host[i:]
+	}
+	h, p := splitAuthority(authority)
+	if p == "" {
+		p = port
+	}
+	return prefix + joinAuthority(h, p) + suffix
+}
+
+// mapPort replaces the port of the host with the one mapped to it, if any. The hosts without an
+// explicit port are not mapped.
+func mapPort(host string, ports map[string]string) string {
+	if len(ports) == 0 {
+		return host
+	}
+	prefix, authority, suffix := "", host, ""
+	if i := strings.Index(authority, "://"); i >= 0 {
+		prefix, authority = authority[:i+3], authority[i+3:]
+	}
+	if i := strings.Index(authority, "/"); i >= 0 {
+		authority, suffix = authority[:i], authority[i:]
+	}
+	h, p := splitAuthority(authority)
+	mapped, ok := ports[p]
+	if p == "" || !ok {
+		return host
+	}
+	return prefix + joinAuthority(h, mapped) + suffix
+}
+
+// splitAuthority returns the host and the port of the received authority. Bare IPv6 literals
+// are returned as hosts without port. The zone identifiers of the bracketed IPv6 literals are
+// unescaped (e.g. "[fe80::1%25eth0]" returns "fe80::1%eth0"), while the bare ones are already raw.
+func splitAuthority(authority string) (string, string) {
+	bracketed := strings.HasPrefix(authority, "[")
+	if h, p, err := net.SplitHostPort(authority); err == nil {
+		if bracketed {
+			h = unescapeZone(h)
+		}
+		return h, p
+	}
+	if bracketed && strings.HasSuffix(authority, "]") {
+		return unescapeZone(authority[1 : len(authority)-1]), ""
+	}
+	return authority, ""
+}
+
+// unescapeZone unescapes the zone identifier of an IPv6 literal taken from the brackets of an
+// authority, leaving it as it is if it is not properly escaped
+func unescapeZone(host string) string {
+	i := strings.Index(host, "%")
+	if i < 0 {
+		return host
+	}
+	zone, err := url.PathUnescape(host[i:])
+	if err != nil {
+		return host
+	}
+	return host[:i] + zone
+}
+
+// joinAuthority combines the host and the port, wrapping IPv6 literals in brackets and escaping
+// their zone identifier as required by RFC 6874. The zone of the host must be raw (e.g.
+// "fe80::1%eth0"), as returned by splitAuthority.
+func joinAuthority(host, port string) string {
+	addr, zone := host, ""
+	if i := strings.Index(host, "%"); i >= 0 {
+		addr, zone = host[:i], host[i+1:]
+	}
+	if ip := net.ParseIP(addr); ip != nil && strings.Contains(addr, ":") {
+		if zone != "" {
+			addr += "%25" + strings.Replace(zone, "%", "%25", -1)
+		}
+		host = "[" + addr + "]"
+	}
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
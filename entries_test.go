@@ -0,0 +1,203 @@
+package etcd
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestDecodeEntry_hostSource(t *testing.T) {
+	for _, tc := range []struct {
+		source   string
+		key      string
+		value    string
+		expected string
+	}{
+		{"", "/services/api/1", "http://10.0.0.1:8080", "http://10.0.0.1:8080"},
+		{HostSourceValue, "/services/api/1", "http://10.0.0.1:8080", "http://10.0.0.1:8080"},
+		{HostSourceKeySuffix, "/services/api/10.0.0.1:8080", "", "10.0.0.1:8080"},
+		{HostSourceKeySuffix, "/services/api/10.0.0.1:8080/", "ignored", "10.0.0.1:8080"},
+		{HostSourceKeySuffix, "10.0.0.1:8080", "", "10.0.0.1:8080"},
+		{HostSourceKeySuffix, "", "", ""},
+	} {
+		if host, _ := decodeURL(ClientOptions{HostSource: tc.source}, tc.key, tc.value); host != tc.expected {
+			t.Errorf("unexpected host for %s=%s. have: %s, want: %s", tc.key, tc.value, host, tc.expected)
+		}
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	for _, tc := range []struct {
+		host     string
+		scheme   string
+		port     string
+		expected string
+	}{
+		{"10.0.0.1:8080", "", "", "10.0.0.1:8080"},
+		{"10.0.0.1:8080", "http", "", "http://10.0.0.1:8080"},
+		{"10.0.0.1", "http", "8080", "http://10.0.0.1:8080"},
+		{"10.0.0.1", "", "8080", "10.0.0.1:8080"},
+		{"https://10.0.0.1", "http", "8443", "https://10.0.0.1:8443"},
+		{"https://10.0.0.1:9000", "http", "8443", "https://10.0.0.1:9000"},
+		{"api.local/base", "http", "80", "http://api.local:80/base"},
+		{"", "http", "80", ""},
+		{"2001:db8::1", "", "", "[2001:db8::1]"},
+		{"2001:db8::1", "http", "8080", "http://[2001:db8::1]:8080"},
+		{"[2001:db8::1]", "http", "8080", "http://[2001:db8::1]:8080"},
+		{"[2001:db8::1]:9000", "http", "8080", "http://[2001:db8::1]:9000"},
+		{"https://2001:db8::1/base", "", "", "https://[2001:db8::1]/base"},
+		{"fe80::1%eth0", "http", "", "http://[fe80::1%25eth0]"},
+		{"[fe80::1%25eth0]:8080", "http", "", "http://[fe80::1%25eth0]:8080"},
+		{"[fe80::1%25eth0]", "http", "8080", "http://[fe80::1%25eth0]:8080"},
+		{"fe80::1%25", "http", "", "http://[fe80::1%2525]"},
+		{"fe80::1%251", "http", "8080", "http://[fe80::1%25251]:8080"},
+		{"[fe80::1%25251]:8080", "http", "", "http://[fe80::1%25251]:8080"},
+		{"::ffff:10.0.0.1", "", "80", "[::ffff:10.0.0.1]:80"},
+	} {
+		if host := normalizeHost(tc.host, tc.scheme, tc.port); host != tc.expected {
+			t.Errorf("unexpected host for %s. have: %s, want: %s", tc.host, host, tc.expected)
+		}
+	}
+}
+
+func TestBackendOptions_normalize_dualStack(t *testing.T) {
+	hosts := []string{"10.0.0.1:8080", "2001:db8::1", "[2001:db8::2]:8080", "fe80::1%eth0"}
+	expected := []string{
+		"http://10.0.0.1:8080",
+		"http://[2001:db8::1]:8080",
+		"http://[2001:db8::2]:8080",
+		"http://[fe80::1%25eth0]:8080",
+	}
+	result := BackendOptions{DefaultScheme: "http", DefaultPort: "8080"}.normalize(hosts)
+	for i, h := range result {
+		if h != expected[i] {
+			t.Errorf("unexpected host #%d. have: %s, want: %s", i, h, expected[i])
+			continue
+		}
+		if _, err := url.Parse(h); err != nil {
+			t.Errorf("unable to parse the host #%d: %s", i, err.Error())
+		}
+	}
+}
+
+func TestBackendOptions_normalize_portMap(t *testing.T) {
+	options, err := parseBackendOptions(config.ExtraConfig{Namespace: map[string]interface{}{
+		"default_port": "8080",
+		"port_map":     map[string]interface{}{"8080": "31080", "8443": 31443.0},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := []string{"10.0.0.1", "https://10.0.0.2:8443/api", "[2001:db8::1]:8080", "10.0.0.3:9090"}
+	expected := []string{"10.0.0.1:31080", "https://10.0.0.2:31443/api", "[2001:db8::1]:31080", "10.0.0.3:9090"}
+	if result := options.normalize(hosts); !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected hosts: %v", result)
+	}
+	if result := options.normalizeHosts([]Host{{URL: "http://10.0.0.1:8080", Priority: 1}}); result[0].URL != "http://10.0.0.1:31080" || result[0].Priority != 1 {
+		t.Errorf("unexpected hosts: %+v", result)
+	}
+
+	for _, v := range []interface{}{
+		map[string]interface{}{"http": "31080"},
+		map[string]interface{}{"8080": "70000"},
+		map[string]interface{}{"8080": true},
+		"8080:31080",
+	} {
+		_, err := parseBackendOptions(config.ExtraConfig{Namespace: map[string]interface{}{"port_map": v}})
+		if err == nil || err.(*ConfigError).Path != Namespace+".port_map" {
+			t.Errorf("unexpected error parsing %v: %v", v, err)
+		}
+	}
+}
+
+func TestDecodeEntry_multiValue(t *testing.T) {
+	for i, tc := range []struct {
+		options  ClientOptions
+		value    string
+		expected []string
+		ok       bool
+	}{
+		{options: ClientOptions{MultiValue: true}, value: "http://10.0.0.1:8080, http://10.0.1.1:8080", expected: []string{"http://10.0.0.1:8080", "http://10.0.1.1:8080"}, ok: true},
+		{options: ClientOptions{MultiValue: true}, value: `["http://10.0.0.1:8080", "http://10.0.1.1:8080"]`, expected: []string{"http://10.0.0.1:8080", "http://10.0.1.1:8080"}, ok: true},
+		{options: ClientOptions{MultiValue: true}, value: "http://10.0.0.1:8080", expected: []string{"http://10.0.0.1:8080"}, ok: true},
+		{options: ClientOptions{MultiValue: true, EntryFormat: EntryFormatJSON}, value: `[{"host": "10.0.0.1", "port": 8080}, {"host": "10.0.1.1", "port": 8080}]`, expected: []string{"10.0.0.1:8080", "10.0.1.1:8080"}, ok: true},
+		{options: ClientOptions{MultiValue: true, EntryFormat: EntryFormatJSON}, value: `{"host": "10.0.0.1", "port": 8080}`, expected: []string{"10.0.0.1:8080"}, ok: true},
+		{options: ClientOptions{MultiValue: true, EntryFormat: EntryFormatJSON}, value: `[{"host": "10.0.0.1"}, {"port": 8080}]`},
+		{options: ClientOptions{MultiValue: true}, value: `["http://10.0.0.1:8080", 42]`},
+		{options: ClientOptions{}, value: "http://10.0.0.1:8080,http://10.0.1.1:8080", expected: []string{"http://10.0.0.1:8080,http://10.0.1.1:8080"}, ok: true},
+	} {
+		hosts, ok := decodeEntryURLs(tc.options, "/services/api/1", tc.value)
+		if ok != tc.ok || !reflect.DeepEqual(hosts, tc.expected) {
+			t.Errorf("unexpected hosts of the entry %d: %v %v", i, hosts, ok)
+		}
+	}
+}
+
+func TestDecodeEntry(t *testing.T) {
+	for _, tc := range []struct {
+		options  ClientOptions
+		key      string
+		value    string
+		expected string
+		ok       bool
+	}{
+		{ClientOptions{}, "/services/api/1", "10.0.0.1:8080", "10.0.0.1:8080", true},
+		{ClientOptions{Filter: "node-*"}, "/services/api/1", "10.0.0.1:8080", "", false},
+		{ClientOptions{Filter: "node-*"}, "/services/api/node-1", "10.0.0.1:8080", "10.0.0.1:8080", true},
+		{ClientOptions{EntryFormat: EntryFormatJSON}, "/services/api/1", `{"host":"10.0.0.1","port":8080,"scheme":"http"}`, "http://10.0.0.1:8080", true},
+		{ClientOptions{EntryFormat: EntryFormatJSON}, "/services/api/1", `{"host":"2001:db8::1","port":"8080"}`, "[2001:db8::1]:8080", true},
+		{ClientOptions{EntryFormat: EntryFormatJSON}, "/services/api/1", `{"host":"api.local"}`, "api.local", true},
+		{ClientOptions{EntryFormat: EntryFormatJSON}, "/services/api/1", `{"port":8080}`, "", false},
+		{ClientOptions{EntryFormat: EntryFormatJSON}, "/services/api/1", `10.0.0.1:8080`, "", false},
+		{ClientOptions{EntryFormat: EntryFormatJSON, HostSource: HostSourceKeySuffix}, "/services/api/10.0.0.1:8080", "", "10.0.0.1:8080", true},
+	} {
+		host, ok := decodeURL(tc.options, tc.key, tc.value)
+		if ok != tc.ok || host != tc.expected {
+			t.Errorf("unexpected result for %s=%s. have: %s (%v), want: %s (%v)", tc.key, tc.value, host, ok, tc.expected, tc.ok)
+		}
+	}
+}
+
+// decodeURL returns the url of the first host described by the entry
+func decodeURL(options ClientOptions, key, value string) (string, bool) {
+	urls, ok := decodeEntryURLs(options, key, value)
+	if !ok || len(urls) == 0 {
+		return "", false
+	}
+	return urls[0], true
+}
+
+func FuzzDecodeEntry(f *testing.F) {
+	for _, seed := range []struct {
+		format string
+		value  string
+	}{
+		{EntryFormatJSON, `{"host":"10.0.0.1","port":8080,"scheme":"http","metadata":{"zone":"eu"},"priority":"1"}`},
+		{EntryFormatJSON, `{"host":"2001:db8::1","port":"80a","maintenance":true}`},
+		{EntryFormatJSON, `{"host":[],"priority":1e99}`},
+		{EntryFormatYAML, "host: 10.0.0.1\nport: 8080\nmetadata:\n  zone: eu\n"},
+		{EntryFormatGoMicro, `{"name":"api","nodes":[{"id":"1","address":"10.0.0.1:8080","metadata":{"protocol":"http"}}]}`},
+		{EntryFormatSkyDNS, `{"host":"10.0.0.1","port":8080,"priority":10,"weight":5}`},
+		{EntryFormatProtobuf, "\x0a\x0810.0.0.1\x10\x90\x3f"},
+		{EntryFormatRaw, "10.0.0.1:8080"},
+	} {
+		f.Add(seed.format, seed.value, false)
+	}
+	f.Fuzz(func(t *testing.T, format, value string, gzipped bool) {
+		options := ClientOptions{EntryFormat: format}
+		if gzipped {
+			options.ValueEncoding = ValueEncodingAuto
+		}
+		hosts, ok := decodeEntry(options, "/services/fuzz/1", value)
+		if !ok {
+			return
+		}
+		for _, h := range hosts {
+			if h.Maintenance {
+				t.Errorf("host in maintenance returned: %+v", h)
+			}
+		}
+	})
+}
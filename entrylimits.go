@@ -0,0 +1,74 @@
+package etcd
+
+import "fmt"
+
+const (
+	// LimitPolicyTruncate makes the clients discard the entries exceeding the MaxValueBytes and the ones
+	// beyond the MaxEntriesPerPrefix, keeping the rest of the read. This is the default.
+	LimitPolicyTruncate = "truncate"
+	// LimitPolicyReject makes the clients fail the reads of the prefixes holding an entry larger than the
+	// MaxValueBytes or more entries than the MaxEntriesPerPrefix, so the subscribers keep their last hosts
+	LimitPolicyReject = "reject"
+)
+
+// ErrLimitExceeded is the error wrapped by the LimitErrors
+var ErrLimitExceeded = fmt.Errorf("entry limit exceeded")
+
+// LimitError is the error returned by the clients rejecting the read of a prefix exceeding the
+// ClientOptions.MaxValueBytes or MaxEntriesPerPrefix. See LimitPolicyReject.
+type LimitError struct {
+	// Prefix is the prefix read
+	Prefix string
+	// Key is the key of the first entry exceeding the limit
+	Key string
+	// Limit is the name of the option exceeded: max_value_bytes or max_entries_per_prefix
+	Limit string
+}
+
+// Error implements the error interface
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: the entry %s of the prefix %s exceeds the %s", ErrLimitExceeded.Error(), e.Key, e.Prefix, e.Limit)
+}
+
+// Unwrap returns ErrLimitExceeded
+func (*LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// entryLimiter applies the MaxValueBytes and MaxEntriesPerPrefix of the client options to the entries of
+// a read, in the order they are received
+type entryLimiter struct {
+	options ClientOptions
+	prefix  string
+	entries int
+}
+
+// admit reports whether the entry must be decoded. It returns a LimitError instead if the entry exceeds
+// a limit and the policy rejects the whole read.
+func (l *entryLimiter) admit(key, value string) (bool, error) {
+	limit := ""
+	switch {
+	case l.options.MaxValueBytes > 0 && len(value) > l.options.MaxValueBytes:
+		limit = "max_value_bytes"
+	case l.options.MaxEntriesPerPrefix > 0 && l.entries >= l.options.MaxEntriesPerPrefix:
+		limit = "max_entries_per_prefix"
+	default:
+		l.entries++
+		return true, nil
+	}
+	if l.options.LimitPolicy == LimitPolicyReject {
+		addMetric(MetricLimitedReads, 1)
+		return false, &LimitError{Prefix: l.prefix, Key: key, Limit: limit}
+	}
+	addMetric(MetricLimitedEntries, 1)
+	return false, nil
+}
+
+// parseEntryLimit parses the non negative limits of the entries
+func parseEntryLimit(v interface{}) (int, bool) {
+	n, ok := v.(float64)
+	if !ok || n < 0 {
+		return 0, false
+	}
+	return int(n), true
+}
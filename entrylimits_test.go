@@ -0,0 +1,93 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func limitedClientV3(options ClientOptions) *clientv3 {
+	kvs := []*mvccpb.KeyValue{}
+	for i := 0; i < 4; i++ {
+		kvs = append(kvs, &mvccpb.KeyValue{Key: []byte(fmt.Sprintf("/services/limited/%d", i)), Value: []byte(fmt.Sprintf("http://10.0.0.%d", i))})
+	}
+	kvs[1].Value = []byte("http://" + strings.Repeat("a", 100))
+	return &clientv3{
+		client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{
+			Header: &etcdv3.ResponseHeader{Revision: 50},
+			Kvs:    kvs,
+			Count:  int64(len(kvs)),
+		}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+		options: options,
+	}
+}
+
+func TestClientV3_entryLimits_truncate(t *testing.T) {
+	before := Metrics()[MetricLimitedEntries]
+	c := limitedClientV3(ClientOptions{MaxValueBytes: 64, MaxEntriesPerPrefix: 2})
+
+	hosts, err := c.GetEntries("/services/limited/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://10.0.0.0", "http://10.0.0.2"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+	if got := Metrics()[MetricLimitedEntries] - before; got != 2 {
+		t.Errorf("unexpected limited entries: %d", got)
+	}
+}
+
+func TestClientV3_entryLimits_reject(t *testing.T) {
+	for _, tc := range []struct {
+		options ClientOptions
+		key     string
+		limit   string
+	}{
+		{options: ClientOptions{MaxValueBytes: 64}, key: "/services/limited/1", limit: "max_value_bytes"},
+		{options: ClientOptions{MaxEntriesPerPrefix: 3}, key: "/services/limited/3", limit: "max_entries_per_prefix"},
+	} {
+		tc.options.LimitPolicy = LimitPolicyReject
+		_, err := limitedClientV3(tc.options).GetEntries("/services/limited/")
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		if le := err.(*LimitError); le.Prefix != "/services/limited/" || le.Key != tc.key || le.Limit != tc.limit {
+			t.Errorf("unexpected error: %+v", le)
+		}
+	}
+
+	hosts, err := limitedClientV3(ClientOptions{MaxEntriesPerPrefix: 4, LimitPolicy: LimitPolicyReject}).GetEntries("/services/limited/")
+	if err != nil || len(hosts) != 4 {
+		t.Errorf("unexpected result: %v %v", hosts, err)
+	}
+}
+
+func TestParseOptionsMap_entryLimits(t *testing.T) {
+	options, err := parseOptionsMap(map[string]interface{}{
+		"max_value_bytes":        4096.0,
+		"max_entries_per_prefix": 1000.0,
+		"limit_policy":           "reject",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.MaxValueBytes != 4096 || options.MaxEntriesPerPrefix != 1000 || options.LimitPolicy != LimitPolicyReject {
+		t.Errorf("unexpected options: %+v", options)
+	}
+	for _, key := range []string{"max_value_bytes", "max_entries_per_prefix"} {
+		if _, err := parseOptionsMap(map[string]interface{}{key: -1.0}); err == nil || err.(*ConfigError).Path != key {
+			t.Errorf("unexpected error for %s: %v", key, err)
+		}
+	}
+}
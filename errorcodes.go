@@ -0,0 +1,99 @@
+package etcd
+
+import (
+	"context"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	"github.com/devopsfaith/krakend-etcd/internal/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The codes of the errors returned by the etcd clients, used as the labels of the MetricErrors
+// counters. The v2 error codes and the v3 gRPC status codes are mapped into the same set, so the
+// dashboards do not depend on the version of the client.
+const (
+	// ErrorCodeUnavailable is the code of the errors caused by unreachable clusters or clusters without a leader
+	ErrorCodeUnavailable = "Unavailable"
+	// ErrorCodeDeadlineExceeded is the code of the requests timing out
+	ErrorCodeDeadlineExceeded = "DeadlineExceeded"
+	// ErrorCodePermissionDenied is the code of the authentication and authorization failures
+	ErrorCodePermissionDenied = "PermissionDenied"
+	// ErrorCodeCompacted is the code of the reads and watches of a compacted revision
+	ErrorCodeCompacted = "Compacted"
+	// ErrorCodeNotFound is the code of the reads of missing keys (v2 only)
+	ErrorCodeNotFound = "NotFound"
+	// ErrorCodeCanceled is the code of the requests canceled by the client
+	ErrorCodeCanceled = "Canceled"
+	// ErrorCodeUnknown is the code of the rest of the errors
+	ErrorCodeUnknown = "Unknown"
+)
+
+// ErrorCode returns the code of the received error, as used by the MetricErrors counters. The v3
+// gRPC codes not listed above are returned by their name (e.g. "ResourceExhausted").
+func ErrorCode(err error) string {
+	switch err {
+	case nil:
+		return ""
+	case context.DeadlineExceeded:
+		return ErrorCodeDeadlineExceeded
+	case context.Canceled:
+		return ErrorCodeCanceled
+	case rpctypes.ErrCompacted:
+		return ErrorCodeCompacted
+	case rpctypes.ErrAuthFailed, rpctypes.ErrInvalidAuthToken:
+		return ErrorCodePermissionDenied
+	}
+
+	switch e := err.(type) {
+	case etcd.Error:
+		return v2ErrorCode(e.Code)
+	case *etcd.ClusterError:
+		return ErrorCodeUnavailable
+	case rpctypes.EtcdError:
+		return v3ErrorCode(e.Code())
+	}
+	if s, ok := status.FromError(err); ok {
+		return v3ErrorCode(s.Code())
+	}
+	return ErrorCodeUnknown
+}
+
+func v2ErrorCode(code int) string {
+	switch code {
+	case etcd.ErrorCodeKeyNotFound:
+		return ErrorCodeNotFound
+	case etcd.ErrorCodeUnauthorized:
+		return ErrorCodePermissionDenied
+	case etcd.ErrorCodeRaftInternal, etcd.ErrorCodeLeaderElect:
+		return ErrorCodeUnavailable
+	case etcd.ErrorCodeWatcherCleared, etcd.ErrorCodeEventIndexCleared:
+		return ErrorCodeCompacted
+	}
+	return ErrorCodeUnknown
+}
+
+func v3ErrorCode(code codes.Code) string {
+	switch code {
+	case codes.Unavailable:
+		return ErrorCodeUnavailable
+	case codes.DeadlineExceeded:
+		return ErrorCodeDeadlineExceeded
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return ErrorCodePermissionDenied
+	case codes.Canceled:
+		return ErrorCodeCanceled
+	case codes.Unknown:
+		return ErrorCodeUnknown
+	}
+	return code.String()
+}
+
+// countError increments the MetricErrors counter of the code of the received error, if any, and
+// returns it
+func countError(err error) error {
+	if err != nil {
+		addMetric(MetricErrors+"."+ErrorCode(err), 1)
+	}
+	return err
+}
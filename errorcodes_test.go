@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	"github.com/devopsfaith/krakend-etcd/internal/rpctypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code string
+	}{
+		{err: nil, code: ""},
+		{err: context.DeadlineExceeded, code: ErrorCodeDeadlineExceeded},
+		{err: context.Canceled, code: ErrorCodeCanceled},
+		{err: etcd.Error{Code: etcd.ErrorCodeKeyNotFound}, code: ErrorCodeNotFound},
+		{err: etcd.Error{Code: etcd.ErrorCodeUnauthorized}, code: ErrorCodePermissionDenied},
+		{err: etcd.Error{Code: etcd.ErrorCodeLeaderElect}, code: ErrorCodeUnavailable},
+		{err: etcd.Error{Code: etcd.ErrorCodeEventIndexCleared}, code: ErrorCodeCompacted},
+		{err: etcd.Error{Code: 102}, code: ErrorCodeUnknown},
+		{err: &etcd.ClusterError{Errors: []error{errors.New("connection refused")}}, code: ErrorCodeUnavailable},
+		{err: rpctypes.ErrCompacted, code: ErrorCodeCompacted},
+		{err: rpctypes.ErrAuthFailed, code: ErrorCodePermissionDenied},
+		{err: rpctypes.ErrPermissionDenied, code: ErrorCodePermissionDenied},
+		{err: rpctypes.ErrNoLeader, code: ErrorCodeUnavailable},
+		{err: rpctypes.ErrNoSpace, code: "ResourceExhausted"},
+		{err: status.Error(codes.Unavailable, "transport is closing"), code: ErrorCodeUnavailable},
+		{err: status.Error(codes.DeadlineExceeded, "context deadline exceeded"), code: ErrorCodeDeadlineExceeded},
+		{err: status.Error(codes.Unauthenticated, "invalid auth token"), code: ErrorCodePermissionDenied},
+		{err: errors.New("something went wrong"), code: ErrorCodeUnknown},
+	} {
+		if code := ErrorCode(tc.err); code != tc.code {
+			t.Errorf("unexpected code for %v: %s", tc.err, code)
+		}
+	}
+}
+
+func TestCountError(t *testing.T) {
+	before := Metrics()[MetricErrors+"."+ErrorCodePermissionDenied]
+	if err := countError(rpctypes.ErrPermissionDenied); err != rpctypes.ErrPermissionDenied {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := countError(nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if v := Metrics()[MetricErrors+"."+ErrorCodePermissionDenied] - before; v != 1 {
+		t.Errorf("unexpected counter: %d", v)
+	}
+}
@@ -39,10 +39,16 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	etcdClient, err := etcd.New(ctx, serviceConfig.ExtraConfig)
-	if err != nil {
+	etcdClient, report, err := etcd.NewVerified(ctx, serviceConfig)
+	if etcdClient == nil {
 		log.Fatal("ERROR:", err.Error())
 	}
+	if err != nil {
+		logger.Warning(err.Error())
+	}
+	for _, p := range report {
+		logger.Debug("etcd prefix", p.Prefix, "resolved with", len(p.Hosts), "hosts")
+	}
 
 	routerFactory := krakendgin.NewFactory(krakendgin.Config{
 		Engine:         gin.Default(),
@@ -0,0 +1,59 @@
+package etcd
+
+import "context"
+
+// PrefixEvent is the creation or the deletion of a whole prefix, or the error of its read
+type PrefixEvent struct {
+	Prefix string
+	// Exists is true once the prefix holds any key, and false once all of them are deleted
+	Exists bool
+	Err    error
+}
+
+// WatchPrefixExistence watches the prefix, sending whether it holds any key once read and every time
+// it is created (its first key stored) or deleted (its last key removed) until the context is done,
+// when the channel is closed. The changes of the keys inside an existing prefix are not sent. The
+// failed reads are sent as errors and retried after the backoff, as in WatchHosts.
+func WatchPrefixExistence(ctx context.Context, c Client, prefix string) <-chan PrefixEvent {
+	events := make(chan PrefixEvent)
+	go func() {
+		defer close(events)
+		exists, sent := false, false
+		newPrefixLoop(c, prefix).run(ctx, func() (bool, error) {
+			n, err := countKeys(c, prefix)
+			if err != nil {
+				return sendEvent(ctx, events, PrefixEvent{Prefix: prefix, Err: err}), err
+			}
+			if sent && (n > 0) == exists {
+				return true, nil
+			}
+			exists, sent = n > 0, true
+			return sendEvent(ctx, events, PrefixEvent{Prefix: prefix, Exists: exists}), nil
+		})
+	}()
+	return events
+}
+
+// sendEvent sends the event unless the context is done first, returning false in that case
+func sendEvent(ctx context.Context, events chan<- PrefixEvent, e PrefixEvent) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// countKeys returns the number of keys stored under the prefix, or of the hosts decoded from them if
+// the client can not list the keys
+func countKeys(c Client, prefix string) (int64, error) {
+	if cc, ok := c.(CountClient); ok {
+		return cc.CountEntries(prefix)
+	}
+	if kv, ok := c.(KeyValueClient); ok {
+		values, err := kv.GetKeyValues(prefix)
+		return int64(len(values)), err
+	}
+	entries, err := c.GetEntries(prefix)
+	return int64(len(entries)), err
+}
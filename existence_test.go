@@ -0,0 +1,103 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchPrefixExistence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	SetBackoff(ConstantBackoff{Period: time.Millisecond})
+	defer SetBackoff(nil)
+
+	mutex := &sync.Mutex{}
+	responses := []struct {
+		hosts []string
+		err   error
+	}{
+		{},
+		{hosts: []string{"http://10.0.0.1"}},
+		{hosts: []string{"http://10.0.0.1", "http://10.0.0.2"}},
+		{err: errors.New("unavailable")},
+		{},
+	}
+	events := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			r := responses[0]
+			if len(responses) > 1 {
+				responses = responses[1:]
+			}
+			return r.hosts, r.err
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			ch <- struct{}{}
+			for range events {
+				ch <- struct{}{}
+			}
+		},
+	}
+
+	updates := WatchPrefixExistence(ctx, c, "/services/api/")
+	next := func() PrefixEvent {
+		select {
+		case e := <-updates:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for the event")
+		}
+		return PrefixEvent{}
+	}
+
+	if e := next(); e.Err != nil || e.Exists || e.Prefix != "/services/api/" {
+		t.Errorf("unexpected first event: %+v", e)
+	}
+	events <- struct{}{}
+	if e := next(); e.Err != nil || !e.Exists {
+		t.Errorf("the prefix should be created: %+v", e)
+	}
+	// the changes inside the existing prefix are not sent
+	events <- struct{}{}
+	events <- struct{}{}
+	if e := next(); e.Err == nil {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	// the failed read is retried after the backoff
+	if e := next(); e.Err != nil || e.Exists {
+		t.Errorf("the prefix should be deleted: %+v", e)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("unexpected event after the cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Error("the events should be closed once the context is done")
+	}
+}
+
+type countingClient struct {
+	dummyClient
+	count int64
+}
+
+func (c countingClient) CountEntries(string) (int64, error) { return c.count, nil }
+
+func TestCountKeys(t *testing.T) {
+	entries := dummyClient{getEntries: func(string) ([]string, error) { return []string{"http://10.0.0.1"}, nil }}
+	if n, err := countKeys(entries, "/services/api/"); err != nil || n != 1 {
+		t.Errorf("unexpected count of the entries: %d %v", n, err)
+	}
+	if n, err := countKeys(countingClient{dummyClient: entries, count: 3}, "/services/api/"); err != nil || n != 3 {
+		t.Errorf("unexpected count of the keys: %d %v", n, err)
+	}
+}
@@ -0,0 +1,68 @@
+package etcd
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultFallbackPeriod is the period the clients with the ConsistencyFallback mode read serializable
+// after a linearizable read fails, before trying the linearizable reads again
+const DefaultFallbackPeriod = 10 * time.Second
+
+// consistencyFallback tracks the serializable fallback of the clients sharing a connection. The
+// linearizable reads time out while the cluster has no leader, but every member can still answer the
+// serializable ones from its local state, so the discovery keeps working through the elections.
+type consistencyFallback struct {
+	mutex *sync.Mutex
+	until time.Time
+}
+
+func newConsistencyFallback() *consistencyFallback {
+	return &consistencyFallback{mutex: &sync.Mutex{}}
+}
+
+// serializable returns true while the reads must be serializable
+func (f *consistencyFallback) serializable(now time.Time) bool {
+	if f == nil {
+		return false
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return now.Before(f.until)
+}
+
+// failed returns true if the error of a linearizable read could be caused by the loss of the leader, so
+// the read should be retried serializable, entering the fallback mode for the DefaultFallbackPeriod
+func (f *consistencyFallback) failed(err error, now time.Time) bool {
+	if f == nil {
+		return false
+	}
+	switch ErrorCode(err) {
+	case ErrorCodeDeadlineExceeded, ErrorCodeUnavailable:
+	default:
+		return false
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.until.IsZero() {
+		setMetric(MetricSerializableFallback, 1)
+		getLogger().Warning("etcd: the linearizable reads failed, falling back to serializable reads:", err.Error())
+	}
+	f.until = now.Add(Jitter(DefaultFallbackPeriod))
+	return true
+}
+
+// succeeded restores the linearizable reads after one of them succeeds
+func (f *consistencyFallback) succeeded() {
+	if f == nil {
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.until.IsZero() {
+		return
+	}
+	f.until = time.Time{}
+	setMetric(MetricSerializableFallback, 0)
+	getLogger().Info("etcd: the linearizable reads are restored")
+}
@@ -0,0 +1,116 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+)
+
+// quorumKeysAPI fails the quorum reads while the leader is lost
+type quorumKeysAPI struct {
+	fakeKeysAPI
+	mutex      *sync.Mutex
+	noLeader   bool
+	quorumGets int
+	localGets  int
+}
+
+func (k *quorumKeysAPI) Get(_ context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if !opts.Quorum {
+		k.localGets++
+		return &etcd.Response{Node: &etcd.Node{Key: key, Dir: true, Nodes: etcd.Nodes{{Key: key + "/1", Value: "http://10.0.0.1"}}}}, nil
+	}
+	k.quorumGets++
+	if k.noLeader {
+		return nil, context.DeadlineExceeded
+	}
+	return &etcd.Response{Node: &etcd.Node{Key: key, Dir: true, Nodes: etcd.Nodes{{Key: key + "/1", Value: "http://10.0.0.1"}}}}, nil
+}
+
+func (k *quorumKeysAPI) reads() (int, int) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.quorumGets, k.localGets
+}
+
+func TestClient_consistencyFallback(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+
+	api := &quorumKeysAPI{mutex: &sync.Mutex{}, noLeader: true}
+	c := &client{
+		keysAPI:  api,
+		ctx:      context.Background(),
+		options:  ClientOptions{Consistency: ConsistencyFallback},
+		fallback: newConsistencyFallback(),
+	}
+	scoped := c.WithOptions(ClientOptions{Filter: "*"})
+
+	before := Metrics()[MetricErrors+"."+ErrorCodeDeadlineExceeded]
+	for _, cl := range []Client{c, scoped, c} {
+		if hosts, err := cl.GetEntries("/services/api"); err != nil || len(hosts) != 1 {
+			t.Errorf("unexpected result: %v %v", hosts, err)
+		}
+	}
+	if quorum, local := api.reads(); quorum != 1 || local != 3 {
+		t.Errorf("unexpected reads: quorum %d, local %d", quorum, local)
+	}
+	if v := Metrics()[MetricSerializableFallback]; v != 1 {
+		t.Errorf("unexpected fallback gauge: %d", v)
+	}
+	if v := Metrics()[MetricErrors+"."+ErrorCodeDeadlineExceeded] - before; v != 1 {
+		t.Errorf("unexpected errors: %d", v)
+	}
+
+	clock.Advance(DefaultFallbackPeriod)
+	c.GetEntries("/services/api")
+	if quorum, local := api.reads(); quorum != 2 || local != 4 {
+		t.Errorf("unexpected reads: quorum %d, local %d", quorum, local)
+	}
+
+	api.mutex.Lock()
+	api.noLeader = false
+	api.mutex.Unlock()
+	clock.Advance(DefaultFallbackPeriod)
+	for i := 0; i < 2; i++ {
+		if hosts, err := c.GetEntries("/services/api"); err != nil || len(hosts) != 1 {
+			t.Errorf("unexpected result: %v %v", hosts, err)
+		}
+	}
+	if quorum, local := api.reads(); quorum != 4 || local != 4 {
+		t.Errorf("unexpected reads: quorum %d, local %d", quorum, local)
+	}
+	if v := Metrics()[MetricSerializableFallback]; v != 0 {
+		t.Errorf("unexpected fallback gauge: %d", v)
+	}
+}
+
+func TestConsistencyFallback_failed(t *testing.T) {
+	now := time.Now()
+	f := newConsistencyFallback()
+	if f.failed(errors.New("key not found"), now) || f.serializable(now) {
+		t.Error("only the timeouts and the unavailability should trigger the fallback")
+	}
+	if !f.failed(context.DeadlineExceeded, now) || !f.serializable(now) {
+		t.Error("the timeouts should trigger the fallback")
+	}
+	f.succeeded()
+	if f.serializable(now) {
+		t.Error("the linearizable reads should be restored")
+	}
+
+	var disabled *consistencyFallback
+	if disabled.failed(context.DeadlineExceeded, now) || disabled.serializable(now) {
+		t.Error("a nil fallback should be disabled")
+	}
+	disabled.succeeded()
+}
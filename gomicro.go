@@ -0,0 +1,66 @@
+package etcd
+
+import (
+	"encoding/json"
+)
+
+// microService is the service record stored by the go-micro etcd registry
+type microService struct {
+	Name     string            `json:"name"`
+	Version  string            `json:"version"`
+	Metadata map[string]string `json:"metadata"`
+	Nodes    []microNode       `json:"nodes"`
+}
+
+// microNode is an instance of a go-micro service. Old versions of the registry store the port
+// in its own field.
+type microNode struct {
+	ID       string            `json:"id"`
+	Address  string            `json:"address"`
+	Port     json.Number       `json:"port,omitempty"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// decodeGoMicro decodes the service records written by the go-micro etcd registry, returning a host
+// for every node. The metadata of every host contains the service metadata, overridden by the node
+// one, and the node id.
+//
+//	{"name": "api", "version": "1.0.0", "nodes": [{"id": "api-1", "address": "10.0.0.1:8080"}]}
+func decodeGoMicro(b []byte) ([]Host, error) {
+	var s microService
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	hosts := make([]Host, 0, len(s.Nodes))
+	for _, n := range s.Nodes {
+		r := record{Host: n.Address, Port: n.Port}
+		if n.Port == "" {
+			host, port := splitAuthority(n.Address)
+			r.Host, r.Port = host, json.Number(port)
+		}
+		if scheme, ok := n.Metadata["protocol"]; ok && (scheme == "http" || scheme == "https") {
+			r.Scheme = scheme
+		}
+		r.Metadata = map[string]interface{}{}
+		for k, v := range s.Metadata {
+			r.Metadata[k] = v
+		}
+		for k, v := range n.Metadata {
+			r.Metadata[k] = v
+		}
+		if n.ID != "" {
+			r.Metadata["id"] = n.ID
+		}
+
+		h, err := r.toHost()
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		return nil, ErrBadRecord
+	}
+	return hosts, nil
+}
@@ -0,0 +1,57 @@
+package etcd
+
+import (
+	"strconv"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// ResponseHeader identifies the cluster member answering a read, so the observability tools can detect
+// a gateway talking to the wrong cluster or to a partitioned member
+type ResponseHeader struct {
+	// ClusterID is the id of the cluster. It is zero for the v2 clients.
+	ClusterID uint64 `json:"cluster_id,omitempty"`
+	// MemberID is the id of the member answering the read. It is zero for the v2 clients.
+	MemberID uint64 `json:"member_id,omitempty"`
+	// Revision is the revision of the cluster (the index, for the v2 clients) the read was done at
+	Revision int64 `json:"revision,omitempty"`
+	// RaftTerm is the raft term of the member answering the read. It is zero for the v2 clients.
+	RaftTerm uint64 `json:"raft_term,omitempty"`
+}
+
+// HeaderClient is a HostsClient also reporting the header of the responses the hosts were read from
+type HeaderClient interface {
+	HostsClient
+	// GetHostsWithHeader returns the hosts stored under the prefix, along with the header of the
+	// response (of its first page, for the paginated v3 reads).
+	GetHostsWithHeader(prefix string) ([]Host, ResponseHeader, error)
+}
+
+// String returns the ids of the header in the hexadecimal format used by etcdctl
+func (h ResponseHeader) String() string {
+	return "cluster " + formatID(h.ClusterID) + " member " + formatID(h.MemberID) + " revision " + strconv.FormatInt(h.Revision, 10)
+}
+
+// formatID formats an etcd id like etcdctl does
+func formatID(id uint64) string {
+	return strconv.FormatUint(id, 16)
+}
+
+// newResponseHeader returns the header of a v3 response
+func newResponseHeader(h *etcdv3.ResponseHeader) ResponseHeader {
+	if h == nil {
+		return ResponseHeader{}
+	}
+	return ResponseHeader{ClusterID: h.ClusterId, MemberID: h.MemberId, Revision: h.Revision, RaftTerm: h.RaftTerm}
+}
+
+// GetHostsWithHeader implements the etcd HeaderClient interface.
+func (c *clientv3) GetHostsWithHeader(prefix string) ([]Host, ResponseHeader, error) {
+	return c.getHosts(prefix, 0)
+}
+
+// GetHostsWithHeader implements the etcd HeaderClient interface. Only the revision is reported.
+func (c *client) GetHostsWithHeader(prefix string) ([]Host, ResponseHeader, error) {
+	hosts, index, err := c.GetHostsWithRevision(prefix)
+	return hosts, ResponseHeader{Revision: index}, err
+}
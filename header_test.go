@@ -0,0 +1,98 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func TestClientV3_GetHostsWithHeader(t *testing.T) {
+	c := &clientv3{
+		client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{
+			Header: &etcdv3.ResponseHeader{ClusterId: 0xcafe, MemberId: 0xbeef, Revision: 50, RaftTerm: 3},
+			Kvs:    []*mvccpb.KeyValue{{Key: []byte("/services/api/1"), Value: []byte("http://10.0.0.1")}},
+			Count:  1,
+		}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+	}
+	hosts, header, err := c.GetHostsWithHeader("/services/api/")
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("unexpected result: %v %v", hosts, err)
+	}
+	if header != (ResponseHeader{ClusterID: 0xcafe, MemberID: 0xbeef, Revision: 50, RaftTerm: 3}) {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	if s := header.String(); s != "cluster cafe member beef revision 50" {
+		t.Errorf("unexpected string: %s", s)
+	}
+}
+
+type dummyHeaderClient struct {
+	dummyHostsClient
+	mutex  *sync.Mutex
+	header ResponseHeader
+}
+
+func (d dummyHeaderClient) GetHostsWithHeader(prefix string) ([]Host, ResponseHeader, error) {
+	hosts, err := d.getHosts(prefix)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return hosts, d.header, err
+}
+
+func TestSubscriber_clusterChanged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l := &recordingLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	notify := make(chan struct{})
+	c := &dummyHeaderClient{
+		dummyHostsClient: dummyHostsClient{
+			dummyClient: dummyClient{
+				watchPrefix: func(_ string, ch chan struct{}) {
+					for range notify {
+						ch <- struct{}{}
+					}
+				},
+			},
+			getHosts: func(string) ([]Host, error) { return []Host{{URL: "http://10.0.0.1"}}, nil },
+		},
+		mutex:  &sync.Mutex{},
+		header: ResponseHeader{ClusterID: 0xcafe, MemberID: 0xbeef, Revision: 50},
+	}
+	s, err := NewSubscriberWithOptions(ctx, c, "/services/header", BackendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, meta, _ := s.HostsWithMeta()
+	if meta.ClusterID != 0xcafe || meta.MemberID != 0xbeef || meta.Revision != 50 {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+	meta.Stale = true
+	if h := meta.Headers(time.Now()); h.Get(HeaderCluster) != "cafe" {
+		t.Errorf("unexpected headers: %v", h)
+	}
+
+	c.mutex.Lock()
+	c.header = ResponseHeader{ClusterID: 0xf00d, Revision: 3}
+	c.mutex.Unlock()
+	notify <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	close(notify)
+
+	for _, w := range l.logged() {
+		if strings.Contains(w, "the cluster of the prefix changed") && strings.Contains(w, "f00d") {
+			return
+		}
+	}
+	t.Errorf("the change of cluster should be logged: %v", l.logged())
+}
@@ -0,0 +1,157 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+const (
+	// AlarmNoSpace is raised by etcd when the db size exceeds the quota. The cluster rejects the writes
+	// until the space is reclaimed (compact, defrag) and the alarm is disarmed, so the registrations
+	// and their refreshes fail while the gateways keep serving the last known hosts.
+	AlarmNoSpace = "NOSPACE"
+	// AlarmCorrupt is raised by etcd when a member detects an inconsistency in its data
+	AlarmCorrupt = "CORRUPT"
+)
+
+// EndpointStatus is the health of an etcd endpoint
+type EndpointStatus struct {
+	Endpoint string
+	Version  string
+	// DBSize is the size in bytes of the backend database of the member, including the free pages
+	// that a defragmentation would reclaim
+	DBSize int64
+	Leader bool
+	// Alarms are the alarms raised by the member
+	Alarms []string
+	// Err is the error returned by the endpoint, if it did not answer
+	Err error
+}
+
+// ClusterInfo is the health of the endpoints of an etcd cluster
+type ClusterInfo struct {
+	Name      string
+	Endpoints []EndpointStatus
+}
+
+// Alarms returns the distinct alarms raised by the members of the cluster
+func (i ClusterInfo) Alarms() []string {
+	seen := map[string]struct{}{}
+	alarms := []string{}
+	for _, e := range i.Endpoints {
+		for _, a := range e.Alarms {
+			if _, ok := seen[a]; ok {
+				continue
+			}
+			seen[a] = struct{}{}
+			alarms = append(alarms, a)
+		}
+	}
+	sort.Strings(alarms)
+	return alarms
+}
+
+// Healthy returns true if any endpoint answered and no alarm is raised
+func (i ClusterInfo) Healthy() bool {
+	if len(i.Alarms()) > 0 {
+		return false
+	}
+	for _, e := range i.Endpoints {
+		if e.Err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspector is implemented by the clients able to report the health of the endpoints of their cluster
+type Inspector interface {
+	ClusterInfo() (ClusterInfo, error)
+}
+
+// Inspect returns the health of the clusters behind the received client: one ClusterInfo per cluster of
+// a MultiClusterClient or a single one for the clients implementing Inspector. The db sizes and the
+// number of alarms are published as metrics too.
+func Inspect(c Client) ([]ClusterInfo, error) {
+	clusters := []Cluster{{Client: c}}
+	if mc, ok := c.(*MultiClusterClient); ok {
+		clusters = mc.Clusters()
+	}
+
+	infos := make([]ClusterInfo, 0, len(clusters))
+	for _, cl := range clusters {
+		i, ok := cl.Client.(Inspector)
+		if !ok {
+			return nil, ErrNotInspectable
+		}
+		info, err := i.ClusterInfo()
+		if err != nil {
+			return nil, err
+		}
+		info.Name = cl.Name
+		infos = append(infos, info)
+	}
+
+	alarms := 0
+	for _, info := range infos {
+		alarms += len(info.Alarms())
+		for _, e := range info.Endpoints {
+			if e.Err == nil {
+				setMetric(MetricDBSize+"."+e.Endpoint, e.DBSize)
+			}
+		}
+	}
+	setMetric(MetricAlarms, int64(alarms))
+	return infos, nil
+}
+
+// ClusterInfo implements the etcd Inspector interface. The v2 API does not expose the status of the
+// members, so only the v3 clients implement it.
+func (c *clientv3) ClusterInfo() (ClusterInfo, error) {
+	if c.client == nil {
+		return ClusterInfo{}, ErrNilClient
+	}
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	resp, err := c.client.AlarmList(ctx)
+	cancel()
+	if err != nil {
+		return ClusterInfo{}, err
+	}
+	return clusterInfo(c.client.Endpoints(), func(endpoint string) (*etcdv3.StatusResponse, error) {
+		ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+		defer cancel()
+		return c.client.Status(ctx, endpoint)
+	}, resp.Alarms), nil
+}
+
+// clusterInfo collects the status of every endpoint, assigning them the alarms of their members
+func clusterInfo(endpoints []string, status func(string) (*etcdv3.StatusResponse, error), alarms []*etcdv3.AlarmMember) ClusterInfo {
+	byMember := map[uint64][]string{}
+	for _, a := range alarms {
+		if a.Alarm == etcdv3.AlarmType_NONE {
+			continue
+		}
+		byMember[a.MemberID] = append(byMember[a.MemberID], a.Alarm.String())
+	}
+
+	info := ClusterInfo{Endpoints: make([]EndpointStatus, len(endpoints))}
+	for i, endpoint := range endpoints {
+		e := EndpointStatus{Endpoint: endpoint}
+		resp, err := status(endpoint)
+		if err != nil {
+			e.Err = err
+			info.Endpoints[i] = e
+			continue
+		}
+		e.Version = resp.Version
+		e.DBSize = resp.DbSize
+		if resp.Header != nil {
+			e.Leader = resp.Header.MemberId == resp.Leader
+			e.Alarms = byMember[resp.Header.MemberId]
+		}
+		info.Endpoints[i] = e
+	}
+	return info
+}
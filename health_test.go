@@ -0,0 +1,84 @@
+package etcd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+type dummyInspectorClient struct {
+	dummyClient
+	info ClusterInfo
+}
+
+func (d dummyInspectorClient) ClusterInfo() (ClusterInfo, error) { return d.info, nil }
+
+func TestClusterInfo(t *testing.T) {
+	statuses := map[string]*etcdv3.StatusResponse{
+		"http://a:2379": {Header: &etcdv3.ResponseHeader{MemberId: 1}, Version: "3.4.0", DbSize: 2048, Leader: 1},
+		"http://b:2379": {Header: &etcdv3.ResponseHeader{MemberId: 2}, Version: "3.4.0", DbSize: 4096, Leader: 1},
+	}
+	info := clusterInfo(
+		[]string{"http://a:2379", "http://b:2379", "http://c:2379"},
+		func(endpoint string) (*etcdv3.StatusResponse, error) {
+			if s, ok := statuses[endpoint]; ok {
+				return s, nil
+			}
+			return nil, errors.New("unavailable")
+		},
+		[]*etcdv3.AlarmMember{
+			{MemberID: 2, Alarm: etcdv3.AlarmType_NOSPACE},
+			{MemberID: 2, Alarm: etcdv3.AlarmType_CORRUPT},
+			{MemberID: 1, Alarm: etcdv3.AlarmType_NONE},
+		},
+	)
+
+	if len(info.Endpoints) != 3 {
+		t.Fatalf("unexpected endpoints: %+v", info.Endpoints)
+	}
+	if e := info.Endpoints[0]; !e.Leader || e.DBSize != 2048 || e.Version != "3.4.0" || len(e.Alarms) != 0 || e.Err != nil {
+		t.Errorf("unexpected status: %+v", e)
+	}
+	if e := info.Endpoints[1]; e.Leader || e.DBSize != 4096 || !reflect.DeepEqual(e.Alarms, []string{AlarmNoSpace, AlarmCorrupt}) {
+		t.Errorf("unexpected status: %+v", e)
+	}
+	if e := info.Endpoints[2]; e.Err == nil {
+		t.Errorf("unexpected status: %+v", e)
+	}
+	if alarms := info.Alarms(); !reflect.DeepEqual(alarms, []string{AlarmCorrupt, AlarmNoSpace}) {
+		t.Errorf("unexpected alarms: %v", alarms)
+	}
+	if info.Healthy() {
+		t.Error("the cluster should not be healthy")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	if _, err := Inspect(dummyClient{}); err != ErrNotInspectable {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	eu := dummyInspectorClient{info: ClusterInfo{Endpoints: []EndpointStatus{{Endpoint: "http://eu:2379", DBSize: 1024}}}}
+	us := dummyInspectorClient{info: ClusterInfo{Endpoints: []EndpointStatus{{Endpoint: "http://us:2379", DBSize: 2048, Alarms: []string{AlarmNoSpace}}}}}
+	c := &MultiClusterClient{
+		clients: []Client{eu, us},
+		set:     &clusterSet{clusters: []*clusterState{{name: "eu"}, {name: "us"}}},
+	}
+
+	infos, err := Inspect(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "eu" || infos[1].Name != "us" {
+		t.Errorf("unexpected infos: %+v", infos)
+	}
+	if !infos[0].Healthy() || infos[1].Healthy() {
+		t.Errorf("unexpected health: %+v", infos)
+	}
+	m := Metrics()
+	if m[MetricDBSize+".http://us:2379"] != 2048 || m[MetricAlarms] != 1 {
+		t.Errorf("unexpected metrics: %v", m)
+	}
+}
@@ -0,0 +1,90 @@
+package etcd
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// DefaultHeartbeatInterval is the period of the heartbeats when none is defined
+const DefaultHeartbeatInterval = 10 * time.Second
+
+// HeartbeatOptions defines the options of a Heartbeat. All values are optional.
+type HeartbeatOptions struct {
+	// Format is the entry format of the registration (see RegisterInstance). Only the formats keeping the
+	// metadata of the instance, like json and go-micro, carry the heartbeat fields.
+	Format string
+	// Interval is the period of the heartbeats. DefaultHeartbeatInterval if it is not defined.
+	Interval time.Duration
+	// TTL is the ttl of the registration, so it expires if the heartbeats stop. Three intervals if it is
+	// not defined.
+	TTL time.Duration
+	// Inflight returns the requests in flight of the instance, reported as its load
+	Inflight func() int64
+}
+
+// Heartbeat keeps the registration of an instance (e.g. the gateway itself) updated with its liveness and
+// its load, so the dashboards reading etcd can see them. Every heartbeat rewrites the entry with the
+// last_heartbeat (RFC 3339), the uptime (in seconds) and, if reported, the inflight requests added to the
+// metadata of the instance. The registrars implementing LeaseRegistrar keep the entry on a single lease
+// kept alive in the background (see Session).
+type Heartbeat struct {
+	session  *Session
+	key      string
+	instance Instance
+	options  HeartbeatOptions
+	start    time.Time
+}
+
+// NewHeartbeat returns a heartbeat registering the instance under the key with the received registrar
+func NewHeartbeat(r Registrar, key string, i Instance, options HeartbeatOptions) *Heartbeat {
+	if options.Interval <= 0 {
+		options.Interval = DefaultHeartbeatInterval
+	}
+	if options.TTL <= 0 {
+		options.TTL = 3 * options.Interval
+	}
+	return &Heartbeat{
+		session:  NewSession(r, options.TTL),
+		key:      key,
+		instance: i,
+		options:  options,
+		start:    GetClock().Now(),
+	}
+}
+
+// Run registers the instance every interval, plus the jitter, until the context is canceled, when the
+// registration is removed. The failed heartbeats are logged and retried by the next one.
+func (h *Heartbeat) Run(ctx context.Context) error {
+	for {
+		if err := h.beat(); err != nil {
+			getLogger().Warning("etcd: unable to send the heartbeat of", h.key+":", err.Error())
+		}
+		select {
+		case <-GetClock().After(Jitter(h.options.Interval)):
+		case <-ctx.Done():
+			h.session.Close()
+			return ctx.Err()
+		}
+	}
+}
+
+// beat registers the instance with the heartbeat fields
+func (h *Heartbeat) beat() error {
+	now := GetClock().Now()
+	i := h.instance
+	i.Metadata = make(map[string]string, len(h.instance.Metadata)+3)
+	for k, v := range h.instance.Metadata {
+		i.Metadata[k] = v
+	}
+	i.Metadata["last_heartbeat"] = now.UTC().Format(time.RFC3339)
+	i.Metadata["uptime"] = strconv.FormatInt(int64(now.Sub(h.start)/time.Second), 10)
+	if h.options.Inflight != nil {
+		i.Metadata["inflight"] = strconv.FormatInt(h.options.Inflight(), 10)
+	}
+	value, err := EncodeInstance(h.options.Format, i)
+	if err != nil {
+		return err
+	}
+	return h.session.Register(h.key, value)
+}
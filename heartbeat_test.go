@@ -0,0 +1,84 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type channelRegistrar struct {
+	registered   chan string
+	deregistered chan string
+}
+
+func (r channelRegistrar) Register(_, value string, _ time.Duration) error {
+	r.registered <- value
+	return nil
+}
+
+func (r channelRegistrar) Deregister(key string) error {
+	r.deregistered <- key
+	return nil
+}
+
+func TestHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+
+	r := channelRegistrar{registered: make(chan string), deregistered: make(chan string, 1)}
+	h := NewHeartbeat(r, "/gateways/gw-1", Instance{Name: "gateway", URL: "http://10.0.0.1:8080"}, HeartbeatOptions{
+		Format:   EntryFormatJSON,
+		Inflight: func() int64 { return 3 },
+	})
+	done := make(chan error)
+	go func() { done <- h.Run(ctx) }()
+
+	// next returns the metadata of the next heartbeat, advancing the clock until it is sent
+	next := func(advance time.Duration) map[string]string {
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case value := <-r.registered:
+				var record instanceRecord
+				if err := json.Unmarshal([]byte(value), &record); err != nil {
+					t.Fatal(err)
+				}
+				return record.Metadata
+			case <-time.After(10 * time.Millisecond):
+				if advance > 0 {
+					clock.Advance(advance)
+				}
+			case <-timeout:
+				t.Fatal("timeout waiting for the heartbeat")
+			}
+		}
+	}
+
+	if m := next(0); m["last_heartbeat"] != "2020-01-01T00:00:00Z" || m["uptime"] != "0" || m["inflight"] != "3" || m["name"] != "gateway" {
+		t.Errorf("unexpected heartbeat: %v", m)
+	}
+	m := next(DefaultHeartbeatInterval)
+	last, err := time.Parse(time.RFC3339, m["last_heartbeat"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime := strconv.FormatInt(int64(last.Sub(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))/time.Second), 10); m["uptime"] != uptime || uptime == "0" {
+		t.Errorf("unexpected heartbeat: %v", m)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if key := <-r.deregistered; key != "/gateways/gw-1" {
+		t.Errorf("unexpected deregistration: %s", key)
+	}
+}
@@ -0,0 +1,52 @@
+package etcd
+
+import "sync"
+
+// HostsHook post-processes the hosts resolved for a prefix, returning the ones the subscriber should
+// use. It can drop hosts (e.g. deny lists, CIDR filters) or rewrite them (e.g. ports).
+type HostsHook func(prefix string, hosts []string) []string
+
+var (
+	hostsHooks      = []HostsHook{}
+	hostsHooksMutex = &sync.RWMutex{}
+)
+
+// OnHostsResolved registers a hook to call every time a subscriber reads its prefix, after applying the
+// backend options and before updating its hosts, so the host applications can enforce their policies
+// without wrapping the SubscriberFactory. The hooks are called synchronously and in the order they were
+// registered, each one receiving the hosts returned by the previous one, so they should not block.
+// The rewritten hosts lose the metadata of their records.
+func OnHostsResolved(h HostsHook) {
+	hostsHooksMutex.Lock()
+	hostsHooks = append(hostsHooks, h)
+	hostsHooksMutex.Unlock()
+}
+
+// applyHostsHooks returns the hosts of the prefix returned by the registered hooks
+func applyHostsHooks(prefix string, hosts []Host) []Host {
+	hostsHooksMutex.RLock()
+	defer hostsHooksMutex.RUnlock()
+	if len(hostsHooks) == 0 {
+		return hosts
+	}
+	urls := hostURLs(hosts)
+	for _, h := range hostsHooks {
+		urls = h(prefix, urls)
+	}
+	if urls == nil {
+		return nil
+	}
+	index := make(map[string]Host, len(hosts))
+	for _, h := range hosts {
+		index[h.URL] = h
+	}
+	result := make([]Host, len(urls))
+	for i, u := range urls {
+		h, ok := index[u]
+		if !ok {
+			h = Host{URL: u}
+		}
+		result[i] = h
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOnHostsResolved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	OnHostsResolved(func(prefix string, hosts []string) []string {
+		if prefix != "/services/hooks" {
+			return hosts
+		}
+		result := []string{}
+		for _, h := range hosts {
+			if !strings.HasPrefix(h, "http://192.168.") {
+				result = append(result, h)
+			}
+		}
+		return result
+	})
+	OnHostsResolved(func(prefix string, hosts []string) []string {
+		if prefix != "/services/hooks" {
+			return hosts
+		}
+		for i, h := range hosts {
+			hosts[i] = strings.Replace(h, ":8080", ":9090", 1)
+		}
+		return hosts
+	})
+
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			return []string{"http://10.0.0.1:8080", "http://192.168.0.1:8080", "http://10.0.0.2"}, nil
+		},
+		watchPrefix: func(_ string, _ chan struct{}) { <-ctx.Done() },
+	}
+	s, err := NewSubscriber(ctx, c, "/services/hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := s.Hosts()
+	if expected := []string{"http://10.0.0.1:9090", "http://10.0.0.2"}; err != nil || !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("unexpected hosts: %v %v", hosts, err)
+	}
+	if _, ok := s.Host("http://10.0.0.2"); !ok {
+		t.Error("the record of the kept host should be found")
+	}
+
+	other, err := NewSubscriber(ctx, c, "/services/nohooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts, _ := other.Hosts(); len(hosts) != 3 {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
@@ -0,0 +1,69 @@
+package etcd
+
+import "sort"
+
+// HostCount is the number of hosts discovered for a backend prefix
+type HostCount struct {
+	// Key identifies the subscriber (the prefix and the backend options)
+	Key string `json:"key"`
+	// Prefix is the watched prefix
+	Prefix string `json:"prefix"`
+	// Hosts is the number of hosts currently served
+	Hosts int `json:"hosts"`
+	// MinHosts is the min_hosts of the backend, or 0 if it was not declared
+	MinHosts int `json:"min_hosts,omitempty"`
+	// Stale is set if the hosts could not be refreshed since the last failure
+	Stale bool `json:"stale"`
+}
+
+// Missing returns the number of hosts below the MinHosts of the backend
+func (c HostCount) Missing() int {
+	if c.Hosts >= c.MinHosts {
+		return 0
+	}
+	return c.MinHosts - c.Hosts
+}
+
+// HostCounts returns the number of hosts of every subscriber created by the SubscriberFactory, sorted by
+// key, so the autoscalers and the alerting can use the gateway as an independent observer of the
+// instances of every backend.
+func HostCounts() []HostCount {
+	counts := []HostCount{}
+	subscribersMutex.Lock()
+	for key, sf := range subscribers {
+		s, ok := sf.(*Subscriber)
+		if !ok {
+			continue
+		}
+		s.mutex.RLock()
+		counts = append(counts, HostCount{
+			Key:      key,
+			Prefix:   s.prefix,
+			Hosts:    len(*s.cache),
+			MinHosts: s.options.MinHosts,
+			Stale:    s.meta.Stale,
+		})
+		s.mutex.RUnlock()
+	}
+	subscribersMutex.Unlock()
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Key < counts[j].Key })
+	return counts
+}
+
+// countHosts publishes the number of hosts of the prefix and the hosts missing to reach the min_hosts of
+// the backend, logging a warning when the prefix falls below it
+func (s *Subscriber) countHosts(hosts int) {
+	setMetric(MetricHosts+"."+s.prefix, int64(hosts))
+	if s.options.MinHosts <= 0 {
+		return
+	}
+	missing := HostCount{Hosts: hosts, MinHosts: s.options.MinHosts}.Missing()
+	setMetric(MetricMissingHosts+"."+s.prefix, int64(missing))
+	switch {
+	case missing > 0 && !s.belowMin:
+		getLogger().Warning("etcd: the prefix", s.prefix, "has", hosts, "hosts, below the min_hosts", s.options.MinHosts)
+	case missing == 0 && s.belowMin:
+		getLogger().Info("etcd: the prefix", s.prefix, "reached the min_hosts again")
+	}
+	s.belowMin = missing > 0
+}
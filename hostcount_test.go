@@ -0,0 +1,60 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestHostCounts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscribers = map[string]sd.Subscriber{}
+	defer func() { subscribers = map[string]sd.Subscriber{} }()
+
+	hosts := map[string][]string{
+		"/services/api":   {"http://10.0.0.1", "http://10.0.0.2", "http://10.0.0.3"},
+		"/services/users": {"http://10.0.1.1"},
+	}
+	c := dummyClient{
+		getEntries:  func(key string) ([]string, error) { return hosts[key], nil },
+		watchPrefix: func(prefix string, ch chan struct{}) { <-ctx.Done() },
+	}
+	sf := SubscriberFactory(ctx, c)
+	sf(&config.Backend{Host: []string{"/services/api"}})
+	s := sf(&config.Backend{
+		Host:        []string{"/services/users"},
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{"min_hosts": 3.0}},
+	}).(*Subscriber)
+
+	counts := HostCounts()
+	if len(counts) != 2 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+	if c := counts[0]; c.Prefix != "/services/api" || c.Hosts != 3 || c.MinHosts != 0 || c.Missing() != 0 {
+		t.Errorf("unexpected count: %+v", c)
+	}
+	if c := counts[1]; c.Prefix != "/services/users" || c.Hosts != 1 || c.MinHosts != 3 || c.Missing() != 2 {
+		t.Errorf("unexpected count: %+v", c)
+	}
+	metrics := Metrics()
+	if v := metrics[MetricHosts+"./services/api"]; v != 3 {
+		t.Errorf("unexpected hosts gauge: %d", v)
+	}
+	if _, ok := metrics[MetricMissingHosts+"./services/api"]; ok {
+		t.Error("the backends without min_hosts should not publish the missing hosts")
+	}
+	if v := metrics[MetricMissingHosts+"./services/users"]; v != 2 {
+		t.Errorf("unexpected missing hosts gauge: %d", v)
+	}
+
+	s.update([]Host{{URL: "http://10.0.1.1"}, {URL: "http://10.0.1.2"}, {URL: "http://10.0.1.3"}})
+	if v := Metrics()[MetricMissingHosts+"./services/users"]; v != 0 {
+		t.Errorf("unexpected missing hosts gauge: %d", v)
+	}
+	if s.belowMin {
+		t.Error("the prefix should not be below the min hosts")
+	}
+}
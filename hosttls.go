@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// ErrBadCA is the error returned when the TLS hints of a host do not contain a valid PEM encoded CA
+var ErrBadCA = errors.New("the tls hints of the host do not contain a valid CA")
+
+// HostTLS holds the hints to verify the certificate of a discovered host, declared by the json and
+// yaml records under the tls key: {"server_name": "api.internal", "ca": "-----BEGIN CERTIFICATE-----..."}
+type HostTLS struct {
+	// ServerName is the name the certificate of the host is verified against
+	ServerName string `json:"server_name,omitempty"`
+	// CA is the PEM encoded bundle of the authorities trusted to sign the certificate of the host. The
+	// system ones are trusted if it is empty.
+	CA string `json:"ca,omitempty"`
+}
+
+// Config returns a copy of the base TLS config (e.g. the one holding the client certificate of the
+// gateway, for mTLS) verifying the certificate of the host with its hints. It allows the proxy layer
+// to connect to every discovered instance with its own TLS settings. See Subscriber.Host and LookupHost.
+func (t *HostTLS) Config(base *tls.Config) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	if t == nil {
+		return cfg, nil
+	}
+	if t.ServerName != "" {
+		cfg.ServerName = t.ServerName
+	}
+	if t.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(t.CA)) {
+			return nil, ErrBadCA
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// parseHostTLS returns the TLS hints of a yaml record, if any
+func parseHostTLS(v interface{}) *HostTLS {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	t := &HostTLS{}
+	t.ServerName, _ = m["server_name"].(string)
+	t.CA, _ = m["ca"].(string)
+	if *t == (HostTLS{}) {
+		return nil
+	}
+	return t
+}
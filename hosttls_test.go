@@ -0,0 +1,72 @@
+package etcd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+)
+
+func TestDecodeJSON_tls(t *testing.T) {
+	ca := newTestIdentity(t, "ca", nil)
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))
+	entry, _ := json.Marshal(map[string]interface{}{
+		"host":   "10.0.0.1",
+		"port":   8443,
+		"scheme": "https",
+		"tls":    map[string]interface{}{"server_name": "api.internal", "ca": caPEM},
+	})
+	hosts, err := decodeJSON(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hosts[0]
+	if h.TLS == nil || h.TLS.ServerName != "api.internal" || h.TLS.CA != caPEM {
+		t.Fatalf("unexpected tls hints: %+v", h.TLS)
+	}
+
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	cfg, err := h.TLS.Config(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ServerName != "api.internal" || cfg.RootCAs == nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if base.ServerName != "" || base.RootCAs != nil {
+		t.Error("the base config should not be modified")
+	}
+
+	b, err := encodeRecord(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated, err := decodeJSON(b); err != nil || migrated[0].TLS == nil || *migrated[0].TLS != *h.TLS {
+		t.Errorf("the tls hints should be migrated: %s %v", string(b), err)
+	}
+}
+
+func TestDecodeYAML_tls(t *testing.T) {
+	hosts, err := decodeYAML([]byte("host: 10.0.0.1\nport: 8443\ntls:\n  server_name: api.internal\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsHints := hosts[0].TLS; tlsHints == nil || *tlsHints != (HostTLS{ServerName: "api.internal"}) {
+		t.Errorf("unexpected tls hints: %+v", tlsHints)
+	}
+
+	hosts, _ = decodeYAML([]byte("host: 10.0.0.1\n"))
+	if hosts[0].TLS != nil {
+		t.Errorf("unexpected tls hints: %+v", hosts[0].TLS)
+	}
+}
+
+func TestHostTLS_Config(t *testing.T) {
+	var hints *HostTLS
+	if cfg, err := hints.Config(nil); err != nil || cfg == nil {
+		t.Errorf("unexpected result: %v %v", cfg, err)
+	}
+	if _, err := (&HostTLS{CA: "not a certificate"}).Config(nil); err != ErrBadCA {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
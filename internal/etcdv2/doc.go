@@ -0,0 +1,9 @@
+// Package etcdv2 aliases the v2 etcd client, so the etcd package compiles with the client library
+// of the etcd release selected with the build tags:
+//
+//   - no tags: go.etcd.io/etcd/client/v3 and its siblings, the current official client (etcd 3.5 and 3.6)
+//   - etcd34: go.etcd.io/etcd/clientv3 and its siblings (etcd 3.4)
+//   - etcd33: github.com/coreos/etcd/clientv3 and its siblings (etcd 3.3 and older)
+//
+// Only the symbols used by the etcd package are aliased.
+package etcdv2
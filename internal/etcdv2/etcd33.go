@@ -0,0 +1,44 @@
+//go:build etcd33
+// +build etcd33
+
+package etcdv2
+
+import "github.com/coreos/etcd/client"
+
+type (
+	CancelableTransport  = client.CancelableTransport
+	Client               = client.Client
+	ClusterError         = client.ClusterError
+	Config               = client.Config
+	CreateInOrderOptions = client.CreateInOrderOptions
+	DeleteOptions        = client.DeleteOptions
+	Error                = client.Error
+	GetOptions           = client.GetOptions
+	KeysAPI              = client.KeysAPI
+	Node                 = client.Node
+	Nodes                = client.Nodes
+	PrevExistType        = client.PrevExistType
+	Response             = client.Response
+	SetOptions           = client.SetOptions
+	Watcher              = client.Watcher
+	WatcherOptions       = client.WatcherOptions
+)
+
+const (
+	ErrorCodeKeyNotFound       = client.ErrorCodeKeyNotFound
+	ErrorCodeTestFailed        = client.ErrorCodeTestFailed
+	ErrorCodeNodeExist         = client.ErrorCodeNodeExist
+	ErrorCodeUnauthorized      = client.ErrorCodeUnauthorized
+	ErrorCodeEventIndexCleared = client.ErrorCodeEventIndexCleared
+	ErrorCodeRaftInternal      = client.ErrorCodeRaftInternal
+	ErrorCodeLeaderElect       = client.ErrorCodeLeaderElect
+	ErrorCodeWatcherCleared    = client.ErrorCodeWatcherCleared
+
+	PrevNoExist = client.PrevNoExist
+)
+
+var (
+	DefaultTransport = client.DefaultTransport
+	New              = client.New
+	NewKeysAPI       = client.NewKeysAPI
+)
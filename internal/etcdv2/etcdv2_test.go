@@ -0,0 +1,26 @@
+package etcdv2
+
+import "testing"
+
+// the interfaces of the client the etcd package relies on, checked against every variant
+var (
+	_ error = Error{}
+	_ error = (*ClusterError)(nil)
+)
+
+func TestNewKeysAPI(t *testing.T) {
+	c, err := New(Config{Endpoints: []string{"http://127.0.0.1:2379"}, Transport: DefaultTransport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NewKeysAPI(c) == nil {
+		t.Error("unexpected nil keys api")
+	}
+}
+
+func TestError(t *testing.T) {
+	err := Error{Code: ErrorCodeKeyNotFound, Message: "Key not found"}
+	if err.Error() == "" {
+		t.Error("unexpected empty message")
+	}
+}
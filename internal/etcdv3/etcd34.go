@@ -0,0 +1,57 @@
+//go:build etcd34 && !etcd33
+// +build etcd34,!etcd33
+
+package etcdv3
+
+import "go.etcd.io/etcd/clientv3"
+
+type (
+	AlarmMember            = clientv3.AlarmMember
+	Client                 = clientv3.Client
+	Cmp                    = clientv3.Cmp
+	Config                 = clientv3.Config
+	Event                  = clientv3.Event
+	GetResponse            = clientv3.GetResponse
+	KV                     = clientv3.KV
+	Lease                  = clientv3.Lease
+	LeaseGrantResponse     = clientv3.LeaseGrantResponse
+	LeaseID                = clientv3.LeaseID
+	LeaseKeepAliveResponse = clientv3.LeaseKeepAliveResponse
+	LeaseRevokeResponse    = clientv3.LeaseRevokeResponse
+	Op                     = clientv3.Op
+	OpOption               = clientv3.OpOption
+	PutResponse            = clientv3.PutResponse
+	ResponseHeader         = clientv3.ResponseHeader
+	StatusResponse         = clientv3.StatusResponse
+	Txn                    = clientv3.Txn
+	TxnResponse            = clientv3.TxnResponse
+	WatchChan              = clientv3.WatchChan
+	WatchResponse          = clientv3.WatchResponse
+	Watcher                = clientv3.Watcher
+)
+
+const (
+	NoLease           = clientv3.NoLease
+	AlarmType_NONE    = clientv3.AlarmType_NONE
+	AlarmType_NOSPACE = clientv3.AlarmType_NOSPACE
+	AlarmType_CORRUPT = clientv3.AlarmType_CORRUPT
+)
+
+var (
+	New               = clientv3.New
+	Compare           = clientv3.Compare
+	CreateRevision    = clientv3.CreateRevision
+	Value             = clientv3.Value
+	OpPut             = clientv3.OpPut
+	OpDelete          = clientv3.OpDelete
+	GetPrefixRangeEnd = clientv3.GetPrefixRangeEnd
+	WithCountOnly     = clientv3.WithCountOnly
+	WithFragment      = clientv3.WithFragment
+	WithLease         = clientv3.WithLease
+	WithLimit         = clientv3.WithLimit
+	WithPrefix        = clientv3.WithPrefix
+	WithPrevKV        = clientv3.WithPrevKV
+	WithRange         = clientv3.WithRange
+	WithRev           = clientv3.WithRev
+	WithSerializable  = clientv3.WithSerializable
+)
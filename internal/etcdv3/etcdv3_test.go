@@ -0,0 +1,39 @@
+package etcdv3
+
+import "testing"
+
+// the interfaces of the client the etcd package relies on, checked against every variant
+var (
+	_ KV      = (*Client)(nil)
+	_ Watcher = (*Client)(nil)
+	_ Lease   = (*Client)(nil)
+)
+
+func TestNew_noEndpoints(t *testing.T) {
+	if c, err := New(Config{}); err == nil {
+		c.Close()
+		t.Error("the client should not be created without endpoints")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for i, opt := range []OpOption{
+		WithPrefix(),
+		WithPrevKV(),
+		WithFragment(),
+		WithSerializable(),
+		WithCountOnly(),
+		WithLimit(100),
+		WithRange(GetPrefixRangeEnd("/services/api/")),
+		WithRev(42),
+		WithLease(LeaseID(1)),
+	} {
+		if opt == nil {
+			t.Errorf("unexpected nil option %d", i)
+		}
+	}
+	var _ Op = OpPut("/services/api/1", "http://10.0.0.1", WithLease(NoLease))
+	var _ Op = OpDelete("/services/api/1")
+	var _ Cmp = Compare(CreateRevision("/services/api/1"), "=", 0)
+	var _ Cmp = Compare(Value("/services/api/1"), "=", "http://10.0.0.1")
+}
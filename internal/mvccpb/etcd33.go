@@ -0,0 +1,13 @@
+//go:build etcd33
+// +build etcd33
+
+package mvccpb
+
+import upstream "github.com/coreos/etcd/mvcc/mvccpb"
+
+type KeyValue = upstream.KeyValue
+
+const (
+	PUT    = upstream.PUT
+	DELETE = upstream.DELETE
+)
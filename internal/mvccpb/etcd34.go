@@ -0,0 +1,13 @@
+//go:build etcd34 && !etcd33
+// +build etcd34,!etcd33
+
+package mvccpb
+
+import upstream "go.etcd.io/etcd/mvcc/mvccpb"
+
+type KeyValue = upstream.KeyValue
+
+const (
+	PUT    = upstream.PUT
+	DELETE = upstream.DELETE
+)
@@ -0,0 +1,13 @@
+//go:build !etcd33 && !etcd34
+// +build !etcd33,!etcd34
+
+package mvccpb
+
+import upstream "go.etcd.io/etcd/api/v3/mvccpb"
+
+type KeyValue = upstream.KeyValue
+
+const (
+	PUT    = upstream.PUT
+	DELETE = upstream.DELETE
+)
@@ -0,0 +1,17 @@
+//go:build etcd34 && !etcd33
+// +build etcd34,!etcd33
+
+package rpctypes
+
+import upstream "go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
+
+type EtcdError = upstream.EtcdError
+
+var (
+	ErrAuthFailed       = upstream.ErrAuthFailed
+	ErrCompacted        = upstream.ErrCompacted
+	ErrInvalidAuthToken = upstream.ErrInvalidAuthToken
+	ErrNoLeader         = upstream.ErrNoLeader
+	ErrNoSpace          = upstream.ErrNoSpace
+	ErrPermissionDenied = upstream.ErrPermissionDenied
+)
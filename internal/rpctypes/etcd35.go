@@ -0,0 +1,17 @@
+//go:build !etcd33 && !etcd34
+// +build !etcd33,!etcd34
+
+package rpctypes
+
+import upstream "go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+
+type EtcdError = upstream.EtcdError
+
+var (
+	ErrAuthFailed       = upstream.ErrAuthFailed
+	ErrCompacted        = upstream.ErrCompacted
+	ErrInvalidAuthToken = upstream.ErrInvalidAuthToken
+	ErrNoLeader         = upstream.ErrNoLeader
+	ErrNoSpace          = upstream.ErrNoSpace
+	ErrPermissionDenied = upstream.ErrPermissionDenied
+)
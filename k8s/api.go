@@ -0,0 +1,271 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	watchRetryDelay   = time.Second
+)
+
+// ErrNotInCluster is returned when the in-cluster config can not be found
+var ErrNotInCluster = errors.New("k8s: unable to load the in-cluster config")
+
+// API is a minimal client of the Kubernetes API, just able to read and watch the Endpoints and the
+// EndpointSlices. It talks directly to the REST API, so there is no need to depend on client-go.
+type API struct {
+	// Server is the base URL of the API server. e.g. "https://10.96.0.1:443"
+	Server string
+	// Token is the bearer token sent with every request, if any
+	Token string
+	// TokenFile is the file holding the bearer token, read again every time it is modified, like the
+	// service account tokens rotated by the kubelet. It takes precedence over the Token.
+	TokenFile string
+	// Client is the http client used for the requests
+	Client *http.Client
+	// UseEndpointSlices makes the API read the discovery.k8s.io/v1 EndpointSlices of the services
+	// instead of their core/v1 Endpoints
+	UseEndpointSlices bool
+
+	mutex    sync.Mutex
+	token    string
+	tokenMod time.Time
+}
+
+// NewInClusterAPI returns an API configured with the service account mounted in the pod. The token is
+// read again every time the kubelet rotates it.
+func NewInClusterAPI() (*API, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, ErrNotInCluster
+	}
+	api := &API{TokenFile: serviceAccountDir + "/token"}
+	if _, err := api.bearerToken(); err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, ErrNotInCluster
+	}
+	api.Server = "https://" + net.JoinHostPort(host, port)
+	api.Client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	return api, nil
+}
+
+// bearerToken returns the token to send, reading the TokenFile again if it was modified since the last
+// read
+func (a *API) bearerToken() (string, error) {
+	if a.TokenFile == "" {
+		return a.Token, nil
+	}
+	info, err := os.Stat(a.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token != "" && info.ModTime().Equal(a.tokenMod) {
+		return a.token, nil
+	}
+	raw, err := ioutil.ReadFile(a.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.tokenMod = strings.TrimSpace(string(raw)), info.ModTime()
+	return a.token, nil
+}
+
+// Addresses implements the Cluster interface
+func (a *API) Addresses(ctx context.Context, s Service) ([]string, error) {
+	resp, err := a.get(ctx, s, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list objectList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	addresses := []string{}
+	for _, o := range list.Items {
+		addresses = append(addresses, o.addresses(s.Port)...)
+	}
+	return addresses, nil
+}
+
+// Watch implements the Cluster interface. The broken watches are restarted until the context is
+// canceled.
+func (a *API) Watch(ctx context.Context, s Service, ch chan struct{}) {
+	ch <- struct{}{} // make sure the caller reads the addresses
+	for {
+		if err := a.watch(ctx, s, ch); err != nil && ctx.Err() == nil {
+			select {
+			case <-etcd.GetClock().After(etcd.Jitter(watchRetryDelay)):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// some events could have been lost while the watch was down
+		ch <- struct{}{}
+	}
+}
+
+func (a *API) watch(ctx context.Context, s Service, ch chan struct{}) error {
+	resp, err := a.get(ctx, s, url.Values{"watch": []string{"true"}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var e event
+		if err := dec.Decode(&e); err == io.EOF {
+			// the api server closes the watches after a while
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if e.Type == "ERROR" {
+			return fmt.Errorf("k8s: watch error")
+		}
+		select {
+		case ch <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (a *API) get(ctx context.Context, s Service, query url.Values) (*http.Response, error) {
+	var path string
+	if a.UseEndpointSlices {
+		path = fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices", s.namespace())
+		query.Set("labelSelector", "kubernetes.io/service-name="+s.Name)
+	} else {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/endpoints", s.namespace())
+		query.Set("fieldSelector", "metadata.name="+s.Name)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(a.Server, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	token, err := a.bearerToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	c := a.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("k8s: unexpected status code %d reading %s", resp.StatusCode, path)
+	}
+	return resp, nil
+}
+
+type event struct {
+	Type string `json:"type"`
+}
+
+type objectList struct {
+	Items []object `json:"items"`
+}
+
+// object holds the fields of the Endpoints and of the EndpointSlices required by the bridge
+type object struct {
+	// Endpoints
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []port `json:"ports"`
+	} `json:"subsets"`
+
+	// EndpointSlices
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []port `json:"ports"`
+}
+
+type port struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// addresses returns the ready addresses of the object, joined with the selected port
+func (o object) addresses(name string) []string {
+	addresses := []string{}
+	for _, s := range o.Subsets {
+		p, ok := selectPort(s.Ports, name)
+		if !ok {
+			continue
+		}
+		for _, a := range s.Addresses {
+			addresses = append(addresses, net.JoinHostPort(a.IP, p))
+		}
+	}
+
+	p, ok := selectPort(o.Ports, name)
+	if !ok {
+		return addresses
+	}
+	for _, e := range o.Endpoints {
+		if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+			continue
+		}
+		for _, a := range e.Addresses {
+			addresses = append(addresses, net.JoinHostPort(a, p))
+		}
+	}
+	return addresses
+}
+
+// selectPort returns the port with the given name or number, or the first one if no name is given
+func selectPort(ports []port, name string) (string, bool) {
+	for i, p := range ports {
+		if name == "" && i == 0 || p.Name == name || strconv.Itoa(p.Port) == name {
+			return strconv.Itoa(p.Port), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,136 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAPI_Addresses_endpoints(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/endpoints" || r.URL.Query().Get("fieldSelector") != "metadata.name=api" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"items": [{"subsets": [
+			{"addresses": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}], "notReadyAddresses": [{"ip": "10.0.0.3"}], "ports": [{"name": "metrics", "port": 9100}, {"name": "http", "port": 8080}]},
+			{"addresses": [{"ip": "fd00::1"}], "ports": [{"name": "http", "port": 8080}]}
+		]}]}`)
+	}))
+	defer ts.Close()
+
+	api := &API{Server: ts.URL, Token: "secret"}
+	addresses, err := api.Addresses(context.Background(), Service{Name: "api", Port: "http"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.0.0.1:8080", "10.0.0.2:8080", "[fd00::1]:8080"}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("unexpected addresses: %v", addresses)
+	}
+
+	api.Token = ""
+	if _, err := api.Addresses(context.Background(), Service{Name: "api"}); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestAPI_tokenFile(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+r.URL.Query().Get("fieldSelector")[len("metadata.name="):] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"items": []}`)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "k8s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	ioutil.WriteFile(file, []byte("first\n"), 0600)
+
+	api := &API{Server: ts.URL, Token: "ignored", TokenFile: file}
+	if _, err := api.Addresses(context.Background(), Service{Name: "first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rotated tokens are read again
+	ioutil.WriteFile(file, []byte("second\n"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(file, later, later)
+	if _, err := api.Addresses(context.Background(), Service{Name: "second"}); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Remove(file)
+	if _, err := api.Addresses(context.Background(), Service{Name: "second"}); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestAPI_Addresses_endpointSlices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices" || r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=api" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"items": [{
+			"endpoints": [
+				{"addresses": ["10.0.0.1"], "conditions": {"ready": true}},
+				{"addresses": ["10.0.0.2"], "conditions": {"ready": false}},
+				{"addresses": ["10.0.0.3"], "conditions": {}}
+			],
+			"ports": [{"name": "http", "port": 8080}]
+		}]}`)
+	}))
+	defer ts.Close()
+
+	api := &API{Server: ts.URL, UseEndpointSlices: true}
+	addresses, err := api.Addresses(context.Background(), Service{Namespace: "shop", Name: "api", Port: "8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"10.0.0.1:8080", "10.0.0.3:8080"}; !reflect.DeepEqual(addresses, expected) {
+		t.Errorf("unexpected addresses: %v", addresses)
+	}
+}
+
+func TestAPI_Watch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, `{"type": "ADDED", "object": {}}`)
+		fmt.Fprintln(w, `{"type": "MODIFIED", "object": {}}`)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan struct{})
+	go (&API{Server: ts.URL}).Watch(ctx, Service{Name: "api"}, ch)
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for the signal #%d", i)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package k8s publishes the endpoints of Kubernetes services into etcd, so the KrakenD gateways can keep
+// using the etcd subscriber while the source of truth lives in Kubernetes.
+//
+//	api, err := k8s.NewInClusterAPI()
+//	...
+//	b := k8s.NewBridge(api, registrar, 30*time.Second, k8s.Service{
+//		Namespace: "default",
+//		Name:      "api",
+//		Port:      "http",
+//		Prefix:    "/services/api",
+//		Scheme:    "http",
+//	})
+//	err = b.Run(ctx)
+//
+// Every address is stored under its own key, attached to a lease that the bridge keeps alive, so the
+// entries expire by themselves if the bridge stops.
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+)
+
+// DefaultTTL is the ttl of the published entries when none is defined
+const DefaultTTL = 30 * time.Second
+
+// ErrNoServices is returned when the bridge has no services to publish
+var ErrNoServices = errors.New("k8s: no services to publish")
+
+// Cluster is the source of the addresses of the services
+type Cluster interface {
+	// Addresses returns the ready addresses (host:port) of the service
+	Addresses(ctx context.Context, s Service) ([]string, error)
+
+	// Watch signals on the channel every change of the service, after sending an initial sentinel
+	// value. It blocks until the context is canceled.
+	Watch(ctx context.Context, s Service, ch chan struct{})
+}
+
+// Service is a Kubernetes service to publish into etcd
+type Service struct {
+	// Namespace of the service. Defaults to "default"
+	Namespace string
+	// Name of the service
+	Name string
+	// Port is the name or the number of the port to publish. Defaults to the first one.
+	Port string
+	// Prefix is the etcd prefix where the addresses are published. e.g. "/services/api"
+	Prefix string
+	// Scheme is added to the published addresses, if defined. e.g. "http"
+	Scheme string
+	// Format is the entry format of the published values: raw (the default), json, go-micro or any other
+	// registered with etcd.RegisterSerializer
+	Format string
+}
+
+func (s Service) namespace() string {
+	if s.Namespace == "" {
+		return "default"
+	}
+	return s.Namespace
+}
+
+// Bridge keeps the etcd prefixes of the services in sync with their Kubernetes endpoints
+type Bridge struct {
+	cluster   Cluster
+	registrar etcd.Registrar
+	ttl       time.Duration
+	services  []Service
+}
+
+// NewBridge returns a bridge publishing the addresses of the services with the received registrar.
+// The entries of every service are written through an etcd.Session, so the registrars implementing
+// etcd.LeaseRegistrar keep them on a single lease kept alive in the background, written again only when
+// the addresses change. The rest of the registrars get them refreshed every half ttl, plus the jitter.
+func NewBridge(c Cluster, r etcd.Registrar, ttl time.Duration, services ...Service) *Bridge {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Bridge{
+		cluster:   c,
+		registrar: r,
+		ttl:       ttl,
+		services:  services,
+	}
+}
+
+// Run publishes the services until the context is canceled. The published entries are left to expire,
+// so a restart of the bridge does not empty the prefixes.
+func (b *Bridge) Run(ctx context.Context) error {
+	if len(b.services) == 0 {
+		return ErrNoServices
+	}
+	wg := &sync.WaitGroup{}
+	for _, s := range b.services {
+		wg.Add(1)
+		go func(s Service) {
+			defer wg.Done()
+			b.loop(ctx, s)
+		}(s)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (b *Bridge) loop(ctx context.Context, s Service) {
+	ch := make(chan struct{})
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go b.cluster.Watch(watchCtx, s, ch)
+
+	session := etcd.NewSession(b.registrar, b.ttl)
+	refresh := etcd.GetClock().After(etcd.Jitter(b.ttl / 2))
+	var published map[string]string
+	for {
+		select {
+		case <-ch:
+			addresses, err := b.cluster.Addresses(ctx, s)
+			if err != nil {
+				continue
+			}
+			if published, err = b.sync(session, published, entries(s, addresses)); err != nil {
+				etcd.GetLogger().Warning("k8s: unable to publish the service", s.Name+":", err.Error())
+			}
+
+		case <-refresh:
+			if err := b.refresh(session, published); err != nil {
+				etcd.GetLogger().Warning("k8s: unable to refresh the service", s.Name+":", err.Error())
+			}
+			refresh = etcd.GetClock().After(etcd.Jitter(b.ttl / 2))
+
+		case <-ctx.Done():
+			session.Release()
+			return
+		}
+	}
+}
+
+// sync registers the current entries and removes the published ones no longer present, returning the
+// first error. Once the service has no addresses left, its session is closed, revoking its lease. The
+// failed registrations are retried by the next refresh and the failed removals are left to expire.
+func (b *Bridge) sync(session *etcd.Session, published, current map[string]string) (map[string]string, error) {
+	var err error
+	if len(current) > 0 {
+		err = session.RegisterAll(current)
+	}
+	for key := range published {
+		if _, ok := current[key]; ok {
+			continue
+		}
+		if derr := session.Deregister(key); derr != nil && err == nil {
+			err = derr
+		}
+	}
+	if len(current) == 0 {
+		if cerr := session.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return current, err
+}
+
+// refresh registers the published entries again through the session, so only the registrars without
+// leases and the sessions whose lease was lost write them
+func (b *Bridge) refresh(session *etcd.Session, published map[string]string) error {
+	return session.RegisterAll(published)
+}
+
+// entries returns the keys and values to publish for the received addresses, encoded in the format of the
+// service. The addresses that can not be encoded are skipped.
+func entries(s Service, addresses []string) map[string]string {
+	result := make(map[string]string, len(addresses))
+	prefix := strings.TrimRight(s.Prefix, "/")
+	for _, a := range addresses {
+		url := a
+		if s.Scheme != "" {
+			url = s.Scheme + "://" + a
+		}
+		value, err := etcd.EncodeInstance(s.Format, etcd.Instance{Name: s.Name, ID: a, URL: url})
+		if err != nil {
+			continue
+		}
+		result[prefix+"/"+a] = value
+	}
+	return result
+}
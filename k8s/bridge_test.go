@@ -0,0 +1,232 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+)
+
+type fakeCluster struct {
+	mutex     *sync.Mutex
+	addresses []string
+	ch        chan struct{}
+}
+
+func (f *fakeCluster) Addresses(_ context.Context, _ Service) ([]string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.addresses, nil
+}
+
+func (f *fakeCluster) Watch(ctx context.Context, _ Service, ch chan struct{}) {
+	ch <- struct{}{}
+	for {
+		select {
+		case <-f.ch:
+			ch <- struct{}{}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *fakeCluster) set(addresses ...string) {
+	f.mutex.Lock()
+	f.addresses = addresses
+	f.mutex.Unlock()
+	f.ch <- struct{}{}
+}
+
+type fakeRegistrar struct {
+	mutex   *sync.Mutex
+	entries map[string]string
+	ttls    map[string]time.Duration
+	err     error
+}
+
+func (f *fakeRegistrar) Register(key, value string, ttl time.Duration) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.entries[key] = value
+	f.ttls[key] = ttl
+	return nil
+}
+
+func (f *fakeRegistrar) Deregister(key string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.entries, key)
+	return nil
+}
+
+func (f *fakeRegistrar) snapshot() map[string]string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	result := map[string]string{}
+	for k, v := range f.entries {
+		result[k] = v
+	}
+	return result
+}
+
+func TestBridge_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cluster := &fakeCluster{mutex: &sync.Mutex{}, addresses: []string{"10.0.0.1:8080", "10.0.0.2:8080"}, ch: make(chan struct{})}
+	registrar := &fakeRegistrar{mutex: &sync.Mutex{}, entries: map[string]string{}, ttls: map[string]time.Duration{}}
+	b := NewBridge(cluster, registrar, 10*time.Second, Service{Name: "api", Prefix: "/services/api/", Scheme: "http"})
+
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := map[string]string{
+		"/services/api/10.0.0.1:8080": "http://10.0.0.1:8080",
+		"/services/api/10.0.0.2:8080": "http://10.0.0.2:8080",
+	}
+	if entries := registrar.snapshot(); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+	if ttl := registrar.ttls["/services/api/10.0.0.1:8080"]; ttl != 10*time.Second {
+		t.Errorf("unexpected ttl: %s", ttl)
+	}
+
+	cluster.set("10.0.0.2:8080", "10.0.0.3:8080")
+	time.Sleep(50 * time.Millisecond)
+
+	expected = map[string]string{
+		"/services/api/10.0.0.2:8080": "http://10.0.0.2:8080",
+		"/services/api/10.0.0.3:8080": "http://10.0.0.3:8080",
+	}
+	if entries := registrar.snapshot(); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBridge_sync_errors(t *testing.T) {
+	errUnavailable := errors.New("etcdserver: request timed out")
+	registrar := &fakeRegistrar{mutex: &sync.Mutex{}, entries: map[string]string{}, ttls: map[string]time.Duration{}, err: errUnavailable}
+	b := NewBridge(nil, registrar, 10*time.Second, Service{Name: "api", Prefix: "/services/api"})
+
+	session := etcd.NewSession(registrar, b.ttl)
+	published := map[string]string{"/services/api/10.0.0.1:8080": "10.0.0.1:8080"}
+	current := map[string]string{"/services/api/10.0.0.2:8080": "10.0.0.2:8080"}
+	if result, err := b.sync(session, published, current); err != errUnavailable || !reflect.DeepEqual(result, current) {
+		t.Errorf("unexpected sync: %v %v", result, err)
+	}
+	if err := b.refresh(session, current); err != errUnavailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// fakeLeaseRegistrar is a fakeRegistrar granting fakeLeases, counting the grants, the writes and the
+// revocations
+type fakeLeaseRegistrar struct {
+	*fakeRegistrar
+	grants, writes, revokes int
+}
+
+func (f *fakeLeaseRegistrar) GrantLease(time.Duration) (etcd.Lease, error) {
+	f.grants++
+	return fakeLease{registrar: f, done: make(chan struct{})}, nil
+}
+
+type fakeLease struct {
+	etcd.Lease
+	registrar *fakeLeaseRegistrar
+	done      chan struct{}
+}
+
+func (f fakeLease) RegisterAll(entries map[string]string, _ time.Duration) error {
+	for key, value := range entries {
+		f.registrar.writes++
+		f.registrar.Register(key, value, 0)
+	}
+	return nil
+}
+
+func (f fakeLease) Done() <-chan struct{} { return f.done }
+
+func (f fakeLease) Revoke() error {
+	f.registrar.revokes++
+	return nil
+}
+
+func TestBridge_sync_lease(t *testing.T) {
+	registrar := &fakeLeaseRegistrar{fakeRegistrar: &fakeRegistrar{mutex: &sync.Mutex{}, entries: map[string]string{}, ttls: map[string]time.Duration{}}}
+	b := NewBridge(nil, registrar, 10*time.Second, Service{Name: "api", Prefix: "/services/api"})
+	session := etcd.NewSession(registrar, b.ttl)
+
+	current := map[string]string{
+		"/services/api/10.0.0.1:8080": "10.0.0.1:8080",
+		"/services/api/10.0.0.2:8080": "10.0.0.2:8080",
+	}
+	published, err := b.sync(session, nil, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.refresh(session, published); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if registrar.grants != 1 || registrar.writes != 2 {
+		t.Errorf("the refreshes should not write the entries: %d leases, %d writes", registrar.grants, registrar.writes)
+	}
+
+	// only the changed addresses are written
+	current = map[string]string{"/services/api/10.0.0.2:8080": "10.0.0.2:8080", "/services/api/10.0.0.3:8080": "10.0.0.3:8080"}
+	if published, err = b.sync(session, published, current); err != nil {
+		t.Fatal(err)
+	}
+	if registrar.grants != 1 || registrar.writes != 3 || !reflect.DeepEqual(registrar.snapshot(), current) {
+		t.Errorf("unexpected writes: %d leases, %d writes, %v", registrar.grants, registrar.writes, registrar.snapshot())
+	}
+
+	// the lease is revoked once the service has no addresses
+	if _, err = b.sync(session, published, map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if registrar.revokes != 1 || len(registrar.snapshot()) != 0 {
+		t.Errorf("unexpected revocations: %d, %v", registrar.revokes, registrar.snapshot())
+	}
+}
+
+func TestBridge_Run_noServices(t *testing.T) {
+	if err := NewBridge(nil, nil, 0).Run(context.Background()); err != ErrNoServices {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEntries_format(t *testing.T) {
+	s := Service{Name: "api", Prefix: "/services/api/", Scheme: "http", Format: "json"}
+	result := entries(s, []string{"10.0.0.1:8080"})
+	expected := map[string]string{
+		"/services/api/10.0.0.1:8080": `{"host":"10.0.0.1","port":8080,"scheme":"http","metadata":{"id":"10.0.0.1:8080","name":"api"}}`,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("unexpected entries: %v", result)
+	}
+
+	s.Format = "unknown"
+	if result := entries(s, []string{"10.0.0.1:8080"}); len(result) != 0 {
+		t.Errorf("the addresses should be skipped: %v", result)
+	}
+}
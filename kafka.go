@@ -0,0 +1,78 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultKafkaTimeout is the default timeout of the requests of a KafkaPublisher
+const DefaultKafkaTimeout = 5 * time.Second
+
+// KafkaPublisher is a Publisher producing the events to a Kafka topic through a Kafka REST proxy (v2 API),
+// so the gateway does not need a Kafka client. The records are keyed by the prefix, so the events of a
+// prefix land in the same partition and keep their order.
+type KafkaPublisher struct {
+	// URL is the address of the REST proxy, e.g. "http://kafka-rest:8082"
+	URL    string
+	Topic  string
+	Client *http.Client
+}
+
+// NewKafkaPublisher returns a KafkaPublisher producing the events to the topic. The timeout is
+// DefaultKafkaTimeout if it is not positive.
+func NewKafkaPublisher(url, topic string, timeout time.Duration) *KafkaPublisher {
+	if timeout <= 0 {
+		timeout = DefaultKafkaTimeout
+	}
+	return &KafkaPublisher{URL: url, Topic: topic, Client: &http.Client{Timeout: timeout}}
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string         `json:"key"`
+	Value DiscoveryEvent `json:"value"`
+}
+
+// Publish implements the Publisher interface
+func (p *KafkaPublisher) Publish(e DiscoveryEvent) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: e.Prefix, Value: e}}})
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(p.URL, "/") + "/topics/" + url.PathEscape(p.Topic)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka rest proxy %s answered with status %d", p.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func newKafkaPublisher(cfg map[string]interface{}) (Publisher, error) {
+	u, err := stringOption(cfg, "url")
+	if err != nil {
+		return nil, err
+	}
+	topic, err := stringOption(cfg, "topic")
+	if err != nil {
+		return nil, err
+	}
+	return NewKafkaPublisher(u, topic, timeoutOption(cfg)), nil
+}
@@ -0,0 +1,36 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKafkaPublisher(t *testing.T) {
+	var received kafkaRecords
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/topics/discovery" || req.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(req.Body).Decode(&received); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		rw.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer srv.Close()
+
+	e := DiscoveryEvent{ChangeEvent: ChangeEvent{Prefix: "/services/api", Removed: []string{"http://10.0.0.1"}}}
+	if err := NewKafkaPublisher(srv.URL+"/", "discovery", 0).Publish(e); err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Records) != 1 || received.Records[0].Key != "/services/api" || received.Records[0].Value.Removed[0] != "http://10.0.0.1" {
+		t.Errorf("unexpected records: %+v", received)
+	}
+
+	if err := NewKafkaPublisher(srv.URL, "unknown", 0).Publish(e); err == nil {
+		t.Error("error expected")
+	}
+}
@@ -0,0 +1,255 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// Lease is a lease kept alive in the background. The entries written through it are attached to it,
+// ignoring their ttl, so they stay alive without being written again and they expire together once the
+// lease is revoked or lost (e.g. the process holding it stops).
+type Lease interface {
+	SwapRegistrar
+	// RegisterAll stores all the entries attached to the lease, with as few writes as possible
+	RegisterAll(entries map[string]string, ttl time.Duration) error
+	// Done is closed once the lease is lost: revoked, expired or no longer kept alive
+	Done() <-chan struct{}
+	// Revoke stops keeping the lease alive and revokes it, removing its entries
+	Revoke() error
+	// Release stops keeping the lease alive without revoking it, so its entries expire with it
+	Release()
+}
+
+// LeaseRegistrar is implemented by the registrars able to grant a Lease, like the v3 clients. The periodic
+// writers use it to refresh their entries without granting a new lease, and notifying the watchers of
+// their keys, every time.
+type LeaseRegistrar interface {
+	Registrar
+	// GrantLease grants a lease with the received ttl (one second at least), kept alive until it is
+	// revoked or the client is closed
+	GrantLease(ttl time.Duration) (Lease, error)
+}
+
+// GrantLease implements the etcd LeaseRegistrar interface. The lease is kept alive by the keep-alive
+// stream of the client, so no key is written to refresh it.
+func (c *clientv3) GrantLease(ttl time.Duration) (Lease, error) {
+	if c.client == nil {
+		return nil, ErrNilClient
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+	defer cancel()
+	_, id, err := c.leaseOptions(ctx, ttl)
+	if err != nil {
+		return nil, countError(err)
+	}
+	keepAliveCtx, stop := context.WithCancel(c.ctx)
+	responses, err := c.client.KeepAlive(keepAliveCtx, id)
+	if err != nil {
+		stop()
+		c.client.Revoke(ctx, id)
+		return nil, countError(err)
+	}
+	l := &clientLease{client: c, id: id, stop: stop, done: make(chan struct{})}
+	go func() {
+		for range responses {
+		}
+		close(l.done)
+	}()
+	return l, nil
+}
+
+// clientLease is a lease of a v3 client, kept alive until its keep-alive stream is closed
+type clientLease struct {
+	client *clientv3
+	id     etcdv3.LeaseID
+	stop   context.CancelFunc
+	done   chan struct{}
+}
+
+// Register implements the etcd Registrar interface, attaching the entry to the lease
+func (l *clientLease) Register(key, value string, _ time.Duration) error {
+	ctx, cancel := context.WithTimeout(l.client.requestContext(), l.client.timeout)
+	defer cancel()
+	return l.client.put(ctx, key, value, etcdv3.WithLease(l.id))
+}
+
+// RegisterAll implements the etcd BatchRegistrar interface, attaching the entries to the lease
+func (l *clientLease) RegisterAll(entries map[string]string, _ time.Duration) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(l.client.requestContext(), l.client.timeout)
+	defer cancel()
+	return l.client.putAll(ctx, entries, etcdv3.WithLease(l.id))
+}
+
+// Deregister implements the etcd Registrar interface
+func (l *clientLease) Deregister(key string) error {
+	return l.client.Deregister(key)
+}
+
+// PutIfAbsent implements the etcd CASRegistrar interface, attaching the entry to the lease
+func (l *clientLease) PutIfAbsent(key, value string, _ time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(l.client.requestContext(), l.client.timeout)
+	defer cancel()
+	return l.client.putIf(ctx, etcdv3.Compare(etcdv3.CreateRevision(key), "=", 0), key, value, etcdv3.WithLease(l.id))
+}
+
+// CompareAndDelete implements the etcd CASRegistrar interface
+func (l *clientLease) CompareAndDelete(key, expected string) (bool, error) {
+	return l.client.CompareAndDelete(key, expected)
+}
+
+// CompareAndSwap implements the etcd SwapRegistrar interface, attaching the entry to the lease
+func (l *clientLease) CompareAndSwap(key, expected, value string, _ time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(l.client.requestContext(), l.client.timeout)
+	defer cancel()
+	return l.client.putIf(ctx, etcdv3.Compare(etcdv3.Value(key), "=", expected), key, value, etcdv3.WithLease(l.id))
+}
+
+// Done implements the etcd Lease interface
+func (l *clientLease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Revoke implements the etcd Lease interface
+func (l *clientLease) Revoke() error {
+	l.stop()
+	ctx, cancel := context.WithTimeout(l.client.requestContext(), l.client.timeout)
+	defer cancel()
+	_, err := l.client.client.Revoke(ctx, l.id)
+	return countError(err)
+}
+
+// Release implements the etcd Lease interface
+func (l *clientLease) Release() {
+	l.stop()
+}
+
+// Session keeps alive the entries of a periodic writer, like a heartbeat or a bridge, calling Register or
+// RegisterAll with them on every refresh. With a LeaseRegistrar, all the entries are attached to a single
+// lease kept alive in the background, so they are only written when their value changes or the lease is
+// lost, when a new one is granted and all of them are written again. The rest of the registrars get the
+// entries written with the ttl every time.
+type Session struct {
+	registrar Registrar
+	ttl       time.Duration
+	mutex     *sync.Mutex
+	lease     Lease
+	entries   map[string]string
+}
+
+// NewSession returns a Session writing the entries with the received registrar and ttl
+func NewSession(r Registrar, ttl time.Duration) *Session {
+	return &Session{registrar: r, ttl: ttl, mutex: &sync.Mutex{}, entries: map[string]string{}}
+}
+
+// Register writes the entry, unless the lease of the session already holds it with the same value
+func (s *Session) Register(key, value string) error {
+	return s.RegisterAll(map[string]string{key: value})
+}
+
+// RegisterAll writes the entries, skipping the ones the lease of the session already holds with the same
+// value
+func (s *Session) RegisterAll(entries map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(entries) == 0 && s.lease == nil {
+		return nil
+	}
+
+	lr, ok := s.registrar.(LeaseRegistrar)
+	if !ok || s.ttl <= 0 {
+		if err := RegisterAll(s.registrar, entries, s.ttl); err != nil {
+			return err
+		}
+		for key, value := range entries {
+			s.entries[key] = value
+		}
+		return nil
+	}
+
+	pending, err := s.renew(lr)
+	if err != nil {
+		return err
+	}
+	for key, value := range entries {
+		if current, ok := s.entries[key]; !ok || current != value {
+			pending[key] = value
+		}
+	}
+	if err := s.lease.RegisterAll(pending, 0); err != nil {
+		return err
+	}
+	for key, value := range pending {
+		s.entries[key] = value
+	}
+	return nil
+}
+
+// renew grants a new lease if the session has none or it was lost, returning the entries of the lost one
+// to write them again
+func (s *Session) renew(lr LeaseRegistrar) (map[string]string, error) {
+	if s.lease != nil {
+		select {
+		case <-s.lease.Done():
+			getLogger().Warning("etcd: the lease of the session was lost, writing its entries again")
+		default:
+			return map[string]string{}, nil
+		}
+	}
+	lease, err := lr.GrantLease(s.ttl)
+	if err != nil {
+		return nil, err
+	}
+	lost := s.entries
+	s.lease, s.entries = lease, map[string]string{}
+	return lost, nil
+}
+
+// Deregister removes the entry
+func (s *Session) Deregister(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+	return s.registrar.Deregister(key)
+}
+
+// Close removes all the entries of the session, revoking its lease or deregistering them one by one. The
+// session can be used again afterwards.
+func (s *Session) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries := s.entries
+	s.entries = map[string]string{}
+	if s.lease != nil {
+		lease := s.lease
+		s.lease = nil
+		return lease.Revoke()
+	}
+	var firstErr error
+	for _, key := range sortedKeys(entries) {
+		if err := s.registrar.Deregister(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Release stops keeping alive the entries of the session, leaving them to expire after the ttl, like the
+// writers stopping without removing them. The session can be used again afterwards.
+func (s *Session) Release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.lease != nil {
+		s.lease.Release()
+	}
+	s.lease, s.entries = nil, map[string]string{}
+}
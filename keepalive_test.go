@@ -0,0 +1,210 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+type fakePutKV struct {
+	etcdv3.KV
+	puts *int
+}
+
+func (f fakePutKV) Put(context.Context, string, string, ...etcdv3.OpOption) (*etcdv3.PutResponse, error) {
+	*f.puts++
+	return &etcdv3.PutResponse{Header: &etcdv3.ResponseHeader{Revision: 2}}, nil
+}
+
+// memoryLeaseRegistrar is a memorySwapRegistrar granting memoryLeases, counting the grants and the writes
+type memoryLeaseRegistrar struct {
+	*memorySwapRegistrar
+	grants int
+	writes int
+	leases []*memoryLease
+}
+
+func newMemoryLeaseRegistrar() *memoryLeaseRegistrar {
+	return &memoryLeaseRegistrar{memorySwapRegistrar: newMemorySwapRegistrar()}
+}
+
+func (r *memoryLeaseRegistrar) GrantLease(time.Duration) (Lease, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.grants++
+	l := &memoryLease{registrar: r, keys: map[string]struct{}{}, done: make(chan struct{})}
+	r.leases = append(r.leases, l)
+	return l, nil
+}
+
+// lose expires the last lease granted, removing its entries
+func (r *memoryLeaseRegistrar) lose() {
+	r.leases[len(r.leases)-1].Revoke()
+}
+
+type memoryLease struct {
+	registrar *memoryLeaseRegistrar
+	keys      map[string]struct{}
+	done      chan struct{}
+	once      sync.Once
+}
+
+func (l *memoryLease) Register(key, value string, _ time.Duration) error {
+	return l.RegisterAll(map[string]string{key: value}, 0)
+}
+
+func (l *memoryLease) RegisterAll(entries map[string]string, _ time.Duration) error {
+	for key, value := range entries {
+		l.registrar.Register(key, value, 0)
+		l.registrar.mutex.Lock()
+		l.registrar.writes++
+		l.keys[key] = struct{}{}
+		l.registrar.mutex.Unlock()
+	}
+	return nil
+}
+
+func (l *memoryLease) Deregister(key string) error { return l.registrar.Deregister(key) }
+
+func (l *memoryLease) PutIfAbsent(key, value string, _ time.Duration) (bool, error) {
+	ok, err := l.registrar.PutIfAbsent(key, value, 0)
+	l.track(key, ok)
+	return ok, err
+}
+
+func (l *memoryLease) CompareAndDelete(key, expected string) (bool, error) {
+	return l.registrar.CompareAndDelete(key, expected)
+}
+
+func (l *memoryLease) CompareAndSwap(key, expected, value string, _ time.Duration) (bool, error) {
+	ok, err := l.registrar.CompareAndSwap(key, expected, value, 0)
+	l.track(key, ok)
+	return ok, err
+}
+
+func (l *memoryLease) track(key string, ok bool) {
+	if !ok {
+		return
+	}
+	l.registrar.mutex.Lock()
+	l.registrar.writes++
+	l.keys[key] = struct{}{}
+	l.registrar.mutex.Unlock()
+}
+
+func (l *memoryLease) Done() <-chan struct{} { return l.done }
+
+func (l *memoryLease) Release() {}
+
+func (l *memoryLease) Revoke() error {
+	l.once.Do(func() {
+		for key := range l.keys {
+			l.registrar.Deregister(key)
+		}
+		close(l.done)
+	})
+	return nil
+}
+
+func TestClientV3_GrantLease(t *testing.T) {
+	puts, grants, revokes := 0, 0, 0
+	keepAlive := make(chan *etcdv3.LeaseKeepAliveResponse, 1)
+	c := &clientv3{
+		client: &etcdv3.Client{
+			KV:    fakePutKV{puts: &puts},
+			Lease: fakeLease{grants: &grants, revokes: &revokes, keepAlive: keepAlive},
+		},
+		ctx:     context.Background(),
+		timeout: time.Second,
+		writes:  newLocalWrites(),
+	}
+
+	l, err := c.GrantLease(10 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := l.Register("/services/api/1", "http://10.0.0.1", time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if grants != 1 || puts != 3 {
+		t.Errorf("unexpected writes: %d leases, %d puts", grants, puts)
+	}
+
+	keepAlive <- &etcdv3.LeaseKeepAliveResponse{ID: 42, TTL: 10}
+	select {
+	case <-l.Done():
+		t.Error("the lease should be kept alive")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(keepAlive)
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Error("the lease should be lost once its keep-alive stream is closed")
+	}
+
+	if err := l.Revoke(); err != nil || revokes != 1 {
+		t.Errorf("unexpected revoke: %v, %d", err, revokes)
+	}
+	if _, err := (&clientv3{}).GrantLease(time.Second); err != ErrNilClient {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSession_lease(t *testing.T) {
+	r := newMemoryLeaseRegistrar()
+	s := NewSession(r, 10*time.Second)
+
+	entries := map[string]string{"/services/api/1": "http://10.0.0.1", "/services/api/2": "http://10.0.0.2"}
+	for i := 0; i < 3; i++ {
+		if err := s.RegisterAll(entries); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.grants != 1 || r.writes != 2 {
+		t.Errorf("the unchanged entries should not be written again: %d leases, %d writes", r.grants, r.writes)
+	}
+
+	s.Register("/services/api/2", "http://10.0.0.3")
+	if r.grants != 1 || r.writes != 3 || r.get("/services/api/2") != "http://10.0.0.3" {
+		t.Errorf("the changed entries should be written: %d leases, %d writes", r.grants, r.writes)
+	}
+
+	// the entries of a lost lease are written again with a new one
+	r.lose()
+	if err := s.Register("/services/api/1", "http://10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if r.grants != 2 || r.writes != 5 || r.get("/services/api/2") != "http://10.0.0.3" {
+		t.Errorf("unexpected writes: %d leases, %d writes", r.grants, r.writes)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.entries) != 0 {
+		t.Errorf("the entries should be removed with the lease: %v", r.entries)
+	}
+}
+
+func TestSession_noLease(t *testing.T) {
+	r := newMemorySwapRegistrar()
+	s := NewSession(r, 10*time.Second)
+	if err := s.RegisterAll(map[string]string{"/services/api/1": "http://10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("/services/api/2", "http://10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.entries) != 2 {
+		t.Errorf("unexpected entries: %v", r.entries)
+	}
+	if err := s.Close(); err != nil || len(r.entries) != 0 {
+		t.Errorf("the entries should be deregistered: %v %v", err, r.entries)
+	}
+}
@@ -0,0 +1,31 @@
+package etcd
+
+import "sort"
+
+// KV is an entry stored under a prefix, along with the hosts decoded from it
+type KV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Hosts are the urls of the hosts described by the entry. It is empty for the entries discarded by
+	// the client, like the filtered, malformed or in maintenance ones, and for the maintenance
+	// keys themselves.
+	Hosts []string `json:"hosts"`
+}
+
+// DecodeKeyValues decodes the hosts of every entry returned by a KeyValueClient with the options (EntryFormat,
+// HostSource, Filter...), sorting them by key, so the debug tools can show which key produced which host
+func DecodeKeyValues(options ClientOptions, kvs map[string]string) []KV {
+	maintenance := maintenanceKeys(kvs)
+	result := make([]KV, 0, len(kvs))
+	for k, v := range kvs {
+		kv := KV{Key: k, Value: v}
+		_, flag := maintenanceEntry(k)
+		_, inMaintenance := maintenance[k]
+		if !flag && !inMaintenance {
+			kv.Hosts, _ = decodeEntryURLs(options, k, v)
+		}
+		result = append(result, kv)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
@@ -0,0 +1,43 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func TestDecodeKeyValues(t *testing.T) {
+	c := &clientv3{
+		client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{
+			Header: &etcdv3.ResponseHeader{Revision: 50},
+			Kvs: []*mvccpb.KeyValue{
+				{Key: []byte("/services/api/2"), Value: []byte(`{"host": "10.0.0.2", "port": 8080}`)},
+				{Key: []byte("/services/api/1"), Value: []byte(`{"host": "10.0.0.1", "port": 8080}`)},
+				{Key: []byte("/services/api/3"), Value: []byte(`not json`)},
+				{Key: []byte("/services/api/2" + MaintenanceSuffix), Value: []byte("true")},
+			},
+			Count: 4,
+		}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+	}
+	var kc KeyValueClient = c
+	raw, err := kc.GetKeyValues("/services/api/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvs := DecodeKeyValues(ClientOptions{EntryFormat: EntryFormatJSON}, raw)
+	expected := []KV{
+		{Key: "/services/api/1", Value: `{"host": "10.0.0.1", "port": 8080}`, Hosts: []string{"10.0.0.1:8080"}},
+		{Key: "/services/api/2", Value: `{"host": "10.0.0.2", "port": 8080}`},
+		{Key: "/services/api/2" + MaintenanceSuffix, Value: "true"},
+		{Key: "/services/api/3", Value: "not json"},
+	}
+	if !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("unexpected entries: %+v", kvs)
+	}
+}
@@ -0,0 +1,219 @@
+package etcd
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultLeaderTTL is the ttl of the leadership when none is defined
+const DefaultLeaderTTL = 15 * time.Second
+
+// LeaderOptions defines the options of a LeaderRegistration. All values are optional.
+type LeaderOptions struct {
+	// ID identifies the candidate in the election key. The id of the instance, or the hostname if it is
+	// not defined.
+	ID string
+	// TTL is the ttl of the election key and of the registration, so a leader that stops renewing them
+	// is replaced once it expires. The candidates try to take the leadership, and the leader renews it,
+	// every third of the ttl (plus the jitter). The registrars implementing LeaseRegistrar hold both on a
+	// single lease kept alive in the background instead, so the leader does not write them again while it
+	// keeps the leadership. DefaultLeaderTTL if it is not defined.
+	TTL time.Duration
+	// Format is the entry format of the registration (see RegisterInstance)
+	Format string
+	// OnChange is called every time the candidate takes or loses the leadership
+	OnChange func(leader bool)
+}
+
+// LeaderRegistration registers an instance only while it leads its pool, for the active/passive gateway
+// topologies: all the gateways of the pool compete for the election key, and only the one holding it
+// registers the instance (e.g. the virtual address of the service). Another one takes over once the
+// leader stops renewing it.
+type LeaderRegistration struct {
+	registrar SwapRegistrar
+	election  string
+	key       string
+	instance  Instance
+	options   LeaderOptions
+	mutex     *sync.RWMutex
+	leader    bool
+	renewed   time.Time
+	// lease holds the election key and the registration, if the registrar is a LeaseRegistrar
+	lease      Lease
+	registered bool
+}
+
+// NewLeaderRegistration returns a LeaderRegistration competing for the election key and registering the
+// instance under the key while it leads
+func NewLeaderRegistration(r SwapRegistrar, election, key string, i Instance, options LeaderOptions) *LeaderRegistration {
+	if options.TTL <= 0 {
+		options.TTL = DefaultLeaderTTL
+	}
+	if options.ID == "" {
+		options.ID = i.ID
+	}
+	if options.ID == "" {
+		options.ID, _ = os.Hostname()
+	}
+	return &LeaderRegistration{
+		registrar: r,
+		election:  election,
+		key:       key,
+		instance:  i,
+		options:   options,
+		mutex:     &sync.RWMutex{},
+	}
+}
+
+// IsLeader returns true while the candidate holds the leadership
+func (l *LeaderRegistration) IsLeader() bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.leader
+}
+
+// Run competes for the leadership until the context is canceled. The leader releases the election key and
+// removes the registration on its way out, so another candidate takes over right away.
+func (l *LeaderRegistration) Run(ctx context.Context) error {
+	for {
+		l.campaign()
+		select {
+		case <-GetClock().After(Jitter(l.options.TTL / 3)):
+		case <-ctx.Done():
+			if l.IsLeader() {
+				l.resign()
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// campaign takes the leadership if the election key is free, or renews it if the candidate already holds
+// it, refreshing the registration of the leader. The leaders failing to renew the leadership keep it
+// until its ttl expires, since the election key is not released before.
+func (l *LeaderRegistration) campaign() {
+	if lr, ok := l.registrar.(LeaseRegistrar); ok {
+		l.campaignWithLease(lr)
+		return
+	}
+	now := GetClock().Now()
+	var ok bool
+	var err error
+	if l.IsLeader() {
+		ok, err = l.registrar.CompareAndSwap(l.election, l.options.ID, l.options.ID, l.options.TTL)
+	} else {
+		ok, err = l.registrar.PutIfAbsent(l.election, l.options.ID, l.options.TTL)
+	}
+	if err != nil {
+		getLogger().Warning("etcd: unable to campaign for", l.election+":", err.Error())
+		l.mutex.RLock()
+		expired := l.leader && now.Sub(l.renewed) >= l.options.TTL
+		l.mutex.RUnlock()
+		if expired {
+			l.setLeader(false, now)
+		}
+		return
+	}
+	l.setLeader(ok, now)
+	if !ok {
+		return
+	}
+	if err := RegisterInstance(l.registrar, l.key, l.options.Format, l.instance, l.options.TTL); err != nil {
+		getLogger().Warning("etcd: unable to register the leader under", l.key+":", err.Error())
+	}
+}
+
+// campaignWithLease takes the leadership putting the election key and the registration on the lease of
+// the candidate, kept alive in the background like the sessions of the etcd elections. The leader keeps
+// the leadership, without writing any key, until its lease is lost.
+func (l *LeaderRegistration) campaignWithLease(lr LeaseRegistrar) {
+	now := GetClock().Now()
+	if l.lease != nil {
+		select {
+		case <-l.lease.Done():
+			l.lease = nil
+			l.setLeader(false, now)
+		default:
+			if l.IsLeader() {
+				l.registerOnLease()
+				l.setLeader(true, now)
+				return
+			}
+		}
+	}
+	if l.lease == nil {
+		lease, err := lr.GrantLease(l.options.TTL)
+		if err != nil {
+			getLogger().Warning("etcd: unable to campaign for", l.election+":", err.Error())
+			return
+		}
+		l.lease, l.registered = lease, false
+	}
+	ok, err := l.lease.PutIfAbsent(l.election, l.options.ID, 0)
+	if err != nil {
+		getLogger().Warning("etcd: unable to campaign for", l.election+":", err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+	l.registerOnLease()
+	l.setLeader(true, now)
+}
+
+// registerOnLease writes the registration of the leader on its lease, unless it is already there. The
+// failed registrations are retried by the next campaign.
+func (l *LeaderRegistration) registerOnLease() {
+	if l.registered {
+		return
+	}
+	if err := RegisterInstance(l.lease, l.key, l.options.Format, l.instance, 0); err != nil {
+		getLogger().Warning("etcd: unable to register the leader under", l.key+":", err.Error())
+		return
+	}
+	l.registered = true
+}
+
+// resign releases the election key and removes the registration, if they still belong to the candidate.
+// The candidates holding a lease revoke it, removing both.
+func (l *LeaderRegistration) resign() {
+	if l.lease != nil {
+		l.lease.Revoke()
+		l.lease = nil
+		l.setLeader(false, GetClock().Now())
+		return
+	}
+	if value, err := EncodeInstance(l.options.Format, l.instance); err == nil {
+		l.registrar.CompareAndDelete(l.key, value)
+	}
+	l.registrar.CompareAndDelete(l.election, l.options.ID)
+	l.setLeader(false, GetClock().Now())
+}
+
+// setLeader stores the state of the candidate, notifying its changes
+func (l *LeaderRegistration) setLeader(leader bool, now time.Time) {
+	l.mutex.Lock()
+	changed := l.leader != leader
+	l.leader = leader
+	if leader {
+		l.renewed = now
+	}
+	l.mutex.Unlock()
+
+	if !changed {
+		return
+	}
+	value := int64(0)
+	if leader {
+		value = 1
+		getLogger().Info("etcd:", l.options.ID, "took the leadership of", l.election)
+	} else {
+		getLogger().Warning("etcd:", l.options.ID, "lost the leadership of", l.election)
+	}
+	setMetric(MetricLeader+"."+l.election, value)
+	if l.options.OnChange != nil {
+		l.options.OnChange(leader)
+	}
+}
@@ -0,0 +1,199 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySwapRegistrar is an in-memory SwapRegistrar ignoring the ttls
+type memorySwapRegistrar struct {
+	mutex   *sync.Mutex
+	entries map[string]string
+	err     error
+}
+
+func newMemorySwapRegistrar() *memorySwapRegistrar {
+	return &memorySwapRegistrar{mutex: &sync.Mutex{}, entries: map[string]string{}}
+}
+
+func (r *memorySwapRegistrar) Register(key, value string, _ time.Duration) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries[key] = value
+	return nil
+}
+
+func (r *memorySwapRegistrar) Deregister(key string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.entries, key)
+	return nil
+}
+
+func (r *memorySwapRegistrar) PutIfAbsent(key, value string, _ time.Duration) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return false, r.err
+	}
+	if _, ok := r.entries[key]; ok {
+		return false, nil
+	}
+	r.entries[key] = value
+	return true, nil
+}
+
+func (r *memorySwapRegistrar) CompareAndDelete(key, expected string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if v, ok := r.entries[key]; !ok || v != expected {
+		return false, nil
+	}
+	delete(r.entries, key)
+	return true, nil
+}
+
+func (r *memorySwapRegistrar) CompareAndSwap(key, expected, value string, _ time.Duration) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return false, r.err
+	}
+	if v, ok := r.entries[key]; !ok || v != expected {
+		return false, nil
+	}
+	r.entries[key] = value
+	return true, nil
+}
+
+func (r *memorySwapRegistrar) get(key string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.entries[key]
+}
+
+func TestLeaderRegistration(t *testing.T) {
+	r := newMemorySwapRegistrar()
+	vip := Instance{URL: "http://10.0.0.100:8080"}
+	changes := []bool{}
+	a := NewLeaderRegistration(r, "/gateways/leader", "/services/gateway/vip", vip, LeaderOptions{
+		ID:       "gw-a",
+		OnChange: func(leader bool) { changes = append(changes, leader) },
+	})
+	b := NewLeaderRegistration(r, "/gateways/leader", "/services/gateway/vip", vip, LeaderOptions{ID: "gw-b"})
+
+	a.campaign()
+	b.campaign()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("unexpected leadership: %v %v", a.IsLeader(), b.IsLeader())
+	}
+	if r.get("/gateways/leader") != "gw-a" || r.get("/services/gateway/vip") != vip.URL {
+		t.Errorf("unexpected entries: %v", r.entries)
+	}
+	if Metrics()[MetricLeader+"./gateways/leader"] != 1 {
+		t.Error("the leadership should be published")
+	}
+
+	// the renewal keeps the leadership
+	a.campaign()
+	if !a.IsLeader() {
+		t.Error("the leader should renew its leadership")
+	}
+
+	a.resign()
+	if r.get("/gateways/leader") != "" || r.get("/services/gateway/vip") != "" {
+		t.Errorf("the resigning leader should release its entries: %v", r.entries)
+	}
+	b.campaign()
+	if a.IsLeader() || !b.IsLeader() || r.get("/services/gateway/vip") != vip.URL {
+		t.Errorf("the candidate should take over: %v %v %v", a.IsLeader(), b.IsLeader(), r.entries)
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	// the leadership taken by another candidate is lost on the next renewal
+	r.Register("/gateways/leader", "gw-c", 0)
+	b.campaign()
+	if b.IsLeader() {
+		t.Error("the leadership should be lost")
+	}
+}
+
+func TestLeaderRegistration_lease(t *testing.T) {
+	r := newMemoryLeaseRegistrar()
+	vip := Instance{URL: "http://10.0.0.100:8080"}
+	a := NewLeaderRegistration(r, "/gateways/leader", "/services/gateway/vip", vip, LeaderOptions{ID: "gw-a"})
+	b := NewLeaderRegistration(r, "/gateways/leader", "/services/gateway/vip", vip, LeaderOptions{ID: "gw-b"})
+
+	a.campaign()
+	b.campaign()
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("unexpected leadership: %v %v", a.IsLeader(), b.IsLeader())
+	}
+	if r.get("/gateways/leader") != "gw-a" || r.get("/services/gateway/vip") != vip.URL || r.writes != 2 {
+		t.Errorf("unexpected entries: %v, %d writes", r.entries, r.writes)
+	}
+
+	// the leader keeps the leadership without writing the keys again
+	for i := 0; i < 3; i++ {
+		a.campaign()
+	}
+	if !a.IsLeader() || r.grants != 2 || r.writes != 2 {
+		t.Errorf("unexpected renewals: %v, %d leases, %d writes", a.IsLeader(), r.grants, r.writes)
+	}
+
+	// the leadership is lost with the lease of the leader
+	r.leases[0].Revoke()
+	b.campaign()
+	a.campaign()
+	if a.IsLeader() || !b.IsLeader() || r.get("/gateways/leader") != "gw-b" || r.get("/services/gateway/vip") != vip.URL {
+		t.Errorf("the candidate should take over: %v %v %v", a.IsLeader(), b.IsLeader(), r.entries)
+	}
+
+	b.resign()
+	if b.IsLeader() || len(r.entries) != 0 {
+		t.Errorf("the resigning leader should revoke its lease: %v", r.entries)
+	}
+}
+
+func TestLeaderRegistration_expiration(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	r := newMemorySwapRegistrar()
+	l := NewLeaderRegistration(r, "/gateways/leader", "/services/gateway/vip", Instance{URL: "http://10.0.0.100:8080"}, LeaderOptions{ID: "gw-a"})
+	l.campaign()
+
+	// the leader keeps the leadership while it could be still valid
+	r.err = errors.New("unavailable")
+	clock.Advance(DefaultLeaderTTL / 2)
+	l.campaign()
+	if !l.IsLeader() {
+		t.Error("the leadership should be kept until its ttl expires")
+	}
+	clock.Advance(DefaultLeaderTTL / 2)
+	l.campaign()
+	if l.IsLeader() {
+		t.Error("the leadership should expire")
+	}
+}
+
+func TestLeaderRegistration_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newMemorySwapRegistrar()
+	l := NewLeaderRegistration(r, "/gateways/leader", "/services/gateway/vip", Instance{URL: "http://10.0.0.100:8080"}, LeaderOptions{
+		ID:       "gw-a",
+		OnChange: func(leader bool) { cancel() },
+	})
+	if err := l.Run(ctx); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if l.IsLeader() || len(r.entries) != 0 {
+		t.Errorf("the leader should resign once the context is canceled: %v", r.entries)
+	}
+}
@@ -0,0 +1,166 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// maxLeaseLookups limits the concurrent requests checking the time to live of the leases of a read
+const maxLeaseLookups = 16
+
+// leaseTracker caches the expiration of the leases checked by the reads, so the leases known to live
+// longer than the margin are not checked again, and schedules a new read of the prefixes discarding
+// entries with an expiring lease, since their renewals do not trigger any watch event. It is shared by
+// the scoped copies of the client. See ClientOptions.LeaseMargin.
+type leaseTracker struct {
+	mutex     *sync.Mutex
+	expiries  map[int64]time.Time
+	pending   map[string]time.Time
+	listeners map[chan struct{}]string
+}
+
+func newLeaseTracker() *leaseTracker {
+	return &leaseTracker{
+		mutex:     &sync.Mutex{},
+		expiries:  map[int64]time.Time{},
+		pending:   map[string]time.Time{},
+		listeners: map[chan struct{}]string{},
+	}
+}
+
+// leaseTrackerOf returns the lease tracker of the client, or nil if it does not track the leases
+func leaseTrackerOf(c Client) *leaseTracker {
+	if lc, ok := c.(interface{ leaseTracker() *leaseTracker }); ok {
+		return lc.leaseTracker()
+	}
+	return nil
+}
+
+// expiring returns the leases with less than margin time to live, along with their remaining time. The
+// ttl function returns the remaining seconds of a lease, and it is called concurrently for the leases
+// not cached. The leases that can not be checked are considered alive.
+func (t *leaseTracker) expiring(leases []int64, margin time.Duration, ttl func(int64) (int64, error)) map[int64]time.Duration {
+	now := GetClock().Now()
+	pending := []int64{}
+	checked := map[int64]struct{}{}
+	t.mutex.Lock()
+	for id, expiry := range t.expiries {
+		if expiry.Before(now) {
+			delete(t.expiries, id)
+		}
+	}
+	for _, l := range leases {
+		if _, ok := checked[l]; ok {
+			continue
+		}
+		checked[l] = struct{}{}
+		// the renewals only extend the cached expiration, so it is a lower bound
+		if expiry, ok := t.expiries[l]; ok && expiry.Sub(now) >= margin {
+			continue
+		}
+		pending = append(pending, l)
+	}
+	t.mutex.Unlock()
+
+	expiring := map[int64]time.Duration{}
+	wg := &sync.WaitGroup{}
+	slots := make(chan struct{}, maxLeaseLookups)
+	for _, l := range pending {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(l int64) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			seconds, err := ttl(l)
+			if err != nil {
+				return
+			}
+			remaining := time.Duration(seconds) * time.Second
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			// etcd returns -1 for the expired leases
+			if seconds >= 0 {
+				t.expiries[l] = now.Add(remaining)
+			}
+			if remaining < margin {
+				expiring[l] = remaining
+			}
+		}(l)
+	}
+	wg.Wait()
+	return expiring
+}
+
+// schedule signals the listeners of the prefix once the delay has elapsed, unless an earlier signal is
+// already scheduled
+func (t *leaseTracker) schedule(ctx context.Context, prefix string, delay time.Duration) {
+	at := GetClock().Now().Add(delay)
+	t.mutex.Lock()
+	if scheduled, ok := t.pending[prefix]; ok && !scheduled.After(at) {
+		t.mutex.Unlock()
+		return
+	}
+	t.pending[prefix] = at
+	t.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-GetClock().After(delay):
+		case <-ctx.Done():
+		}
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		if t.pending[prefix] == at {
+			delete(t.pending, prefix)
+		}
+		for ch, p := range t.listeners {
+			if p != prefix {
+				continue
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+}
+
+// listen returns a channel signaled every time the prefix should be read again because an entry
+// discarded by a previous read could have its lease renewed, until the context is done
+func (t *leaseTracker) listen(ctx context.Context, prefix string) <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	ch := make(chan struct{}, 1)
+	t.mutex.Lock()
+	t.listeners[ch] = prefix
+	t.mutex.Unlock()
+	go func() {
+		<-ctx.Done()
+		t.mutex.Lock()
+		delete(t.listeners, ch)
+		t.mutex.Unlock()
+	}()
+	return ch
+}
+
+// leaseTTL returns a function querying the remaining seconds of the leases
+func (c *clientv3) leaseTTL() func(int64) (int64, error) {
+	return func(id int64) (int64, error) {
+		ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+		defer cancel()
+		resp, err := c.client.TimeToLive(ctx, etcdv3.LeaseID(id))
+		if err != nil {
+			return 0, err
+		}
+		return resp.TTL, nil
+	}
+}
+
+// leaseTracker returns the lease tracker of the client
+func (c *clientv3) leaseTracker() *leaseTracker {
+	return c.leases
+}
@@ -0,0 +1,114 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeaseTracker_expiring(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	ttls := map[int64]int64{1: 30, 2: 1, 3: -1}
+	mutex := &sync.Mutex{}
+	calls := map[int64]int{}
+	ttl := func(id int64) (int64, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls[id]++
+		ttl, ok := ttls[id]
+		if !ok {
+			return 0, errors.New("unknown lease")
+		}
+		return ttl, nil
+	}
+	tracker := newLeaseTracker()
+
+	expiring := tracker.expiring([]int64{1, 2, 2, 3, 4, 1}, 2*time.Second, ttl)
+	expected := map[int64]time.Duration{2: time.Second, 3: -time.Second}
+	if !reflect.DeepEqual(expiring, expected) {
+		t.Errorf("unexpected leases: %v", expiring)
+	}
+	if !reflect.DeepEqual(calls, map[int64]int{1: 1, 2: 1, 3: 1, 4: 1}) {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+
+	// the leases living longer than the margin are not checked again until they could expire
+	clock.Advance(20 * time.Second)
+	tracker.expiring([]int64{1, 2}, 2*time.Second, ttl)
+	clock.Advance(9 * time.Second)
+	tracker.expiring([]int64{1, 2}, 2*time.Second, ttl)
+	if calls[1] != 2 || calls[2] != 3 {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
+
+func TestLeaseTracker_expiring_concurrent(t *testing.T) {
+	start := make(chan struct{})
+	mutex := &sync.Mutex{}
+	running, max := 0, 0
+	leases := []int64{}
+	for i := int64(1); i <= 3*maxLeaseLookups; i++ {
+		leases = append(leases, i)
+	}
+	go func() {
+		<-time.After(50 * time.Millisecond)
+		close(start)
+	}()
+	newLeaseTracker().expiring(leases, time.Second, func(int64) (int64, error) {
+		mutex.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mutex.Unlock()
+		<-start
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return 10, nil
+	})
+	if max != maxLeaseLookups {
+		t.Errorf("unexpected concurrent lookups: %d", max)
+	}
+}
+
+func TestLeaseTracker_schedule(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tracker := newLeaseTracker()
+	api := tracker.listen(ctx, "/services/api")
+	admin := tracker.listen(ctx, "/services/admin")
+	tracker.schedule(ctx, "/services/api", time.Second)
+	// a later signal is not scheduled while an earlier one is pending
+	tracker.schedule(ctx, "/services/api", time.Minute)
+
+	for {
+		clock.Advance(time.Second)
+		select {
+		case <-api:
+		case <-time.After(10 * time.Millisecond):
+			continue
+		}
+		break
+	}
+	select {
+	case <-admin:
+		t.Error("the admin prefix should not be signaled")
+	default:
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if len(tracker.pending) != 0 {
+		t.Errorf("unexpected pending signals: %v", tracker.pending)
+	}
+}
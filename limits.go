@@ -0,0 +1,153 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+)
+
+// ConcurrencyLimit bounds the concurrent operations of a client, in total and for every prefix. The
+// operations exceeding it wait for a slot. Zero values are unlimited.
+type ConcurrencyLimit struct {
+	Total     int
+	PerPrefix int
+}
+
+// clientLimits holds the limiters of the watches and the reads of a client, shared by its scoped copies
+type clientLimits struct {
+	watchers *concurrencyLimiter
+	gets     *concurrencyLimiter
+}
+
+func newClientLimits(options ClientOptions) *clientLimits {
+	return &clientLimits{
+		watchers: newConcurrencyLimiter(options.MaxWatchers, MetricQueuedWatches),
+		gets:     newConcurrencyLimiter(options.MaxConcurrentGets, MetricQueuedGets),
+	}
+}
+
+// acquireWatch waits for a slot to watch the prefix. See ClientOptions.MaxWatchers.
+func (l *clientLimits) acquireWatch(ctx context.Context, prefix string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	return l.watchers.acquire(ctx, prefix)
+}
+
+// acquireGet waits for a slot to read the prefix. See ClientOptions.MaxConcurrentGets.
+func (l *clientLimits) acquireGet(ctx context.Context, prefix string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	return l.gets.acquire(ctx, prefix)
+}
+
+// concurrencyLimiter counts the operations in flight, in total and by prefix, blocking the ones
+// exceeding its limit until another one is released
+type concurrencyLimiter struct {
+	limit    ConcurrencyLimit
+	metric   string
+	mutex    *sync.Mutex
+	active   int
+	prefixes map[string]int
+	// released is closed and replaced every time a slot is released, waking up the waiting operations
+	released chan struct{}
+}
+
+// newConcurrencyLimiter returns the limiter of the operations, publishing the waiting ones in the metric
+// gauge, or nil if the limit is unlimited
+func newConcurrencyLimiter(limit ConcurrencyLimit, metric string) *concurrencyLimiter {
+	if limit.Total <= 0 && limit.PerPrefix <= 0 {
+		return nil
+	}
+	return &concurrencyLimiter{
+		limit:    limit,
+		metric:   metric,
+		mutex:    &sync.Mutex{},
+		prefixes: map[string]int{},
+		released: make(chan struct{}),
+	}
+}
+
+// acquire waits for a slot to run an operation on the prefix, returning the function releasing it. The
+// error of the context is returned if it is done before.
+func (l *concurrencyLimiter) acquire(ctx context.Context, prefix string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	queued := false
+	defer func() {
+		if queued {
+			addMetric(l.metric, -1)
+		}
+	}()
+	for {
+		l.mutex.Lock()
+		if l.fits(prefix) {
+			l.active++
+			l.prefixes[prefix]++
+			l.mutex.Unlock()
+			once := &sync.Once{}
+			return func() { once.Do(func() { l.release(prefix) }) }, nil
+		}
+		released := l.released
+		l.mutex.Unlock()
+
+		if !queued {
+			queued = true
+			addMetric(l.metric, 1)
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fits returns true if another operation on the prefix is under the limit. It must be called with the
+// mutex locked.
+func (l *concurrencyLimiter) fits(prefix string) bool {
+	if l.limit.Total > 0 && l.active >= l.limit.Total {
+		return false
+	}
+	return l.limit.PerPrefix <= 0 || l.prefixes[prefix] < l.limit.PerPrefix
+}
+
+func (l *concurrencyLimiter) release(prefix string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.active--
+	if l.prefixes[prefix]--; l.prefixes[prefix] <= 0 {
+		delete(l.prefixes, prefix)
+	}
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// parseConcurrencyLimit parses a concurrency limit, declared as the total number of operations
+// (e.g. 100) or as an object with the total and per prefix limits: {"total": 100, "per_prefix": 2}
+func parseConcurrencyLimit(v interface{}) (ConcurrencyLimit, bool) {
+	if n, ok := v.(float64); ok {
+		if n < 0 {
+			return ConcurrencyLimit{}, false
+		}
+		return ConcurrencyLimit{Total: int(n)}, true
+	}
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return ConcurrencyLimit{}, false
+	}
+	limit := ConcurrencyLimit{}
+	for key, field := range map[string]*int{"total": &limit.Total, "per_prefix": &limit.PerPrefix} {
+		o, ok := cfg[key]
+		if !ok {
+			continue
+		}
+		n, ok := o.(float64)
+		if !ok || n < 0 {
+			return ConcurrencyLimit{}, false
+		}
+		*field = int(n)
+	}
+	return limit, true
+}
@@ -0,0 +1,102 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := newConcurrencyLimiter(ConcurrencyLimit{Total: 2, PerPrefix: 1}, MetricQueuedGets)
+	api, err := l.acquire(context.Background(), "/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second read of the prefix waits for the first one
+	acquired := make(chan func())
+	go func() {
+		release, _ := l.acquire(context.Background(), "/services/api")
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the per prefix limit has not been enforced")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if v := Metrics()[MetricQueuedGets]; v != 1 {
+		t.Errorf("unexpected queued gets: %d", v)
+	}
+
+	users, err := l.acquire(context.Background(), "/services/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx, "/services/orders"); err != context.DeadlineExceeded {
+		t.Errorf("the total limit has not been enforced: %v", err)
+	}
+
+	api()
+	api()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("the waiting read has not acquired the released slot")
+	}
+	users()
+	if v := Metrics()[MetricQueuedGets]; v != 0 {
+		t.Errorf("unexpected queued gets: %d", v)
+	}
+	if l.active != 0 || len(l.prefixes) != 0 {
+		t.Errorf("unexpected slots in use: %d %v", l.active, l.prefixes)
+	}
+}
+
+func TestConcurrencyLimiter_unlimited(t *testing.T) {
+	if l := newConcurrencyLimiter(ConcurrencyLimit{}, MetricQueuedGets); l != nil {
+		t.Error("the unlimited operations should not be limited")
+	}
+	var limits *clientLimits
+	release, err := limits.acquireWatch(context.Background(), "/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestParseConcurrencyLimit(t *testing.T) {
+	for i, tc := range []struct {
+		cfg      interface{}
+		expected ConcurrencyLimit
+		ok       bool
+	}{
+		{cfg: 100.0, expected: ConcurrencyLimit{Total: 100}, ok: true},
+		{cfg: map[string]interface{}{"total": 100.0, "per_prefix": 2.0}, expected: ConcurrencyLimit{Total: 100, PerPrefix: 2}, ok: true},
+		{cfg: map[string]interface{}{"per_prefix": 1.0}, expected: ConcurrencyLimit{PerPrefix: 1}, ok: true},
+		{cfg: -1.0},
+		{cfg: "100"},
+		{cfg: map[string]interface{}{"total": "100"}},
+	} {
+		limit, ok := parseConcurrencyLimit(tc.cfg)
+		if ok != tc.ok || limit != tc.expected {
+			t.Errorf("unexpected limit parsing the config %d: %+v %v", i, limit, ok)
+		}
+	}
+
+	options, err := parseOptionsMap(map[string]interface{}{
+		"max_watchers":        500.0,
+		"max_concurrent_gets": map[string]interface{}{"total": 50.0, "per_prefix": 1.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.MaxWatchers.Total != 500 || options.MaxConcurrentGets != (ConcurrencyLimit{Total: 50, PerPrefix: 1}) {
+		t.Errorf("unexpected options: %+v", options)
+	}
+	if _, err := parseOptionsMap(map[string]interface{}{"max_watchers": "all"}); err == nil || err.(*ConfigError).Path != "max_watchers" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
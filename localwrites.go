@@ -0,0 +1,154 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// localWrite is an entry written by the gateway, not confirmed by the reads of its subscribers yet
+type localWrite struct {
+	hosts    []Host
+	revision int64
+	deleted  bool
+}
+
+// localWrites tracks the entries written through a client (see Registrar), so the subscribers of the
+// same client reflect them right away instead of waiting for their watch, like the health checks
+// resolving the gateway through its own discovery. Every write is applied to the hosts read at a
+// previous revision and forgotten once a read at its revision, or a later one, confirms it.
+type localWrites struct {
+	mutex     *sync.Mutex
+	writes    map[string]localWrite
+	listeners map[chan struct{}]string
+}
+
+func newLocalWrites() *localWrites {
+	return &localWrites{
+		mutex:     &sync.Mutex{},
+		writes:    map[string]localWrite{},
+		listeners: map[chan struct{}]string{},
+	}
+}
+
+// localWritesOf returns the local writes of the client, or nil if it does not track them
+func localWritesOf(c Client) *localWrites {
+	if lc, ok := c.(interface{ localWrites() *localWrites }); ok {
+		return lc.localWrites()
+	}
+	return nil
+}
+
+// put records the hosts of an entry stored at the received revision
+func (w *localWrites) put(key string, hosts []Host, revision int64) {
+	if w == nil || revision <= 0 {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.writes[key] = localWrite{hosts: hosts, revision: revision}
+	w.notify(key)
+}
+
+// delete records the removal of an entry at the received revision. Only the entries written through
+// the client are tracked, since the hosts of the others are unknown.
+func (w *localWrites) delete(key string, revision int64) {
+	if w == nil || revision <= 0 {
+		return
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	previous, ok := w.writes[key]
+	if !ok {
+		return
+	}
+	w.writes[key] = localWrite{hosts: previous.hosts, revision: revision, deleted: true}
+	w.notify(key)
+}
+
+// notify signals the listeners of the prefixes holding the key. It must be called with the mutex held.
+func (w *localWrites) notify(key string) {
+	for ch, prefix := range w.listeners {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// listen returns a channel signaled every time an entry under the prefix is written, until the context
+// is done
+func (w *localWrites) listen(ctx context.Context, prefix string) <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	ch := make(chan struct{}, 1)
+	w.mutex.Lock()
+	w.listeners[ch] = prefix
+	w.mutex.Unlock()
+	go func() {
+		<-ctx.Done()
+		w.mutex.Lock()
+		delete(w.listeners, ch)
+		w.mutex.Unlock()
+	}()
+	return ch
+}
+
+// apply returns the hosts of the prefix read at the received revision with the writes not confirmed
+// yet: the hosts of the stored entries are added and the ones of the removed entries are discarded. The
+// writes confirmed by the read are forgotten. The reads without revision are returned as they are.
+func (w *localWrites) apply(prefix string, hosts []Host, revision int64) []Host {
+	if w == nil || revision <= 0 {
+		return hosts
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	added, removed := []Host{}, map[string]struct{}{}
+	for key, write := range w.writes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if write.revision <= revision {
+			delete(w.writes, key)
+			continue
+		}
+		for _, h := range write.hosts {
+			if write.deleted {
+				removed[h.URL] = struct{}{}
+				continue
+			}
+			added = append(added, h)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return hosts
+	}
+
+	result := make([]Host, 0, len(hosts)+len(added))
+	seen := make(map[string]struct{}, len(hosts)+len(added))
+	for _, h := range append(append([]Host{}, hosts...), added...) {
+		if _, ok := removed[h.URL]; ok {
+			continue
+		}
+		if _, ok := seen[h.URL]; ok {
+			continue
+		}
+		seen[h.URL] = struct{}{}
+		result = append(result, h)
+	}
+	return result
+}
+
+// localWrites returns the writes of the client not confirmed by the reads of its subscribers yet
+func (c *clientv3) localWrites() *localWrites {
+	return c.writes
+}
+
+// localWrites returns the writes of the client not confirmed by the reads of its subscribers yet
+func (c *client) localWrites() *localWrites {
+	return c.writes
+}
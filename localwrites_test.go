@@ -0,0 +1,114 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLocalWrites_apply(t *testing.T) {
+	w := newLocalWrites()
+	read := []Host{{URL: "http://10.0.0.1"}}
+
+	w.put("/services/api/2", []Host{{URL: "http://10.0.0.2"}}, 11)
+	w.put("/services/admin/1", []Host{{URL: "http://10.0.1.1"}}, 12)
+	if hosts := w.apply("/services/api/", read, 10); !reflect.DeepEqual(hostURLs(hosts), []string{"http://10.0.0.1", "http://10.0.0.2"}) {
+		t.Errorf("the pending write should be added: %v", hosts)
+	}
+	if hosts := w.apply("/services/api/", read, 0); !reflect.DeepEqual(hosts, read) {
+		t.Errorf("the reads without revision should not be changed: %v", hosts)
+	}
+
+	w.delete("/services/api/2", 13)
+	w.delete("/services/api/unknown", 13)
+	if hosts := w.apply("/services/api/", []Host{{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2"}}, 12); !reflect.DeepEqual(hosts, read) {
+		t.Errorf("the pending removal should be applied: %v", hosts)
+	}
+
+	// the read at the revision of the writes confirms them
+	confirmed := []Host{{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2"}}
+	if hosts := w.apply("/services/api/", confirmed, 13); !reflect.DeepEqual(hosts, confirmed) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+	if _, ok := w.writes["/services/api/2"]; ok {
+		t.Error("the confirmed write should be forgotten")
+	}
+	if _, ok := w.writes["/services/admin/1"]; !ok {
+		t.Error("the writes of other prefixes should be kept")
+	}
+
+	var nilWrites *localWrites
+	nilWrites.put("/services/api/2", nil, 1)
+	if hosts := nilWrites.apply("/services/api/", read, 10); !reflect.DeepEqual(hosts, read) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+type dummyLocalClient struct {
+	dummyRevisionClient
+	writes *localWrites
+}
+
+func (d dummyLocalClient) localWrites() *localWrites { return d.writes }
+
+func TestSubscriber_localWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := dummyLocalClient{
+		dummyRevisionClient: dummyRevisionClient{
+			dummyHostsClient: dummyHostsClient{
+				dummyClient: dummyClient{watchPrefix: func(string, chan struct{}) { <-ctx.Done() }},
+				getHosts:    func(string) ([]Host, error) { return []Host{{URL: "http://10.0.0.1"}}, nil },
+			},
+			revision: 10,
+		},
+		writes: newLocalWrites(),
+	}
+	s, err := NewSubscriberWithOptions(ctx, c, "/services/gateway/", BackendOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.writes.put("/services/gateway/self", []Host{{URL: "http://10.0.0.2"}}, 11)
+	expected := []string{"http://10.0.0.1", "http://10.0.0.2"}
+	for i := 0; i < 100; i++ {
+		if hosts, _ := s.Hosts(); reflect.DeepEqual(hosts, expected) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	hosts, _ := s.Hosts()
+	t.Errorf("the registration should be reflected without waiting for the watch: %v", hosts)
+}
+
+func TestLocalWrites_listen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := newLocalWrites()
+	ch := w.listen(ctx, "/services/api/")
+	w.put("/services/admin/1", nil, 1)
+	select {
+	case <-ch:
+		t.Error("the writes of other prefixes should not be signaled")
+	default:
+	}
+	w.put("/services/api/1", nil, 2)
+	select {
+	case <-ch:
+	default:
+		t.Error("the write should be signaled")
+	}
+
+	cancel()
+	for i := 0; i < 100; i++ {
+		w.mutex.Lock()
+		n := len(w.listeners)
+		w.mutex.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("the listener should be removed once the context is done")
+}
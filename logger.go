@@ -0,0 +1,46 @@
+package etcd
+
+import "sync"
+
+// Logger is the subset of the KrakenD logger used by the etcd integration, so a logging.Logger can be
+// passed to SetLogger
+type Logger interface {
+	Debug(v ...interface{})
+	Info(v ...interface{})
+	Warning(v ...interface{})
+	Error(v ...interface{})
+}
+
+var (
+	logger      Logger = noopLogger{}
+	loggerMutex        = &sync.RWMutex{}
+)
+
+// SetLogger sets the logger used by the etcd integration. Nothing is logged by default.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = noopLogger{}
+	}
+	loggerMutex.Lock()
+	logger = l
+	loggerMutex.Unlock()
+}
+
+// GetLogger returns the logger used by the etcd integration, so the packages extending it (like the
+// Kubernetes bridge) log through the same one
+func GetLogger() Logger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return logger
+}
+
+func getLogger() Logger {
+	return GetLogger()
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(_ ...interface{})   {}
+func (noopLogger) Info(_ ...interface{})    {}
+func (noopLogger) Warning(_ ...interface{}) {}
+func (noopLogger) Error(_ ...interface{})   {}
@@ -0,0 +1,129 @@
+package etcd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLogSamplingBurst is the default number of errors of the same prefix and class logged every
+	// sampling period
+	DefaultLogSamplingBurst = 5
+	// DefaultLogSamplingPeriod is the default period of the log sampling of the discovery errors
+	DefaultLogSamplingPeriod = time.Minute
+)
+
+// logSampler rate limits the logs of the discovery errors, so an etcd outage does not flood the logs
+// at request rate. Every period, the first errors of every prefix and error class (see ErrorCode) are
+// logged and the rest are counted, logging a summary once the period ends.
+type logSampler struct {
+	mutex   *sync.Mutex
+	burst   int
+	period  time.Duration
+	windows map[string]*logWindow
+}
+
+// logWindow counts the errors of a prefix and class in the current sampling period
+type logWindow struct {
+	start      time.Time
+	logged     int
+	suppressed int
+}
+
+var sampler = &logSampler{
+	mutex:   &sync.Mutex{},
+	burst:   DefaultLogSamplingBurst,
+	period:  DefaultLogSamplingPeriod,
+	windows: map[string]*logWindow{},
+}
+
+// SetLogSampling sets the number of errors of the same prefix and error class logged every period
+// (DefaultLogSamplingPeriod if zero). The rest are counted in the logs.suppressed metric and reported
+// with a summary at the end of the period. A burst lower than 1 logs all the errors. It can be changed
+// at runtime.
+func SetLogSampling(burst int, period time.Duration) {
+	if period <= 0 {
+		period = DefaultLogSamplingPeriod
+	}
+	sampler.mutex.Lock()
+	sampler.burst = burst
+	sampler.period = period
+	sampler.windows = map[string]*logWindow{}
+	sampler.mutex.Unlock()
+}
+
+// parseLogSampling parses the log_sampling config: {"burst": 5, "period": "1m"}
+func parseLogSampling(v interface{}) (int, time.Duration, error) {
+	path := Namespace + ".log_sampling"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return 0, 0, badConfig(path)
+	}
+	burst := DefaultLogSamplingBurst
+	if o, ok := cfg["burst"]; ok {
+		n, ok := o.(float64)
+		if !ok {
+			return 0, 0, badConfig(path + ".burst")
+		}
+		burst = int(n)
+	}
+	var period time.Duration
+	if o, ok := cfg["period"]; ok {
+		d, err := parseDuration(o)
+		if err != nil || d < 0 {
+			return 0, 0, badConfig(path + ".period")
+		}
+		period = d
+	}
+	return burst, period, nil
+}
+
+// logError logs the discovery error of the prefix with the received message, unless the errors of the
+// same prefix and class already reached the burst of the current sampling period
+func logError(prefix, msg string, err error) {
+	class := ErrorCode(err)
+	if !sampler.allow(prefix, class, GetClock().Now()) {
+		addMetric(MetricSuppressedLogs, 1)
+		return
+	}
+	getLogger().Warning(msg, prefix, "-", err.Error())
+}
+
+// allow returns true if the error must be logged, counting it otherwise. The first suppressed error of
+// a period schedules the summary of the period.
+func (l *logSampler) allow(prefix, class string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.burst < 1 {
+		return true
+	}
+	key := prefix + "|" + class
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.period {
+		w = &logWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.logged < l.burst {
+		w.logged++
+		return true
+	}
+	w.suppressed++
+	if w.suppressed == 1 {
+		go l.summarize(key, prefix, class, w, GetClock().After(w.start.Add(l.period).Sub(now)))
+	}
+	return false
+}
+
+// summarize logs the errors suppressed in the window once it ends
+func (l *logSampler) summarize(key, prefix, class string, w *logWindow, end <-chan time.Time) {
+	<-end
+	l.mutex.Lock()
+	suppressed, period := w.suppressed, l.period
+	if l.windows[key] == w {
+		delete(l.windows, key)
+	}
+	l.mutex.Unlock()
+	getLogger().Warning("etcd: suppressed similar errors of the prefix", prefix, "-",
+		fmt.Sprintf("%d %s errors in the last %s", suppressed, class, period))
+}
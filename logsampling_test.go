@@ -0,0 +1,96 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingLogger struct {
+	mutex    *sync.Mutex
+	warnings []string
+}
+
+func (l *recordingLogger) Debug(_ ...interface{}) {}
+func (l *recordingLogger) Info(_ ...interface{})  {}
+func (l *recordingLogger) Warning(v ...interface{}) {
+	l.mutex.Lock()
+	l.warnings = append(l.warnings, fmt.Sprintln(v...))
+	l.mutex.Unlock()
+}
+func (l *recordingLogger) Error(_ ...interface{}) {}
+
+func (l *recordingLogger) logged() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string{}, l.warnings...)
+}
+
+func TestLogError_sampling(t *testing.T) {
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	SetLogSampling(2, time.Minute)
+	defer SetLogSampling(DefaultLogSamplingBurst, 0)
+	l := &recordingLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	before := Metrics()[MetricSuppressedLogs]
+	unavailable := errors.New("connection refused")
+	for i := 0; i < 5; i++ {
+		logError("/services/a", "etcd: unable to refresh the prefix", unavailable)
+	}
+	logError("/services/b", "etcd: unable to refresh the prefix", unavailable)
+	logError("/services/a", "etcd: unable to refresh the prefix", context.DeadlineExceeded)
+
+	if warnings := l.logged(); len(warnings) != 4 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+	if v := Metrics()[MetricSuppressedLogs] - before; v != 3 {
+		t.Errorf("unexpected suppressed logs: %d", v)
+	}
+
+	clock.Advance(time.Minute)
+	for i := 0; i < 100 && len(l.logged()) < 5; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	warnings := l.logged()
+	if len(warnings) != 5 || !strings.Contains(warnings[4], "/services/a - 3 Unknown errors in the last 1m0s") {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+
+	logError("/services/a", "etcd: unable to refresh the prefix", unavailable)
+	if warnings := l.logged(); len(warnings) != 6 {
+		t.Errorf("the errors of a new period should be logged: %v", warnings)
+	}
+}
+
+func TestLogError_disabled(t *testing.T) {
+	SetLogSampling(0, 0)
+	defer SetLogSampling(DefaultLogSamplingBurst, 0)
+	l := &recordingLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	for i := 0; i < 10; i++ {
+		logError("/services/a", "etcd: unable to refresh the prefix", ErrWatchStopped)
+	}
+	if warnings := l.logged(); len(warnings) != 10 {
+		t.Errorf("unexpected warnings: %d", len(warnings))
+	}
+}
+
+func TestParseLogSampling(t *testing.T) {
+	burst, period, err := parseLogSampling(map[string]interface{}{"burst": 10.0, "period": "30s"})
+	if err != nil || burst != 10 || period != 30*time.Second {
+		t.Errorf("unexpected result: %d %s %v", burst, period, err)
+	}
+	if _, _, err := parseLogSampling(map[string]interface{}{"burst": "10"}); err == nil || err.(*ConfigError).Path != Namespace+".log_sampling.burst" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package etcd
+
+import "strings"
+
+// MaintenanceSuffix is appended to the key of an entry to put it in maintenance. The hosts of the
+// entries in maintenance are removed from rotation without deleting their registration. e.g. a
+// "/services/api/1/maintenance" key drains the host stored under "/services/api/1".
+//
+// Only the v3 clients support the maintenance keys, since the v2 keys holding a value can not have
+// children. The records of the json, yaml and protobuf formats can also declare a maintenance flag.
+const MaintenanceSuffix = "/maintenance"
+
+// SetMaintenance removes the host stored under the received key from rotation, without deleting it
+func SetMaintenance(r Registrar, key string) error {
+	return r.Register(strings.TrimRight(key, "/")+MaintenanceSuffix, "true", 0)
+}
+
+// ClearMaintenance puts back in rotation the host stored under the received key
+func ClearMaintenance(r Registrar, key string) error {
+	return r.Deregister(strings.TrimRight(key, "/") + MaintenanceSuffix)
+}
+
+// maintenanceKeys returns the keys of the entries put in maintenance by the received maintenance keys.
+// Maintenance keys with the value "false" are ignored.
+func maintenanceKeys(kvs map[string]string) map[string]struct{} {
+	result := map[string]struct{}{}
+	for k, v := range kvs {
+		if entry, ok := maintenanceEntry(k); ok && v != "false" {
+			result[entry] = struct{}{}
+		}
+	}
+	return result
+}
+
+// maintenanceEntry returns the key of the entry affected by the received key, if it is a maintenance key
+func maintenanceEntry(key string) (string, bool) {
+	if !strings.HasSuffix(key, MaintenanceSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(key, MaintenanceSuffix), true
+}
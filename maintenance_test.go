@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type dummyRegistrar map[string]string
+
+func (r dummyRegistrar) Register(key, value string, _ time.Duration) error {
+	r[key] = value
+	return nil
+}
+
+func (r dummyRegistrar) Deregister(key string) error {
+	delete(r, key)
+	return nil
+}
+
+func TestSetMaintenance(t *testing.T) {
+	r := dummyRegistrar{}
+	if err := SetMaintenance(r, "/services/api/1/"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r, dummyRegistrar{"/services/api/1/maintenance": "true"}) {
+		t.Errorf("unexpected entries: %v", r)
+	}
+	if err := ClearMaintenance(r, "/services/api/1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 0 {
+		t.Errorf("unexpected entries: %v", r)
+	}
+}
+
+func TestMaintenanceKeys(t *testing.T) {
+	keys := maintenanceKeys(map[string]string{
+		"/services/api/1/maintenance": "true",
+		"/services/api/2/maintenance": "false",
+		"/services/api/3/maintenance": "",
+	})
+	expected := map[string]struct{}{"/services/api/1": {}, "/services/api/3": {}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+}
+
+func TestDecodeEntry_maintenance(t *testing.T) {
+	options := ClientOptions{EntryFormat: EntryFormatJSON}
+	urls, ok := decodeEntryURLs(options, "/services/api/1", `{"host": "10.0.0.1", "port": 8080, "maintenance": true}`)
+	if !ok || len(urls) != 0 {
+		t.Errorf("unexpected result: %v, %v", urls, ok)
+	}
+	urls, ok = decodeEntryURLs(options, "/services/api/1", `{"host": "10.0.0.1", "port": 8080, "maintenance": false}`)
+	if !ok || !reflect.DeepEqual(urls, []string{"10.0.0.1:8080"}) {
+		t.Errorf("unexpected result: %v, %v", urls, ok)
+	}
+}
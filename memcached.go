@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemcachedCache is a Cache storing the values in a memcached server. It speaks the text protocol
+// directly, without depending on a memcached client, over a single connection reestablished after an
+// error.
+type MemcachedCache struct {
+	// Address of the server, e.g. "127.0.0.1:11211"
+	Address string
+	Timeout time.Duration
+
+	mutex  *sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewMemcachedCache returns a MemcachedCache using the server at the address. The timeout is
+// DefaultCacheTimeout if it is not positive.
+func NewMemcachedCache(address string, timeout time.Duration) *MemcachedCache {
+	if timeout <= 0 {
+		timeout = DefaultCacheTimeout
+	}
+	return &MemcachedCache{Address: address, Timeout: timeout, mutex: &sync.Mutex{}}
+}
+
+// Get implements the Cache interface
+func (c *MemcachedCache) Get(key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.send("get " + key + "\r\n"); err != nil {
+		return nil, err
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "END" {
+		return nil, ErrCacheMiss
+	}
+	// VALUE <key> <flags> <bytes>
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "VALUE" {
+		c.close()
+		return nil, memcachedReplyError(line)
+	}
+	size, err := strconv.Atoi(fields[3])
+	if err != nil {
+		c.close()
+		return nil, memcachedReplyError(line)
+	}
+	value := make([]byte, size+2)
+	if _, err := io.ReadFull(c.reader, value); err != nil {
+		c.close()
+		return nil, err
+	}
+	if line, err := c.readLine(); err != nil || line != "END" {
+		c.close()
+		return nil, memcachedReplyError(line)
+	}
+	return value[:size], nil
+}
+
+// Set implements the Cache interface. The ttl is rounded up to seconds.
+func (c *MemcachedCache) Set(key string, value []byte, ttl time.Duration) error {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.send(fmt.Sprintf("set %s 0 %d %d\r\n%s\r\n", key, seconds, len(value), value)); err != nil {
+		return err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if line != "STORED" {
+		c.close()
+		return memcachedReplyError(line)
+	}
+	return nil
+}
+
+// send writes the request, connecting if required
+func (c *MemcachedCache) send(msg string) error {
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+		c.reader = bufio.NewReader(conn)
+	}
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	if _, err := c.conn.Write([]byte(msg)); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+func (c *MemcachedCache) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		c.close()
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *MemcachedCache) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.reader = nil
+}
+
+func memcachedReplyError(line string) error {
+	return fmt.Errorf("memcached: unexpected reply %q", line)
+}
+
+func newMemcachedCache(cfg map[string]interface{}) (Cache, error) {
+	address, err := stringOption(cfg, "address")
+	if err != nil {
+		return nil, err
+	}
+	return NewMemcachedCache(address, timeoutOption(cfg)), nil
+}
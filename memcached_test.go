@@ -0,0 +1,78 @@
+package etcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMemcachedServer serves get and set from a map, sending the requested expiration times
+func fakeMemcachedServer(t *testing.T, expirations chan<- string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		data := map[string]string{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 2 && fields[0] == "get":
+				if v, ok := data[fields[1]]; ok {
+					fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+				}
+				fmt.Fprint(conn, "END\r\n")
+			case len(fields) == 5 && fields[0] == "set":
+				size, _ := strconv.Atoi(fields[4])
+				buf := make([]byte, size+2)
+				if _, err := io.ReadFull(r, buf); err != nil {
+					return
+				}
+				data[fields[1]] = string(buf[:size])
+				expirations <- fields[3]
+				fmt.Fprint(conn, "STORED\r\n")
+			default:
+				fmt.Fprint(conn, "ERROR\r\n")
+			}
+		}
+	}()
+	return l
+}
+
+func TestMemcachedCache(t *testing.T) {
+	expirations := make(chan string, 1)
+	l := fakeMemcachedServer(t, expirations)
+	defer l.Close()
+
+	c := NewMemcachedCache(l.Addr().String(), 0)
+	if _, err := c.Get("krakend-etcd:a"); err != ErrCacheMiss {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := c.Set("krakend-etcd:a", []byte("{\"hosts\":[]}\r\nEND"), 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("krakend-etcd:a"); err != nil || string(v) != "{\"hosts\":[]}\r\nEND" {
+		t.Errorf("unexpected value: %q %v", v, err)
+	}
+	if v := <-expirations; v != "2" {
+		t.Errorf("unexpected expiration: %s", v)
+	}
+	if err := c.Set("bad key", []byte("value"), time.Minute); err == nil {
+		t.Error("error expected")
+	}
+}
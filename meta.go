@@ -0,0 +1,122 @@
+package etcd
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devopsfaith/krakend/sd"
+)
+
+// ErrWatchStopped is reported by the subscribers whose watch stopped before their context was canceled
+var ErrWatchStopped = errors.New("the etcd watch stopped")
+
+const (
+	// HeaderStale is the header added by the proxies when the discovery of the backend is degraded
+	HeaderStale = "X-Etcd-Discovery-Stale"
+	// HeaderAge is the header with the seconds since the last successful read of the hosts
+	HeaderAge = "X-Etcd-Discovery-Age"
+	// HeaderRevision is the header with the revision the hosts were read at
+	HeaderRevision = "X-Etcd-Discovery-Revision"
+	// HeaderCluster is the header with the id of the cluster the hosts were read from
+	HeaderCluster = "X-Etcd-Discovery-Cluster"
+)
+
+// Meta describes the freshness of the hosts returned by a MetaSubscriber
+type Meta struct {
+	// LastRefresh is the time of the last successful read of the hosts
+	LastRefresh time.Time
+	// Revision is the revision of the cluster the hosts were read at. It is zero if the client does
+	// not report it. See RevisionClient.
+	Revision int64
+	// ClusterID and MemberID identify the cluster member the hosts were read from. They are zero if
+	// the client does not report them. See HeaderClient.
+	ClusterID uint64
+	MemberID  uint64
+	// Stale is true if the last read failed or the watch stopped, so the hosts may be outdated
+	Stale bool
+}
+
+// Headers returns the headers describing a degraded discovery, or nil if the hosts are fresh
+func (m Meta) Headers(now time.Time) http.Header {
+	if !m.Stale {
+		return nil
+	}
+	h := http.Header{}
+	h.Set(HeaderStale, "true")
+	if !m.LastRefresh.IsZero() {
+		h.Set(HeaderAge, strconv.Itoa(int(now.Sub(m.LastRefresh)/time.Second)))
+	}
+	if m.Revision != 0 {
+		h.Set(HeaderRevision, strconv.FormatInt(m.Revision, 10))
+	}
+	if m.ClusterID != 0 {
+		h.Set(HeaderCluster, formatID(m.ClusterID))
+	}
+	return h
+}
+
+// MetaSubscriber is a subscriber also reporting the freshness of its hosts
+type MetaSubscriber interface {
+	sd.Subscriber
+	// HostsWithMeta returns the hosts, with the metadata of their records, and the freshness of the
+	// list. The error of the last failed read is returned along with the cached hosts.
+	HostsWithMeta() ([]Host, Meta, error)
+}
+
+// HostsWithMeta implements the MetaSubscriber interface
+func (s *Subscriber) HostsWithMeta() ([]Host, Meta, error) {
+	s.awaitRead()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	hosts := make([]Host, len(*s.cache))
+	for i, url := range *s.cache {
+		hosts[i] = s.index[url]
+		hosts[i].URL = url
+	}
+	return hosts, s.meta, s.err
+}
+
+// refreshed records a successful read of the hosts, storing them in the shared cache. The change of
+// the cluster the prefix is read from, like a gateway pointed to the wrong cluster, is logged.
+func (s *Subscriber) refreshed(header ResponseHeader) {
+	s.mutex.Lock()
+	previous := s.meta.ClusterID
+	s.meta = Meta{
+		LastRefresh: GetClock().Now(),
+		Revision:    header.Revision,
+		ClusterID:   header.ClusterID,
+		MemberID:    header.MemberID,
+	}
+	s.err = nil
+	s.mutex.Unlock()
+	if previous != 0 && header.ClusterID != 0 && previous != header.ClusterID {
+		getLogger().Warning("etcd: the cluster of the prefix changed", s.prefix, "-", formatID(previous), "to", formatID(header.ClusterID))
+	}
+	s.share()
+}
+
+// failed records a failed read of the hosts or the end of the watch, logging it through the log sampling
+func (s *Subscriber) failed(err error) {
+	logError(s.prefix, "etcd: unable to refresh the prefix", err)
+	s.mutex.Lock()
+	s.meta.Stale = true
+	s.err = err
+	s.mutex.Unlock()
+}
+
+// fallbackMetaSubscriber wraps the fallback subscribers, reporting their hosts as stale
+type fallbackMetaSubscriber struct {
+	sd.Subscriber
+}
+
+// HostsWithMeta implements the MetaSubscriber interface
+func (f fallbackMetaSubscriber) HostsWithMeta() ([]Host, Meta, error) {
+	urls, err := f.Hosts()
+	hosts := make([]Host, len(urls))
+	for i, url := range urls {
+		hosts[i] = Host{URL: url}
+	}
+	return hosts, Meta{Stale: true}, err
+}
@@ -0,0 +1,99 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+type dummyRevisionClient struct {
+	dummyHostsClient
+	revision int64
+}
+
+func (d dummyRevisionClient) GetHostsWithRevision(prefix string) ([]Host, int64, error) {
+	hosts, err := d.getHosts(prefix)
+	return hosts, d.revision, err
+}
+
+func TestSubscriber_HostsWithMeta(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mutex := &sync.Mutex{}
+	var readErr error
+	notify := make(chan struct{})
+	c := dummyRevisionClient{
+		dummyHostsClient: dummyHostsClient{
+			dummyClient: dummyClient{
+				watchPrefix: func(_ string, ch chan struct{}) {
+					for range notify {
+						ch <- struct{}{}
+					}
+				},
+			},
+			getHosts: func(string) ([]Host, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return []Host{{URL: "10.0.0.1", Metadata: map[string]interface{}{"zone": "eu"}}}, readErr
+			},
+		},
+		revision: 42,
+	}
+
+	s, err := NewSubscriberWithOptions(ctx, c, "/services/api", BackendOptions{DefaultScheme: "http"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, meta, err := s.HostsWithMeta()
+	if err != nil || meta.Stale || meta.Revision != 42 || meta.LastRefresh.IsZero() {
+		t.Errorf("unexpected meta: %+v, %v", meta, err)
+	}
+	if len(hosts) != 1 || hosts[0].URL != "http://10.0.0.1" || hosts[0].Metadata["zone"] != "eu" {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+	if h := meta.Headers(time.Now()); h != nil {
+		t.Errorf("unexpected headers: %v", h)
+	}
+
+	mutex.Lock()
+	readErr = errors.New("unavailable")
+	mutex.Unlock()
+	notify <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+
+	hosts, meta, err = s.HostsWithMeta()
+	if err == nil || !meta.Stale || len(hosts) != 1 {
+		t.Errorf("unexpected result: %+v, %+v, %v", hosts, meta, err)
+	}
+	h := meta.Headers(meta.LastRefresh.Add(3 * time.Second))
+	if h.Get(HeaderStale) != "true" || h.Get(HeaderAge) != "3" || h.Get(HeaderRevision) != "42" {
+		t.Errorf("unexpected headers: %v", h)
+	}
+
+	mutex.Lock()
+	readErr = nil
+	mutex.Unlock()
+	notify <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	if _, meta, _ := s.HostsWithMeta(); meta.Stale {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+	// the end of the watch makes the hosts stale too
+	close(notify)
+	time.Sleep(50 * time.Millisecond)
+	if _, meta, err := s.HostsWithMeta(); !meta.Stale || err != ErrWatchStopped {
+		t.Errorf("unexpected meta: %+v, %v", meta, err)
+	}
+}
+
+func TestMetaSubscriberFactory_fallback(t *testing.T) {
+	s := MetaSubscriberFactory(context.Background(), dummyClient{})(&config.Backend{})
+	if _, meta, _ := s.HostsWithMeta(); !meta.Stale {
+		t.Error("the fallback subscribers should be reported as stale")
+	}
+}
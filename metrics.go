@@ -0,0 +1,182 @@
+package etcd
+
+import (
+	"expvar"
+	"sync"
+)
+
+// MetricsNamespace is the name of the expvar map holding the metrics of the etcd integration
+const MetricsNamespace = "krakend_etcd"
+
+const (
+	// MetricWatchRanges is the gauge with the number of watch ranges opened against the cluster
+	MetricWatchRanges = "watch.ranges"
+	// MetricMuxPrefixes is the gauge with the number of prefixes served by the multiplexed watch
+	MetricMuxPrefixes = "watch.mux.prefixes"
+	// MetricIgnoredTouches is the counter of the watch events discarded because they rewrote a key with
+	// its value. See ClientOptions.IgnoreTouches.
+	MetricIgnoredTouches = "watch.ignored_touches"
+	// MetricChangedRefreshes is the counter of the reads of the subscribers changing their hosts. It is
+	// also published for every prefix. e.g. "refreshes.changed./services/api"
+	MetricChangedRefreshes = "refreshes.changed"
+	// MetricUnchangedRefreshes is the counter of the reads of the subscribers returning the hosts they
+	// already had. It is also published for every prefix. e.g. "refreshes.unchanged./services/api"
+	MetricUnchangedRefreshes = "refreshes.unchanged"
+	// MetricRejectedEntries is the counter of the JSON entries rejected because they are malformed or
+	// do not validate against the entry schema
+	MetricRejectedEntries = "entries.rejected"
+	// MetricExpiringEntries is the counter of the entries discarded because their lease is about to expire
+	MetricExpiringEntries = "entries.expiring"
+	// MetricClusterSwitches is the counter of changes of the preferred cluster of a MultiClusterClient
+	MetricClusterSwitches = "clusters.switches"
+	// MetricChurn is the counter of the hosts added to or removed from the watched prefixes
+	MetricChurn = "churn"
+	// MetricChurnRate is the prefix of the gauges with the hosts added or removed during the last minute
+	// on each watched prefix. e.g. "churn.rate./services/api"
+	MetricChurnRate = "churn.rate"
+	// MetricHosts is the prefix of the gauges with the hosts of each watched prefix.
+	// e.g. "hosts.count./services/api"
+	MetricHosts = "hosts.count"
+	// MetricMissingHosts is the prefix of the gauges with the hosts missing to reach the min_hosts of the
+	// backends declaring it. e.g. "hosts.missing./services/api"
+	MetricMissingHosts = "hosts.missing"
+	// MetricDBSize is the prefix of the gauges with the db size of every endpoint inspected, in bytes.
+	// e.g. "db.size.http://10.0.0.1:2379"
+	MetricDBSize = "db.size"
+	// MetricAlarms is the gauge with the number of alarms raised in the clusters inspected
+	MetricAlarms = "alarms"
+	// MetricSkippedRegistrations is the counter of the registrations skipped because the cluster was out of space
+	MetricSkippedRegistrations = "registrations.skipped"
+	// MetricPublishFailures is the counter of the discovery events the publishers failed to deliver
+	MetricPublishFailures = "publish.failures"
+	// MetricPublishDropped is the counter of the discovery events dropped because a publisher did not keep up
+	MetricPublishDropped = "publish.dropped"
+	// MetricErrors is the prefix of the counters of the errors returned by etcd, by their code. e.g.
+	// "errors.Unavailable" or "errors.PermissionDenied". See ErrorCode.
+	MetricErrors = "errors"
+	// MetricShedding is the gauge set to 1 while the subscribers are in the load shedding mode
+	MetricShedding = "shedding"
+	// MetricShedReads is the counter of the reads deferred by the load shedding mode
+	MetricShedReads = "reads.shed"
+	// MetricCacheHits is the counter of the subscribers started with the hosts of the shared cache
+	MetricCacheHits = "cache.hits"
+	// MetricCacheMisses is the counter of the subscribers not found in the shared cache
+	MetricCacheMisses = "cache.misses"
+	// MetricCacheErrors is the counter of the failed requests to the shared cache
+	MetricCacheErrors = "cache.errors"
+	// MetricDecryptionFailures is the counter of the encrypted entries discarded because they could not be decrypted
+	MetricDecryptionFailures = "entries.decryption_failures"
+	// MetricSerializableFallback is the gauge set to 1 while the clients read serializable because the
+	// linearizable reads failed. See ConsistencyFallback.
+	MetricSerializableFallback = "reads.serializable_fallback"
+	// MetricReadThrough is the counter of the first reads triggered by the requests to the subscribers without hosts
+	MetricReadThrough = "reads.through"
+	// MetricQueuedRefreshes is the gauge of the subscriber reads waiting for a slot. See SetRefreshConcurrency.
+	MetricQueuedRefreshes = "reads.queued"
+	// MetricTenantPrefixes is the prefix of the gauges with the prefixes watched by each tenant.
+	// e.g. "tenants.prefixes.team-a"
+	MetricTenantPrefixes = "tenants.prefixes"
+	// MetricTenantWatches is the prefix of the gauges with the subscribers of each tenant.
+	// e.g. "tenants.watches.team-a"
+	MetricTenantWatches = "tenants.watches"
+	// MetricTenantRejections is the counter of the subscribers not created because their tenant exceeded
+	// its quota
+	MetricTenantRejections = "tenants.rejected"
+	// MetricTenantThrottled is the counter of the reads deferred because their tenant exceeded its
+	// refresh rate
+	MetricTenantThrottled = "tenants.throttled"
+	// MetricWatchReconnects is the counter of the watches restarted after stopping. See SetBackoff.
+	MetricWatchReconnects = "watch.reconnects"
+	// MetricReadRetries is the counter of the failed reads of the subscribers scheduled for a retry.
+	// See SetBackoff.
+	MetricReadRetries = "reads.retries"
+	// MetricQueuedWatches is the gauge of the watches waiting for a slot. See ClientOptions.MaxWatchers.
+	MetricQueuedWatches = "watch.queued"
+	// MetricQueuedGets is the gauge of the reads waiting for a slot. See ClientOptions.MaxConcurrentGets.
+	MetricQueuedGets = "gets.queued"
+	// MetricSuppressedLogs is the counter of the discovery errors not logged by the log sampling. See
+	// SetLogSampling.
+	MetricSuppressedLogs = "logs.suppressed"
+	// MetricPanics is the counter of the panics recovered in the watches and the reads of the subscribers
+	MetricPanics = "panics"
+	// MetricRejectedPrefixes is the counter of the reads and watches rejected because their prefix is
+	// outside the allowlist. See ClientOptions.PrefixAllowlist.
+	MetricRejectedPrefixes = "prefixes.rejected"
+	// MetricOutOfRangeHosts is the counter of the hosts discarded because they are outside the networks
+	// allowed by their backend. See BackendOptions.AllowedCIDRs and DeniedCIDRs.
+	MetricOutOfRangeHosts = "hosts.out_of_range"
+	// MetricStaggeredReads is the counter of the reads of the restarted watches delayed after a mass
+	// reconnection. See SetWarmRestart.
+	MetricStaggeredReads = "reads.staggered"
+	// MetricUnexpectedCluster is the gauge set to 1 when a client is connected to a cluster other than
+	// the one declared with expected_cluster_id
+	MetricUnexpectedCluster = "cluster.unexpected"
+	// MetricPausedPrefixes is the gauge of the prefixes paused with Pause (or PauseAll)
+	MetricPausedPrefixes = "prefixes.paused"
+	// MetricPausedReads is the counter of the reads deferred to the end of a pause
+	MetricPausedReads = "reads.paused"
+	// MetricPayloadBytes is the counter of the bytes of the keys and values received by the reads of the
+	// prefixes. It is also published for every prefix as the gauge of its last read.
+	// e.g. "payload.bytes./services/api"
+	MetricPayloadBytes = "payload.bytes"
+	// MetricPayloadLargest is the prefix of the gauges with the size of the largest entry of the last read
+	// of each prefix, in bytes. e.g. "payload.largest./services/api"
+	MetricPayloadLargest = "payload.largest"
+	// MetricPayloadOverhead is the prefix of the gauges with the bytes of the last read of each prefix on
+	// top of the urls of its hosts (keys, metadata and encoding). e.g. "payload.overhead./services/api"
+	MetricPayloadOverhead = "payload.overhead"
+	// MetricLimitedEntries is the counter of the entries discarded because they exceed the
+	// ClientOptions.MaxValueBytes or MaxEntriesPerPrefix
+	MetricLimitedEntries = "entries.limited"
+	// MetricLimitedReads is the counter of the reads rejected because their prefix exceeds the
+	// ClientOptions.MaxValueBytes or MaxEntriesPerPrefix. See LimitPolicyReject.
+	MetricLimitedReads = "reads.limited"
+	// MetricLeader is the prefix of the gauges set to 1 while the LeaderRegistration of an election key
+	// holds its leadership. e.g. "leader./gateways/api/leader"
+	MetricLeader = "leader"
+	// MetricAssignedShards is the prefix of the gauges with the shards assigned to the ShardCoordinator of
+	// each prefix. e.g. "shards.assigned./gateways/shards/"
+	MetricAssignedShards = "shards.assigned"
+	// MetricShardRebalances is the counter of the shard assignments replaced by the ShardCoordinators
+	MetricShardRebalances = "shards.rebalances"
+	// MetricConfigReloads is the prefix of the counters of the reloads of the ConfigReloaders, by their
+	// outcome. e.g. "config.reloads.applied" or "config.reloads.rolled_back"
+	MetricConfigReloads = "config.reloads"
+	// MetricNegativeHits is the counter of the subscriber requests answered from the negative cache
+	MetricNegativeHits = "subscribers.negative_hits"
+)
+
+var (
+	metrics      = expvar.NewMap(MetricsNamespace)
+	metricsMutex = &sync.Mutex{}
+)
+
+// Metrics returns a snapshot of the metrics of the etcd integration. They are also published
+// through the expvar package, under the MetricsNamespace key.
+func Metrics() map[string]int64 {
+	snapshot := map[string]int64{}
+	metrics.Do(func(kv expvar.KeyValue) {
+		if v, ok := kv.Value.(*expvar.Int); ok {
+			snapshot[kv.Key] = v.Value()
+		}
+	})
+	return snapshot
+}
+
+// addMetric adds the delta to the counter or gauge with the given name
+func addMetric(name string, delta int64) {
+	metrics.Add(name, delta)
+}
+
+// setMetric sets the value of the gauge with the given name
+func setMetric(name string, value int64) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		v.Set(value)
+		return
+	}
+	v := new(expvar.Int)
+	v.Set(value)
+	metrics.Set(name, v)
+}
@@ -0,0 +1,238 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotMigratable is the error reported for the entries that can not be transformed into the
+	// format of the migration, like the ones describing several hosts
+	ErrNotMigratable = fmt.Errorf("the entry can not be migrated")
+	// ErrMigrationMismatch is the error reported for the entries whose value read after the migration
+	// does not match the written one
+	ErrMigrationMismatch = fmt.Errorf("the migrated entry does not match the written value")
+	// ErrNotVerifiable is the error returned when the destination of a migration can not list its entries
+	ErrNotVerifiable = fmt.Errorf("the etcd client does not list the entries of the prefixes")
+)
+
+// KeyValueClient is implemented by the clients able to list the raw entries stored under a prefix
+type KeyValueClient interface {
+	// GetKeyValues returns the values stored under the prefix, by key. The v2 directories are walked
+	// recursively.
+	GetKeyValues(prefix string) (map[string]string, error)
+}
+
+// Migration describes the copy of the entries of a prefix into another one, transforming them from a
+// layout into another, so a registry can be upgraded while the gateways keep reading the old one.
+type Migration struct {
+	// From is the prefix to copy
+	From string
+	// To is the prefix receiving the entries. The keys keep their path relative to From.
+	To string
+	// Flatten joins the segments of the relative paths with dashes, so the v2 trees become flat lists
+	// of keys (e.g. "/services/api/eu/1" is copied as "/services/api-v3/eu-1")
+	Flatten bool
+	// Source are the options decoding the entries of From (EntryFormat, HostSource, ValueEncoding...)
+	Source ClientOptions
+	// Format is the entry format of the written values: EntryFormatRaw or EntryFormatJSON. The values are
+	// copied as they are if it is empty.
+	Format string
+	// TTL is the ttl of the written entries. Zero writes them without a ttl.
+	TTL time.Duration
+	// DryRun reports the entries to write without writing them
+	DryRun bool
+	// Verify reads the entries of To after writing them, reporting the ones not matching the written value
+	Verify bool
+}
+
+// MigrationEntry is the migration of an entry
+type MigrationEntry struct {
+	From  string
+	To    string
+	Value string
+	Err   error
+}
+
+// MigrationReport contains the migrated entries
+type MigrationReport []MigrationEntry
+
+// Failed returns the entries that could not be migrated
+func (r MigrationReport) Failed() MigrationReport {
+	failed := MigrationReport{}
+	for _, e := range r {
+		if e.Err != nil {
+			failed = append(failed, e)
+		}
+	}
+	return failed
+}
+
+// Err returns an error describing all the entries that could not be migrated, or nil if there are none
+func (r MigrationReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(failed))
+	for i, e := range failed {
+		msgs[i] = fmt.Sprintf("%s: %s", e.From, e.Err.Error())
+	}
+	return fmt.Errorf("unable to migrate the etcd entries: %s", strings.Join(msgs, ", "))
+}
+
+// Migrate copies the entries of the From prefix of the source into the To prefix of the destination,
+// transforming them as declared by the migration. The entries that can not be transformed or written
+// are reported and skipped, so the migration can be repeated once they are fixed.
+func Migrate(src KeyValueClient, dst Registrar, m Migration) (MigrationReport, error) {
+	switch m.Format {
+	case "", EntryFormatRaw, EntryFormatJSON:
+	default:
+		return nil, fmt.Errorf("unable to migrate the etcd entries to the %s format", m.Format)
+	}
+	kvs, err := src.GetKeyValues(m.From)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	report := MigrationReport{}
+	for _, k := range keys {
+		report = append(report, m.migrate(k, kvs[k])...)
+	}
+	if m.DryRun {
+		return report, nil
+	}
+	for i, e := range report {
+		if e.Err == nil {
+			report[i].Err = dst.Register(e.To, e.Value, m.TTL)
+		}
+	}
+	if !m.Verify {
+		return report, nil
+	}
+
+	kv, ok := dst.(KeyValueClient)
+	if !ok {
+		return report, ErrNotVerifiable
+	}
+	written, err := kv.GetKeyValues(m.To)
+	if err != nil {
+		return report, err
+	}
+	for i, e := range report {
+		if v, ok := written[e.To]; e.Err == nil && (!ok || v != e.Value) {
+			report[i].Err = ErrMigrationMismatch
+		}
+	}
+	return report, nil
+}
+
+// migrate returns the entries to write for the received source entry
+func (m Migration) migrate(key, value string) []MigrationEntry {
+	if entry, ok := maintenanceEntry(key); ok {
+		return []MigrationEntry{{From: key, To: m.target(entry) + MaintenanceSuffix, Value: value}}
+	}
+	to := m.target(key)
+	if m.Format == "" {
+		return []MigrationEntry{{From: key, To: to, Value: value}}
+	}
+	hosts, ok := decodeHosts(m.Source, key, value)
+	if !ok || len(hosts) != 1 {
+		return []MigrationEntry{{From: key, To: to, Err: ErrNotMigratable}}
+	}
+	h := hosts[0]
+	if m.Format == EntryFormatRaw {
+		entries := []MigrationEntry{{From: key, To: to, Value: h.URL}}
+		if h.Maintenance {
+			// the raw values can not describe the maintenance, so it is declared with a maintenance key
+			entries = append(entries, MigrationEntry{From: key, To: to + MaintenanceSuffix, Value: "true"})
+		}
+		return entries
+	}
+	b, err := encodeRecord(h)
+	if err != nil {
+		return []MigrationEntry{{From: key, To: to, Err: err}}
+	}
+	return []MigrationEntry{{From: key, To: to, Value: string(b)}}
+}
+
+// target returns the key receiving the source key
+func (m Migration) target(key string) string {
+	rel := strings.Trim(strings.TrimPrefix(key, m.From), "/")
+	if m.Flatten {
+		rel = strings.Replace(rel, "/", "-", -1)
+	}
+	return strings.TrimRight(m.To, "/") + "/" + rel
+}
+
+// encodeRecord returns the json record describing the host
+func encodeRecord(h Host) ([]byte, error) {
+	scheme, authority := "", h.URL
+	if i := strings.Index(h.URL, "://"); i >= 0 {
+		scheme, authority = h.URL[:i], h.URL[i+3:]
+	}
+	host, port := splitAuthority(authority)
+	if _, err := strconv.Atoi(port); port != "" && err != nil {
+		return nil, ErrNotMigratable
+	}
+	r := struct {
+		Host        string                 `json:"host"`
+		Port        json.Number            `json:"port,omitempty"`
+		Scheme      string                 `json:"scheme,omitempty"`
+		Metadata    map[string]interface{} `json:"metadata,omitempty"`
+		Maintenance bool                   `json:"maintenance,omitempty"`
+		Priority    int                    `json:"priority,omitempty"`
+		TLS         *HostTLS               `json:"tls,omitempty"`
+	}{
+		Host:        host,
+		Port:        json.Number(port),
+		Scheme:      scheme,
+		Metadata:    h.Metadata,
+		Maintenance: h.Maintenance,
+		Priority:    h.Priority,
+		TLS:         h.TLS,
+	}
+	return json.Marshal(r)
+}
+
+// GetKeyValues implements the etcd KeyValueClient interface.
+func (c *client) GetKeyValues(prefix string) (map[string]string, error) {
+	resp, err := c.get(prefix, true)
+	if err != nil {
+		return nil, countError(err)
+	}
+	if !resp.Node.Dir {
+		return map[string]string{resp.Node.Key: resp.Node.Value}, nil
+	}
+	nodes := leafNodes(resp.Node)
+	kvs := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		kvs[n.Key] = n.Value
+	}
+	return kvs, nil
+}
+
+// GetKeyValues implements the etcd KeyValueClient interface.
+func (c *clientv3) GetKeyValues(prefix string) (map[string]string, error) {
+	if c.client == nil {
+		return nil, ErrNilClient
+	}
+	resp, err := c.get(prefix, 0, false)
+	if err != nil {
+		return nil, countError(err)
+	}
+	kvs := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = string(kv.Value)
+	}
+	return kvs, nil
+}
@@ -0,0 +1,122 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+)
+
+// memoryRegistry is a KeyValueClient and Registrar storing the entries in a map
+type memoryRegistry map[string]string
+
+func (r memoryRegistry) GetKeyValues(prefix string) (map[string]string, error) {
+	kvs := map[string]string{}
+	for k, v := range r {
+		if strings.HasPrefix(k, prefix) {
+			kvs[k] = v
+		}
+	}
+	return kvs, nil
+}
+
+func (r memoryRegistry) Register(key, value string, _ time.Duration) error {
+	if strings.Contains(key, "readonly") {
+		return nil
+	}
+	r[key] = value
+	return nil
+}
+
+func (r memoryRegistry) Deregister(key string) error {
+	delete(r, key)
+	return nil
+}
+
+func TestMigrate(t *testing.T) {
+	src := memoryRegistry{
+		"/services/api/eu/1":             "http://10.0.0.1:8080",
+		"/services/api/eu/2":             `{"host": "10.0.0.2", "port": 8080, "scheme": "https", "metadata": {"zone": "eu"}, "maintenance": true}`,
+		"/services/api/eu/2/maintenance": "true",
+	}
+	m := Migration{
+		From:    "/services/api/",
+		To:      "/services/api-v3",
+		Flatten: true,
+		Source:  ClientOptions{EntryFormat: EntryFormatJSON},
+		Format:  EntryFormatRaw,
+		DryRun:  true,
+	}
+
+	dst := memoryRegistry{}
+	report, err := Migrate(src, dst, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := MigrationReport{
+		{From: "/services/api/eu/1", To: "/services/api-v3/eu-1", Err: ErrNotMigratable},
+		{From: "/services/api/eu/2", To: "/services/api-v3/eu-2", Value: "https://10.0.0.2:8080"},
+		{From: "/services/api/eu/2", To: "/services/api-v3/eu-2/maintenance", Value: "true"},
+		{From: "/services/api/eu/2/maintenance", To: "/services/api-v3/eu-2/maintenance", Value: "true"},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(dst) != 0 {
+		t.Errorf("the dry run should not write: %v", dst)
+	}
+	if err := report.Err(); err == nil || err.Error() != "unable to migrate the etcd entries: /services/api/eu/1: "+ErrNotMigratable.Error() {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	m.Source = ClientOptions{}
+	m.Format = EntryFormatJSON
+	m.DryRun = false
+	m.Verify = true
+	m.To = "/services/readonly"
+	report, err = Migrate(memoryRegistry{"/services/api/1": "http://10.0.0.1:8080"}, dst, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Err != ErrMigrationMismatch {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	m.To = "/services/api-v3"
+	report, err = Migrate(memoryRegistry{"/services/api/1": "http://10.0.0.1:8080"}, dst, m)
+	if err != nil || report.Err() != nil {
+		t.Fatalf("unexpected result: %+v %v", report, err)
+	}
+	hosts, err := decodeJSON([]byte(dst["/services/api-v3/1"]))
+	if err != nil || len(hosts) != 1 || hosts[0].URL != "http://10.0.0.1:8080" {
+		t.Errorf("unexpected migrated entry: %s", dst["/services/api-v3/1"])
+	}
+
+	if _, err := Migrate(src, dst, Migration{Format: EntryFormatProtobuf}); err == nil {
+		t.Error("the migration should not accept the protobuf format")
+	}
+}
+
+func TestClient_GetKeyValues(t *testing.T) {
+	c := &client{
+		keysAPI: &fakeKeysAPI{getres: &getResult{resp: &etcd.Response{Node: &etcd.Node{
+			Key: "/services/api",
+			Dir: true,
+			Nodes: etcd.Nodes{
+				{Key: "/services/api/1", Value: "http://10.0.0.1"},
+				{Key: "/services/api/eu", Dir: true, Nodes: etcd.Nodes{{Key: "/services/api/eu/2", Value: "http://10.0.0.2"}}},
+			},
+		}}}},
+		ctx: context.Background(),
+	}
+	kvs, err := c.GetKeyValues("/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"/services/api/1": "http://10.0.0.1", "/services/api/eu/2": "http://10.0.0.2"}; !reflect.DeepEqual(kvs, expected) {
+		t.Errorf("unexpected entries: %v", kvs)
+	}
+}
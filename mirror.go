@@ -0,0 +1,79 @@
+package etcd
+
+import (
+	"sort"
+	"time"
+)
+
+// removalGrace keeps the hosts removed from etcd in the list during a grace period, so the lag between
+// mirrored clusters (or a key briefly deleted and recreated by the mirror) does not make the lists flap.
+// The period starts with the first read missing the host, no matter how long ago it was last seen.
+type removalGrace struct {
+	period    time.Duration
+	known     map[string]struct{}
+	removedAt map[string]time.Time
+}
+
+func newRemovalGrace(period time.Duration) *removalGrace {
+	return &removalGrace{
+		period:    period,
+		known:     map[string]struct{}{},
+		removedAt: map[string]time.Time{},
+	}
+}
+
+// apply returns the received hosts plus the ones removed less than a grace period ago, and the time
+// remaining until the next of those expires (zero if there are none)
+func (g *removalGrace) apply(hosts []string, now time.Time) ([]string, time.Duration) {
+	present := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		present[h] = struct{}{}
+		g.known[h] = struct{}{}
+		delete(g.removedAt, h)
+	}
+
+	lingering := []string{}
+	var next time.Duration
+	for h := range g.known {
+		if _, ok := present[h]; ok {
+			continue
+		}
+		removed, ok := g.removedAt[h]
+		if !ok {
+			removed = now
+			g.removedAt[h] = now
+		}
+		remaining := g.period - now.Sub(removed)
+		if remaining <= 0 {
+			delete(g.known, h)
+			delete(g.removedAt, h)
+			continue
+		}
+		lingering = append(lingering, h)
+		if next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+	if len(lingering) == 0 {
+		return hosts, 0
+	}
+
+	sort.Strings(lingering)
+	result := make([]string, 0, len(hosts)+len(lingering))
+	result = append(result, hosts...)
+	return append(result, lingering...), next
+}
+
+// dedupHosts removes the repeated hosts, keeping the first occurrence of each one
+func dedupHosts(hosts []string) []string {
+	seen := make(map[string]struct{}, len(hosts))
+	result := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		result = append(result, h)
+	}
+	return result
+}
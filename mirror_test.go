@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRemovalGrace(t *testing.T) {
+	g := newRemovalGrace(time.Minute)
+	now := time.Now()
+
+	hosts, next := g.apply([]string{"a", "b", "c"}, now)
+	if !reflect.DeepEqual(hosts, []string{"a", "b", "c"}) || next != 0 {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+
+	hosts, next = g.apply([]string{"a"}, now.Add(10*time.Second))
+	if !reflect.DeepEqual(hosts, []string{"a", "b", "c"}) || next != time.Minute {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+
+	hosts, next = g.apply([]string{"a", "c"}, now.Add(30*time.Second))
+	if !reflect.DeepEqual(hosts, []string{"a", "c", "b"}) || next != 40*time.Second {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+
+	hosts, next = g.apply([]string{"a", "c"}, now.Add(70*time.Second))
+	if !reflect.DeepEqual(hosts, []string{"a", "c"}) || next != 0 {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+}
+
+func TestRemovalGrace_sparseReads(t *testing.T) {
+	g := newRemovalGrace(time.Minute)
+	now := time.Now()
+
+	g.apply([]string{"a", "b"}, now)
+	// the grace starts with the read missing the host, even if the previous one is older than the period
+	hosts, next := g.apply([]string{"a"}, now.Add(5*time.Minute))
+	if !reflect.DeepEqual(hosts, []string{"a", "b"}) || next != time.Minute {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+
+	hosts, next = g.apply([]string{"a"}, now.Add(5*time.Minute+59*time.Second))
+	if !reflect.DeepEqual(hosts, []string{"a", "b"}) || next != time.Second {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+
+	hosts, next = g.apply([]string{"a"}, now.Add(6*time.Minute))
+	if !reflect.DeepEqual(hosts, []string{"a"}) || next != 0 {
+		t.Errorf("unexpected result: %v, %v", hosts, next)
+	}
+}
+
+func TestDedupHosts(t *testing.T) {
+	hosts := dedupHosts([]string{"a", "b", "a", "c", "b"})
+	if !reflect.DeepEqual(hosts, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
+func TestNewSubscriberWithOptions_removalGrace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mutex := &sync.Mutex{}
+	entries := []string{"a", "b", "a"}
+	notify := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return entries, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			for range notify {
+				ch <- struct{}{}
+			}
+		},
+	}
+
+	s, err := NewSubscriberWithOptions(ctx, c, "/services/api", BackendOptions{
+		DedupHosts:   true,
+		RemovalGrace: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts, _ := s.Hosts(); !reflect.DeepEqual(hosts, []string{"a", "b"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+
+	mutex.Lock()
+	entries = []string{"a"}
+	mutex.Unlock()
+	notify <- struct{}{}
+	<-time.After(20 * time.Millisecond)
+
+	if hosts, _ := s.Hosts(); !reflect.DeepEqual(hosts, []string{"a", "b"}) {
+		t.Errorf("unexpected hosts during the grace period: %v", hosts)
+	}
+
+	<-time.After(150 * time.Millisecond)
+	if hosts, _ := s.Hosts(); !reflect.DeepEqual(hosts, []string{"a"}) {
+		t.Errorf("unexpected hosts after the grace period: %v", hosts)
+	}
+	close(notify)
+}
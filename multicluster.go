@@ -0,0 +1,254 @@
+package etcd
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProbeInterval is the default period between two probes of the clusters
+	DefaultProbeInterval = 10 * time.Second
+	// DefaultSwitchMargin is the default latency improvement required for switching to another cluster
+	DefaultSwitchMargin = 5 * time.Millisecond
+
+	// latencyWeight is the weight of the last probe in the smoothed latency of a cluster
+	latencyWeight = 0.3
+)
+
+// Pinger is implemented by the clients able to check the health of their cluster
+type Pinger interface {
+	// Ping sends a lightweight request to the cluster, returning an error if it is not able to answer it
+	Ping() error
+}
+
+// Cluster is a named etcd client, used by the MultiClusterClient
+type Cluster struct {
+	Name   string
+	Client Client
+}
+
+type clusterState struct {
+	name    string
+	latency time.Duration
+	healthy bool
+}
+
+// clusterSet holds the state of the clusters, shared by the scoped copies of a MultiClusterClient
+type clusterSet struct {
+	clusters []*clusterState
+	current  int
+	margin   time.Duration
+	mutex    *sync.RWMutex
+}
+
+// MultiClusterClient reads the entries from the healthy cluster with the lowest latency, among a set of
+// clusters probed periodically. The preferred cluster is sticky: it is only replaced when it becomes
+// unhealthy or when another cluster is faster by more than the switch margin. The watches are established
+// against all the clusters, so the subscribers are notified whatever cluster is preferred.
+type MultiClusterClient struct {
+	clients []Client
+	set     *clusterSet
+}
+
+// NewMultiClusterClient returns a MultiClusterClient probing the received clusters every interval, plus
+// the jitter, until the context is cancelled. The first cluster is preferred until the first probe completes.
+func NewMultiClusterClient(ctx context.Context, clusters []Cluster, interval, margin time.Duration) *MultiClusterClient {
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	if margin < 0 {
+		margin = DefaultSwitchMargin
+	}
+	c := &MultiClusterClient{
+		clients: make([]Client, len(clusters)),
+		set: &clusterSet{
+			clusters: make([]*clusterState, len(clusters)),
+			margin:   margin,
+			mutex:    &sync.RWMutex{},
+		},
+	}
+	for i, cl := range clusters {
+		c.clients[i] = cl.Client
+		c.set.clusters[i] = &clusterState{name: cl.Name, healthy: true}
+	}
+
+	go func() {
+		c.probe()
+		for {
+			select {
+			case <-GetClock().After(Jitter(interval)):
+				c.probe()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+// Preferred returns the name of the cluster currently used for the reads
+func (c *MultiClusterClient) Preferred() string {
+	c.set.mutex.RLock()
+	defer c.set.mutex.RUnlock()
+	return c.set.clusters[c.set.current].name
+}
+
+// Clusters returns the named clients of the clusters
+func (c *MultiClusterClient) Clusters() []Cluster {
+	clusters := make([]Cluster, len(c.clients))
+	for i, cl := range c.clients {
+		clusters[i] = Cluster{Name: c.set.clusters[i].name, Client: cl}
+	}
+	return clusters
+}
+
+// GetEntries implements the etcd Client interface. If the preferred cluster fails, the rest of the
+// clusters are tried by their latency.
+func (c *MultiClusterClient) GetEntries(prefix string) ([]string, error) {
+	var lastErr error
+	for _, cl := range c.candidates() {
+		entries, err := cl.GetEntries(prefix)
+		if err == nil {
+			return entries, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// GetHosts implements the etcd HostsClient interface, with the same failover than GetEntries.
+func (c *MultiClusterClient) GetHosts(prefix string) ([]Host, error) {
+	hosts, _, err := c.GetHostsWithRevision(prefix)
+	return hosts, err
+}
+
+// GetHostsWithRevision implements the etcd RevisionClient interface, with the same failover than
+// GetEntries. The revision belongs to the cluster answering the request.
+func (c *MultiClusterClient) GetHostsWithRevision(prefix string) ([]Host, int64, error) {
+	var lastErr error
+	for _, cl := range c.candidates() {
+		hosts, revision, err := getHosts(cl, prefix)
+		if err == nil {
+			return hosts, revision, nil
+		}
+		lastErr = err
+	}
+	return nil, 0, lastErr
+}
+
+// WatchPrefix implements the etcd Client interface. It watches the prefix in all the clusters and it
+// returns once all the watches are finished.
+func (c *MultiClusterClient) WatchPrefix(prefix string, ch chan struct{}) {
+	wg := &sync.WaitGroup{}
+	for _, cl := range c.clients {
+		wg.Add(1)
+		go func(cl Client) {
+			cl.WatchPrefix(prefix, ch)
+			wg.Done()
+		}(cl)
+	}
+	wg.Wait()
+}
+
+// WithOptions implements the etcd ScopedClient interface, scoping all the clusters supporting it. The
+// scoped copy shares the probes and the preferred cluster with the original client.
+func (c *MultiClusterClient) WithOptions(options ClientOptions) Client {
+	clients := make([]Client, len(c.clients))
+	for i, cl := range c.clients {
+		clients[i] = cl
+		if sc, ok := cl.(ScopedClient); ok {
+			clients[i] = sc.WithOptions(options)
+		}
+	}
+	return &MultiClusterClient{clients: clients, set: c.set}
+}
+
+// candidates returns the clients of the clusters, starting with the preferred one and followed by the
+// rest of the healthy clusters sorted by latency, and the unhealthy ones
+func (c *MultiClusterClient) candidates() []Client {
+	c.set.mutex.RLock()
+	defer c.set.mutex.RUnlock()
+
+	rest := make([]int, 0, len(c.clients)-1)
+	for i := range c.clients {
+		if i != c.set.current {
+			rest = append(rest, i)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		a, b := c.set.clusters[rest[i]], c.set.clusters[rest[j]]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		return a.latency < b.latency
+	})
+
+	result := make([]Client, 0, len(c.clients))
+	result = append(result, c.clients[c.set.current])
+	for _, i := range rest {
+		result = append(result, c.clients[i])
+	}
+	return result
+}
+
+// probe pings every cluster, updates their smoothed latency and health, and selects the preferred one
+func (c *MultiClusterClient) probe() {
+	type result struct {
+		latency time.Duration
+		err     error
+		probed  bool
+	}
+	results := make([]result, len(c.clients))
+	wg := &sync.WaitGroup{}
+	for i, cl := range c.clients {
+		p, ok := cl.(Pinger)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, p Pinger) {
+			start := GetClock().Now()
+			err := p.Ping()
+			results[i] = result{GetClock().Now().Sub(start), err, true}
+			wg.Done()
+		}(i, p)
+	}
+	wg.Wait()
+
+	set := c.set
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	for i, cl := range set.clusters {
+		if !results[i].probed {
+			continue
+		}
+		cl.healthy = results[i].err == nil
+		if !cl.healthy {
+			continue
+		}
+		if cl.latency == 0 {
+			cl.latency = results[i].latency
+			continue
+		}
+		cl.latency = time.Duration(latencyWeight*float64(results[i].latency) + (1-latencyWeight)*float64(cl.latency))
+	}
+
+	best := -1
+	for i, cl := range set.clusters {
+		if cl.healthy && (best == -1 || cl.latency < set.clusters[best].latency) {
+			best = i
+		}
+	}
+	if best == -1 || best == set.current {
+		return
+	}
+	current := set.clusters[set.current]
+	if !current.healthy || set.clusters[best].latency+set.margin < current.latency {
+		set.current = best
+		addMetric(MetricClusterSwitches, 1)
+	}
+}
@@ -0,0 +1,131 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type pingerClient struct {
+	dummyClient
+	ping func() error
+}
+
+func (c pingerClient) Ping() error { return c.ping() }
+
+func newPingerClient(name string, latency *time.Duration, healthy *bool) pingerClient {
+	return pingerClient{
+		dummyClient: dummyClient{
+			getEntries: func(string) ([]string, error) {
+				if !*healthy {
+					return nil, fmt.Errorf("%s is down", name)
+				}
+				return []string{name}, nil
+			},
+			watchPrefix: func(string, chan struct{}) {},
+		},
+		ping: func() error {
+			<-time.After(*latency)
+			if !*healthy {
+				return fmt.Errorf("%s is down", name)
+			}
+			return nil
+		},
+	}
+}
+
+func TestMultiClusterClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	euLatency, usLatency := 40*time.Millisecond, time.Millisecond
+	euHealthy, usHealthy := true, true
+	c := NewMultiClusterClient(ctx, []Cluster{
+		{Name: "eu", Client: newPingerClient("eu", &euLatency, &euHealthy)},
+		{Name: "us", Client: newPingerClient("us", &usLatency, &usHealthy)},
+	}, time.Hour, 10*time.Millisecond)
+	<-time.After(100 * time.Millisecond)
+
+	if p := c.Preferred(); p != "us" {
+		t.Errorf("unexpected preferred cluster: %s", p)
+	}
+
+	// the difference is lower than the margin, so the preferred cluster is kept
+	euLatency, usLatency = time.Millisecond, 5*time.Millisecond
+	for i := 0; i < 5; i++ {
+		c.probe()
+	}
+	if p := c.Preferred(); p != "us" {
+		t.Errorf("unexpected preferred cluster after a small improvement: %s", p)
+	}
+
+	usHealthy = false
+	c.probe()
+	if p := c.Preferred(); p != "eu" {
+		t.Errorf("unexpected preferred cluster after a failure: %s", p)
+	}
+	entries, err := c.GetEntries("/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []string{"eu"}) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	// the preferred cluster fails before the next probe
+	euHealthy, usHealthy = false, true
+	entries, err = c.GetEntries("/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []string{"us"}) {
+		t.Errorf("unexpected entries after a failure of the preferred cluster: %v", entries)
+	}
+
+	usHealthy = false
+	if _, err := c.GetEntries("/services/api"); err == nil {
+		t.Error("expecting an error when all the clusters are down")
+	}
+}
+
+func TestNew_clusters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := New(ctx, map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"clusters": []interface{}{
+				map[string]interface{}{"name": "eu", "machines": []interface{}{"http://eu:2379"}},
+				map[string]interface{}{"machines": []interface{}{"http://us:2379"}},
+			},
+			"probe_interval": "1h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc, ok := c.(*MultiClusterClient)
+	if !ok {
+		t.Fatalf("unexpected client type: %T", c)
+	}
+	if len(mc.clients) != 2 || mc.set.clusters[0].name != "eu" || mc.set.clusters[1].name != "cluster-1" {
+		t.Errorf("unexpected clusters: %+v", mc.set.clusters)
+	}
+
+	scoped, ok := mc.WithOptions(ClientOptions{Filter: "*"}).(*MultiClusterClient)
+	if !ok || scoped.set != mc.set {
+		t.Error("the scoped client should share the state of the clusters")
+	}
+
+	for _, cfg := range []map[string]interface{}{
+		{"clusters": []interface{}{}},
+		{"clusters": []interface{}{"http://eu:2379"}},
+		{"clusters": []interface{}{map[string]interface{}{"name": "eu"}}},
+	} {
+		if _, err := New(ctx, map[string]interface{}{Namespace: cfg}); err == nil {
+			t.Errorf("expecting an error with the config %v", cfg)
+		}
+	}
+}
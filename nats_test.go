@@ -0,0 +1,85 @@
+package etcd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeNATSServer accepts a single connection, sending the payloads published to the channel
+func fakeNATSServer(t *testing.T, published chan<- string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "CONNECT":
+				var options natsConnect
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &options); err != nil || options.User != "user" || options.Pass != "secret" {
+					fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+					return
+				}
+			case fields[0] == "PING":
+				fmt.Fprint(conn, "PING\r\nPONG\r\n")
+			case fields[0] == "PONG":
+			case fields[0] == "PUB" && len(fields) == 3:
+				size, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, size+2)
+				if _, err := r.Read(payload); err != nil {
+					return
+				}
+				published <- fields[1] + " " + string(payload[:size])
+			}
+		}
+	}()
+	return l
+}
+
+func TestNATSPublisher(t *testing.T) {
+	published := make(chan string, 1)
+	l := fakeNATSServer(t, published)
+	defer l.Close()
+
+	p := NewNATSPublisher("nats://user:secret@"+l.Addr().String(), "krakend.discovery", 0)
+	e := DiscoveryEvent{ChangeEvent: ChangeEvent{Prefix: "/services/api", Added: []string{"http://10.0.0.1"}}}
+	if err := p.Publish(e); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-published
+	var received DiscoveryEvent
+	if !strings.HasPrefix(msg, "krakend.discovery ") || json.Unmarshal([]byte(strings.TrimPrefix(msg, "krakend.discovery ")), &received) != nil {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+	if received.Prefix != "/services/api" || len(received.Added) != 1 {
+		t.Errorf("unexpected event: %+v", received)
+	}
+}
+
+func TestNATSPublisher_authorizationViolation(t *testing.T) {
+	l := fakeNATSServer(t, make(chan string, 1))
+	defer l.Close()
+
+	p := NewNATSPublisher("nats://"+l.Addr().String(), "krakend.discovery", 0)
+	if err := p.Publish(DiscoveryEvent{}); err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package etcd
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultNegativeTTL is the default period the subscribers of a missing prefix are not retried
+const DefaultNegativeTTL = 5 * time.Second
+
+// negativeEntry is a prefix that could not be resolved
+type negativeEntry struct {
+	err     error
+	expires time.Time
+}
+
+var (
+	// negativeCache and negativeWatches are guarded by the subscribersMutex
+	negativeCache   = map[string]negativeEntry{}
+	negativeWatches = map[string]struct{}{}
+)
+
+// negativeResult returns the error cached for the subscriber key, if it has not expired. It must be
+// called with the subscribersMutex locked.
+func negativeResult(key string, now time.Time) (error, bool) {
+	e, ok := negativeCache[key]
+	if !ok || now.After(e.expires) {
+		return nil, false
+	}
+	addMetric(MetricNegativeHits, 1)
+	return e.err, true
+}
+
+// cacheNegative stores the error returned creating the subscriber of the prefix for the ttl plus the
+// jitter, so the retries of the missing prefixes are spread, logging it the first time. The prefix is
+// watched, so the negative entry is discarded as soon as the prefix is created. It must be called with
+// the subscribersMutex locked.
+func cacheNegative(ctx context.Context, c Client, prefix, key string, ttl time.Duration, err error) {
+	if ttl <= 0 {
+		ttl = DefaultNegativeTTL
+	}
+	if _, ok := negativeCache[key]; !ok {
+		getLogger().Warning("etcd: unable to resolve the prefix", prefix, "-", err.Error())
+	}
+	negativeCache[key] = negativeEntry{err: err, expires: GetClock().Now().Add(settingsOf(c).jitterOf(ttl))}
+
+	if _, ok := negativeWatches[key]; ok {
+		return
+	}
+	negativeWatches[key] = struct{}{}
+	ch := make(chan struct{})
+	go func() {
+		defer func() { recovered(prefix, recover()) }()
+		c.WatchPrefix(prefix, ch)
+	}()
+	go func() {
+		// skip the initial sentinel
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return
+		}
+		for {
+			select {
+			case <-ch:
+				subscribersMutex.Lock()
+				delete(negativeCache, key)
+				subscribersMutex.Unlock()
+			case <-ctx.Done():
+				subscribersMutex.Lock()
+				delete(negativeWatches, key)
+				subscribersMutex.Unlock()
+				return
+			}
+		}
+	}()
+}
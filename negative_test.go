@@ -0,0 +1,116 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+type dummyLogger struct {
+	mutex    *sync.Mutex
+	warnings []string
+}
+
+func (l *dummyLogger) Debug(_ ...interface{}) {}
+func (l *dummyLogger) Info(_ ...interface{})  {}
+func (l *dummyLogger) Warning(v ...interface{}) {
+	l.mutex.Lock()
+	l.warnings = append(l.warnings, v[1].(string))
+	l.mutex.Unlock()
+}
+func (l *dummyLogger) Error(_ ...interface{}) {}
+
+func TestCachedSubscriber_negative(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l := &dummyLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	mutex := &sync.Mutex{}
+	calls := 0
+	var entries []string
+	notify := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			calls++
+			if entries == nil {
+				return nil, errors.New("key not found")
+			}
+			return entries, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			ch <- struct{}{}
+			for range notify {
+				ch <- struct{}{}
+			}
+		},
+	}
+	cfg := &config.Backend{
+		Host: []string{"/services/missing"},
+		ExtraConfig: config.ExtraConfig{
+			Namespace: map[string]interface{}{"negative_ttl": "1h"},
+		},
+	}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+	hits := Metrics()[MetricNegativeHits]
+
+	for i := 0; i < 3; i++ {
+		if _, err := cachedSubscriber(ctx, c, cfg); err == nil {
+			t.Error("error expected")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("unexpected number of reads: %d", calls)
+	}
+	if v := Metrics()[MetricNegativeHits] - hits; v != 2 {
+		t.Errorf("unexpected negative hits: %d", v)
+	}
+	l.mutex.Lock()
+	if len(l.warnings) != 1 || l.warnings[0] != "/services/missing" {
+		t.Errorf("unexpected warnings: %v", l.warnings)
+	}
+	l.mutex.Unlock()
+
+	// the creation of the prefix discards the negative entry
+	mutex.Lock()
+	entries = []string{"http://10.0.0.1"}
+	mutex.Unlock()
+	notify <- struct{}{}
+	<-time.After(20 * time.Millisecond)
+
+	s, err := cachedSubscriber(ctx, c, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts, _ := s.Hosts(); len(hosts) != 1 || hosts[0] != "http://10.0.0.1" {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+	close(notify)
+}
+
+func TestNegativeResult_expiration(t *testing.T) {
+	now := time.Now()
+	err := errors.New("key not found")
+	negativeCache = map[string]negativeEntry{"key": {err: err, expires: now.Add(time.Second)}}
+
+	if e, ok := negativeResult("key", now); !ok || e != err {
+		t.Errorf("unexpected result: %v, %v", e, ok)
+	}
+	if _, ok := negativeResult("key", now.Add(2*time.Second)); ok {
+		t.Error("the entry should be expired")
+	}
+	if _, ok := negativeResult("unknown", now); ok {
+		t.Error("unexpected entry")
+	}
+}
@@ -0,0 +1,88 @@
+package etcd
+
+import "strings"
+
+// optionKeys are the keys of the options block. See parseOptionsMap.
+var optionKeys = []string{
+	"cert", "key", "cacert", "username", "password", "spiffe_socket", "spiffe_server_id", "tls_provider",
+	"dialer", "dial_timeout", "dial_keepalive", "header_timeout", "host_source", "filter", "entry_format",
+	"consistency", "watch_root", "value_encoding", "ignore_touches", "multi_value", "max_watchers",
+	"max_concurrent_gets", "page_size", "prefix_allowlist", "lease_margin", "entry_schema", "entry_schema_file",
+	"max_value_bytes", "max_entries_per_prefix", "limit_policy",
+}
+
+// normalizeOptionKeys returns a copy of the options block with its keys in their canonical form, so
+// "DialTimeout", "dial-timeout" and " dial_timeout " are all accepted as "dial_timeout". The unknown
+// keys are kept and logged, along with the known key they most likely meant, if any.
+func normalizeOptionKeys(tmp map[string]interface{}) map[string]interface{} {
+	known := make(map[string]string, len(optionKeys))
+	for _, k := range optionKeys {
+		known[squashKey(k)] = k
+	}
+	result := make(map[string]interface{}, len(tmp))
+	for k, v := range tmp {
+		canonical, ok := known[squashKey(k)]
+		if !ok {
+			if suggestion := closestKey(squashKey(k), known); suggestion != "" {
+				getLogger().Warning("etcd: unknown option", k, "- did you mean", suggestion)
+			} else {
+				getLogger().Warning("etcd: unknown option", k)
+			}
+			result[k] = v
+			continue
+		}
+		// the keys already in their canonical form win over the variants
+		if _, ok := result[canonical]; ok && k != canonical {
+			continue
+		}
+		result[canonical] = v
+	}
+	return result
+}
+
+// squashKey lowercases the key, removing the spaces, dashes and underscores
+func squashKey(k string) string {
+	return strings.NewReplacer("_", "", "-", "", " ", "", "\t", "").Replace(strings.ToLower(k))
+}
+
+// closestKey returns the known key at an edit distance of 2 or less of the received one, if any
+func closestKey(k string, known map[string]string) string {
+	best, distance := "", 3
+	for squashed, canonical := range known {
+		if d := editDistance(k, squashed); d < distance || (d == distance && canonical < best) {
+			best, distance = canonical, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between the two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
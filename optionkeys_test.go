@@ -0,0 +1,68 @@
+package etcd
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseOptionsMap_keyVariants(t *testing.T) {
+	l := &recordingLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	options, err := parseOptionsMap(map[string]interface{}{
+		"DialTimeout":     "5s",
+		"dial-keepalive":  "10s",
+		" header_timeout": "2s",
+		"CACert":          "ca.pem",
+		"Max-Watchers":    100.0,
+		"entry_format":    "json",
+		"EntryFormat":     "yaml",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.DialTimeout != 5*time.Second || options.DialKeepAlive != 10*time.Second || options.HeaderTimeoutPerRequest != 2*time.Second {
+		t.Errorf("unexpected timeouts: %+v", options)
+	}
+	if options.CACert != "ca.pem" || options.MaxWatchers.Total != 100 || options.EntryFormat != "json" {
+		t.Errorf("unexpected options: %+v", options)
+	}
+	if warnings := l.logged(); len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	if _, err := parseOptionsMap(map[string]interface{}{"dial_timeuot": "5s", "shards": 2.0}); err != nil {
+		t.Fatal(err)
+	}
+	warnings := l.logged()
+	if len(warnings) != 2 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+	for _, w := range warnings {
+		if strings.Contains(w, "dial_timeuot") && !strings.Contains(w, "did you mean dial_timeout") {
+			t.Errorf("unexpected suggestion: %s", w)
+		}
+		if strings.Contains(w, "shards") && strings.Contains(w, "did you mean") {
+			t.Errorf("unexpected suggestion: %s", w)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "", b: "abc", expected: 3},
+		{a: "dialtimeout", b: "dialtimeout", expected: 0},
+		{a: "dialtimeuot", b: "dialtimeout", expected: 2},
+		{a: "usrname", b: "username", expected: 1},
+	} {
+		if d := editDistance(tc.a, tc.b); d != tc.expected {
+			t.Errorf("unexpected distance between %s and %s: %d", tc.a, tc.b, d)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package etcd
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrPanic is reported by the subscribers whose read of the prefix panicked
+var ErrPanic = errors.New("the etcd read panicked")
+
+// recovered logs the panic of a goroutine watching or reading the prefix, along with its stack, and
+// counts it. It returns false if there is no panic. The received value must be the result of a recover
+// call in a deferred function.
+func recovered(prefix string, r interface{}) bool {
+	if r == nil {
+		return false
+	}
+	addMetric(MetricPanics, 1)
+	getLogger().Error("etcd: recovered from a panic watching the prefix", prefix, "-", fmt.Sprint(r), "\n"+string(debug.Stack()))
+	return true
+}
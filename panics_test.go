@@ -0,0 +1,87 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func TestSubscriber_recoverPanics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+	SetBackoff(ConstantBackoff{Period: 10 * time.Millisecond})
+	defer SetBackoff(nil)
+
+	mutex := &sync.Mutex{}
+	watches, reads := 0, 0
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			reads++
+			if reads == 2 {
+				panic("malformed entry")
+			}
+			return []string{"http://10.0.0.1"}, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			mutex.Lock()
+			watches++
+			first := watches == 1
+			mutex.Unlock()
+			ch <- struct{}{}
+			if first {
+				panic("malformed event")
+			}
+			<-ctx.Done()
+		},
+	}
+	before := Metrics()[MetricPanics]
+	s, err := NewSubscriber(ctx, c, "/services/panics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	if watches != 2 || reads != 4 {
+		t.Errorf("unexpected calls: %d watches, %d reads", watches, reads)
+	}
+	mutex.Unlock()
+	if v := Metrics()[MetricPanics] - before; v != 2 {
+		t.Errorf("unexpected panics: %d", v)
+	}
+	if _, meta, err := s.HostsWithMeta(); meta.Stale || err != nil {
+		t.Errorf("unexpected meta: %+v %v", meta, err)
+	}
+}
+
+func TestWatchMux_recoverPanics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := &fakeV3Watcher{ch: make(chan etcdv3.WatchResponse)}
+	m := newWatchMux(ctx, watcher, ClientOptions{WatchRoot: "/services/", IgnoreTouches: true})
+	api := make(chan struct{})
+	go m.watchPrefix("/services/api/", api)
+	<-api
+
+	before := Metrics()[MetricPanics]
+	watcher.ch <- etcdv3.WatchResponse{Events: []*etcdv3.Event{nil}}
+	watcher.ch <- etcdv3.WatchResponse{Events: []*etcdv3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/services/api/1")}}}}
+	select {
+	case <-api:
+	case <-time.After(time.Second):
+		t.Fatal("the watch should survive the malformed events")
+	}
+	if v := Metrics()[MetricPanics] - before; v != 1 {
+		t.Errorf("unexpected panics: %d", v)
+	}
+}
@@ -0,0 +1,93 @@
+package etcd
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// prefixPause is a pause of the subscribers, whose channel is closed once it ends
+type prefixPause struct {
+	resumed chan struct{}
+}
+
+// subscriberPauses holds the paused prefixes. The empty prefix pauses all the subscribers.
+type subscriberPauses struct {
+	mutex    *sync.Mutex
+	prefixes map[string]*prefixPause
+}
+
+var pauses = &subscriberPauses{mutex: &sync.Mutex{}, prefixes: map[string]*prefixPause{}}
+
+// Pause freezes the hosts of the subscribers whose prefix starts with the received one during a planned
+// maintenance of the registry, so the bulk rewrites of its keys do not cause routing churn. The changes
+// notified by their watches are read once the pause ends, with Resume or, as a safety net, once the
+// timeout expires (a zero timeout never expires). Pausing a paused prefix restarts its timeout.
+func Pause(prefix string, timeout time.Duration) {
+	pauses.mutex.Lock()
+	p, ok := pauses.prefixes[prefix]
+	if ok {
+		// the previous timeout is discarded
+		close(p.resumed)
+	}
+	p = &prefixPause{resumed: make(chan struct{})}
+	pauses.prefixes[prefix] = p
+	setMetric(MetricPausedPrefixes, int64(len(pauses.prefixes)))
+	pauses.mutex.Unlock()
+
+	if timeout <= 0 {
+		return
+	}
+	go func() {
+		select {
+		case <-GetClock().After(timeout):
+			if pauses.resume(prefix, p) {
+				getLogger().Warning("etcd: resuming the paused prefix after the timeout:", prefix)
+			}
+		case <-p.resumed:
+		}
+	}()
+}
+
+// Resume ends the pause of the prefix, so its subscribers read the changes notified during the pause
+func Resume(prefix string) {
+	pauses.resume(prefix, nil)
+}
+
+// PauseAll freezes the hosts of all the subscribers, like Pause with the empty prefix
+func PauseAll(timeout time.Duration) {
+	Pause("", timeout)
+}
+
+// ResumeAll ends the pause of all the subscribers started with PauseAll. The pauses of the prefixes
+// are kept.
+func ResumeAll() {
+	Resume("")
+}
+
+// resume ends the pause of the prefix, if it is the received one or any if nil, returning false if the
+// prefix was not paused by it
+func (s *subscriberPauses) resume(prefix string, p *prefixPause) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	current, ok := s.prefixes[prefix]
+	if !ok || (p != nil && current != p) {
+		return false
+	}
+	close(current.resumed)
+	delete(s.prefixes, prefix)
+	setMetric(MetricPausedPrefixes, int64(len(s.prefixes)))
+	return true
+}
+
+// paused returns the channel closed once a pause of the prefix ends, or nil if it is not paused
+func (s *subscriberPauses) paused(prefix string) <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for p, pause := range s.prefixes {
+		if strings.HasPrefix(prefix, p) {
+			return pause.resumed
+		}
+	}
+	return nil
+}
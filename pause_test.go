@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer ResumeAll()
+
+	mutex := &sync.Mutex{}
+	hosts := []string{"http://10.0.0.1"}
+	notify := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return hosts, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			for range notify {
+				ch <- struct{}{}
+			}
+		},
+	}
+	s, err := NewSubscriber(ctx, c, "/services/paused/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Pause("/services/paused/", 0)
+	mutex.Lock()
+	hosts = []string{"http://10.0.0.2"}
+	mutex.Unlock()
+	notify <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	if h, _ := s.Hosts(); !reflect.DeepEqual(h, []string{"http://10.0.0.1"}) {
+		t.Errorf("the hosts should be frozen during the pause: %v", h)
+	}
+
+	Resume("/services/paused/")
+	for i := 0; i < 100; i++ {
+		if h, _ := s.Hosts(); reflect.DeepEqual(h, []string{"http://10.0.0.2"}) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	h, _ := s.Hosts()
+	t.Errorf("the change should be read once resumed: %v", h)
+}
+
+func TestPause_timeout(t *testing.T) {
+	l := &recordingLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	PauseAll(10 * time.Millisecond)
+	resumed := pauses.paused("/services/api")
+	if resumed == nil {
+		t.Fatal("all the prefixes should be paused")
+	}
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("the pause should end after the timeout")
+	}
+	if pauses.paused("/services/api") != nil {
+		t.Error("unexpected pause")
+	}
+	if len(l.logged()) == 0 {
+		t.Error("the automatic resume should be logged")
+	}
+}
+
+func TestPause_restart(t *testing.T) {
+	Pause("/services/api/", time.Hour)
+	first := pauses.paused("/services/api/1")
+	Pause("/services/api/", 0)
+	select {
+	case <-first:
+	default:
+		t.Error("the previous pause should end")
+	}
+	if pauses.paused("/services/api/1") == nil || pauses.paused("/services/admin/1") != nil {
+		t.Error("unexpected pauses")
+	}
+	Resume("/services/api/")
+	Resume("/services/api/")
+	if pauses.paused("/services/api/1") != nil {
+		t.Error("the prefix should be resumed")
+	}
+	if v := Metrics()[MetricPausedPrefixes]; v != 0 {
+		t.Errorf("unexpected gauge: %v", v)
+	}
+}
@@ -0,0 +1,33 @@
+package etcd
+
+// payload accumulates the size of the keys and values received when reading a prefix
+type payload struct {
+	bytes   int64
+	largest int64
+}
+
+// add accounts for an entry of the received size (its key and its value)
+func (p *payload) add(n int) {
+	size := int64(n)
+	p.bytes += size
+	if size > p.largest {
+		p.largest = size
+	}
+}
+
+// publish publishes the size of the read of the prefix, its largest entry and the bytes received on top
+// of the urls of the decoded hosts, so the oversized registrations (e.g. huge JSON blobs) slowing the
+// discovery and inflating the db of the cluster can be spotted
+func (p payload) publish(prefix string, hosts []Host) {
+	overhead := p.bytes
+	for _, h := range hosts {
+		overhead -= int64(len(h.URL))
+	}
+	if overhead < 0 {
+		overhead = 0
+	}
+	addMetric(MetricPayloadBytes, p.bytes)
+	setMetric(MetricPayloadBytes+"."+prefix, p.bytes)
+	setMetric(MetricPayloadLargest+"."+prefix, p.largest)
+	setMetric(MetricPayloadOverhead+"."+prefix, overhead)
+}
@@ -0,0 +1,52 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func TestClientV3_payloadMetrics(t *testing.T) {
+	small := `{"host":"10.0.0.1","port":8080,"scheme":"http"}`
+	blob := `{"host":"10.0.0.2","port":8080,"scheme":"http","metadata":{"zone":"a","owner":"team-a"}}`
+	c := &clientv3{
+		client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{
+			Header: &etcdv3.ResponseHeader{Revision: 50},
+			Kvs: []*mvccpb.KeyValue{
+				{Key: []byte("/services/payload/1"), Value: []byte(small)},
+				{Key: []byte("/services/payload/2"), Value: []byte(blob)},
+			},
+			Count: 2,
+		}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+		options: ClientOptions{EntryFormat: EntryFormatJSON},
+	}
+	before := Metrics()[MetricPayloadBytes]
+
+	hosts, err := c.GetHosts("/services/payload/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("unexpected hosts: %+v", hosts)
+	}
+
+	total := int64(2*len("/services/payload/1") + len(small) + len(blob))
+	metrics := Metrics()
+	if got := metrics[MetricPayloadBytes] - before; got != total {
+		t.Errorf("unexpected bytes received: %d, want %d", got, total)
+	}
+	if got := metrics[MetricPayloadBytes+"./services/payload/"]; got != total {
+		t.Errorf("unexpected bytes of the prefix: %d, want %d", got, total)
+	}
+	if got, want := metrics[MetricPayloadLargest+"./services/payload/"], int64(len("/services/payload/2")+len(blob)); got != want {
+		t.Errorf("unexpected largest entry: %d, want %d", got, want)
+	}
+	if got, want := metrics[MetricPayloadOverhead+"./services/payload/"], total-int64(len(hosts[0].URL)+len(hosts[1].URL)); got != want {
+		t.Errorf("unexpected overhead: %d, want %d", got, want)
+	}
+}
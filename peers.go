@@ -0,0 +1,168 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPeerTTL is the ttl of the metadata published by the peers when none is defined
+const DefaultPeerTTL = 30 * time.Second
+
+// ErrNotPeerable is the error returned when the client is not able to publish and read the metadata of
+// the peers
+var ErrNotPeerable = errors.New("the etcd client does not support the peer groups")
+
+// ErrMissingPeerID is the error returned when the metadata of the gateway does not define its id
+var ErrMissingPeerID = errors.New("the peer does not define its id")
+
+// Peer is the metadata of a gateway of the fleet
+type Peer struct {
+	// ID identifies the gateway among its peers. It is the last segment of its key.
+	ID string `json:"id"`
+	// Version is the version of the gateway
+	Version string `json:"version,omitempty"`
+	// ConfigHash is the hash of the config of the gateway, so the peers running another config can be
+	// detected. See PeerGroup.Drifted.
+	ConfigHash string `json:"config_hash,omitempty"`
+	// Shards are the shards assigned to the gateway, if any
+	Shards []int `json:"shards,omitempty"`
+	// Metadata contains extra information about the gateway
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// PeerOptions defines the options of a PeerGroup. All values are optional.
+type PeerOptions struct {
+	// TTL is the ttl of the published metadata, so the gateways stopping are removed from the group
+	// once it expires. The metadata is refreshed every third of the ttl (plus the jitter), or kept on a
+	// single lease by the clients implementing LeaseRegistrar. DefaultPeerTTL if it is not defined.
+	TTL time.Duration
+	// OnChange is called with the peers every time they change
+	OnChange func([]Peer)
+}
+
+// peerClient is a client able to publish and read the metadata of the peers
+type peerClient interface {
+	Client
+	Registrar
+	KeyValueClient
+}
+
+// PeerGroup publishes the metadata of a gateway under a prefix shared by its fleet and watches the
+// metadata of the rest, so the fleet can coordinate its rollouts and detect the config drifts
+type PeerGroup struct {
+	client  peerClient
+	session *Session
+	prefix  string
+	self    Peer
+	options PeerOptions
+	mutex   *sync.RWMutex
+	peers   []Peer
+}
+
+// NewPeerGroup returns a PeerGroup publishing the metadata of the gateway under the prefix. The client
+// must be a Registrar and a KeyValueClient, like the v2 and v3 clients.
+func NewPeerGroup(c Client, prefix string, self Peer, options PeerOptions) (*PeerGroup, error) {
+	pc, ok := c.(peerClient)
+	if !ok {
+		return nil, ErrNotPeerable
+	}
+	if self.ID == "" {
+		return nil, ErrMissingPeerID
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultPeerTTL
+	}
+	return &PeerGroup{
+		client:  pc,
+		session: NewSession(pc, options.TTL),
+		prefix:  strings.TrimRight(prefix, "/") + "/",
+		self:    self,
+		options: options,
+		mutex:   &sync.RWMutex{},
+		peers:   []Peer{},
+	}, nil
+}
+
+// Peers returns the metadata of the gateways of the group, including this one once published, sorted by
+// id
+func (g *PeerGroup) Peers() []Peer {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	return append([]Peer{}, g.peers...)
+}
+
+// Drifted returns the peers running a config other than the one of this gateway
+func (g *PeerGroup) Drifted() []Peer {
+	drifted := []Peer{}
+	for _, p := range g.Peers() {
+		if p.ConfigHash != g.self.ConfigHash {
+			drifted = append(drifted, p)
+		}
+	}
+	return drifted
+}
+
+// Run publishes the metadata of the gateway and watches the metadata of its peers until the context is
+// canceled, when the metadata is removed. The failed reads are retried after the backoff set with
+// SetBackoff.
+func (g *PeerGroup) Run(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.publish(ctx)
+	}()
+	newPrefixLoop(g.client, g.prefix).run(ctx, func() (bool, error) {
+		return true, g.read()
+	})
+	<-done
+	return ctx.Err()
+}
+
+// publish registers the metadata of the gateway every third of the ttl until the context is canceled
+func (g *PeerGroup) publish(ctx context.Context) {
+	key := g.prefix + g.self.ID
+	value, _ := json.Marshal(g.self)
+	for {
+		if err := g.session.Register(key, string(value)); err != nil {
+			getLogger().Warning("etcd: unable to publish the metadata of the peer", key+":", err.Error())
+		}
+		select {
+		case <-GetClock().After(Jitter(g.options.TTL / 3)):
+		case <-ctx.Done():
+			g.session.Close()
+			return
+		}
+	}
+}
+
+// read reads the metadata of the peers, skipping the malformed entries
+func (g *PeerGroup) read() error {
+	kvs, err := g.client.GetKeyValues(g.prefix)
+	if err != nil {
+		return err
+	}
+	peers := make([]Peer, 0, len(kvs))
+	for key, value := range kvs {
+		var p Peer
+		if err := json.Unmarshal([]byte(value), &p); err != nil || p.ID != keySuffix(key) {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+
+	g.mutex.Lock()
+	changed := !reflect.DeepEqual(peers, g.peers)
+	g.peers = peers
+	g.mutex.Unlock()
+	if changed && g.options.OnChange != nil {
+		g.options.OnChange(peers)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryPeerClient is a peerClient storing the entries in memory and notifying its watch on every write
+type memoryPeerClient struct {
+	*memorySwapRegistrar
+	notify chan struct{}
+	stop   chan struct{}
+}
+
+func newMemoryPeerClient() *memoryPeerClient {
+	return &memoryPeerClient{
+		memorySwapRegistrar: newMemorySwapRegistrar(),
+		notify:              make(chan struct{}, 1),
+		stop:                make(chan struct{}),
+	}
+}
+
+func (c *memoryPeerClient) GetEntries(string) ([]string, error) { return nil, nil }
+
+func (c *memoryPeerClient) WatchPrefix(_ string, ch chan struct{}) {
+	for {
+		select {
+		case ch <- struct{}{}:
+		case <-c.stop:
+			return
+		}
+		select {
+		case <-c.notify:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *memoryPeerClient) Register(key, value string, ttl time.Duration) error {
+	c.memorySwapRegistrar.Register(key, value, ttl)
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *memoryPeerClient) GetKeyValues(prefix string) (map[string]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	kvs := map[string]string{}
+	for k, v := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			kvs[k] = v
+		}
+	}
+	return kvs, nil
+}
+
+func TestNewPeerGroup(t *testing.T) {
+	if _, err := NewPeerGroup(dummyClient{}, "/gateways/peers", Peer{ID: "gw-a"}, PeerOptions{}); err != ErrNotPeerable {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := NewPeerGroup(newMemoryPeerClient(), "/gateways/peers", Peer{}, PeerOptions{}); err != ErrMissingPeerID {
+		t.Errorf("unexpected error: %v", err)
+	}
+	g, err := NewPeerGroup(newMemoryPeerClient(), "/gateways/peers/", Peer{ID: "gw-a"}, PeerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.prefix != "/gateways/peers/" || g.options.TTL != DefaultPeerTTL {
+		t.Errorf("unexpected group: %s %s", g.prefix, g.options.TTL)
+	}
+}
+
+func TestPeerGroup_read(t *testing.T) {
+	c := newMemoryPeerClient()
+	c.Register("/gateways/peers/gw-b", `{"id":"gw-b","version":"2.1","config_hash":"def","shards":[2,3]}`, 0)
+	c.Register("/gateways/peers/gw-a", `{"id":"gw-a","version":"2.0","config_hash":"abc","shards":[0,1]}`, 0)
+	c.Register("/gateways/peers/gw-c", `{"id":"gw-x"}`, 0)
+	c.Register("/gateways/peers/gw-d", `not json`, 0)
+
+	changes := 0
+	g, err := NewPeerGroup(c, "/gateways/peers", Peer{ID: "gw-a", ConfigHash: "abc"}, PeerOptions{
+		OnChange: func([]Peer) { changes++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.read(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Peer{
+		{ID: "gw-a", Version: "2.0", ConfigHash: "abc", Shards: []int{0, 1}},
+		{ID: "gw-b", Version: "2.1", ConfigHash: "def", Shards: []int{2, 3}},
+	}
+	if peers := g.Peers(); !reflect.DeepEqual(peers, expected) {
+		t.Errorf("unexpected peers: %v", peers)
+	}
+	if drifted := g.Drifted(); len(drifted) != 1 || drifted[0].ID != "gw-b" {
+		t.Errorf("unexpected drifted peers: %v", drifted)
+	}
+
+	// the reads not changing the peers are not notified
+	g.read()
+	if changes != 1 {
+		t.Errorf("unexpected changes: %d", changes)
+	}
+}
+
+func TestPeerGroup_Run(t *testing.T) {
+	c := newMemoryPeerClient()
+	defer close(c.stop)
+	c.Register("/gateways/peers/gw-b", `{"id":"gw-b","version":"2.1"}`, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g, err := NewPeerGroup(c, "/gateways/peers", Peer{ID: "gw-a", Version: "2.0"}, PeerOptions{
+		OnChange: func(peers []Peer) {
+			if len(peers) == 2 {
+				cancel()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Run(ctx); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if c.get("/gateways/peers/gw-a") != "" || c.get("/gateways/peers/gw-b") == "" {
+		t.Errorf("the gateway should remove its metadata once the context is canceled: %v", c.entries)
+	}
+}
@@ -0,0 +1,140 @@
+// Package main is the KrakenD http client plugin resolving the backend hosts with the etcd subscriber.
+//
+// Build it with
+//
+//	go build -buildmode=plugin -o krakend-etcd.so .
+//
+// and declare it in the backend extra config:
+//
+//	"extra_config": {
+//	  "plugin/http-client": {
+//	    "name": "krakend-etcd",
+//	    "krakend-etcd": {
+//	      "machines": [ "http://192.168.110.111:2379" ],
+//	      "client_version": "v3",
+//	      "prefix": "/services/api",
+//	      "default_scheme": "http"
+//	    }
+//	  }
+//	}
+//
+// The plugin config accepts the same fields as the etcd namespace at the service level plus the
+// ones of the backend level (default_scheme, default_port and options overrides).
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+const pluginName = "krakend-etcd"
+
+// ClientRegisterer is the symbol the plugin loader will try to load. It must implement the RegisterClient interface
+var ClientRegisterer = registerer(pluginName)
+
+var (
+	// errNoPrefix is returned when the plugin config does not declare the prefix to watch
+	errNoPrefix = errors.New("krakend-etcd plugin: no prefix defined")
+
+	clientFactory = etcd.New
+	clients       = map[string]etcd.Client{}
+	clientsMutex  = &sync.Mutex{}
+)
+
+type registerer string
+
+// RegisterClients registers the etcd backed http client
+func (r registerer) RegisterClients(f func(
+	name string,
+	handler func(context.Context, map[string]interface{}) (http.Handler, error),
+)) {
+	f(string(r), r.registerClients)
+}
+
+func (r registerer) registerClients(ctx context.Context, extra map[string]interface{}) (http.Handler, error) {
+	cfg, ok := extra[string(r)].(map[string]interface{})
+	if !ok {
+		return nil, etcd.ErrNoConfig
+	}
+	prefix, ok := cfg["prefix"].(string)
+	if !ok || prefix == "" {
+		return nil, errNoPrefix
+	}
+
+	c, err := client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber := etcd.MetaSubscriberFactory(ctx, c)(&config.Backend{
+		Host:        []string{prefix},
+		ExtraConfig: config.ExtraConfig{etcd.Namespace: cfg},
+	})
+	return newHandler(subscriber), nil
+}
+
+// client returns the etcd client for the received config, sharing it among all the backends
+// with the same etcd config
+func client(ctx context.Context, cfg map[string]interface{}) (etcd.Client, error) {
+	key := fmt.Sprintf("%v|%v|%v", cfg["machines"], cfg["client_version"], cfg["options"])
+
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	if c, ok := clients[key]; ok {
+		return c, nil
+	}
+	c, err := clientFactory(ctx, config.ExtraConfig{etcd.Namespace: cfg})
+	if err != nil {
+		return nil, err
+	}
+	clients[key] = c
+	return c, nil
+}
+
+type targetKey struct{}
+
+// newHandler returns a reverse proxy sending every request to one of the hosts of the subscriber. The
+// responses served while the discovery is degraded carry the etcd.HeaderStale header.
+func newHandler(subscriber etcd.MetaSubscriber) http.Handler {
+	balancer := sd.NewBalancer(subscriber)
+	rp := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			target := req.Context().Value(targetKey{}).(*url.URL)
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, meta, _ := subscriber.HostsWithMeta(); meta.Stale {
+			for k, v := range meta.Headers(etcd.GetClock().Now()) {
+				w.Header()[k] = v
+			}
+		}
+		host, err := balancer.Host()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		target, err := url.Parse(host)
+		if err != nil || target.Host == "" {
+			target, err = url.Parse("http://" + host)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		rp.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), targetKey{}, target)))
+	})
+}
+
+func main() {}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	etcd "github.com/devopsfaith/krakend-etcd"
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestRegisterer_RegisterClients(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer backend.Close()
+
+	clientFactory = func(_ context.Context, _ config.ExtraConfig) (etcd.Client, error) {
+		return dummyClient{backend.URL}, nil
+	}
+	defer func() { clientFactory = etcd.New }()
+
+	var handlerFactory func(context.Context, map[string]interface{}) (http.Handler, error)
+	ClientRegisterer.RegisterClients(func(name string, f func(context.Context, map[string]interface{}) (http.Handler, error)) {
+		if name != pluginName {
+			t.Errorf("unexpected plugin name: %s", name)
+		}
+		handlerFactory = f
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := handlerFactory(ctx, map[string]interface{}{}); err != etcd.ErrNoConfig {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := handlerFactory(ctx, map[string]interface{}{pluginName: map[string]interface{}{}}); err != errNoPrefix {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	h, err := handlerFactory(ctx, map[string]interface{}{
+		pluginName: map[string]interface{}{
+			"machines": []interface{}{"http://etcd:2379"},
+			"prefix":   "/services/plugin_test",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://not-used/some/path", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	if body, _ := ioutil.ReadAll(w.Body); string(body) != "hello from /some/path" {
+		t.Errorf("unexpected body: %s", string(body))
+	}
+}
+
+type dummyClient struct {
+	host string
+}
+
+func (c dummyClient) GetEntries(string) ([]string, error)   { return []string{c.host}, nil }
+func (c dummyClient) WatchPrefix(_ string, _ chan struct{}) {}
@@ -0,0 +1,169 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+// DefaultPrefetchParallelism is the default number of subscribers created concurrently by Prefetch
+const DefaultPrefetchParallelism = 8
+
+// Prefetch creates and caches the subscribers of all the backends of the service config relying on
+// the etcd subscriber, so their prefixes are resolved and watched before the first request arrives.
+// At most parallelism subscribers are created concurrently. If the client reads the batches concurrently
+// (see GetEntriesBatch), the prefixes read with it are read first with a single batch, under a shared
+// deadline, and the subscribers of the failed ones are not created, so an unreachable cluster fails the
+// prefetch within a request timeout instead of one per group of parallelism prefixes. It returns the hosts
+// found, or the error returned, for every prefix.
+func Prefetch(ctx context.Context, c Client, cfg config.ServiceConfig, parallelism int) Report {
+	if parallelism <= 0 {
+		parallelism = DefaultPrefetchParallelism
+	}
+
+	backends := []*config.Backend{}
+	for _, e := range cfg.Endpoints {
+		for _, b := range e.Backend {
+			if b.SD == SDName {
+				backends = append(backends, b)
+			}
+		}
+	}
+
+	failed := batchFailures(c, backends)
+	report := make(Report, len(backends))
+	sem := make(chan struct{}, parallelism)
+	wg := &sync.WaitGroup{}
+	for i, b := range backends {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, b *config.Backend) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if p, ok := failed[i]; ok {
+				report[i] = p
+				return
+			}
+			report[i] = prefetch(ctx, c, b)
+		}(i, b)
+	}
+	wg.Wait()
+
+	// the backends sharing a subscriber are reported once
+	result := Report{}
+	visited := map[string]struct{}{}
+	for _, p := range report {
+		if _, ok := visited[p.Prefix]; ok && p.Err == nil {
+			continue
+		}
+		visited[p.Prefix] = struct{}{}
+		result = append(result, p)
+	}
+	return result
+}
+
+// batchFailures reads with a single batch the prefixes of the backends reading them with the received
+// client, returning the reports of the failed ones by the index of their backend. It reads nothing if the
+// client does not read the batches concurrently.
+func batchFailures(c Client, backends []*config.Backend) map[int]PrefixReport {
+	failed := map[int]PrefixReport{}
+	br, ok := c.(batchReader)
+	if !ok {
+		return failed
+	}
+	prefixes := []string{}
+	indexes := map[string][]int{}
+	for i, b := range backends {
+		if len(b.Host) == 0 {
+			continue
+		}
+		options, err := parseBackendOptions(b.ExtraConfig)
+		if err != nil || options.scoped() {
+			continue
+		}
+		prefix, err := options.prefix(c, b.Host[0])
+		if err != nil {
+			continue
+		}
+		if _, ok := indexes[prefix]; !ok {
+			prefixes = append(prefixes, prefix)
+		}
+		indexes[prefix] = append(indexes[prefix], i)
+	}
+	if len(prefixes) == 0 {
+		return failed
+	}
+	_, errs := br.readBatch(prefixes)
+	for prefix, err := range errs {
+		for _, i := range indexes[prefix] {
+			failed[i] = PrefixReport{Prefix: prefix, Err: err}
+		}
+	}
+	return failed
+}
+
+func prefetch(ctx context.Context, c Client, b *config.Backend) PrefixReport {
+	prefix := ""
+	if len(b.Host) > 0 {
+		prefix = b.Host[0]
+		if options, err := parseBackendOptions(b.ExtraConfig); err == nil {
+			if p, err := options.prefix(c, prefix); err == nil {
+				prefix = p
+			}
+		}
+	}
+	s, err := cachedSubscriber(ctx, c, b)
+	if err != nil {
+		return PrefixReport{Prefix: prefix, Err: err}
+	}
+	hosts, err := s.Hosts()
+	return PrefixReport{Prefix: prefix, Hosts: hosts, Err: err}
+}
+
+// NewForService creates an etcd client with the config extracted from the extra config of the service.
+// If the etcd config enables the prefetch option, the subscribers of all the backends relying on the etcd
+// subscriber are created in the background, with prefetch_parallelism concurrent requests (8 by default),
+// so they are ready before the first request, logging the StartupReport once they are. See Prefetch. If
+// it declares a webhook or a list of publishers, the changes of the discovered hosts are published to
+// them. See RegisterPublisher. If it declares a username, the access of the credentials to every prefix
+// is checked before returning the client, failing with the denied ones. See CheckACL.
+func NewForService(ctx context.Context, cfg config.ServiceConfig) (Client, error) {
+	return newForService(ctx, cfg, true)
+}
+
+func newForService(ctx context.Context, cfg config.ServiceConfig, prefetch bool) (Client, error) {
+	start := GetClock().Now()
+	ns, _ := cfg.ExtraConfig[Namespace].(map[string]interface{})
+	publishers, err := parsePublishers(ns)
+	if err != nil {
+		return nil, err
+	}
+	c, err := New(ctx, cfg.ExtraConfig)
+	if err != nil {
+		return nil, err
+	}
+	if options, _ := parseOptions(ns); options.Username != "" {
+		registrationPrefix, _ := ns["registration_prefix"].(string)
+		if err := CheckACL(c, cfg, registrationPrefix).Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range publishers {
+		RegisterPublisher(ctx, p)
+	}
+	if enabled, _ := ns["prefetch"].(bool); enabled && prefetch {
+		go startupReport(ctx, c, cfg, ns, GetClock().Now().Sub(start))
+	}
+	return c, nil
+}
+
+// prefetchParallelism returns the prefetch_parallelism of the etcd config, or 0 if it is not declared
+func prefetchParallelism(ns map[string]interface{}) int {
+	if p, ok := ns["prefetch_parallelism"].(float64); ok {
+		return int(p)
+	}
+	return 0
+}
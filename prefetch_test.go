@@ -0,0 +1,129 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestPrefetch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var concurrent, peak, calls int32
+	mutex := &sync.Mutex{}
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) {
+			atomic.AddInt32(&calls, 1)
+			n := atomic.AddInt32(&concurrent, 1)
+			mutex.Lock()
+			if n > peak {
+				peak = n
+			}
+			mutex.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&concurrent, -1)
+			if prefix == "/services/broken" {
+				return nil, fmt.Errorf("unavailable")
+			}
+			return []string{"http://" + prefix[len("/services/"):]}, nil
+		},
+		watchPrefix: func(string, chan struct{}) {},
+	}
+
+	backends := []*config.Backend{}
+	for _, prefix := range []string{"/services/a", "/services/b", "/services/c", "/services/d", "/services/a", "/services/broken"} {
+		backends = append(backends, &config.Backend{SD: SDName, Host: []string{prefix}})
+	}
+	cfg := config.ServiceConfig{Endpoints: []*config.EndpointConfig{
+		{Backend: backends},
+		{Backend: []*config.Backend{{Host: []string{"http://static"}}}},
+	}}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+	report := Prefetch(ctx, c, cfg, 2)
+
+	if len(report) != 5 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0].Prefix != "/services/broken" {
+		t.Errorf("unexpected failures: %+v", failed)
+	}
+	if peak > 2 {
+		t.Errorf("the parallelism was not respected: %d", peak)
+	}
+	if calls != 5 {
+		t.Errorf("unexpected number of reads: %d", calls)
+	}
+	if len(subscribers) != 4 {
+		t.Errorf("unexpected number of cached subscribers: %d", len(subscribers))
+	}
+
+	// the prefetched subscribers are reused by the factory
+	SubscriberFactory(ctx, c)(backends[0]).Hosts()
+	if calls != 5 {
+		t.Errorf("unexpected number of reads: %d", calls)
+	}
+}
+
+// batchDummyClient reads the batches concurrently with the timeout
+type batchDummyClient struct {
+	dummyClient
+	timeout time.Duration
+}
+
+func (c batchDummyClient) readBatch(prefixes []string) (map[string][]string, map[string]error) {
+	return readConcurrently(c, prefixes, c.timeout)
+}
+
+func TestPrefetch_batch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	block := make(chan struct{})
+	defer close(block)
+	var calls int32
+	c := batchDummyClient{
+		dummyClient: dummyClient{
+			getEntries: func(prefix string) ([]string, error) {
+				atomic.AddInt32(&calls, 1)
+				if prefix == "/services/unreachable" {
+					<-block
+				}
+				return []string{"http://10.0.0.1"}, nil
+			},
+			watchPrefix: func(string, chan struct{}) {},
+		},
+		timeout: 50 * time.Millisecond,
+	}
+	backends := []*config.Backend{
+		{SD: SDName, Host: []string{"/services/ok"}},
+		{SD: SDName, Host: []string{"/services/unreachable"}},
+		{SD: SDName, Host: []string{"/services/unreachable"}},
+	}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+	report := Prefetch(ctx, c, config.ServiceConfig{Endpoints: []*config.EndpointConfig{{Backend: backends}}}, 1)
+
+	failed := report.Failed()
+	if len(failed) != 2 {
+		t.Errorf("unexpected failures: %+v", failed)
+	}
+	for _, p := range failed {
+		if p.Prefix != "/services/unreachable" || p.Err != context.DeadlineExceeded {
+			t.Errorf("unexpected failure: %+v", p)
+		}
+	}
+	// the subscriber of the failed prefix is not created, so it does not wait for another timeout
+	if len(subscribers) != 1 || calls != 3 {
+		t.Errorf("unexpected subscribers: %d subscribers, %d reads", len(subscribers), calls)
+	}
+}
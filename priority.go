@@ -0,0 +1,55 @@
+package etcd
+
+import "time"
+
+const (
+	// PriorityCritical is the priority class of the backends whose discovery must stay fresh during
+	// the brownouts of the registry: their refreshes get the largest share of the refresh scheduler,
+	// their failed reads are retried sooner and they are not deferred by the load shedding mode nor
+	// by the warm restarts
+	PriorityCritical = "critical"
+	// PriorityStandard is the default priority class
+	PriorityStandard = "standard"
+	// PriorityBestEffort is the priority class of the backends tolerating an outdated discovery: their
+	// refreshes get the smallest share of the refresh scheduler and their failed reads are retried later
+	PriorityBestEffort = "best-effort"
+)
+
+// priorityWeights are the default refresh weights of the priority classes
+var priorityWeights = map[string]float64{
+	PriorityCritical:   4,
+	PriorityStandard:   1,
+	PriorityBestEffort: 0.25,
+}
+
+// priorityRetryFactors scale the delays of the read retries of the priority classes
+var priorityRetryFactors = map[string]float64{
+	PriorityCritical:   0.5,
+	PriorityStandard:   1,
+	PriorityBestEffort: 2,
+}
+
+// refreshWeight returns the share of the refreshes of the backend: its RefreshWeight or, if not set,
+// the weight of its priority class
+func (o BackendOptions) refreshWeight() float64 {
+	if o.RefreshWeight > 0 {
+		return o.RefreshWeight
+	}
+	if w, ok := priorityWeights[o.Priority]; ok {
+		return w
+	}
+	return 1
+}
+
+// retryDelay scales the delay of a read retry according to the priority class of the backend
+func (o BackendOptions) retryDelay(d time.Duration) time.Duration {
+	if f, ok := priorityRetryFactors[o.Priority]; ok {
+		return time.Duration(float64(d) * f)
+	}
+	return d
+}
+
+// critical returns true if the backend belongs to the critical priority class
+func (o BackendOptions) critical() bool {
+	return o.Priority == PriorityCritical
+}
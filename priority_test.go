@@ -0,0 +1,56 @@
+package etcd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestBackendOptions_priority(t *testing.T) {
+	for _, tc := range []struct {
+		options BackendOptions
+		weight  float64
+		delay   time.Duration
+	}{
+		{options: BackendOptions{}, weight: 1, delay: time.Second},
+		{options: BackendOptions{Priority: PriorityCritical}, weight: 4, delay: 500 * time.Millisecond},
+		{options: BackendOptions{Priority: PriorityStandard}, weight: 1, delay: time.Second},
+		{options: BackendOptions{Priority: PriorityBestEffort}, weight: 0.25, delay: 2 * time.Second},
+		{options: BackendOptions{Priority: PriorityBestEffort, RefreshWeight: 3}, weight: 3, delay: 2 * time.Second},
+	} {
+		if w := tc.options.refreshWeight(); w != tc.weight {
+			t.Errorf("unexpected weight of %+v: %v", tc.options, w)
+		}
+		if d := tc.options.retryDelay(time.Second); d != tc.delay {
+			t.Errorf("unexpected retry delay of %+v: %s", tc.options, d)
+		}
+	}
+}
+
+func TestParseBackendOptions_priority(t *testing.T) {
+	options, err := parseBackendOptions(config.ExtraConfig{Namespace: map[string]interface{}{"priority": "critical"}})
+	if err != nil || !options.critical() {
+		t.Errorf("unexpected options: %+v %v", options, err)
+	}
+	_, err = parseBackendOptions(config.ExtraConfig{Namespace: map[string]interface{}{"priority": "urgent"}})
+	if ce, ok := err.(*ConfigError); !ok || ce.Path != Namespace+".priority" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSubscriber_shedding(t *testing.T) {
+	SetLoadShedding(time.Millisecond, time.Minute)
+	defer SetLoadShedding(0, 0)
+	now := GetClock().Now()
+	for i := 0; i < shedMinSamples; i++ {
+		shedder.observe(time.Second, now)
+	}
+
+	if d := (&Subscriber{options: BackendOptions{}}).shedding(); d <= 0 {
+		t.Error("the standard backends should be shed")
+	}
+	if d := (&Subscriber{options: BackendOptions{Priority: PriorityCritical}}).shedding(); d != 0 {
+		t.Errorf("the critical backends should not be shed: %s", d)
+	}
+}
@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// errBadProtobuf is returned when the value is not a valid protobuf message
+var errBadProtobuf = errors.New("protobuf: malformed message")
+
+// decodeProtobuf decodes the records encoded as the following protobuf message. The wire format is
+// decoded directly, so there is no need to generate code nor to depend on the protobuf libraries.
+// Unknown fields are ignored.
+//
+//	message Host {
+//	  string host = 1;
+//	  uint32 port = 2;
+//	  string scheme = 3;
+//	  map<string, string> metadata = 4;
+//	  bool maintenance = 5;
+//	}
+func decodeProtobuf(b []byte) ([]Host, error) {
+	r := record{}
+	err := walkProtobuf(b, func(field uint64, wireType int, varint uint64, data []byte) error {
+		switch {
+		case field == 1 && wireType == 2:
+			r.Host = string(data)
+		case field == 2 && wireType == 0:
+			r.Port = json.Number(strconv.FormatUint(varint, 10))
+		case field == 3 && wireType == 2:
+			r.Scheme = string(data)
+		case field == 4 && wireType == 2:
+			var k, v string
+			if err := walkProtobuf(data, func(field uint64, wireType int, _ uint64, data []byte) error {
+				if wireType == 2 && field == 1 {
+					k = string(data)
+				}
+				if wireType == 2 && field == 2 {
+					v = string(data)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if r.Metadata == nil {
+				r.Metadata = map[string]interface{}{}
+			}
+			r.Metadata[k] = v
+		case field == 5 && wireType == 0:
+			r.Maintenance = varint != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	h, err := r.toHost()
+	if err != nil {
+		return nil, err
+	}
+	return []Host{h}, nil
+}
+
+// walkProtobuf calls the visitor with every field of the message. Varints are passed as numbers and
+// length delimited fields as data. Fixed size fields are passed as data too.
+func walkProtobuf(b []byte, visit func(field uint64, wireType int, varint uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errBadProtobuf
+		}
+		b = b[n:]
+		field, wireType := tag>>3, int(tag&0x7)
+
+		var varint uint64
+		var data []byte
+		switch wireType {
+		case 0:
+			varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errBadProtobuf
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if wireType == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return errBadProtobuf
+			}
+			data, b = b[:size], b[size:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errBadProtobuf
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", wireType)
+		}
+
+		if err := visit(field, wireType, varint, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// publisherQueueSize is the number of events waiting to be published before dropping the new ones
+const publisherQueueSize = 64
+
+// DiscoveryEvent is a change of the hosts of a watched prefix, as published to the external systems
+type DiscoveryEvent struct {
+	ChangeEvent
+	Time time.Time `json:"time"`
+}
+
+// Publisher delivers the discovery events to an external system (a webhook, a message bus...), so it can
+// track the topology of the upstreams as the gateway sees it without polling etcd
+type Publisher interface {
+	Publish(e DiscoveryEvent) error
+}
+
+// PublisherFactory creates a Publisher from its config
+type PublisherFactory func(cfg map[string]interface{}) (Publisher, error)
+
+var (
+	publisherFactories = map[string]PublisherFactory{
+		PublisherWebhook: newWebhookPublisher,
+		PublisherNATS:    newNATSPublisher,
+		PublisherKafka:   newKafkaPublisher,
+	}
+	publisherFactoriesMutex = &sync.RWMutex{}
+)
+
+const (
+	// PublisherWebhook is the type of the publishers posting the events to a webhook. See Webhook.
+	PublisherWebhook = "webhook"
+	// PublisherNATS is the type of the publishers sending the events to a NATS subject. See NATSPublisher.
+	PublisherNATS = "nats"
+	// PublisherKafka is the type of the publishers producing the events to a Kafka topic through a REST
+	// proxy. See KafkaPublisher.
+	PublisherKafka = "kafka"
+)
+
+// RegisterPublisherFactory registers a factory for the publishers of the given type, so they can be
+// declared in the config. Registering an existing type replaces it.
+func RegisterPublisherFactory(name string, f PublisherFactory) {
+	publisherFactoriesMutex.Lock()
+	publisherFactories[name] = f
+	publisherFactoriesMutex.Unlock()
+}
+
+func getPublisherFactory(name string) (PublisherFactory, bool) {
+	publisherFactoriesMutex.RLock()
+	f, ok := publisherFactories[name]
+	publisherFactoriesMutex.RUnlock()
+	return f, ok
+}
+
+// RegisterPublisher registers a change handler publishing the changes in the background, in order, until
+// the context is cancelled. The events are dropped if the publisher does not keep up, and the failed
+// deliveries are not retried.
+func RegisterPublisher(ctx context.Context, p Publisher) {
+	queue := make(chan DiscoveryEvent, publisherQueueSize)
+	RegisterChangeHandler(func(e ChangeEvent) {
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case queue <- DiscoveryEvent{ChangeEvent: e, Time: GetClock().Now()}:
+		default:
+			addMetric(MetricPublishDropped, 1)
+		}
+	})
+	go func() {
+		for {
+			select {
+			case e := <-queue:
+				if err := p.Publish(e); err != nil {
+					addMetric(MetricPublishFailures, 1)
+					getLogger().Warning("etcd: unable to publish the change of", e.Prefix, "-", err.Error())
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// parsePublishers returns the publishers declared in the etcd config of the service: the webhook and
+// the list of publishers, each one with its type
+func parsePublishers(cfg map[string]interface{}) ([]Publisher, error) {
+	publishers := []Publisher{}
+	if v, ok := cfg["webhook"]; ok {
+		tmp, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, badConfig(Namespace + ".webhook")
+		}
+		p, err := newWebhookPublisher(tmp)
+		if err != nil {
+			return nil, withPath(Namespace+".webhook", err)
+		}
+		publishers = append(publishers, p)
+	}
+
+	v, ok := cfg["publishers"]
+	if !ok {
+		return publishers, nil
+	}
+	ps, ok := v.([]interface{})
+	if !ok {
+		return nil, badConfig(Namespace + ".publishers")
+	}
+	for i, p := range ps {
+		path := fmt.Sprintf("%s.publishers[%d]", Namespace, i)
+		tmp, ok := p.(map[string]interface{})
+		if !ok {
+			return nil, badConfig(path)
+		}
+		name, _ := tmp["type"].(string)
+		f, ok := getPublisherFactory(name)
+		if !ok {
+			return nil, badConfig(path + ".type")
+		}
+		publisher, err := f(tmp)
+		if err != nil {
+			return nil, withPath(path, err)
+		}
+		publishers = append(publishers, publisher)
+	}
+	return publishers, nil
+}
+
+// stringOption returns the required string option of a publisher or cache config
+func stringOption(cfg map[string]interface{}, key string) (string, error) {
+	s, ok := cfg[key].(string)
+	if !ok || s == "" {
+		return "", badConfig(key)
+	}
+	return s, nil
+}
+
+// timeoutOption returns the timeout declared in a publisher or cache config, or zero
+func timeoutOption(cfg map[string]interface{}) time.Duration {
+	if o, ok := cfg["timeout"]; ok {
+		if d, err := parseDuration(o); err == nil {
+			return d
+		}
+	}
+	return 0
+}
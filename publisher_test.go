@@ -0,0 +1,57 @@
+package etcd
+
+import (
+	"testing"
+)
+
+type dummyPublisher struct{}
+
+func (dummyPublisher) Publish(DiscoveryEvent) error { return nil }
+
+func TestParsePublishers(t *testing.T) {
+	RegisterPublisherFactory("dummy", func(map[string]interface{}) (Publisher, error) { return dummyPublisher{}, nil })
+	defer func() {
+		publisherFactoriesMutex.Lock()
+		delete(publisherFactories, "dummy")
+		publisherFactoriesMutex.Unlock()
+	}()
+
+	publishers, err := parsePublishers(map[string]interface{}{
+		"webhook": map[string]interface{}{"url": "http://hooks.example.com"},
+		"publishers": []interface{}{
+			map[string]interface{}{"type": "nats", "url": "nats://127.0.0.1:4222", "subject": "krakend.discovery"},
+			map[string]interface{}{"type": "kafka", "url": "http://kafka-rest:8082", "topic": "discovery", "timeout": "1s"},
+			map[string]interface{}{"type": "dummy"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(publishers) != 4 {
+		t.Fatalf("unexpected publishers: %v", publishers)
+	}
+	if _, ok := publishers[1].(*NATSPublisher); !ok {
+		t.Errorf("unexpected publisher: %T", publishers[1])
+	}
+	if p, ok := publishers[2].(*KafkaPublisher); !ok || p.Topic != "discovery" {
+		t.Errorf("unexpected publisher: %+v", publishers[2])
+	}
+	if _, ok := publishers[3].(dummyPublisher); !ok {
+		t.Errorf("unexpected publisher: %T", publishers[3])
+	}
+
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "nats", path: Namespace + ".publishers"},
+		{cfg: []interface{}{"nats"}, path: Namespace + ".publishers[0]"},
+		{cfg: []interface{}{map[string]interface{}{"type": "amqp"}}, path: Namespace + ".publishers[0].type"},
+		{cfg: []interface{}{map[string]interface{}{"type": "nats", "url": "nats://127.0.0.1:4222"}}, path: Namespace + ".publishers[0].subject"},
+	} {
+		_, err := parsePublishers(map[string]interface{}{"publishers": tc.cfg})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+}
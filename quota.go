@@ -0,0 +1,120 @@
+package etcd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultAlarmCheckInterval is the default period the alarms of the cluster checked by a
+// QuotaAwareRegistrar are cached
+const DefaultAlarmCheckInterval = 10 * time.Second
+
+// ErrNoSpace is the error returned by the QuotaAwareRegistrar for the registrations skipped while the
+// cluster raises the NOSPACE alarm
+var ErrNoSpace = fmt.Errorf("registration skipped: the etcd cluster is out of space")
+
+// QuotaEvent describes a change of the NOSPACE alarm of the cluster used by a QuotaAwareRegistrar
+type QuotaEvent struct {
+	// NoSpace is true when the alarm is raised and false when it is cleared
+	NoSpace bool
+	// Alarms are all the alarms raised in the cluster
+	Alarms []string
+}
+
+var (
+	quotaHandlers      = []func(QuotaEvent){}
+	quotaHandlersMutex = &sync.RWMutex{}
+)
+
+// RegisterQuotaHandler registers a function to call every time a QuotaAwareRegistrar detects that the
+// NOSPACE alarm of its cluster has been raised or cleared
+func RegisterQuotaHandler(h func(QuotaEvent)) {
+	quotaHandlersMutex.Lock()
+	quotaHandlers = append(quotaHandlers, h)
+	quotaHandlersMutex.Unlock()
+}
+
+func notifyQuota(e QuotaEvent) {
+	quotaHandlersMutex.RLock()
+	defer quotaHandlersMutex.RUnlock()
+	for _, h := range quotaHandlers {
+		h(e)
+	}
+}
+
+// QuotaAwareRegistrar is a Registrar checking the alarms of the cluster before the registrations. While
+// the cluster raises the NOSPACE alarm, it rejects every write but the deletes, so the registrations (and
+// the leases granted for them) are skipped instead of failing over and over. The deregistrations are
+// always sent, since they reclaim space.
+type QuotaAwareRegistrar struct {
+	Registrar
+	inspector Inspector
+	interval  time.Duration
+	mutex     *sync.Mutex
+	checked   time.Time
+	noSpace   bool
+}
+
+// NewQuotaAwareRegistrar returns a QuotaAwareRegistrar wrapping the received registrar and checking the
+// alarms with the inspector (usually, the same v3 client) at most once per interval
+func NewQuotaAwareRegistrar(r Registrar, i Inspector, interval time.Duration) *QuotaAwareRegistrar {
+	if interval <= 0 {
+		interval = DefaultAlarmCheckInterval
+	}
+	return &QuotaAwareRegistrar{
+		Registrar: r,
+		inspector: i,
+		interval:  interval,
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Register implements the etcd Registrar interface. It returns ErrNoSpace without writing anything if the
+// cluster is out of space.
+func (r *QuotaAwareRegistrar) Register(key, value string, ttl time.Duration) error {
+	if r.outOfSpace(GetClock().Now()) {
+		addMetric(MetricSkippedRegistrations, 1)
+		return ErrNoSpace
+	}
+	return r.Registrar.Register(key, value, ttl)
+}
+
+// RegisterAll implements the etcd BatchRegistrar interface, keeping the batches of the wrapped registrar.
+// It returns ErrNoSpace without writing anything if the cluster is out of space.
+func (r *QuotaAwareRegistrar) RegisterAll(entries map[string]string, ttl time.Duration) error {
+	if r.outOfSpace(GetClock().Now()) {
+		addMetric(MetricSkippedRegistrations, int64(len(entries)))
+		return ErrNoSpace
+	}
+	return RegisterAll(r.Registrar, entries, ttl)
+}
+
+// outOfSpace returns true if the NOSPACE alarm is raised, according to the last check. If the alarms can
+// not be checked, the last known state is kept.
+func (r *QuotaAwareRegistrar) outOfSpace(now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.checked.IsZero() && now.Sub(r.checked) < r.interval {
+		return r.noSpace
+	}
+	r.checked = now
+
+	info, err := r.inspector.ClusterInfo()
+	if err != nil {
+		return r.noSpace
+	}
+	alarms := info.Alarms()
+	noSpace := false
+	for _, a := range alarms {
+		if a == AlarmNoSpace {
+			noSpace = true
+		}
+	}
+	if noSpace != r.noSpace {
+		r.noSpace = noSpace
+		getLogger().Warning("etcd: NOSPACE alarm changed:", fmt.Sprintf("raised=%v", noSpace))
+		notifyQuota(QuotaEvent{NoSpace: noSpace, Alarms: alarms})
+	}
+	return r.noSpace
+}
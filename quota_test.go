@@ -0,0 +1,69 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type dummyInspector struct {
+	info  *ClusterInfo
+	calls *int
+}
+
+func (d dummyInspector) ClusterInfo() (ClusterInfo, error) {
+	*d.calls++
+	return *d.info, nil
+}
+
+func TestQuotaAwareRegistrar(t *testing.T) {
+	events := []QuotaEvent{}
+	RegisterQuotaHandler(func(e QuotaEvent) { events = append(events, e) })
+	defer func() {
+		quotaHandlersMutex.Lock()
+		quotaHandlers = quotaHandlers[:0]
+		quotaHandlersMutex.Unlock()
+	}()
+
+	info := &ClusterInfo{Endpoints: []EndpointStatus{{Endpoint: "http://a:2379"}}}
+	calls := 0
+	entries := dummyRegistrar{}
+	r := NewQuotaAwareRegistrar(entries, dummyInspector{info: info, calls: &calls}, time.Hour)
+	skipped := Metrics()[MetricSkippedRegistrations]
+
+	if err := r.Register("/services/api/1", "http://10.0.0.1", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	info.Endpoints[0].Alarms = []string{AlarmNoSpace}
+	now := time.Now()
+	r.checked = now.Add(-2 * time.Hour)
+	if err := r.Register("/services/api/2", "http://10.0.0.2", time.Second); err != ErrNoSpace {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Register("/services/api/3", "http://10.0.0.3", time.Second); err != ErrNoSpace {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Deregister("/services/api/1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+	if calls != 2 {
+		t.Errorf("unexpected number of checks: %d", calls)
+	}
+	if v := Metrics()[MetricSkippedRegistrations] - skipped; v != 2 {
+		t.Errorf("unexpected skipped registrations: %d", v)
+	}
+
+	info.Endpoints[0].Alarms = nil
+	r.checked = now.Add(-2 * time.Hour)
+	if err := r.Register("/services/api/2", "http://10.0.0.2", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expected := []QuotaEvent{{NoSpace: true, Alarms: []string{AlarmNoSpace}}, {NoSpace: false, Alarms: []string{}}}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
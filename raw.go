@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// RawClient is implemented by the clients able to share their etcd connection, so the embedders
+// needing a one-off etcd operation reuse the configured endpoints, TLS and credentials instead of
+// creating another client. Only the v3 clients implement it.
+//
+// This is an advanced feature: the operations sent through the accessors skip the limits, the
+// metrics, the correlation ids and the codecs of the client. The returned values are the interfaces
+// of the etcd client library selected with the build tags (go.etcd.io/etcd/client/v3 by default).
+// Closing them is a no-op, as the connection is owned by the client.
+type RawClient interface {
+	// KV returns the KV API of the etcd connection
+	KV() etcdv3.KV
+	// Lease returns the Lease API of the etcd connection
+	Lease() etcdv3.Lease
+	// Watcher returns the Watch API of the etcd connection
+	Watcher() etcdv3.Watcher
+}
+
+// KV implements the etcd RawClient interface.
+func (c *clientv3) KV() etcdv3.KV {
+	return c.client.KV
+}
+
+// Lease implements the etcd RawClient interface.
+func (c *clientv3) Lease() etcdv3.Lease {
+	return sharedLease{c.client.Lease}
+}
+
+// Watcher implements the etcd RawClient interface.
+func (c *clientv3) Watcher() etcdv3.Watcher {
+	return sharedWatcher{c.client.Watcher}
+}
+
+// sharedLease keeps the embedders from closing the leases of the client, like the ones of its
+// registrations
+type sharedLease struct {
+	etcdv3.Lease
+}
+
+// Close does nothing, as the Lease API is owned by the client
+func (sharedLease) Close() error { return nil }
+
+// sharedWatcher keeps the embedders from closing the watches of the client, like the ones of its
+// subscribers
+type sharedWatcher struct {
+	etcdv3.Watcher
+}
+
+// Close does nothing, as the Watch API is owned by the client
+func (sharedWatcher) Close() error { return nil }
@@ -0,0 +1,62 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+type closingWatcher struct {
+	etcdv3.Watcher
+	closed *bool
+}
+
+func (w closingWatcher) Close() error {
+	*w.closed = true
+	return nil
+}
+
+type closingLease struct {
+	etcdv3.Lease
+	closed *bool
+}
+
+func (l closingLease) Close() error {
+	*l.closed = true
+	return nil
+}
+
+func TestClientV3_RawClient(t *testing.T) {
+	watcherClosed, leaseClosed := false, false
+	kv := fakeGetKV{resp: &etcdv3.GetResponse{Header: &etcdv3.ResponseHeader{Revision: 50}}}
+	c := &clientv3{
+		client: &etcdv3.Client{
+			KV:      kv,
+			Lease:   closingLease{closed: &leaseClosed},
+			Watcher: closingWatcher{Watcher: &fakeV3Watcher{}, closed: &watcherClosed},
+		},
+		ctx: context.Background(),
+	}
+
+	raw, ok := c.WithOptions(ClientOptions{}).(RawClient)
+	if !ok {
+		t.Fatal("the v3 clients should implement RawClient")
+	}
+	resp, err := raw.KV().Get(context.Background(), "/services/api/1")
+	if err != nil || resp.Header.Revision != 50 {
+		t.Errorf("unexpected response: %+v %v", resp, err)
+	}
+	if err := raw.Watcher().Close(); err != nil || watcherClosed {
+		t.Errorf("the watcher of the client should not be closed: %v", err)
+	}
+	if err := raw.Lease().Close(); err != nil || leaseClosed {
+		t.Errorf("the lease of the client should not be closed: %v", err)
+	}
+}
+
+func TestClient_RawClient(t *testing.T) {
+	if _, ok := interface{}(&client{}).(RawClient); ok {
+		t.Error("the v2 clients should not implement RawClient")
+	}
+}
@@ -0,0 +1,169 @@
+package etcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTimeout is the default timeout of the connections and the requests of the remote caches
+const DefaultCacheTimeout = time.Second
+
+// RedisCache is a Cache storing the values in a Redis server. It speaks the RESP protocol directly,
+// without depending on a Redis client, over a single connection reestablished after an error.
+type RedisCache struct {
+	// Address of the server, e.g. "127.0.0.1:6379"
+	Address  string
+	Password string
+	DB       int
+	Timeout  time.Duration
+
+	mutex  *sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisCache returns a RedisCache using the server at the address. The timeout is DefaultCacheTimeout
+// if it is not positive.
+func NewRedisCache(address, password string, db int, timeout time.Duration) *RedisCache {
+	if timeout <= 0 {
+		timeout = DefaultCacheTimeout
+	}
+	return &RedisCache{Address: address, Password: password, DB: db, Timeout: timeout, mutex: &sync.Mutex{}}
+}
+
+// Get implements the Cache interface
+func (c *RedisCache) Get(key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	value, err := c.do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, ErrCacheMiss
+	}
+	return value, nil
+}
+
+// Set implements the Cache interface
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, err := c.do("SET", key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// do sends the command, connecting if required, and returns the bulk string of the reply (nil for the
+// null replies and the simple strings)
+func (c *RedisCache) do(args ...string) ([]byte, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	value, err := c.command(args...)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			c.close()
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// connect dials the server, authenticating and selecting the database if required
+func (c *RedisCache) connect() error {
+	conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	if c.Password != "" {
+		if _, err := c.command("AUTH", c.Password); err != nil {
+			c.close()
+			return err
+		}
+	}
+	if c.DB > 0 {
+		if _, err := c.command("SELECT", strconv.Itoa(c.DB)); err != nil {
+			c.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// command writes the command as an array of bulk strings and reads its reply
+func (c *RedisCache) command(args ...string) ([]byte, error) {
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	msg := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		msg += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write([]byte(msg)); err != nil {
+		return nil, err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil, nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: unexpected reply %q", line)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, value); err != nil {
+			return nil, err
+		}
+		return value[:size], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (c *RedisCache) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.reader = nil
+}
+
+// redisError is an error reply of the server. The connection is still usable after it.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func newRedisCache(cfg map[string]interface{}) (Cache, error) {
+	address, err := stringOption(cfg, "address")
+	if err != nil {
+		return nil, err
+	}
+	password, _ := cfg["password"].(string)
+	db, _ := cfg["db"].(float64)
+	return NewRedisCache(address, password, int(db), timeoutOption(cfg)), nil
+}
@@ -0,0 +1,112 @@
+package etcd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedisServer serves GET, SET, AUTH and SELECT from a map, requiring the password if not empty
+func fakeRedisServer(t *testing.T, password string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex := &sync.Mutex{}
+	data := map[string]string{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				authenticated := password == ""
+				for {
+					args, err := readRedisCommand(r)
+					if err != nil {
+						return
+					}
+					switch {
+					case args[0] == "AUTH" && args[1] == password:
+						authenticated = true
+						fmt.Fprint(conn, "+OK\r\n")
+					case args[0] == "AUTH":
+						fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+					case !authenticated:
+						fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+					case args[0] == "SELECT":
+						fmt.Fprint(conn, "+OK\r\n")
+					case args[0] == "SET" && len(args) == 5 && args[3] == "PX":
+						mutex.Lock()
+						data[args[1]] = args[2]
+						mutex.Unlock()
+						fmt.Fprint(conn, "+OK\r\n")
+					case args[0] == "GET":
+						mutex.Lock()
+						v, ok := data[args[1]]
+						mutex.Unlock()
+						if !ok {
+							fmt.Fprint(conn, "$-1\r\n")
+							continue
+						}
+						fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+					default:
+						fmt.Fprint(conn, "-ERR unknown command\r\n")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return l
+}
+
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisCache(t *testing.T) {
+	l := fakeRedisServer(t, "s3cr3t")
+	defer l.Close()
+
+	c := NewRedisCache(l.Addr().String(), "s3cr3t", 2, 0)
+	if _, err := c.Get("krakend-etcd:a"); err != ErrCacheMiss {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := c.Set("krakend-etcd:a", []byte("{\"hosts\":[\"http://10.0.0.1\"]}\r\n"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get("krakend-etcd:a"); err != nil || string(v) != "{\"hosts\":[\"http://10.0.0.1\"]}\r\n" {
+		t.Errorf("unexpected value: %q %v", v, err)
+	}
+
+	if _, err := NewRedisCache(l.Addr().String(), "wrong", 0, 0).Get("krakend-etcd:a"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+// RegisterSubscriberFactory registers the subscribers of the client in the KrakenD sd register under the
+// SDName, so the gateways resolving the subscribers of their backends by name (sd.GetRegister().Get(cfg.SD))
+// use them for the backends declaring "sd": "etcd", instead of wrapping the proxy factory with
+// proxy.DefaultFactoryWithSubscriber. The backends declaring other names keep their own subscribers.
+func RegisterSubscriberFactory(ctx context.Context, c Client) error {
+	f := SubscriberFactory(ctx, c)
+	return sd.GetRegister().Register(SDName, func(cfg *config.Backend) sd.Subscriber {
+		return f(unsanitizedBackend(cfg))
+	})
+}
+
+// unsanitizedBackend returns a copy of the backend with the scheme added by the gateway to its hosts
+// removed (e.g. "http:///services/api"), since the hosts of the etcd backends are the prefixes to watch
+func unsanitizedBackend(cfg *config.Backend) *config.Backend {
+	if len(cfg.Host) == 0 {
+		return cfg
+	}
+	prefix := cfg.Host[0]
+	if i := strings.Index(prefix, "://"); i >= 0 {
+		prefix = prefix[i+3:]
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+	}
+	if prefix == cfg.Host[0] {
+		return cfg
+	}
+	backend := *cfg
+	backend.Host = append([]string{prefix}, cfg.Host[1:]...)
+	return &backend
+}
@@ -0,0 +1,36 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestRegisterSubscriberFactory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscribers = map[string]sd.Subscriber{}
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) {
+			if prefix != "/services/sd" {
+				t.Errorf("unexpected prefix: %s", prefix)
+			}
+			return []string{"http://10.0.0.1:8080"}, nil
+		},
+		watchPrefix: func(_ string, _ chan struct{}) { <-ctx.Done() },
+	}
+	if err := RegisterSubscriberFactory(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"/services/sd", "http:///services/sd", "http://services/sd"} {
+		s := sd.GetRegister().Get(SDName)(&config.Backend{SD: SDName, Host: []string{host}})
+		hosts, err := s.Hosts()
+		if err != nil || len(hosts) != 1 || hosts[0] != "http://10.0.0.1:8080" {
+			t.Errorf("unexpected hosts for %s: %v %v", host, hosts, err)
+		}
+	}
+}
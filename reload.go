@@ -0,0 +1,193 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+const (
+	// ReloadApplied is the outcome of the reloads applying a new config
+	ReloadApplied = "applied"
+	// ReloadRolledBack is the outcome of the reloads rejecting a config and rolling the store back to the
+	// config applied before
+	ReloadRolledBack = "rolled_back"
+	// ReloadFailed is the outcome of the reloads rejecting a config without a previous one to roll back to,
+	// failing to roll back or failing to apply the previous config again, so the router of the gateway
+	// may not serve any of them
+	ReloadFailed = "failed"
+)
+
+// ErrNoApply is the error returned when the ConfigReloader does not define its Apply function
+var ErrNoApply = errors.New("the config reloader needs an apply function")
+
+// ReloadEvent reports the outcome of a reload
+type ReloadEvent struct {
+	// Revision is the revision of the config reloaded
+	Revision int64
+	// Previous is the revision applied before the reload, or 0 if there is none
+	Previous int64
+	// Outcome is one of ReloadApplied, ReloadRolledBack or ReloadFailed
+	Outcome string
+	// Err is the error rejecting the config, if any
+	Err  error
+	Time time.Time
+}
+
+// ReloadOptions defines the options of a ConfigReloader. Apply is required.
+type ReloadOptions struct {
+	// Parse parses the config. The krakend parser if it is not defined.
+	Parse func([]byte) (config.ServiceConfig, error)
+	// Check validates the parsed config before applying it, e.g. sending a synthetic request to a router
+	// built with it. Optional.
+	Check func(ctx context.Context, cfg config.ServiceConfig) error
+	// Apply swaps the router of the gateway with one serving the config
+	Apply func(cfg config.ServiceConfig) error
+	// OnEvent is called with the outcome of every reload. Optional.
+	OnEvent func(ReloadEvent)
+}
+
+// ConfigReloader hot-reloads the gateway config served by a ConfigStore in two phases: every new
+// revision is parsed, its etcd backends are resolved once (like Verify) and the Check is run before
+// applying it. A config failing any of them is not applied, and the store is rolled back to the config
+// applied before, so the rest of the fleet does not load it either.
+type ConfigReloader struct {
+	client  Client
+	store   *ConfigStore
+	options ReloadOptions
+	mutex   *sync.RWMutex
+	applied int64
+	config  config.ServiceConfig
+}
+
+// NewConfigReloader returns a ConfigReloader applying the configs of the store. The client resolves the
+// etcd backends of the configs and watches the store.
+func NewConfigReloader(c Client, store *ConfigStore, options ReloadOptions) (*ConfigReloader, error) {
+	if options.Apply == nil {
+		return nil, ErrNoApply
+	}
+	if options.Parse == nil {
+		options.Parse = parseServiceConfig
+	}
+	return &ConfigReloader{client: c, store: store, options: options, mutex: &sync.RWMutex{}}, nil
+}
+
+// Revision returns the revision of the config applied, or 0 if there is none
+func (r *ConfigReloader) Revision() int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.applied
+}
+
+// Run reloads the config every time the store changes until the context is canceled. The failed reads
+// are retried after the backoff set with SetBackoff.
+func (r *ConfigReloader) Run(ctx context.Context) error {
+	newPrefixLoop(r.client, r.store.prefix).run(ctx, func() (bool, error) {
+		return true, r.reload(ctx)
+	})
+	return ctx.Err()
+}
+
+// reload applies the current config of the store if it is not applied yet. It only returns the errors
+// reading the store, so the reads are retried.
+func (r *ConfigReloader) reload(ctx context.Context) error {
+	raw, revision, err := r.store.Load()
+	if err == ErrNoConfigVersion {
+		return nil
+	}
+	if err != nil && !errors.Is(err, ErrUnsupportedSchema) && !errors.Is(err, ErrBadSignature) && !errors.Is(err, ErrStaleConfig) && err != ErrUnknownConfigVersion {
+		return err
+	}
+
+	r.mutex.RLock()
+	previous, current := r.applied, r.config
+	r.mutex.RUnlock()
+	if err == nil && revision == previous {
+		return nil
+	}
+
+	var cfg config.ServiceConfig
+	reapplied := true
+	if err == nil {
+		cfg, err = r.validate(ctx, raw)
+	}
+	if err == nil {
+		if err = r.options.Apply(cfg); err == nil {
+			r.mutex.Lock()
+			r.applied, r.config = revision, cfg
+			r.mutex.Unlock()
+			r.store.SetMinRevision(revision)
+			getLogger().Info("etcd: config revision", revision, "applied")
+			r.notify(ReloadEvent{Revision: revision, Previous: previous, Outcome: ReloadApplied})
+			return nil
+		}
+		if previous != 0 {
+			if err := r.options.Apply(current); err != nil {
+				reapplied = false
+				getLogger().Warning("etcd: unable to apply the config revision", previous, "again:", err.Error())
+			}
+		}
+	}
+
+	// the stale configs are not rolled back, since the store was already rolled back by another gateway
+	// that did not apply the newer revision this one applied
+	outcome := ReloadFailed
+	if previous != 0 && revision != previous && !errors.Is(err, ErrStaleConfig) {
+		if rbErr := r.store.Rollback(previous); rbErr == nil && reapplied {
+			outcome = ReloadRolledBack
+		} else if rbErr != nil {
+			getLogger().Warning("etcd: unable to roll back to the config revision", previous, rbErr.Error())
+		}
+	}
+	getLogger().Warning("etcd: config revision", revision, "rejected:", err.Error())
+	r.notify(ReloadEvent{Revision: revision, Previous: previous, Outcome: outcome, Err: err})
+	return nil
+}
+
+// validate parses the config, resolves its etcd backends and runs the check
+func (r *ConfigReloader) validate(ctx context.Context, raw []byte) (config.ServiceConfig, error) {
+	cfg, err := r.options.Parse(raw)
+	if err != nil {
+		return cfg, err
+	}
+	if err := Verify(r.client, cfg).Err(); err != nil {
+		return cfg, err
+	}
+	if r.options.Check != nil {
+		if err := r.options.Check(ctx, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, nil
+}
+
+// notify counts and reports the outcome of a reload
+func (r *ConfigReloader) notify(e ReloadEvent) {
+	e.Time = GetClock().Now()
+	addMetric(MetricConfigReloads+"."+e.Outcome, 1)
+	if r.options.OnEvent != nil {
+		r.options.OnEvent(e)
+	}
+}
+
+// parseServiceConfig parses the config with the krakend parser, which reads it from a file
+func parseServiceConfig(raw []byte) (config.ServiceConfig, error) {
+	f, err := ioutil.TempFile("", "krakend-etcd-*.json")
+	if err != nil {
+		return config.ServiceConfig{}, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(raw); err != nil {
+		f.Close()
+		return config.ServiceConfig{}, err
+	}
+	if err := f.Close(); err != nil {
+		return config.ServiceConfig{}, err
+	}
+	return config.NewParser().Parse(f.Name())
+}
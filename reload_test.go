@@ -0,0 +1,167 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func parseTestConfig(raw []byte) (config.ServiceConfig, error) {
+	cfg := config.ServiceConfig{}
+	err := json.Unmarshal(raw, &cfg)
+	return cfg, err
+}
+
+func TestNewConfigReloader(t *testing.T) {
+	if _, err := NewConfigReloader(newMemoryPeerClient(), nil, ReloadOptions{}); err != ErrNoApply {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigReloader_reload(t *testing.T) {
+	c := newMemoryPeerClient()
+	store, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{})
+	applied := []string{}
+	events := []ReloadEvent{}
+	var checkErr error
+	applyErrs := []error{}
+	r, err := NewConfigReloader(c, store, ReloadOptions{
+		Parse: parseTestConfig,
+		Check: func(context.Context, config.ServiceConfig) error { return checkErr },
+		Apply: func(cfg config.ServiceConfig) error {
+			if len(applyErrs) > 0 {
+				err := applyErrs[0]
+				applyErrs = applyErrs[1:]
+				return err
+			}
+			applied = append(applied, cfg.Name)
+			return nil
+		},
+		OnEvent: func(e ReloadEvent) { events = append(events, e) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	store.Publish([]byte(`{"version":3,"name":"v1"}`))
+	if err := r.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.Revision() != 1 || len(applied) != 1 || events[0].Outcome != ReloadApplied {
+		t.Errorf("unexpected reload: %d %v %+v", r.Revision(), applied, events)
+	}
+
+	// the unchanged revisions are not applied again
+	r.reload(ctx)
+	if len(applied) != 1 || len(events) != 1 {
+		t.Errorf("unexpected reload: %v %+v", applied, events)
+	}
+
+	// the configs whose etcd backends do not resolve are rolled back
+	store.Publish([]byte(`{"version":3,"name":"v2","endpoints":[{"backend":[{"sd":"etcd","host":["/services/api"]}]}]}`))
+	r.reload(ctx)
+	if e := events[len(events)-1]; e.Outcome != ReloadRolledBack || e.Revision != 2 || e.Previous != 1 || e.Err == nil {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if _, rev, _ := store.Load(); rev != 1 || r.Revision() != 1 {
+		t.Errorf("the store should be rolled back: %d", rev)
+	}
+
+	// the configs failing the check are rolled back
+	checkErr = errors.New("synthetic request failed")
+	store.Publish([]byte(`{"version":3,"name":"v3"}`))
+	r.reload(ctx)
+	if e := events[len(events)-1]; e.Outcome != ReloadRolledBack || e.Err != checkErr {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	checkErr = nil
+
+	// the previous config is applied again when the new one can not be applied
+	applyErrs = []error{errors.New("unable to build the router")}
+	store.Publish([]byte(`{"version":3,"name":"v4"}`))
+	r.reload(ctx)
+	if e := events[len(events)-1]; e.Outcome != ReloadRolledBack || e.Revision != 4 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if len(applied) != 2 || applied[1] != "v1" {
+		t.Errorf("unexpected applied configs: %v", applied)
+	}
+
+	// the unsupported configs are rejected
+	store.Publish([]byte(`{"version":4,"name":"v5"}`))
+	r.reload(ctx)
+	if e := events[len(events)-1]; e.Outcome != ReloadRolledBack || e.Revision != 5 || !errors.Is(e.Err, ErrUnsupportedSchema) {
+		t.Errorf("unexpected event: %+v", e)
+	}
+
+	// the reloads failing to apply the previous config again fail, even if the store is rolled back
+	applyErrs = []error{errors.New("unable to build the router"), errors.New("unable to build the router")}
+	store.Publish([]byte(`{"version":3,"name":"v6"}`))
+	r.reload(ctx)
+	if e := events[len(events)-1]; e.Outcome != ReloadFailed || e.Revision != 6 || e.Previous != 1 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if _, rev, _ := store.Load(); rev != 1 {
+		t.Errorf("the store should be rolled back: %d", rev)
+	}
+
+	store.Publish([]byte(`{"version":3,"name":"v7"}`))
+	r.reload(ctx)
+	if r.Revision() != 7 || applied[len(applied)-1] != "v7" {
+		t.Errorf("unexpected reload: %d %v", r.Revision(), applied)
+	}
+}
+
+func TestConfigReloader_noPrevious(t *testing.T) {
+	c := newMemoryPeerClient()
+	store, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{})
+	events := []ReloadEvent{}
+	r, _ := NewConfigReloader(c, store, ReloadOptions{
+		Parse:   parseTestConfig,
+		Apply:   func(config.ServiceConfig) error { return nil },
+		OnEvent: func(e ReloadEvent) { events = append(events, e) },
+	})
+
+	if err := r.reload(context.Background()); err != nil || len(events) != 0 {
+		t.Errorf("unexpected reload: %v %+v", err, events)
+	}
+	store.Publish([]byte(`{"version":3,"name":1}`))
+	r.reload(context.Background())
+	if len(events) != 1 || events[0].Outcome != ReloadFailed || r.Revision() != 0 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestConfigReloader_Run(t *testing.T) {
+	c := newMemoryPeerClient()
+	defer close(c.stop)
+	store, _ := NewConfigStore(c, "/gateways/config", ConfigStoreOptions{})
+	store.Publish([]byte(`{"version":3,"name":"v1"}`))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, _ := NewConfigReloader(c, store, ReloadOptions{
+		Parse:   parseTestConfig,
+		Apply:   func(config.ServiceConfig) error { return nil },
+		OnEvent: func(ReloadEvent) { cancel() },
+	})
+	if err := r.Run(ctx); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if r.Revision() != 1 {
+		t.Errorf("unexpected revision: %d", r.Revision())
+	}
+}
+
+func TestParseServiceConfig(t *testing.T) {
+	cfg, err := parseServiceConfig([]byte(`{"version":3,"name":"gateway"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "gateway" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+}
@@ -0,0 +1,203 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotRecorded is the error returned by the ReplayClient for the prefixes without recorded events
+var ErrNotRecorded = fmt.Errorf("the prefix was not recorded")
+
+// WatchEvent is a read of a watched prefix, as persisted by the Recorder. The subscribers read their
+// prefix once at start and after every change notified by the watch, so the events of a prefix are the
+// sequence of hosts the gateway discovered for it.
+type WatchEvent struct {
+	At       time.Time `json:"at"`
+	Prefix   string    `json:"prefix"`
+	Hosts    []Host    `json:"hosts"`
+	Revision int64     `json:"revision,omitempty"`
+	// Error is the message of the error returned by the read, if any
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder is a Client persisting the result of every read as a WatchEvent, encoded as a line of JSON,
+// so the discovery churn of a production gateway can be reproduced later with a ReplayClient.
+type Recorder struct {
+	Client
+	mutex   *sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecorder returns a Recorder wrapping the received client and writing the events into w
+func NewRecorder(c Client, w io.Writer) *Recorder {
+	return &Recorder{Client: c, mutex: &sync.Mutex{}, encoder: json.NewEncoder(w)}
+}
+
+// WithOptions implements the etcd ScopedClient interface, recording the reads of the scoped client too
+func (r *Recorder) WithOptions(options ClientOptions) Client {
+	sc, ok := r.Client.(ScopedClient)
+	if !ok {
+		return r
+	}
+	return &Recorder{Client: sc.WithOptions(options), mutex: r.mutex, encoder: r.encoder}
+}
+
+// GetEntries implements the etcd Client interface.
+func (r *Recorder) GetEntries(prefix string) ([]string, error) {
+	hosts, _, err := r.GetHostsWithRevision(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return hostURLs(hosts), nil
+}
+
+// GetHosts implements the etcd HostsClient interface.
+func (r *Recorder) GetHosts(prefix string) ([]Host, error) {
+	hosts, _, err := r.GetHostsWithRevision(prefix)
+	return hosts, err
+}
+
+// GetHostsWithRevision implements the etcd RevisionClient interface.
+func (r *Recorder) GetHostsWithRevision(prefix string) ([]Host, int64, error) {
+	hosts, revision, err := getHosts(r.Client, prefix)
+	e := WatchEvent{At: GetClock().Now(), Prefix: prefix, Hosts: hosts, Revision: revision}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.mutex.Lock()
+	if werr := r.encoder.Encode(e); werr != nil {
+		getLogger().Warning("etcd: unable to record the read of", prefix, "-", werr.Error())
+	}
+	r.mutex.Unlock()
+	return hosts, revision, err
+}
+
+// ReplayClient is a Client reproducing the events persisted by a Recorder. The reads return the hosts of
+// the last event replayed for the prefix, starting with the first one recorded, and the watches notify
+// the following events with the same delays they were recorded with, divided by the speed.
+type ReplayClient struct {
+	ctx     context.Context
+	speed   float64
+	events  map[string][]WatchEvent
+	mutex   *sync.RWMutex
+	current map[string]WatchEvent
+	// settings are the ones declared along with the replay file. See clientSettings.
+	settings *clientSettings
+}
+
+// NewReplayClient returns a ReplayClient with the events read from r. The speed multiplies the pace of
+// the replay (1 if it is not positive). The watches return once the context is done.
+func NewReplayClient(ctx context.Context, r io.Reader, speed float64) (*ReplayClient, error) {
+	if speed <= 0 {
+		speed = 1
+	}
+	c := &ReplayClient{
+		ctx:     ctx,
+		speed:   speed,
+		events:  map[string][]WatchEvent{},
+		mutex:   &sync.RWMutex{},
+		current: map[string]WatchEvent{},
+	}
+	decoder := json.NewDecoder(r)
+	for {
+		var e WatchEvent
+		if err := decoder.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if _, ok := c.current[e.Prefix]; !ok {
+			c.current[e.Prefix] = e
+		}
+		c.events[e.Prefix] = append(c.events[e.Prefix], e)
+	}
+	return c, nil
+}
+
+// GetEntries implements the etcd Client interface.
+func (c *ReplayClient) GetEntries(prefix string) ([]string, error) {
+	hosts, _, err := c.GetHostsWithRevision(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return hostURLs(hosts), nil
+}
+
+// GetHosts implements the etcd HostsClient interface.
+func (c *ReplayClient) GetHosts(prefix string) ([]Host, error) {
+	hosts, _, err := c.GetHostsWithRevision(prefix)
+	return hosts, err
+}
+
+// GetHostsWithRevision implements the etcd RevisionClient interface.
+func (c *ReplayClient) GetHostsWithRevision(prefix string) ([]Host, int64, error) {
+	c.mutex.RLock()
+	e, ok := c.current[prefix]
+	c.mutex.RUnlock()
+	if !ok {
+		return nil, 0, ErrNotRecorded
+	}
+	if e.Error != "" {
+		return nil, 0, errors.New(e.Error)
+	}
+	hosts := make([]Host, len(e.Hosts))
+	copy(hosts, e.Hosts)
+	return hosts, e.Revision, nil
+}
+
+// WatchPrefix implements the etcd Client interface, replaying the events recorded for the prefix
+func (c *ReplayClient) WatchPrefix(prefix string, ch chan struct{}) {
+	events := c.events[prefix]
+	for i := 1; i < len(events); i++ {
+		delay := time.Duration(float64(events[i].At.Sub(events[i-1].At)) / c.speed)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-GetClock().After(delay):
+		}
+		c.mutex.Lock()
+		c.current[prefix] = events[i]
+		c.mutex.Unlock()
+		select {
+		case <-c.ctx.Done():
+			return
+		case ch <- struct{}{}:
+		}
+	}
+	<-c.ctx.Done()
+}
+
+// parseReplay returns the ReplayClient declared by the replay object of the service config
+func parseReplay(ctx context.Context, v interface{}) (*ReplayClient, error) {
+	path := Namespace + ".replay"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, badConfig(path)
+	}
+	file, ok := cfg["file"].(string)
+	if !ok {
+		return nil, badConfig(path + ".file")
+	}
+	speed := 1.0
+	if o, ok := cfg["speed"]; ok {
+		if speed, ok = o.(float64); !ok || speed <= 0 {
+			return nil, badConfig(path + ".speed")
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, badConfig(path + ".file")
+	}
+	defer f.Close()
+	c, err := NewReplayClient(ctx, f, speed)
+	if err != nil {
+		return nil, badConfig(path + ".file")
+	}
+	return c, nil
+}
@@ -0,0 +1,134 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecorder_ReplayClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	reads := [][]string{
+		{"http://10.0.0.1"},
+		{"http://10.0.0.1", "http://10.0.0.2"},
+		nil,
+		{"http://10.0.0.2"},
+	}
+	i := 0
+	c := dummyClient{
+		getEntries: func(key string) ([]string, error) {
+			defer func() { i++ }()
+			if reads[i] == nil {
+				return nil, fmt.Errorf("context deadline exceeded")
+			}
+			return reads[i], nil
+		},
+	}
+	buf := &bytes.Buffer{}
+	r := NewRecorder(c, buf)
+	for range reads {
+		r.GetEntries("/services/api")
+		clock.Advance(time.Minute)
+	}
+
+	replay, err := NewReplayClient(ctx, buf, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replay.GetEntries("/services/users"); err != ErrNotRecorded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if hosts, err := replay.GetEntries("/services/api"); err != nil || !reflect.DeepEqual(hosts, reads[0]) {
+		t.Errorf("unexpected hosts: %v %v", hosts, err)
+	}
+
+	ch := make(chan struct{})
+	go replay.WatchPrefix("/services/api", ch)
+	for i := 1; i < len(reads); i++ {
+		select {
+		case <-ch:
+		case <-time.After(100 * time.Millisecond):
+			clock.Advance(time.Second)
+			i--
+			continue
+		}
+		hosts, err := replay.GetEntries("/services/api")
+		if reads[i] == nil {
+			if err == nil || err.Error() != "context deadline exceeded" {
+				t.Errorf("unexpected error: %v", err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(hosts, reads[i]) {
+			t.Errorf("unexpected hosts after the event %d: %v %v", i, hosts, err)
+		}
+	}
+}
+
+func TestNew_replay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.jsonl")
+	if err := ioutil.WriteFile(file, []byte(`{"at":"2020-01-01T00:00:00Z","prefix":"/services/api","hosts":[{"url":"http://10.0.0.1"}]}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(ctx, map[string]interface{}{
+		Namespace: map[string]interface{}{"replay": map[string]interface{}{"file": file, "speed": 10.0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hosts, err := c.GetEntries("/services/api"); err != nil || len(hosts) != 1 || hosts[0] != "http://10.0.0.1" {
+		t.Errorf("unexpected hosts: %v %v", hosts, err)
+	}
+
+	// the settings of the config apply to the replayed clients too
+	c, err = New(ctx, map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"replay":              map[string]interface{}{"file": file},
+			"refresh_concurrency": 3.0,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler := settingsOf(c).scheduler()
+	scheduler.mutex.Lock()
+	limit := scheduler.limit
+	scheduler.mutex.Unlock()
+	if limit != 3 {
+		t.Errorf("unexpected refresh concurrency: %d", limit)
+	}
+
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: file, path: Namespace + ".replay"},
+		{cfg: map[string]interface{}{"file": filepath.Join(dir, "unknown")}, path: Namespace + ".replay.file"},
+		{cfg: map[string]interface{}{"file": file, "speed": -1.0}, path: Namespace + ".replay.speed"},
+	} {
+		_, err := New(ctx, map[string]interface{}{Namespace: map[string]interface{}{"replay": tc.cfg}})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+}
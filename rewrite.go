@@ -0,0 +1,91 @@
+package etcd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RewriteRule replaces the From head of the prefixes of the backends with To, so the same backend
+// configs can be used in environments with different registry roots. e.g. the rule
+// {From: "/services/", To: "/prod/eu/services/"} makes the backends declaring "/services/api/" watch
+// "/prod/eu/services/api/".
+type RewriteRule struct {
+	From string
+	To   string
+	// Tenant restricts the rule to the backends of the tenant. See BackendOptions.Tenant.
+	Tenant string
+}
+
+var (
+	rewriteRules = []RewriteRule{}
+	rewriteMutex = &sync.RWMutex{}
+)
+
+// SetRewriteRules sets the rules rewriting the prefixes of the backends. Only one rule is applied to
+// every prefix: the one with the longest From matching it among the rules of its tenant or, if none
+// matches, among the rules without a tenant. The subscribers already created keep their prefixes. The
+// clients created by New with a prefix_rewrite config apply their own rules.
+func SetRewriteRules(rules []RewriteRule) {
+	rewriteMutex.Lock()
+	rewriteRules = append([]RewriteRule{}, rules...)
+	rewriteMutex.Unlock()
+}
+
+// getRewriteRules returns the rules set with SetRewriteRules
+func getRewriteRules() []RewriteRule {
+	rewriteMutex.RLock()
+	defer rewriteMutex.RUnlock()
+	return rewriteRules
+}
+
+// rewritePrefix applies the rule matching the prefix of the tenant, if any
+func rewritePrefix(rules []RewriteRule, tenant, prefix string) string {
+	var match *RewriteRule
+	for i, r := range rules {
+		if !strings.HasPrefix(prefix, r.From) {
+			continue
+		}
+		if r.Tenant != "" && r.Tenant != tenant {
+			continue
+		}
+		if match == nil || (r.Tenant != "" && match.Tenant == "") ||
+			(r.Tenant == match.Tenant && len(r.From) > len(match.From)) {
+			match = &rules[i]
+		}
+	}
+	if match == nil {
+		return prefix
+	}
+	return match.To + prefix[len(match.From):]
+}
+
+// parseRewriteRules parses the rewrite rules config: [{"from": "/services/", "to": "/prod/eu/services/"},
+// {"from": "/services/", "to": "/prod/eu/team-a/", "tenant": "team-a"}]
+func parseRewriteRules(v interface{}) ([]RewriteRule, error) {
+	path := Namespace + ".prefix_rewrite"
+	cfg, ok := v.([]interface{})
+	if !ok {
+		return nil, badConfig(path)
+	}
+	rules := make([]RewriteRule, len(cfg))
+	for i, o := range cfg {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, badConfig(fmt.Sprintf("%s[%d]", path, i))
+		}
+		for key, field := range map[string]*string{"from": &rules[i].From, "to": &rules[i].To} {
+			s, ok := m[key].(string)
+			if !ok || !strings.HasPrefix(s, "/") {
+				return nil, badConfig(fmt.Sprintf("%s[%d].%s", path, i, key))
+			}
+			*field = s
+		}
+		if t, ok := m["tenant"]; ok {
+			if rules[i].Tenant, ok = t.(string); !ok {
+				return nil, badConfig(fmt.Sprintf("%s[%d].tenant", path, i))
+			}
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,54 @@
+package etcd
+
+import "testing"
+
+func TestBackendOptions_rewritePrefix(t *testing.T) {
+	SetRewriteRules([]RewriteRule{
+		{From: "/services/", To: "/prod/eu/services/"},
+		{From: "/services/internal/", To: "/prod/eu/internal/"},
+		{From: "/services/", To: "/prod/eu/team-a/", Tenant: "team-a"},
+	})
+	defer SetRewriteRules(nil)
+
+	for _, tc := range []struct {
+		host     string
+		options  BackendOptions
+		expected string
+	}{
+		{host: "/services/api/", expected: "/prod/eu/services/api/"},
+		{host: "//services//api", options: BackendOptions{TrailingSlash: true}, expected: "/prod/eu/services/api/"},
+		{host: "/services/internal/billing/", expected: "/prod/eu/internal/billing/"},
+		{host: "/services/internal/billing/", options: BackendOptions{Tenant: "team-a"}, expected: "/prod/eu/team-a/internal/billing/"},
+		{host: "/services/api/", options: BackendOptions{Tenant: "team-b"}, expected: "/prod/eu/services/api/"},
+		{host: "/registry/api/", expected: "/registry/api/"},
+	} {
+		prefix, err := tc.options.prefix(nil, tc.host)
+		if prefix != tc.expected || err != nil {
+			t.Errorf("unexpected prefix for %s %+v: %s %v", tc.host, tc.options, prefix, err)
+		}
+	}
+}
+
+func TestParseRewriteRules(t *testing.T) {
+	rules, err := parseRewriteRules([]interface{}{
+		map[string]interface{}{"from": "/services/", "to": "/prod/eu/services/"},
+		map[string]interface{}{"from": "/services/", "to": "/prod/eu/team-a/", "tenant": "team-a"},
+	})
+	if err != nil || len(rules) != 2 || rules[1] != (RewriteRule{From: "/services/", To: "/prod/eu/team-a/", Tenant: "team-a"}) {
+		t.Errorf("unexpected rules: %+v %v", rules, err)
+	}
+
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: map[string]interface{}{}, path: Namespace + ".prefix_rewrite"},
+		{cfg: []interface{}{"/services/"}, path: Namespace + ".prefix_rewrite[0]"},
+		{cfg: []interface{}{map[string]interface{}{"from": "/services/", "to": "prod/"}}, path: Namespace + ".prefix_rewrite[0].to"},
+		{cfg: []interface{}{map[string]interface{}{"from": "/services/", "to": "/prod/", "tenant": 1.0}}, path: Namespace + ".prefix_rewrite[0].tenant"},
+	} {
+		if _, err := parseRewriteRules(tc.cfg); err == nil || err.(*ConfigError).Path != tc.path {
+			t.Errorf("unexpected error parsing %v: %v", tc.cfg, err)
+		}
+	}
+}
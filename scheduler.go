@@ -0,0 +1,139 @@
+package etcd
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sync"
+)
+
+// refreshScheduler caps the concurrent reads of the subscribers refreshing their hosts. The reads over
+// the cap wait in a weighted fair queue, so a burst of refreshes (e.g. all the watches firing after a
+// reconnection) neither hits etcd at once nor lets a tenant with hundreds of prefixes delay the others.
+type refreshScheduler struct {
+	mutex   *sync.Mutex
+	limit   int
+	running int
+	// vtime is the virtual time of the queue: the start tag of the last dispatched read
+	vtime   float64
+	finish  map[string]float64
+	waiting refreshQueue
+	seq     uint64
+}
+
+func newRefreshScheduler(limit int) *refreshScheduler {
+	return &refreshScheduler{mutex: &sync.Mutex{}, limit: limit, finish: map[string]float64{}}
+}
+
+// refreshes schedules the reads of the subscribers of the clients without their own refresh concurrency
+var refreshes = newRefreshScheduler(0)
+
+// SetRefreshConcurrency caps the number of subscribers reading their prefix at the same time after the
+// changes notified by their watches. The reads over the cap are queued and served in a weighted fair
+// order: every tenant (or every prefix without a tenant) is a flow, getting a share of the reads
+// proportional to the refresh_weight of its backends. Zero disables it, which is the default. The
+// clients created by New with a refresh_concurrency config schedule the reads of their subscribers on
+// their own.
+func SetRefreshConcurrency(n int) {
+	refreshes.mutex.Lock()
+	refreshes.limit = n
+	refreshes.dispatch()
+	refreshes.mutex.Unlock()
+}
+
+type refreshWaiter struct {
+	start float64
+	tag   float64
+	seq   uint64
+	ready chan struct{}
+	index int
+}
+
+// refreshQueue is a heap of the waiting reads, ordered by their finish tag
+type refreshQueue []*refreshWaiter
+
+func (q refreshQueue) Len() int { return len(q) }
+func (q refreshQueue) Less(i, j int) bool {
+	if q[i].tag != q[j].tag {
+		return q[i].tag < q[j].tag
+	}
+	return q[i].seq < q[j].seq
+}
+func (q refreshQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *refreshQueue) Push(x interface{}) {
+	w := x.(*refreshWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+func (q *refreshQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// acquire waits for a slot for a read of the flow, returning the function releasing it. The weight is 1
+// if it is not positive.
+func (s *refreshScheduler) acquire(ctx context.Context, flow string, weight float64) (func(), error) {
+	s.mutex.Lock()
+	if s.limit <= 0 {
+		s.mutex.Unlock()
+		return func() {}, nil
+	}
+	if weight <= 0 {
+		weight = 1
+	}
+	start := math.Max(s.vtime, s.finish[flow])
+	s.finish[flow] = start + 1/weight
+	s.seq++
+	w := &refreshWaiter{start: start, tag: start + 1/weight, seq: s.seq, ready: make(chan struct{})}
+	heap.Push(&s.waiting, w)
+	s.dispatch()
+	s.mutex.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.release, nil
+	case <-ctx.Done():
+	}
+	s.mutex.Lock()
+	if w.index >= 0 {
+		heap.Remove(&s.waiting, w.index)
+		s.dispatch()
+		s.mutex.Unlock()
+		return nil, ctx.Err()
+	}
+	s.mutex.Unlock()
+	// the slot was granted while giving up
+	s.release()
+	return nil, ctx.Err()
+}
+
+func (s *refreshScheduler) release() {
+	s.mutex.Lock()
+	s.running--
+	s.dispatch()
+	s.mutex.Unlock()
+}
+
+// dispatch grants the free slots to the waiting reads. It must be called with the mutex locked.
+func (s *refreshScheduler) dispatch() {
+	for len(s.waiting) > 0 && (s.limit <= 0 || s.running < s.limit) {
+		w := heap.Pop(&s.waiting).(*refreshWaiter)
+		s.vtime = w.start
+		s.running++
+		close(w.ready)
+	}
+	if len(s.waiting) == 0 {
+		// the tags are relative to the backlog, so they can be reset once it is empty
+		s.vtime = 0
+		s.finish = map[string]float64{}
+	}
+	setMetric(MetricQueuedRefreshes, int64(len(s.waiting)))
+}
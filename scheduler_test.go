@@ -0,0 +1,78 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRefreshScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	SetRefreshConcurrency(1)
+	defer SetRefreshConcurrency(0)
+
+	release, err := refreshes.acquire(ctx, "x", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := func() int64 { return Metrics()[MetricQueuedRefreshes] }
+	order := make(chan string, 5)
+	for i, w := range []struct {
+		name   string
+		flow   string
+		weight float64
+	}{
+		{name: "a1", flow: "a"},
+		{name: "a2", flow: "a"},
+		{name: "b1", flow: "b", weight: 2},
+		{name: "b2", flow: "b", weight: 2},
+		{name: "b3", flow: "b", weight: 2},
+	} {
+		go func(name, flow string, weight float64) {
+			release, err := refreshes.acquire(ctx, flow, weight)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- name
+			release()
+		}(w.name, w.flow, w.weight)
+		for queued() != int64(i+1) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// a flow waiting for a slot can give up
+	abandoned, stop := context.WithCancel(ctx)
+	stop()
+	if _, err := refreshes.acquire(abandoned, "c", 1); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if v := queued(); v != 5 {
+		t.Errorf("unexpected queued reads: %d", v)
+	}
+
+	release()
+	names := []string{}
+	for i := 0; i < 5; i++ {
+		names = append(names, <-order)
+	}
+	// the flow b has twice the share of the flow a
+	if expected := []string{"b1", "a1", "b2", "b3", "a2"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected order: %v", names)
+	}
+	if v := queued(); v != 0 {
+		t.Errorf("unexpected queued reads: %d", v)
+	}
+}
+
+func TestRefreshScheduler_disabled(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		if _, err := refreshes.acquire(context.Background(), "a", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Schema is a compiled JSON Schema used for validating the JSON entries. It supports the subset of
+// keywords relevant for the registry records: type, required, properties, additionalProperties
+// (as a boolean), enum, minimum, maximum, minLength, maxLength, pattern, items (as a single schema),
+// minItems and maxItems, besides the annotations ($schema, $id, $comment, title, description, default
+// and examples). Any other keyword fails the compilation, instead of accepting the entries it should
+// reject.
+type Schema struct {
+	source               string
+	types                []string
+	required             []string
+	properties           map[string]*Schema
+	additionalProperties *bool
+	enum                 []interface{}
+	minimum              *float64
+	maximum              *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+	items                *Schema
+	minItems             *int
+	maxItems             *int
+}
+
+// CompileSchema parses the received JSON Schema document
+func CompileSchema(raw []byte) (*Schema, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse the json schema: %s", err.Error())
+	}
+	s, err := compileSchema(doc, "#")
+	if err != nil {
+		return nil, err
+	}
+	s.source = string(raw)
+	return s, nil
+}
+
+// String returns the source of the schema
+func (s *Schema) String() string {
+	return s.source
+}
+
+// canonical returns the source of the schema with its keys sorted and without spaces, so the same schema
+// is identified by the same string in every process
+func (s *Schema) canonical() string {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(s.source), &doc); err != nil {
+		return s.source
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return s.source
+	}
+	return string(b)
+}
+
+// schemaKeywords are the keywords accepted by compileSchema. The annotations do not affect the validation.
+var schemaKeywords = map[string]bool{
+	"type": true, "required": true, "properties": true, "additionalProperties": true, "enum": true,
+	"minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+	"items": true, "minItems": true, "maxItems": true,
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true,
+	"examples": true,
+}
+
+func compileSchema(doc map[string]interface{}, path string) (*Schema, error) {
+	s := &Schema{}
+
+	unsupported := []string{}
+	for keyword := range doc {
+		if !schemaKeywords[keyword] {
+			unsupported = append(unsupported, keyword)
+		}
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, fmt.Errorf("%s/%s: unsupported keyword", path, unsupported[0])
+	}
+
+	switch t := doc["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/type: bad type definition", path)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("%s/type: bad type definition", path)
+	}
+
+	if r, ok := doc["required"].([]interface{}); ok {
+		for _, v := range r {
+			if name, ok := v.(string); ok {
+				s.required = append(s.required, name)
+			}
+		}
+	}
+
+	if props, ok := doc["properties"].(map[string]interface{}); ok {
+		s.properties = make(map[string]*Schema, len(props))
+		for name, p := range props {
+			pdoc, ok := p.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s/properties/%s: bad schema", path, name)
+			}
+			ps, err := compileSchema(pdoc, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = ps
+		}
+	}
+
+	switch ap := doc["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		s.additionalProperties = &ap
+	default:
+		return nil, fmt.Errorf("%s/additionalProperties: unsupported schema, only booleans are supported", path)
+	}
+
+	if e, ok := doc["enum"].([]interface{}); ok {
+		s.enum = e
+	}
+
+	s.minimum = schemaFloat(doc, "minimum")
+	s.maximum = schemaFloat(doc, "maximum")
+	s.minLength = schemaInt(doc, "minLength")
+	s.maxLength = schemaInt(doc, "maxLength")
+	s.minItems = schemaInt(doc, "minItems")
+	s.maxItems = schemaInt(doc, "maxItems")
+
+	if p, ok := doc["pattern"].(string); ok {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s/pattern: %s", path, err.Error())
+		}
+		s.pattern = re
+	}
+
+	switch items := doc["items"].(type) {
+	case nil:
+	case map[string]interface{}:
+		is, err := compileSchema(items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		s.items = is
+	default:
+		return nil, fmt.Errorf("%s/items: unsupported schema, only a single schema is supported", path)
+	}
+
+	return s, nil
+}
+
+func schemaFloat(doc map[string]interface{}, key string) *float64 {
+	if v, ok := doc[key].(float64); ok {
+		return &v
+	}
+	return nil
+}
+
+func schemaInt(doc map[string]interface{}, key string) *int {
+	if v, ok := doc[key].(float64); ok {
+		i := int(v)
+		return &i
+	}
+	return nil
+}
+
+// Validate checks the decoded JSON value against the schema
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate(v, "#")
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	if len(s.types) > 0 && !s.matchesType(v) {
+		return fmt.Errorf("%s: expected %s", path, strings.Join(s.types, " or "))
+	}
+
+	if len(s.enum) > 0 {
+		found := false
+		for _, e := range s.enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not allowed", path)
+		}
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return s.validateObject(t, path)
+	case []interface{}:
+		return s.validateArray(t, path)
+	case string:
+		return s.validateString(t, path)
+	case float64:
+		if s.minimum != nil && t < *s.minimum {
+			return fmt.Errorf("%s: lower than %v", path, *s.minimum)
+		}
+		if s.maximum != nil && t > *s.maximum {
+			return fmt.Errorf("%s: greater than %v", path, *s.maximum)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, path string) error {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required property %s", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ps, ok := s.properties[name]
+		if !ok {
+			if s.additionalProperties != nil && !*s.additionalProperties {
+				return fmt.Errorf("%s: additional property %s not allowed", path, name)
+			}
+			continue
+		}
+		if err := ps.validate(obj[name], path+"/"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(arr []interface{}, path string) error {
+	if s.minItems != nil && len(arr) < *s.minItems {
+		return fmt.Errorf("%s: less than %d items", path, *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		return fmt.Errorf("%s: more than %d items", path, *s.maxItems)
+	}
+	if s.items == nil {
+		return nil
+	}
+	for i, item := range arr {
+		if err := s.items.validate(item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateString(str, path string) error {
+	l := len([]rune(str))
+	if s.minLength != nil && l < *s.minLength {
+		return fmt.Errorf("%s: shorter than %d", path, *s.minLength)
+	}
+	if s.maxLength != nil && l > *s.maxLength {
+		return fmt.Errorf("%s: longer than %d", path, *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		return fmt.Errorf("%s: does not match %s", path, s.pattern.String())
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	for _, t := range s.types {
+		switch t {
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := v.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package etcd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["host", "port"],
+	"additionalProperties": false,
+	"properties": {
+		"host": {"type": "string", "minLength": 1, "pattern": "^[a-z0-9.:\\[\\]-]+$"},
+		"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+		"scheme": {"enum": ["http", "https"]},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+	}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := CompileSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		doc   string
+		valid bool
+	}{
+		{`{"host":"10.0.0.1","port":8080}`, true},
+		{`{"host":"10.0.0.1","port":8080,"scheme":"https","tags":["a","b"]}`, true},
+		{`{"host":"10.0.0.1"}`, false},
+		{`{"host":"","port":8080}`, false},
+		{`{"host":"10.0.0.1","port":80.5}`, false},
+		{`{"host":"10.0.0.1","port":70000}`, false},
+		{`{"host":"10.0.0.1","port":0}`, false},
+		{`{"host":"10.0.0.1","port":8080,"scheme":"ftp"}`, false},
+		{`{"host":"10.0.0.1","port":8080,"tags":["a","b","c"]}`, false},
+		{`{"host":"10.0.0.1","port":8080,"tags":[1]}`, false},
+		{`{"host":"10.0.0.1","port":8080,"weight":1}`, false},
+		{`{"host":"HOST","port":8080}`, false},
+		{`["10.0.0.1"]`, false},
+		{`null`, false},
+	} {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(tc.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Validate(doc); (err == nil) != tc.valid {
+			t.Errorf("unexpected validation result for %s: %v", tc.doc, err)
+		}
+	}
+}
+
+func TestCompileSchema_ko(t *testing.T) {
+	for _, doc := range []string{
+		`not a json`,
+		`{"type": 1}`,
+		`{"type": [1]}`,
+		`{"properties": {"host": 1}}`,
+		`{"pattern": "("}`,
+		`{"items": {"pattern": "("}}`,
+	} {
+		if _, err := CompileSchema([]byte(doc)); err == nil {
+			t.Errorf("expecting an error compiling %s", doc)
+		}
+	}
+}
+
+func TestCompileSchema_unsupported(t *testing.T) {
+	for doc, expected := range map[string]string{
+		`{"$ref": "#/definitions/host"}`:                   "#/$ref: unsupported keyword",
+		`{"oneOf": [{"type": "string"}]}`:                  "#/oneOf: unsupported keyword",
+		`{"properties": {"host": {"format": "hostname"}}}`: "#/properties/host/format: unsupported keyword",
+		`{"items": {"const": "a"}}`:                        "#/items/const: unsupported keyword",
+		`{"additionalProperties": {"type": "string"}}`:     "#/additionalProperties: unsupported schema, only booleans are supported",
+		`{"items": [{"type": "string"}]}`:                  "#/items: unsupported schema, only a single schema is supported",
+	} {
+		_, err := CompileSchema([]byte(doc))
+		if err == nil || err.Error() != expected {
+			t.Errorf("unexpected error compiling %s: %v", doc, err)
+		}
+	}
+	if _, err := CompileSchema([]byte(`{"$schema": "http://json-schema.org/draft-07/schema#", "title": "host", "type": "object"}`)); err != nil {
+		t.Errorf("the annotations should be accepted: %v", err)
+	}
+}
+
+func TestDecodeEntry_schema(t *testing.T) {
+	s, err := CompileSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := ClientOptions{EntryFormat: EntryFormatJSON, EntrySchema: s}
+
+	before := Metrics()[MetricRejectedEntries]
+	if host, ok := decodeURL(options, "/services/api/1", `{"host":"10.0.0.1","port":8080}`); !ok || host != "10.0.0.1:8080" {
+		t.Errorf("unexpected result: %s, %v", host, ok)
+	}
+	if _, ok := decodeURL(options, "/services/api/2", `{"host":"10.0.0.1","port":"8080"}`); ok {
+		t.Error("the entry should be rejected")
+	}
+	if rejected := Metrics()[MetricRejectedEntries] - before; rejected != 1 {
+		t.Errorf("unexpected number of rejected entries: %d", rejected)
+	}
+}
+
+func TestParseOptions_schema(t *testing.T) {
+	options, err := parseOptionsMap(map[string]interface{}{
+		"entry_format": "json",
+		"entry_schema": map[string]interface{}{"type": "object", "required": []interface{}{"host"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.EntrySchema == nil {
+		t.Fatal("the schema has not been parsed")
+	}
+
+	if _, err := parseOptionsMap(map[string]interface{}{"entry_schema_file": "unknown.json"}); err == nil {
+		t.Error("expecting an error loading an unknown schema file")
+	}
+	if _, err := parseOptionsMap(map[string]interface{}{"entry_schema": map[string]interface{}{"pattern": "("}}); err == nil {
+		t.Error("expecting an error compiling a bad schema")
+	}
+}
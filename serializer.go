@@ -0,0 +1,161 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Instance is an instance registered into etcd, like the gateway itself or the services published by the
+// Kubernetes bridge
+type Instance struct {
+	// Name is the name of the service of the instance. e.g. "api-gateway"
+	Name string
+	// ID identifies the instance among the ones of its service. e.g. its hostname
+	ID string
+	// URL is the address of the instance. e.g. "http://10.0.0.1:8080"
+	URL string
+	// Version is the version of the software running in the instance, if known
+	Version string
+	// Build identifies the build of the software running in the instance, if known
+	Build string
+	// Metadata contains extra information about the instance
+	Metadata map[string]string
+}
+
+// Serializer encodes an instance into the value of its entry
+type Serializer interface {
+	Encode(Instance) ([]byte, error)
+}
+
+// SerializerFunc is a function implementing the Serializer interface
+type SerializerFunc func(Instance) ([]byte, error)
+
+// Encode implements the Serializer interface
+func (f SerializerFunc) Encode(i Instance) ([]byte, error) { return f(i) }
+
+// ErrUnknownSerializer is the error returned when encoding an instance with an entry format without a
+// registered serializer
+var ErrUnknownSerializer = fmt.Errorf("unknown etcd entry serializer")
+
+var (
+	serializers = map[string]Serializer{
+		EntryFormatRaw:     SerializerFunc(encodeRaw),
+		EntryFormatJSON:    SerializerFunc(encodeJSON),
+		EntryFormatGoMicro: SerializerFunc(encodeGoMicro),
+	}
+	serializersMutex = &sync.RWMutex{}
+)
+
+// RegisterSerializer registers a serializer for the entry format with the given name, replacing any
+// previous one, so the registrations can be written in the format already read by other tools sharing the
+// etcd tree. The codec decoding the format can be registered with RegisterCodec.
+func RegisterSerializer(name string, s Serializer) {
+	serializersMutex.Lock()
+	serializers[name] = s
+	serializersMutex.Unlock()
+}
+
+func getSerializer(name string) (Serializer, bool) {
+	if name == "" {
+		name = EntryFormatRaw
+	}
+	serializersMutex.RLock()
+	s, ok := serializers[name]
+	serializersMutex.RUnlock()
+	return s, ok
+}
+
+// EncodeInstance returns the value describing the instance in the entry format (raw by default)
+func EncodeInstance(format string, i Instance) (string, error) {
+	s, ok := getSerializer(format)
+	if !ok {
+		return "", ErrUnknownSerializer
+	}
+	b, err := s.Encode(i)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// RegisterInstance stores the instance under the key, encoded in the entry format (raw by default).
+// If the ttl is not zero, the entry will be removed by etcd once it expires.
+func RegisterInstance(r Registrar, key, format string, i Instance, ttl time.Duration) error {
+	value, err := EncodeInstance(format, i)
+	if err != nil {
+		return err
+	}
+	return r.Register(key, value, ttl)
+}
+
+func encodeRaw(i Instance) ([]byte, error) {
+	if i.URL == "" {
+		return nil, ErrBadRecord
+	}
+	return []byte(i.URL), nil
+}
+
+// instanceRecord is the json record of an instance, readable by the json entry format. The version,
+// the build, the name and the id of the instance are stored in its metadata.
+type instanceRecord struct {
+	Host     string            `json:"host"`
+	Port     json.Number       `json:"port,omitempty"`
+	Scheme   string            `json:"scheme,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func encodeJSON(i Instance) ([]byte, error) {
+	scheme, host, port := splitInstanceURL(i.URL)
+	if host == "" {
+		return nil, ErrBadRecord
+	}
+	metadata := map[string]string{}
+	for k, v := range i.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range map[string]string{"name": i.Name, "id": i.ID, "version": i.Version, "build": i.Build} {
+		if v != "" {
+			metadata[k] = v
+		}
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return json.Marshal(instanceRecord{Host: host, Port: json.Number(port), Scheme: scheme, Metadata: metadata})
+}
+
+// encodeGoMicro encodes the instance as a service record of the go-micro etcd registry, with a single
+// node. The scheme is stored as the protocol of the node and the build in the service metadata.
+func encodeGoMicro(i Instance) ([]byte, error) {
+	scheme, host, port := splitInstanceURL(i.URL)
+	if host == "" {
+		return nil, ErrBadRecord
+	}
+	node := microNode{ID: i.ID, Address: joinAuthority(host, port), Metadata: map[string]string{}}
+	for k, v := range i.Metadata {
+		node.Metadata[k] = v
+	}
+	if scheme != "" {
+		node.Metadata["protocol"] = scheme
+	}
+	s := microService{Name: i.Name, Version: i.Version, Metadata: map[string]string{}, Nodes: []microNode{node}}
+	if i.Build != "" {
+		s.Metadata["build"] = i.Build
+	}
+	return json.Marshal(s)
+}
+
+// splitInstanceURL returns the scheme, the host and the port of the url of an instance. The scheme is
+// optional. e.g. "10.0.0.1:8080"
+func splitInstanceURL(u string) (string, string, string) {
+	scheme := ""
+	if i := strings.Index(u, "://"); i >= 0 {
+		scheme, u = u[:i], u[i+3:]
+	}
+	u = strings.TrimRight(u, "/")
+	host, port := splitAuthority(u)
+	return scheme, host, port
+}
@@ -0,0 +1,83 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeInstance_roundTrip(t *testing.T) {
+	i := Instance{
+		Name:     "gateway",
+		ID:       "gw-1",
+		URL:      "http://10.0.0.1:8080",
+		Version:  "2.1.0",
+		Build:    "abc123",
+		Metadata: map[string]string{"zone": "a"},
+	}
+	for _, tc := range []struct {
+		format   string
+		metadata map[string]interface{}
+	}{
+		{format: EntryFormatRaw},
+		{
+			format:   EntryFormatJSON,
+			metadata: map[string]interface{}{"zone": "a", "name": "gateway", "id": "gw-1", "version": "2.1.0", "build": "abc123"},
+		},
+		{
+			format:   EntryFormatGoMicro,
+			metadata: map[string]interface{}{"zone": "a", "protocol": "http", "build": "abc123", "id": "gw-1"},
+		},
+	} {
+		value, err := EncodeInstance(tc.format, i)
+		if err != nil {
+			t.Errorf("%s: %v", tc.format, err)
+			continue
+		}
+		codec, _ := getCodec(tc.format)
+		hosts, err := codec.Decode([]byte(value))
+		if err != nil || len(hosts) != 1 {
+			t.Errorf("%s: unexpected decoding of %s: %v %v", tc.format, value, hosts, err)
+			continue
+		}
+		if hosts[0].URL != i.URL || !reflect.DeepEqual(hosts[0].Metadata, tc.metadata) {
+			t.Errorf("%s: unexpected host: %+v", tc.format, hosts[0])
+		}
+	}
+
+	if _, err := EncodeInstance("unknown", i); err != ErrUnknownSerializer {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := EncodeInstance(EntryFormatJSON, Instance{Name: "gateway"}); err != ErrBadRecord {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRegisterInstance(t *testing.T) {
+	RegisterSerializer("name", SerializerFunc(func(i Instance) ([]byte, error) { return []byte(i.Name), nil }))
+	defer func() {
+		serializersMutex.Lock()
+		delete(serializers, "name")
+		serializersMutex.Unlock()
+	}()
+
+	r := &recordingRegistrar{}
+	if err := RegisterInstance(r, "/gateways/gw-1", "name", Instance{Name: "gateway"}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if r.key != "/gateways/gw-1" || r.value != "gateway" || r.ttl != time.Second {
+		t.Errorf("unexpected registration: %+v", r)
+	}
+}
+
+type recordingRegistrar struct {
+	key, value string
+	ttl        time.Duration
+}
+
+func (r *recordingRegistrar) Register(key, value string, ttl time.Duration) error {
+	r.key, r.value, r.ttl = key, value, ttl
+	return nil
+}
+
+func (*recordingRegistrar) Deregister(string) error { return nil }
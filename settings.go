@@ -0,0 +1,191 @@
+package etcd
+
+import "time"
+
+// clientSettings are the settings of a client and its subscribers declared in the extra config read by
+// New: prefix_rewrite, jitter, backoff, load_shedding, cache, encryption, refresh_concurrency, tenants
+// and warm_restart. They are carried by the ClientOptions of the client, so its scoped copies and the
+// clients of its clusters keep them, and the clients created by New from different configs do not
+// override each other. The ones not declared (nil) fall back on the process defaults set with the
+// package setters (SetRewriteRules, SetJitter, SetBackoff...), as the clients created without New.
+type clientSettings struct {
+	rewriteRules []RewriteRule
+	jitter       *float64
+	backoff      Backoff
+	shedder      *loadShedder
+	cache        *cacheSettings
+	keys         *keyRing
+	refreshes    *refreshScheduler
+	tenants      *tenantRegistry
+	warmRestarts *warmRestarts
+}
+
+// cacheSettings are the shared cache of a client and the ttl of its entries
+type cacheSettings struct {
+	cache Cache
+	ttl   time.Duration
+}
+
+// parseSettings parses the settings declared in the extra config of the client
+func parseSettings(cfg map[string]interface{}) (*clientSettings, error) {
+	s := &clientSettings{}
+
+	if o, ok := cfg["jitter"]; ok {
+		fraction, ok := o.(float64)
+		if !ok || fraction < 0 || fraction > 1 {
+			return nil, badConfig(Namespace + ".jitter")
+		}
+		s.jitter = &fraction
+	}
+
+	if o, ok := cfg["backoff"]; ok {
+		b, err := parseBackoff(o)
+		if err != nil {
+			return nil, err
+		}
+		s.backoff = b
+	}
+
+	if o, ok := cfg["load_shedding"]; ok {
+		threshold, cooldown, err := parseLoadShedding(o)
+		if err != nil {
+			return nil, err
+		}
+		s.shedder = newLoadShedder(threshold, cooldown)
+	}
+
+	if o, ok := cfg["cache"]; ok {
+		c, ttl, err := parseCache(o)
+		if err != nil {
+			return nil, err
+		}
+		if ttl <= 0 {
+			ttl = DefaultCacheTTL
+		}
+		s.cache = &cacheSettings{cache: c, ttl: ttl}
+	}
+
+	if o, ok := cfg["encryption"]; ok {
+		k, err := parseKeyManager(o)
+		if err != nil {
+			return nil, err
+		}
+		s.keys = newKeyRing(k)
+	}
+
+	if o, ok := cfg["refresh_concurrency"]; ok {
+		n, ok := o.(float64)
+		if !ok || n < 0 {
+			return nil, badConfig(Namespace + ".refresh_concurrency")
+		}
+		s.refreshes = newRefreshScheduler(int(n))
+	}
+
+	if o, ok := cfg["tenants"]; ok {
+		quotas, err := parseTenantQuotas(o)
+		if err != nil {
+			return nil, err
+		}
+		s.tenants = newTenantRegistry(quotas)
+	}
+
+	if o, ok := cfg["prefix_rewrite"]; ok {
+		rules, err := parseRewriteRules(o)
+		if err != nil {
+			return nil, err
+		}
+		s.rewriteRules = rules
+	}
+
+	if o, ok := cfg["warm_restart"]; ok {
+		window, threshold, priority, err := parseWarmRestart(o)
+		if err != nil {
+			return nil, err
+		}
+		s.warmRestarts = newWarmRestarts(window, threshold, priority)
+	}
+
+	return s, nil
+}
+
+// settingsOf returns the settings of the client, or nil if it has none, so the process defaults apply
+func settingsOf(c Client) *clientSettings {
+	_, options := clientIdentity(c)
+	return options.settings
+}
+
+// prefix applies the rewrite rule matching the prefix of the tenant, if any
+func (s *clientSettings) prefix(tenant, prefix string) string {
+	if s == nil || s.rewriteRules == nil {
+		return rewritePrefix(getRewriteRules(), tenant, prefix)
+	}
+	return rewritePrefix(s.rewriteRules, tenant, prefix)
+}
+
+// jitterOf returns the received period plus a random fraction of it, up to the jitter of the settings
+func (s *clientSettings) jitterOf(d time.Duration) time.Duration {
+	if s == nil || s.jitter == nil {
+		return Jitter(d)
+	}
+	return jitterWith(*s.jitter, d)
+}
+
+// delay returns the delay before the retry number attempt with the backoff and the jitter of the settings
+func (s *clientSettings) delay(attempt int, previous time.Duration) time.Duration {
+	b := GetBackoff()
+	if s != nil && s.backoff != nil {
+		b = s.backoff
+	}
+	if jb, ok := b.(jitteredBackoff); ok {
+		return jb.delay(attempt, previous, s.jitterOf)
+	}
+	return b.Delay(attempt, previous)
+}
+
+// loadShedder returns the load shedder tracking the reads of the subscribers
+func (s *clientSettings) loadShedder() *loadShedder {
+	if s == nil || s.shedder == nil {
+		return shedder
+	}
+	return s.shedder
+}
+
+// sharedCache returns the cache shared by the subscribers, if any, and the ttl of its entries
+func (s *clientSettings) sharedCache() (Cache, time.Duration) {
+	if s == nil || s.cache == nil {
+		return getCache()
+	}
+	return s.cache.cache, s.cache.ttl
+}
+
+// keyRing returns the key ring decrypting the encrypted values
+func (s *clientSettings) keyRing() *keyRing {
+	if s == nil || s.keys == nil {
+		return dataKeyRing
+	}
+	return s.keys
+}
+
+// scheduler returns the scheduler of the queued reads of the subscribers
+func (s *clientSettings) scheduler() *refreshScheduler {
+	if s == nil || s.refreshes == nil {
+		return refreshes
+	}
+	return s.refreshes
+}
+
+// tenantRegistry returns the quotas and the usage of the tenants of the subscribers
+func (s *clientSettings) tenantRegistry() *tenantRegistry {
+	if s == nil || s.tenants == nil {
+		return tenants
+	}
+	return s.tenants
+}
+
+// warmRestarter returns the tracker of the restarts of the watches of the subscribers
+func (s *clientSettings) warmRestarter() *warmRestarts {
+	if s == nil || s.warmRestarts == nil {
+		return warmRestarter
+	}
+	return s.warmRestarts
+}
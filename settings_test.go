@@ -0,0 +1,67 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNew_settingsPerClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	newTestClient := func(root, period string) Client {
+		c, err := New(ctx, map[string]interface{}{
+			Namespace: map[string]interface{}{
+				"machines":       []interface{}{"http://127.0.0.1:2379"},
+				"jitter":         0.0,
+				"backoff":        map[string]interface{}{"strategy": "constant", "base": period},
+				"prefix_rewrite": []interface{}{map[string]interface{}{"from": "/services/", "to": root}},
+				"tenants":        map[string]interface{}{"team-a": map[string]interface{}{"max_watches": 1.0}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	eu := newTestClient("/eu/services/", "1s")
+	us := newTestClient("/us/services/", "2s")
+
+	for _, tc := range []struct {
+		client   Client
+		prefix   string
+		delay    time.Duration
+		expected string
+	}{
+		{client: eu, delay: time.Second, expected: "/eu/services/api/"},
+		{client: us, delay: 2 * time.Second, expected: "/us/services/api/"},
+		// the scoped copies keep the settings of their client
+		{client: BackendOptions{Overrides: ClientOptions{Consistency: ConsistencySerializable}}.scope(eu), delay: time.Second, expected: "/eu/services/api/"},
+	} {
+		if prefix, err := (BackendOptions{}).prefix(tc.client, "/services/api/"); err != nil || prefix != tc.expected {
+			t.Errorf("unexpected prefix: %s %v", prefix, err)
+		}
+		if d := (&retrier{settings: settingsOf(tc.client)}).next(); d != tc.delay {
+			t.Errorf("unexpected delay: %v", d)
+		}
+		if s := newSubscriber(ctx, tc.client, tc.expected, BackendOptions{}); s.settings != settingsOf(tc.client) {
+			t.Error("the subscriber should use the settings of its client")
+		}
+	}
+
+	// the quotas of the tenants are tracked by client
+	for _, c := range []Client{eu, us} {
+		if err := settingsOf(c).tenantRegistry().acquire("team-a", "/services/api/"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	// the process defaults are not modified
+	if prefix, err := (BackendOptions{}).prefix(nil, "/services/api/"); err != nil || prefix != "/services/api/" {
+		t.Errorf("unexpected prefix: %s %v", prefix, err)
+	}
+	if _, ok := GetBackoff().(ExponentialBackoff); !ok {
+		t.Errorf("unexpected backoff: %T", GetBackoff())
+	}
+}
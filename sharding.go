@@ -0,0 +1,99 @@
+package etcd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultShardFormat is the format of the sub-prefixes of a sharded prefix, applied to the shard index
+const DefaultShardFormat = "shard-%02d"
+
+// ShardedClient is a Client reading the entries of a prefix from a set of sharded sub-prefixes
+// (e.g. /services/api/shard-00 ... /services/api/shard-15) with parallel requests, merging the
+// results. The watches are delegated to the parent prefix, since it contains all the shards.
+type ShardedClient struct {
+	Client
+	// Shards is the number of sub-prefixes
+	Shards int
+	// Format is the format of the sub-prefixes. DefaultShardFormat is used if empty
+	Format string
+	// Parallelism is the maximum number of concurrent requests. All the shards are requested
+	// at once if it is not positive
+	Parallelism int
+}
+
+// NewShardedClient returns a ShardedClient wrapping the received client
+func NewShardedClient(c Client, shards int, format string, parallelism int) *ShardedClient {
+	return &ShardedClient{
+		Client:      c,
+		Shards:      shards,
+		Format:      format,
+		Parallelism: parallelism,
+	}
+}
+
+// GetEntries implements the etcd Client interface. If any shard fails, the error is returned
+// instead of a partial set of entries.
+func (c *ShardedClient) GetEntries(prefix string) ([]string, error) {
+	hosts, err := c.GetHosts(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return hostURLs(hosts), nil
+}
+
+// GetHosts implements the etcd HostsClient interface.
+func (c *ShardedClient) GetHosts(prefix string) ([]Host, error) {
+	hosts, _, err := c.GetHostsWithRevision(prefix)
+	return hosts, err
+}
+
+// GetHostsWithRevision implements the etcd RevisionClient interface. The revision is the highest one
+// of the shards.
+func (c *ShardedClient) GetHostsWithRevision(prefix string) ([]Host, int64, error) {
+	if c.Shards <= 0 {
+		return getHosts(c.Client, prefix)
+	}
+
+	format := c.Format
+	if format == "" {
+		format = DefaultShardFormat
+	}
+	parallelism := c.Parallelism
+	if parallelism <= 0 || parallelism > c.Shards {
+		parallelism = c.Shards
+	}
+
+	results := make([][]Host, c.Shards)
+	revisions := make([]int64, c.Shards)
+	errs := make([]error, c.Shards)
+	sem := make(chan struct{}, parallelism)
+	wg := &sync.WaitGroup{}
+	base := strings.TrimRight(prefix, "/")
+	for i := 0; i < c.Shards; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], revisions[i], errs[i] = getHosts(c.Client, fmt.Sprintf("%s/"+format+"/", base, i))
+		}(i)
+	}
+	wg.Wait()
+
+	entries := []Host{}
+	var revision int64
+	for i, r := range results {
+		if errs[i] != nil {
+			return nil, 0, errs[i]
+		}
+		entries = append(entries, r...)
+		if revisions[i] > revision {
+			revision = revisions[i]
+		}
+	}
+	return entries, revision, nil
+}
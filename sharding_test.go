@@ -0,0 +1,79 @@
+package etcd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedClient_GetEntries(t *testing.T) {
+	var current, max int64
+	mutex := &sync.Mutex{}
+	prefixes := []string{}
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) {
+			n := atomic.AddInt64(&current, 1)
+			defer atomic.AddInt64(&current, -1)
+			mutex.Lock()
+			prefixes = append(prefixes, prefix)
+			if n > max {
+				max = n
+			}
+			mutex.Unlock()
+			<-time.After(10 * time.Millisecond)
+			return []string{prefix + "host"}, nil
+		},
+	}
+
+	entries, err := NewShardedClient(c, 4, "", 2).GetEntries("/services/api/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/services/api/shard-00/host",
+		"/services/api/shard-01/host",
+		"/services/api/shard-02/host",
+		"/services/api/shard-03/host",
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+	sort.Strings(prefixes)
+	if len(prefixes) != 4 || prefixes[0] != "/services/api/shard-00/" {
+		t.Errorf("unexpected requested prefixes: %v", prefixes)
+	}
+	if max > 2 {
+		t.Errorf("the parallelism has not been respected: %d", max)
+	}
+}
+
+func TestShardedClient_GetEntries_ko(t *testing.T) {
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) {
+			if prefix == "/services/api/s1/" {
+				return nil, fmt.Errorf("random fail")
+			}
+			return []string{"host"}, nil
+		},
+	}
+	if _, err := NewShardedClient(c, 3, "s%d", 0).GetEntries("/services/api"); err == nil {
+		t.Error("expecting error")
+	}
+}
+
+func TestShardedClient_noShards(t *testing.T) {
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) { return []string{prefix}, nil },
+	}
+	entries, err := NewShardedClient(c, 0, "", 0).GetEntries("/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []string{"/services/api"}) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
@@ -0,0 +1,142 @@
+package etcd
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultShedCooldown is the default period the subscribers serve their cached hosts once the latency
+// of the reads exceeds the load shedding threshold
+const DefaultShedCooldown = 30 * time.Second
+
+const (
+	// shedWindow is the number of reads the p99 latency is computed over
+	shedWindow = 100
+	// shedMinSamples is the number of reads required before entering the load shedding mode
+	shedMinSamples = 20
+)
+
+// loadShedder tracks the latency of the reads of the subscribers. When the p99 exceeds the threshold,
+// the reads triggered by the watches are deferred until the end of the cooldown.
+type loadShedder struct {
+	mutex     *sync.Mutex
+	threshold time.Duration
+	cooldown  time.Duration
+	samples   []time.Duration
+	next      int
+	until     time.Time
+}
+
+func newLoadShedder(threshold, cooldown time.Duration) *loadShedder {
+	l := &loadShedder{mutex: &sync.Mutex{}}
+	l.set(threshold, cooldown)
+	return l
+}
+
+// shedder tracks the reads of the subscribers of the clients without their own load shedding
+var shedder = newLoadShedder(0, 0)
+
+// SetLoadShedding enables the load shedding mode of the subscribers. When the p99 latency of their reads
+// exceeds the threshold, they stop reading the changes notified by the watches and serve their cached
+// hosts during the cooldown (DefaultShedCooldown if zero), protecting the latency of the requests from a
+// slow registry. The watches keep running, so the pending changes are read once the cooldown ends. A zero
+// threshold disables it, which is the default. The clients created by New with a load_shedding config
+// track the reads of their subscribers on their own.
+func SetLoadShedding(threshold, cooldown time.Duration) {
+	shedder.set(threshold, cooldown)
+	setMetric(MetricShedding, 0)
+}
+
+// set replaces the threshold and the cooldown, restarting the tracking of the reads
+func (l *loadShedder) set(threshold, cooldown time.Duration) {
+	if cooldown <= 0 {
+		cooldown = DefaultShedCooldown
+	}
+	l.mutex.Lock()
+	l.threshold = threshold
+	l.cooldown = cooldown
+	l.samples = l.samples[:0]
+	l.next = 0
+	l.until = time.Time{}
+	l.mutex.Unlock()
+}
+
+// parseLoadShedding parses the load_shedding config: {"p99": "500ms", "cooldown": "30s"}
+func parseLoadShedding(v interface{}) (time.Duration, time.Duration, error) {
+	path := Namespace + ".load_shedding"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return 0, 0, badConfig(path)
+	}
+	threshold, err := parseDuration(cfg["p99"])
+	if err != nil || threshold <= 0 {
+		return 0, 0, badConfig(path + ".p99")
+	}
+	var cooldown time.Duration
+	if o, ok := cfg["cooldown"]; ok {
+		if cooldown, err = parseDuration(o); err != nil {
+			return 0, 0, badConfig(path + ".cooldown")
+		}
+	}
+	return threshold, cooldown, nil
+}
+
+// observe records the latency of a read, entering the load shedding mode if the p99 exceeds the threshold
+func (l *loadShedder) observe(latency time.Duration, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.threshold <= 0 {
+		return
+	}
+	if len(l.samples) < shedWindow {
+		l.samples = append(l.samples, latency)
+	} else {
+		l.samples[l.next] = latency
+		l.next = (l.next + 1) % shedWindow
+	}
+	if len(l.samples) < shedMinSamples || now.Before(l.until) {
+		return
+	}
+	p99 := percentile(l.samples, 0.99)
+	if p99 <= l.threshold {
+		return
+	}
+	l.until = now.Add(l.cooldown)
+	// the next decision is based on the reads after the cooldown
+	l.samples = l.samples[:0]
+	l.next = 0
+	setMetric(MetricShedding, 1)
+	getLogger().Warning("etcd: entering the load shedding mode:", "p99="+p99.String(), "cooldown="+l.cooldown.String())
+}
+
+// shedding returns the time remaining until the end of the load shedding mode, or zero if it is not active
+func (l *loadShedder) shedding(now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.until.IsZero() {
+		return 0
+	}
+	if remaining := l.until.Sub(now); remaining > 0 {
+		return remaining
+	}
+	l.until = time.Time{}
+	setMetric(MetricShedding, 0)
+	getLogger().Info("etcd: leaving the load shedding mode")
+	return 0
+}
+
+// percentile returns the received percentile of the samples, without modifying them
+func percentile(samples []time.Duration, p float64) time.Duration {
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,142 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	samples := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	if p := percentile(samples, 0.99); p != 99*time.Millisecond {
+		t.Errorf("unexpected p99: %v", p)
+	}
+	if p := percentile(samples[:10], 0.99); p != 100*time.Millisecond {
+		t.Errorf("unexpected p99: %v", p)
+	}
+	if samples[0] != 100*time.Millisecond {
+		t.Error("the samples have been modified")
+	}
+}
+
+func TestLoadShedder(t *testing.T) {
+	SetLoadShedding(100*time.Millisecond, time.Minute)
+	defer SetLoadShedding(0, 0)
+
+	now := time.Now()
+	for i := 0; i < shedMinSamples-1; i++ {
+		shedder.observe(time.Second, now)
+	}
+	if wait := shedder.shedding(now); wait != 0 {
+		t.Errorf("the shedding mode requires %d samples", shedMinSamples)
+	}
+
+	shedder.observe(time.Second, now)
+	if wait := shedder.shedding(now.Add(time.Second)); wait != 59*time.Second {
+		t.Errorf("unexpected remaining period: %v", wait)
+	}
+	if v := Metrics()[MetricShedding]; v != 1 {
+		t.Errorf("unexpected gauge: %d", v)
+	}
+
+	if wait := shedder.shedding(now.Add(time.Minute)); wait != 0 {
+		t.Errorf("unexpected remaining period: %v", wait)
+	}
+	if v := Metrics()[MetricShedding]; v != 0 {
+		t.Errorf("unexpected gauge: %d", v)
+	}
+
+	for i := 0; i < shedWindow; i++ {
+		shedder.observe(time.Millisecond, now.Add(time.Minute))
+	}
+	if wait := shedder.shedding(now.Add(time.Minute)); wait != 0 {
+		t.Errorf("unexpected remaining period: %v", wait)
+	}
+}
+
+func TestSubscriber_loadShedding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	SetLoadShedding(100*time.Millisecond, time.Minute)
+	defer SetLoadShedding(0, 0)
+
+	mutex := &sync.Mutex{}
+	reads := 0
+	notify := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			reads++
+			return []string{"http://10.0.0.1"}, nil
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			ch <- struct{}{}
+			for range notify {
+				ch <- struct{}{}
+			}
+		},
+	}
+	if _, err := NewSubscriber(ctx, c, "/services/shedding"); err != nil {
+		t.Fatal(err)
+	}
+	// the initial notification of the watch
+	notify <- struct{}{}
+
+	shedder.mutex.Lock()
+	shedder.until = clock.Now().Add(time.Minute)
+	shedder.mutex.Unlock()
+	shed := Metrics()[MetricShedReads]
+
+	// every notification is served once the previous one has been processed
+	for i := 0; i < 4; i++ {
+		notify <- struct{}{}
+	}
+
+	mutex.Lock()
+	before := reads
+	mutex.Unlock()
+	if v := Metrics()[MetricShedReads] - shed; v < 2 {
+		t.Errorf("unexpected deferred reads: %d", v)
+	}
+
+	for i := 0; i < 100; i++ {
+		clock.Advance(time.Minute)
+		mutex.Lock()
+		after := reads
+		mutex.Unlock()
+		if after > before {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the deferred change has not been read")
+}
+
+func TestNew_loadShedding(t *testing.T) {
+	defer SetLoadShedding(0, 0)
+
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "500ms", path: Namespace + ".load_shedding"},
+		{cfg: map[string]interface{}{}, path: Namespace + ".load_shedding.p99"},
+		{cfg: map[string]interface{}{"p99": "500ms", "cooldown": 30}, path: Namespace + ".load_shedding.cooldown"},
+	} {
+		_, err := New(context.Background(), map[string]interface{}{
+			Namespace: map[string]interface{}{"machines": []interface{}{"http://127.0.0.1:2379"}, "load_shedding": tc.cfg},
+		})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+}
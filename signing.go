@@ -0,0 +1,131 @@
+package etcd
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// SignatureEd25519 is the algorithm of the signatures of the Ed25519Signer
+	SignatureEd25519 = "ed25519"
+	// SignatureHMAC is the algorithm of the signatures of the HMACKey
+	SignatureHMAC = "hmac-sha256"
+)
+
+// ErrBadSignature is the error returned when a signed document is not signed or its signature can not be
+// verified
+var ErrBadSignature = errors.New("invalid signature")
+
+// SignatureError is the ErrBadSignature returned along with the revision of the config rejected and the
+// reason, so errors.Is(err, ErrBadSignature) still holds
+type SignatureError struct {
+	Revision int64
+	Reason   string
+}
+
+// Error implements the error interface
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("%s: revision %d: %s", ErrBadSignature.Error(), e.Revision, e.Reason)
+}
+
+// Unwrap returns ErrBadSignature
+func (*SignatureError) Unwrap() error {
+	return ErrBadSignature
+}
+
+// Signature is the signature of a document, stored along with it
+type Signature struct {
+	// KeyID identifies the key signing the document, so the keys can be rotated
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Value     []byte `json:"sig"`
+}
+
+// Signer signs the documents written to etcd, like the configs published to a ConfigStore
+type Signer interface {
+	Sign(data []byte) (Signature, error)
+}
+
+// Verifier verifies the signatures of the documents read from etcd, returning an error describing why a
+// signature is rejected
+type Verifier interface {
+	Verify(data []byte, s Signature) error
+}
+
+// Ed25519Signer signs the documents with an Ed25519 private key. It also verifies them with the public key.
+type Ed25519Signer struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+// Sign implements the Signer interface
+func (s Ed25519Signer) Sign(data []byte) (Signature, error) {
+	if len(s.Key) != ed25519.PrivateKeySize {
+		return Signature{}, errors.New("bad ed25519 private key size")
+	}
+	return Signature{KeyID: s.ID, Algorithm: SignatureEd25519, Value: ed25519.Sign(s.Key, data)}, nil
+}
+
+// Verify implements the Verifier interface
+func (s Ed25519Signer) Verify(data []byte, sig Signature) error {
+	if len(s.Key) != ed25519.PrivateKeySize {
+		return errors.New("bad ed25519 private key size")
+	}
+	return Ed25519Verifier{s.ID: s.Key.Public().(ed25519.PublicKey)}.Verify(data, sig)
+}
+
+// Ed25519Verifier verifies the Ed25519 signatures with the public keys, by key id, so the gateways do not
+// hold the keys able to sign
+type Ed25519Verifier map[string]ed25519.PublicKey
+
+// Verify implements the Verifier interface
+func (v Ed25519Verifier) Verify(data []byte, s Signature) error {
+	if s.Algorithm != SignatureEd25519 {
+		return fmt.Errorf("unexpected algorithm %q", s.Algorithm)
+	}
+	key, ok := v[s.KeyID]
+	if !ok || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("unknown key %q", s.KeyID)
+	}
+	if !ed25519.Verify(key, data, s.Value) {
+		return errors.New("the signature does not match")
+	}
+	return nil
+}
+
+// HMACKey signs and verifies the documents with an HMAC-SHA256 shared key
+type HMACKey struct {
+	ID  string
+	Key []byte
+}
+
+// Sign implements the Signer interface
+func (k HMACKey) Sign(data []byte) (Signature, error) {
+	if len(k.Key) == 0 {
+		return Signature{}, errors.New("empty hmac key")
+	}
+	return Signature{KeyID: k.ID, Algorithm: SignatureHMAC, Value: k.mac(data)}, nil
+}
+
+// Verify implements the Verifier interface
+func (k HMACKey) Verify(data []byte, s Signature) error {
+	if s.Algorithm != SignatureHMAC {
+		return fmt.Errorf("unexpected algorithm %q", s.Algorithm)
+	}
+	if s.KeyID != k.ID || len(k.Key) == 0 {
+		return fmt.Errorf("unknown key %q", s.KeyID)
+	}
+	if !hmac.Equal(k.mac(data), s.Value) {
+		return errors.New("the signature does not match")
+	}
+	return nil
+}
+
+func (k HMACKey) mac(data []byte) []byte {
+	m := hmac.New(sha256.New, k.Key)
+	m.Write(data)
+	return m.Sum(nil)
+}
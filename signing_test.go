@@ -0,0 +1,76 @@
+package etcd
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestEd25519Signer(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := Ed25519Signer{ID: "k1", Key: key}
+	verifier := Ed25519Verifier{"k1": key.Public().(ed25519.PublicKey)}
+	data := []byte(`{"version":3}`)
+
+	sig, err := signer.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.KeyID != "k1" || sig.Algorithm != SignatureEd25519 {
+		t.Errorf("unexpected signature: %+v", sig)
+	}
+	if err := verifier.Verify(data, sig); err != nil {
+		t.Error(err)
+	}
+	if err := signer.Verify(data, sig); err != nil {
+		t.Error(err)
+	}
+
+	for _, tc := range []struct {
+		data []byte
+		sig  Signature
+	}{
+		{data: []byte(`{"version":4}`), sig: sig},
+		{data: data, sig: Signature{KeyID: "k2", Algorithm: SignatureEd25519, Value: sig.Value}},
+		{data: data, sig: Signature{KeyID: "k1", Algorithm: SignatureHMAC, Value: sig.Value}},
+		{data: data, sig: Signature{KeyID: "k1", Algorithm: SignatureEd25519}},
+	} {
+		if err := verifier.Verify(tc.data, tc.sig); err == nil {
+			t.Errorf("the signature %+v should be rejected", tc.sig)
+		}
+	}
+
+	if _, err := (Ed25519Signer{ID: "k1"}).Sign(data); err == nil {
+		t.Error("the signers without a key should fail")
+	}
+}
+
+func TestHMACKey(t *testing.T) {
+	k := HMACKey{ID: "k1", Key: []byte("secret")}
+	data := []byte(`{"version":3}`)
+
+	sig, err := k.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Algorithm != SignatureHMAC || len(sig.Value) != 32 {
+		t.Errorf("unexpected signature: %+v", sig)
+	}
+	if err := k.Verify(data, sig); err != nil {
+		t.Error(err)
+	}
+	if err := k.Verify([]byte(`{"version":4}`), sig); err == nil {
+		t.Error("the tampered data should be rejected")
+	}
+	if err := (HMACKey{ID: "k1", Key: []byte("other")}).Verify(data, sig); err == nil {
+		t.Error("the signatures of other keys should be rejected")
+	}
+	if err := (HMACKey{ID: "k2", Key: []byte("secret")}).Verify(data, sig); err == nil {
+		t.Error("the signatures of unknown key ids should be rejected")
+	}
+	if _, err := (HMACKey{ID: "k1"}).Sign(data); err == nil {
+		t.Error("the empty keys should fail")
+	}
+}
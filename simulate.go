@@ -0,0 +1,58 @@
+package etcd
+
+import (
+	"context"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+// Simulate connects to the registry with a proposed extra config and reports the hosts the subscribers
+// of the prefixes would get, through the same pipeline (rewrite rules, tiers, backend options and
+// hooks), without creating them nor starting any watch, so the CI pipelines can validate the changes of
+// the gateway config against the live registries. As with New, the global settings of the config are
+// applied, so it is meant for the tools running on their own process. The client lives as long as the
+// context.
+func Simulate(ctx context.Context, extra config.ExtraConfig, prefixes []string) (Report, error) {
+	c, err := New(ctx, extra)
+	if err != nil {
+		return nil, err
+	}
+	report := Report{}
+	for _, p := range prefixes {
+		options := BackendOptions{}
+		prefix, err := options.prefix(c, p)
+		if err != nil {
+			report = append(report, PrefixReport{Prefix: p, Err: err})
+			continue
+		}
+		report = append(report, simulatePrefix(c, prefix, options))
+	}
+	return report, nil
+}
+
+// SimulateService is like Simulate, but it reports the prefixes of all the backends of the proposed
+// service config relying on the etcd subscriber, applying their backend options
+func SimulateService(ctx context.Context, cfg config.ServiceConfig) (Report, error) {
+	c, err := New(ctx, cfg.ExtraConfig)
+	if err != nil {
+		return nil, err
+	}
+	report := Report{}
+	backendPrefixes(c, cfg, func(prefix string, options BackendOptions, err error) {
+		if err != nil {
+			report = append(report, PrefixReport{Prefix: prefix, Err: err})
+			return
+		}
+		report = append(report, simulatePrefix(c, prefix, options))
+	})
+	return report, nil
+}
+
+// simulatePrefix resolves the prefix once, as a subscriber with the received options would do
+func simulatePrefix(c Client, prefix string, options BackendOptions) PrefixReport {
+	hosts, _, err := getHosts(options.scope(c), prefix)
+	if err != nil {
+		return PrefixReport{Prefix: prefix, Err: err}
+	}
+	return PrefixReport{Prefix: prefix, Hosts: hostURLs(resolveHosts(prefix, options, hosts))}
+}
@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestSimulate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "simulate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "events.jsonl")
+	if err := ioutil.WriteFile(file, []byte(`{"at":"2020-01-01T00:00:00Z","prefix":"/services/api","hosts":[{"url":"10.0.0.1"}]}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	extra := config.ExtraConfig{Namespace: map[string]interface{}{"replay": map[string]interface{}{"file": file}}}
+
+	report, err := Simulate(ctx, extra, []string{"/services/api", "services/api", "/services/unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if p := report[0]; p.Err != nil || !reflect.DeepEqual(p.Hosts, []string{"10.0.0.1"}) {
+		t.Errorf("unexpected report of the prefix: %+v", p)
+	}
+	if report[1].Err != ErrBadPrefix || report[2].Err != ErrNotRecorded {
+		t.Errorf("unexpected errors: %+v", report)
+	}
+
+	service := config.ServiceConfig{
+		ExtraConfig: extra,
+		Endpoints: []*config.EndpointConfig{{Backend: []*config.Backend{{
+			SD:          SDName,
+			Host:        []string{"/services/api"},
+			ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{"default_scheme": "https"}},
+		}}}},
+	}
+	report, err = SimulateService(ctx, service)
+	if err != nil || len(report) != 1 || !reflect.DeepEqual(report[0].Hosts, []string{"https://10.0.0.1"}) {
+		t.Errorf("unexpected report of the service: %+v %v", report, err)
+	}
+
+	if _, err := Simulate(ctx, config.ExtraConfig{Namespace: map[string]interface{}{"replay": file}}, nil); err == nil {
+		t.Error("the config errors should be returned")
+	}
+}
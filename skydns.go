@@ -0,0 +1,68 @@
+package etcd
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// SkyDNSRoot is the root of the keys written by SkyDNS and registrator
+const SkyDNSRoot = "/skydns"
+
+// SkyDNSPrefix returns the etcd prefix storing the records of the received domain name, following
+// the SkyDNS key layout. e.g. "api.example.com" is stored under "/skydns/com/example/api". Names
+// already starting with a slash are considered prefixes and returned as they are.
+func SkyDNSPrefix(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+	labels := strings.Split(strings.Trim(name, "."), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return SkyDNSRoot + "/" + strings.Join(labels, "/")
+}
+
+// skyDNSRecord is the service record stored by SkyDNS
+type skyDNSRecord struct {
+	Host     string      `json:"host"`
+	Port     json.Number `json:"port"`
+	Priority json.Number `json:"priority"`
+	Weight   json.Number `json:"weight"`
+	Text     string      `json:"text"`
+}
+
+// decodeSkyDNS decodes the service records written by SkyDNS and registrator. The priority, weight
+// and text of the record are added to the metadata of the host, and the priority defines its tier
+// too. A zero port is ignored.
+//
+//	{"host": "10.0.0.1", "port": 8080, "priority": 10, "weight": 100}
+func decodeSkyDNS(b []byte) ([]Host, error) {
+	var s skyDNSRecord
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	r := record{Host: s.Host, Priority: s.Priority}
+	if s.Port != "0" {
+		r.Port = s.Port
+	}
+	metadata := map[string]interface{}{}
+	if s.Priority != "" {
+		metadata["priority"] = s.Priority.String()
+	}
+	if s.Weight != "" {
+		metadata["weight"] = s.Weight.String()
+	}
+	if s.Text != "" {
+		metadata["text"] = s.Text
+	}
+	if len(metadata) > 0 {
+		r.Metadata = metadata
+	}
+
+	h, err := r.toHost()
+	if err != nil {
+		return nil, err
+	}
+	return []Host{h}, nil
+}
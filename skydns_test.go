@@ -0,0 +1,69 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestSkyDNSPrefix(t *testing.T) {
+	for name, expected := range map[string]string{
+		"api.example.com":  "/skydns/com/example/api",
+		"api.example.com.": "/skydns/com/example/api",
+		"local":            "/skydns/local",
+		"/skydns/local/db": "/skydns/local/db",
+	} {
+		if prefix := SkyDNSPrefix(name); prefix != expected {
+			t.Errorf("unexpected prefix for %s: %s", name, prefix)
+		}
+	}
+}
+
+func TestDecodeSkyDNS(t *testing.T) {
+	hosts, err := decodeSkyDNS([]byte(`{"host": "10.0.0.1", "port": 8080, "priority": 10, "weight": 100, "ttl": 30}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Host{{
+		URL:      "10.0.0.1:8080",
+		Metadata: map[string]interface{}{"priority": "10", "weight": "100"},
+		Priority: 10,
+	}}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+
+	hosts, err = decodeSkyDNS([]byte(`{"host": "db.example.com", "port": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hosts, []Host{{URL: "db.example.com"}}) {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+
+	if _, err := decodeSkyDNS([]byte(`{"port": 8080}`)); err == nil {
+		t.Error("expecting an error decoding a record without host")
+	}
+}
+
+func TestParseBackendOptions_skyDNS(t *testing.T) {
+	options, err := parseBackendOptions(config.ExtraConfig{
+		Namespace: map[string]interface{}{
+			"key_layout":     "skydns",
+			"default_scheme": "http",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if options.KeyLayout != KeyLayoutSkyDNS {
+		t.Errorf("unexpected key layout: %s", options.KeyLayout)
+	}
+	if options.Overrides.EntryFormat != EntryFormatSkyDNS {
+		t.Errorf("unexpected entry format: %s", options.Overrides.EntryFormat)
+	}
+	if prefix, err := options.prefix(nil, "api.example.com"); err != nil || prefix != "/skydns/com/example/api" {
+		t.Errorf("unexpected prefix: %s %v", prefix, err)
+	}
+}
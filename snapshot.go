@@ -0,0 +1,65 @@
+package etcd
+
+import "fmt"
+
+// ErrNoSnapshots is the error returned when the client is not able to read at a given revision
+var ErrNoSnapshots = fmt.Errorf("the etcd client does not support reads at a given revision")
+
+// SnapshotClient is implemented by the clients able to read the prefixes as they were at a past
+// revision. Only the v3 clients implement it.
+type SnapshotClient interface {
+	RevisionClient
+	// GetEntriesAtRevision returns the entries of the prefix at the received revision
+	GetEntriesAtRevision(prefix string, revision int64) ([]string, error)
+	// GetHostsAtRevision returns the hosts of the prefix at the received revision
+	GetHostsAtRevision(prefix string, revision int64) ([]Host, error)
+}
+
+// Snapshot holds the hosts of several prefixes, all of them read at the same revision
+type Snapshot struct {
+	Revision int64
+	Hosts    map[string][]Host
+}
+
+// GetSnapshot reads all the prefixes at the same revision, so the comparisons between them (e.g. the
+// consistency checks of several backends) are not affected by the writes happening between the reads.
+// The revision is the one returned by the read of the first prefix.
+func GetSnapshot(c Client, prefixes ...string) (Snapshot, error) {
+	sc, ok := c.(SnapshotClient)
+	if !ok {
+		return Snapshot{}, ErrNoSnapshots
+	}
+	snapshot := Snapshot{Hosts: make(map[string][]Host, len(prefixes))}
+	for i, prefix := range prefixes {
+		if i == 0 {
+			hosts, revision, err := sc.GetHostsWithRevision(prefix)
+			if err != nil {
+				return Snapshot{}, err
+			}
+			snapshot.Revision = revision
+			snapshot.Hosts[prefix] = hosts
+			continue
+		}
+		hosts, err := sc.GetHostsAtRevision(prefix, snapshot.Revision)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snapshot.Hosts[prefix] = hosts
+	}
+	return snapshot, nil
+}
+
+// GetEntriesAtRevision implements the etcd SnapshotClient interface.
+func (c *clientv3) GetEntriesAtRevision(prefix string, revision int64) ([]string, error) {
+	hosts, err := c.GetHostsAtRevision(prefix, revision)
+	if err != nil {
+		return nil, err
+	}
+	return hostURLs(hosts), nil
+}
+
+// GetHostsAtRevision implements the etcd SnapshotClient interface. A zero revision reads the latest one.
+func (c *clientv3) GetHostsAtRevision(prefix string, revision int64) ([]Host, error) {
+	hosts, _, err := c.getHosts(prefix, revision)
+	return hosts, err
+}
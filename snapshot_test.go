@@ -0,0 +1,85 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+type dummySnapshotClient struct {
+	dummyRevisionClient
+	revisions *[]int64
+}
+
+func (d dummySnapshotClient) GetEntriesAtRevision(prefix string, revision int64) ([]string, error) {
+	hosts, err := d.GetHostsAtRevision(prefix, revision)
+	return hostURLs(hosts), err
+}
+
+func (d dummySnapshotClient) GetHostsAtRevision(prefix string, revision int64) ([]Host, error) {
+	*d.revisions = append(*d.revisions, revision)
+	return d.getHosts(prefix)
+}
+
+func TestGetSnapshot(t *testing.T) {
+	if _, err := GetSnapshot(dummyClient{}, "/services/a"); err != ErrNoSnapshots {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	revisions := []int64{}
+	c := dummySnapshotClient{
+		dummyRevisionClient: dummyRevisionClient{
+			dummyHostsClient: dummyHostsClient{
+				getHosts: func(prefix string) ([]Host, error) {
+					return []Host{{URL: "http://10.0.0.1" + prefix}}, nil
+				},
+			},
+			revision: 42,
+		},
+		revisions: &revisions,
+	}
+
+	snapshot, err := GetSnapshot(c, "/services/a", "/services/b", "/services/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Revision != 42 || len(snapshot.Hosts) != 3 || snapshot.Hosts["/services/b"][0].URL != "http://10.0.0.1/services/b" {
+		t.Errorf("unexpected snapshot: %+v", snapshot)
+	}
+	if !reflect.DeepEqual(revisions, []int64{42, 42}) {
+		t.Errorf("unexpected revisions: %v", revisions)
+	}
+}
+
+type fakeGetKV struct {
+	etcdv3.KV
+	resp *etcdv3.GetResponse
+	err  error
+}
+
+func (f fakeGetKV) Get(context.Context, string, ...etcdv3.OpOption) (*etcdv3.GetResponse, error) {
+	return f.resp, f.err
+}
+
+func TestClientV3_GetEntriesAtRevision(t *testing.T) {
+	c := &clientv3{
+		client: &etcdv3.Client{KV: fakeGetKV{resp: &etcdv3.GetResponse{
+			Header: &etcdv3.ResponseHeader{Revision: 50},
+			Kvs:    []*mvccpb.KeyValue{{Key: []byte("/services/a/1"), Value: []byte("http://10.0.0.1")}},
+			Count:  1,
+		}}},
+		ctx:     context.Background(),
+		timeout: time.Second,
+	}
+	entries, err := c.GetEntriesAtRevision("/services/a", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []string{"http://10.0.0.1"}) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
@@ -0,0 +1,303 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// spiffeRetry is the delay before reconnecting to the Workload API after its stream fails
+	spiffeRetry = time.Second
+	// spiffeHeader is the metadata required by the Workload API in every request
+	spiffeHeader = "workload.spiffe.io"
+	// fetchX509SVIDMethod streams the X509SVIDResponse messages every time the SVIDs are rotated
+	fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+)
+
+var (
+	// ErrNoSVID is returned when the Workload API does not deliver an SVID before the timeout
+	ErrNoSVID = errors.New("etcd: no SVID received from the SPIFFE Workload API")
+	// ErrNoSPIFFEServerID is returned when the SPIFFE ID of the servers is not defined. The SVIDs are not
+	// verified against the host names, so any workload of the trust domain could impersonate the cluster.
+	ErrNoSPIFFEServerID = errors.New("etcd: the SPIFFE ID of the servers is required")
+)
+
+// X509SVID is the X.509 SPIFFE Verifiable Identity Document of the workload, along with the bundle of its
+// trust domain
+type X509SVID struct {
+	ID          string
+	Certificate tls.Certificate
+	Bundle      *x509.CertPool
+}
+
+// WorkloadAPISource keeps the X509SVID delivered by a SPIFFE Workload API, replacing it every time the
+// agent rotates it, so the connections to the cluster use the identity issued to the workload instead of
+// static certificates.
+type WorkloadAPISource struct {
+	socket string
+	fetch  func(ctx context.Context, socket string, update func(*X509SVID)) error
+	mutex  *sync.RWMutex
+	svid   *X509SVID
+	ready  chan struct{}
+	once   *sync.Once
+}
+
+// NewWorkloadAPISource returns a WorkloadAPISource streaming the SVIDs from the Workload API at the
+// socket (e.g. "unix:///run/spire/sockets/agent.sock") until the context is canceled
+func NewWorkloadAPISource(ctx context.Context, socket string) *WorkloadAPISource {
+	return newWorkloadAPISource(ctx, socket, fetchX509SVIDs)
+}
+
+func newWorkloadAPISource(ctx context.Context, socket string, fetch func(context.Context, string, func(*X509SVID)) error) *WorkloadAPISource {
+	s := &WorkloadAPISource{
+		socket: socket,
+		fetch:  fetch,
+		mutex:  &sync.RWMutex{},
+		ready:  make(chan struct{}),
+		once:   &sync.Once{},
+	}
+	go s.run(ctx)
+	return s
+}
+
+// Wait blocks until the first SVID is received or the timeout expires
+func (s *WorkloadAPISource) Wait(timeout time.Duration) error {
+	select {
+	case <-s.ready:
+		return nil
+	case <-GetClock().After(timeout):
+		return ErrNoSVID
+	}
+}
+
+// SVID returns the current SVID, or nil if none has been received yet
+func (s *WorkloadAPISource) SVID() *X509SVID {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.svid
+}
+
+// TLSConfig returns a TLS config presenting the current SVID and verifying the servers against the
+// current bundle. The servers must present the server id too, since the host names are not verified (the
+// SVIDs identify the workloads by their SPIFFE ID), so the connections fail with ErrNoSPIFFEServerID if it
+// is empty.
+func (s *WorkloadAPISource) TLSConfig(serverID string) *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			svid := s.SVID()
+			if svid == nil {
+				return nil, ErrNoSVID
+			}
+			return &svid.Certificate, nil
+		},
+		// the chain is verified by VerifyPeerCertificate against the bundle of the current SVID
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			return s.verify(raw, serverID)
+		},
+	}
+}
+
+func (s *WorkloadAPISource) verify(raw [][]byte, serverID string) error {
+	svid := s.SVID()
+	if svid == nil {
+		return ErrNoSVID
+	}
+	if serverID == "" {
+		return ErrNoSPIFFEServerID
+	}
+	if len(raw) == 0 {
+		return fmt.Errorf("etcd: the server did not present a certificate")
+	}
+	certs := make([]*x509.Certificate, len(raw))
+	for i, b := range raw {
+		c, err := x509.ParseCertificate(b)
+		if err != nil {
+			return err
+		}
+		certs[i] = c
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         svid.Bundle,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return err
+	}
+	for _, u := range certs[0].URIs {
+		if u.String() == serverID {
+			return nil
+		}
+	}
+	return fmt.Errorf("etcd: the server does not present the SPIFFE ID %s", serverID)
+}
+
+// run streams the SVIDs, reconnecting after the failures, until the context is canceled
+func (s *WorkloadAPISource) run(ctx context.Context) {
+	for {
+		err := s.fetch(ctx, s.socket, s.update)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			getLogger().Warning("etcd: the SPIFFE Workload API stream failed:", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-GetClock().After(Jitter(spiffeRetry)):
+		}
+	}
+}
+
+func (s *WorkloadAPISource) update(svid *X509SVID) {
+	s.mutex.Lock()
+	s.svid = svid
+	s.mutex.Unlock()
+	s.once.Do(func() { close(s.ready) })
+}
+
+// fetchX509SVIDs calls the FetchX509SVID method of the Workload API, passing every SVID received to the
+// update function until the stream fails or the context is canceled. The messages are encoded with the
+// protobuf helpers of the package, so it does not depend on the generated code of the Workload API.
+func fetchX509SVIDs(ctx context.Context, socket string, update func(*X509SVID)) error {
+	conn, err := grpc.DialContext(ctx, socket, grpc.WithInsecure(), grpc.WithContextDialer(dialWorkloadAPI))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, spiffeHeader, "true")
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fetchX509SVIDMethod, grpc.CallCustomCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+	// the X509SVIDRequest has no fields
+	if err := stream.SendMsg(&[]byte{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		var b []byte
+		if err := stream.RecvMsg(&b); err != nil {
+			return err
+		}
+		svid, err := decodeX509SVIDResponse(b)
+		if err != nil {
+			return err
+		}
+		update(svid)
+	}
+}
+
+func dialWorkloadAPI(ctx context.Context, address string) (net.Conn, error) {
+	return (&net.Dialer{}).DialContext(ctx, "unix", strings.TrimPrefix(address, "unix://"))
+}
+
+// decodeX509SVIDResponse returns the first SVID of the X509SVIDResponse message:
+//
+//	message X509SVIDResponse { repeated X509SVID svids = 1; ... }
+//	message X509SVID {
+//	  string spiffe_id = 1;
+//	  bytes x509_svid = 2;     // ASN.1 DER certificates, leaf first
+//	  bytes x509_svid_key = 3; // PKCS#8 DER private key
+//	  bytes bundle = 4;        // ASN.1 DER certificates
+//	}
+func decodeX509SVIDResponse(b []byte) (*X509SVID, error) {
+	var msg []byte
+	if err := walkProtobuf(b, func(field uint64, wireType int, _ uint64, data []byte) error {
+		if field == 1 && wireType == 2 && msg == nil {
+			msg = data
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, ErrNoSVID
+	}
+
+	svid := &X509SVID{Bundle: x509.NewCertPool()}
+	var chain, key, bundle []byte
+	if err := walkProtobuf(msg, func(field uint64, wireType int, _ uint64, data []byte) error {
+		if wireType != 2 {
+			return nil
+		}
+		switch field {
+		case 1:
+			svid.ID = string(data)
+		case 2:
+			chain = data
+		case 3:
+			key = data
+		case 4:
+			bundle = data
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	certs, err := x509.ParseCertificates(chain)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("etcd: the SVID %s has no certificates", svid.ID)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.ParseCertificates(bundle)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range roots {
+		svid.Bundle.AddCert(c)
+	}
+	for _, c := range certs {
+		svid.Certificate.Certificate = append(svid.Certificate.Certificate, c.Raw)
+	}
+	svid.Certificate.PrivateKey = privateKey
+	svid.Certificate.Leaf = certs[0]
+	return svid, nil
+}
+
+// rawCodec passes the messages as they are, since they are encoded by the caller
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec: unexpected message %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec: unexpected message %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) String() string { return "proto" }
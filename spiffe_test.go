@@ -0,0 +1,187 @@
+package etcd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type testIdentity struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestIdentity(t *testing.T, id string, parent *testIdentity) *testIdentity {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: id},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		u, _ := url.Parse(id)
+		tmpl.URIs = []*url.URL{u}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testIdentity{cert: cert, key: key}
+}
+
+func appendProtobufField(b []byte, field uint64, data []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	b = append(b, buf[:binary.PutUvarint(buf, field<<3|2)]...)
+	b = append(b, buf[:binary.PutUvarint(buf, uint64(len(data)))]...)
+	return append(b, data...)
+}
+
+func encodeX509SVIDResponse(t *testing.T, id string, svid, ca *testIdentity) []byte {
+	key, err := x509.MarshalPKCS8PrivateKey(svid.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := appendProtobufField(nil, 1, []byte(id))
+	msg = appendProtobufField(msg, 2, svid.cert.Raw)
+	msg = appendProtobufField(msg, 3, key)
+	msg = appendProtobufField(msg, 4, ca.cert.Raw)
+	return appendProtobufField(nil, 1, msg)
+}
+
+func TestDecodeX509SVIDResponse(t *testing.T) {
+	ca := newTestIdentity(t, "ca", nil)
+	id := "spiffe://example.org/krakend"
+	svid, err := decodeX509SVIDResponse(encodeX509SVIDResponse(t, id, newTestIdentity(t, id, ca), ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svid.ID != id || len(svid.Certificate.Certificate) != 1 || svid.Certificate.PrivateKey == nil {
+		t.Errorf("unexpected svid: %+v", svid)
+	}
+	if _, err := svid.Certificate.Leaf.Verify(x509.VerifyOptions{
+		Roots:     svid.Bundle,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		t.Errorf("unexpected bundle: %v", err)
+	}
+
+	if _, err := decodeX509SVIDResponse(nil); err != ErrNoSVID {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := decodeX509SVIDResponse(appendProtobufField(nil, 1, appendProtobufField(nil, 1, []byte(id)))); err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestWorkloadAPISource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := newTestIdentity(t, "ca", nil)
+	clientID := "spiffe://example.org/krakend"
+	serverID := "spiffe://example.org/etcd"
+	svid, err := decodeX509SVIDResponse(encodeX509SVIDResponse(t, clientID, newTestIdentity(t, clientID, ca), ca))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(chan string, 10)
+	s := newWorkloadAPISource(ctx, "unix:///tmp/agent.sock", func(ctx context.Context, socket string, update func(*X509SVID)) error {
+		calls <- socket
+		update(svid)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := s.Wait(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if socket := <-calls; socket != "unix:///tmp/agent.sock" {
+		t.Errorf("unexpected socket: %s", socket)
+	}
+
+	server := newTestIdentity(t, serverID, ca)
+	for _, tc := range []struct {
+		serverID string
+		fail     bool
+	}{
+		{serverID: "", fail: true},
+		{serverID: serverID},
+		{serverID: "spiffe://example.org/other", fail: true},
+	} {
+		if err := handshake(s.TLSConfig(tc.serverID), server, ca); (err != nil) != tc.fail {
+			t.Errorf("unexpected result for %q: %v", tc.serverID, err)
+		}
+	}
+
+	other := newTestIdentity(t, "other ca", nil)
+	if err := handshake(s.TLSConfig(serverID), newTestIdentity(t, serverID, other), ca); err == nil {
+		t.Error("the servers of other trust domains should be rejected")
+	}
+}
+
+func TestWorkloadAPISource_noSVID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := newWorkloadAPISource(ctx, "unix:///tmp/agent.sock", func(ctx context.Context, _ string, _ func(*X509SVID)) error {
+		return fmt.Errorf("connection refused")
+	})
+	if err := s.Wait(10 * time.Millisecond); err != ErrNoSVID {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if s.SVID() != nil {
+		t.Error("unexpected svid")
+	}
+	if err := s.verify(nil, ""); err != ErrNoSVID {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// handshake connects a client with the config to a server presenting the identity and requiring a
+// client certificate signed by the ca
+func handshake(cfg *tls.Config, server, ca *testIdentity) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tls.Server(s, &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{server.cert.Raw}, PrivateKey: server.key}},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    roots,
+		}).Handshake()
+	}()
+	err := tls.Client(c, cfg).Handshake()
+	c.Close()
+	if serr := <-done; err == nil {
+		err = serr
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+const (
+	// AuthNone is the auth mode of the clients without credentials
+	AuthNone = "none"
+	// AuthPassword is the auth mode of the clients authenticated with a username and a password
+	AuthPassword = "password"
+	// AuthClientCertificate is the auth mode of the clients authenticated with their TLS certificate
+	AuthClientCertificate = "client_certificate"
+
+	// TLSDisabled is the TLS mode of the clients connecting without TLS
+	TLSDisabled = "disabled"
+	// TLSFiles is the TLS mode of the clients loading their certificates from the cert, key and cacert files
+	TLSFiles = "files"
+	// TLSSPIFFE is the TLS mode of the clients getting their certificates from the SPIFFE Workload API
+	TLSSPIFFE = "spiffe"
+	// TLSProviderMode is the TLS mode of the clients getting their certificates from a TLSProvider
+	TLSProviderMode = "provider"
+)
+
+// StartupReport summarizes the etcd integration once its client is created and the prefixes of the
+// backends are resolved, so the deploy pipelines can check the discovery is wired correctly
+type StartupReport struct {
+	// ClientVersion is the version of the client: v2 or v3
+	ClientVersion string `json:"client_version"`
+	// Clusters are the clusters the client connects to
+	Clusters []StartupCluster `json:"clusters"`
+	// Auth is the auth mode of the client: AuthNone, AuthPassword or AuthClientCertificate
+	Auth string `json:"auth"`
+	// TLS is the TLS mode of the client: TLSDisabled, TLSFiles, TLSSPIFFE or TLSProviderMode
+	TLS string `json:"tls"`
+	// Prefixes are the prefixes of the backends relying on the etcd subscriber
+	Prefixes []StartupPrefix `json:"prefixes"`
+	// Hosts is the number of hosts found for all the prefixes
+	Hosts int `json:"hosts"`
+	// Failed is the number of prefixes that could not be resolved or did not contain any entry
+	Failed int `json:"failed"`
+	// ClientDuration is the time taken to create the client
+	ClientDuration time.Duration `json:"client_duration"`
+	// PrefetchDuration is the time taken to resolve the prefixes
+	PrefetchDuration time.Duration `json:"prefetch_duration"`
+}
+
+// StartupCluster is a cluster of the StartupReport
+type StartupCluster struct {
+	Name     string   `json:"name"`
+	Machines []string `json:"machines"`
+}
+
+// StartupPrefix is a prefix of the StartupReport
+type StartupPrefix struct {
+	Prefix string `json:"prefix"`
+	Hosts  int    `json:"hosts"`
+	Error  string `json:"error,omitempty"`
+}
+
+// String returns the report as a JSON document
+func (r StartupReport) String() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+// log logs the report with the logger set with SetLogger, as a warning if some prefix failed
+func (r StartupReport) log() {
+	if r.Failed > 0 {
+		getLogger().Warning("etcd: startup report:", r.String())
+		return
+	}
+	getLogger().Info("etcd: startup report:", r.String())
+}
+
+// NewWithStartupReport creates the etcd client like NewForService, but it resolves the prefixes of all
+// the backends relying on the etcd subscriber before returning, reporting the clusters, the auth and TLS
+// modes, the hosts of every prefix and the time taken. The report is logged too. The prefixes that could
+// not be resolved do not fail the creation of the client.
+func NewWithStartupReport(ctx context.Context, cfg config.ServiceConfig) (Client, StartupReport, error) {
+	start := GetClock().Now()
+	c, err := newForService(ctx, cfg, false)
+	if err != nil {
+		return nil, StartupReport{}, err
+	}
+	ns, _ := cfg.ExtraConfig[Namespace].(map[string]interface{})
+	report := startupReport(ctx, c, cfg, ns, GetClock().Now().Sub(start))
+	return c, report, nil
+}
+
+// startupReport prefetches the subscribers of the service config and logs the report of the startup
+func startupReport(ctx context.Context, c Client, cfg config.ServiceConfig, ns map[string]interface{}, clientDuration time.Duration) StartupReport {
+	start := GetClock().Now()
+	prefixes := Prefetch(ctx, c, cfg, prefetchParallelism(ns))
+	report := newStartupReport(ns, prefixes)
+	report.ClientDuration = clientDuration
+	report.PrefetchDuration = GetClock().Now().Sub(start)
+	report.log()
+	return report
+}
+
+// newStartupReport describes the etcd config and the resolved prefixes
+func newStartupReport(ns map[string]interface{}, prefixes Report) StartupReport {
+	version, _ := parseVersion(ns)
+	options, _ := parseOptions(ns)
+	report := StartupReport{
+		ClientVersion: version,
+		Clusters:      startupClusters(ns),
+		Auth:          authMode(options),
+		TLS:           tlsMode(options),
+		Prefixes:      make([]StartupPrefix, len(prefixes)),
+	}
+	for i, p := range prefixes {
+		report.Prefixes[i] = StartupPrefix{Prefix: p.Prefix, Hosts: len(p.Hosts)}
+		report.Hosts += len(p.Hosts)
+		if p.Err != nil {
+			report.Prefixes[i].Error = p.Err.Error()
+		}
+	}
+	report.Failed = len(prefixes.Failed())
+	return report
+}
+
+// startupClusters returns the clusters declared by the etcd config
+func startupClusters(ns map[string]interface{}) []StartupCluster {
+	cls, ok := ns["clusters"].([]interface{})
+	if !ok {
+		machines, _ := parseMachines(ns)
+		return []StartupCluster{{Name: "default", Machines: machines}}
+	}
+	clusters := make([]StartupCluster, 0, len(cls))
+	for i, cl := range cls {
+		tmp, ok := cl.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := tmp["name"].(string)
+		if !ok {
+			name = fmt.Sprintf("cluster-%d", i)
+		}
+		machines, _ := parseMachines(tmp)
+		clusters = append(clusters, StartupCluster{Name: name, Machines: machines})
+	}
+	return clusters
+}
+
+// authMode returns the auth mode of the client options
+func authMode(options ClientOptions) string {
+	if options.Username != "" {
+		return AuthPassword
+	}
+	if tlsMode(options) != TLSDisabled {
+		return AuthClientCertificate
+	}
+	return AuthNone
+}
+
+// tlsMode returns the TLS mode of the client options, in the same order than newTLSConfig
+func tlsMode(options ClientOptions) string {
+	switch {
+	case options.TLSProvider != nil:
+		return TLSProviderMode
+	case options.SPIFFESocket != "":
+		return TLSSPIFFE
+	case options.Cert != "" && options.Key != "":
+		return TLSFiles
+	}
+	return TLSDisabled
+}
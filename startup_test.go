@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestStartupReport(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscribers = map[string]sd.Subscriber{}
+	subscribersMutex.Lock()
+	negativeCache = map[string]negativeEntry{}
+	subscribersMutex.Unlock()
+	l := &recordingLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) {
+			if prefix == "/services/startup-broken" {
+				return nil, errors.New("unavailable")
+			}
+			return []string{"http://10.0.0.1", "http://10.0.0.2"}, nil
+		},
+		watchPrefix: func(_ string, _ chan struct{}) { <-ctx.Done() },
+	}
+	cfg := config.ServiceConfig{Endpoints: []*config.EndpointConfig{{Backend: []*config.Backend{
+		{SD: SDName, Host: []string{"/services/startup"}},
+		{SD: SDName, Host: []string{"/services/startup-broken"}},
+	}}}}
+	ns := map[string]interface{}{
+		"machines":       []interface{}{"https://10.0.0.100:2379"},
+		"client_version": "v3",
+		"options":        map[string]interface{}{"username": "gateway", "password": "secret"},
+	}
+
+	report := startupReport(ctx, c, cfg, ns, time.Second)
+	if report.ClientVersion != "v3" || report.Auth != AuthPassword || report.TLS != TLSDisabled {
+		t.Errorf("unexpected modes: %+v", report)
+	}
+	if expected := []StartupCluster{{Name: "default", Machines: []string{"https://10.0.0.100:2379"}}}; !reflect.DeepEqual(report.Clusters, expected) {
+		t.Errorf("unexpected clusters: %+v", report.Clusters)
+	}
+	expected := []StartupPrefix{
+		{Prefix: "/services/startup", Hosts: 2},
+		{Prefix: "/services/startup-broken", Error: "unavailable"},
+	}
+	if !reflect.DeepEqual(report.Prefixes, expected) || report.Hosts != 2 || report.Failed != 1 {
+		t.Errorf("unexpected prefixes: %+v", report)
+	}
+	if report.ClientDuration != time.Second {
+		t.Errorf("unexpected client duration: %s", report.ClientDuration)
+	}
+
+	warnings := l.logged()
+	if len(warnings) == 0 || !strings.Contains(warnings[len(warnings)-1], `"failed":1`) {
+		t.Errorf("the failed report should be logged as a warning: %v", warnings)
+	}
+}
+
+func TestStartupClusters(t *testing.T) {
+	clusters := startupClusters(map[string]interface{}{"clusters": []interface{}{
+		map[string]interface{}{"name": "eu", "machines": []interface{}{"http://10.0.0.1:2379"}},
+		map[string]interface{}{"machines": []interface{}{"http://10.0.1.1:2379"}},
+	}})
+	expected := []StartupCluster{
+		{Name: "eu", Machines: []string{"http://10.0.0.1:2379"}},
+		{Name: "cluster-1", Machines: []string{"http://10.0.1.1:2379"}},
+	}
+	if !reflect.DeepEqual(clusters, expected) {
+		t.Errorf("unexpected clusters: %+v", clusters)
+	}
+}
+
+func TestAuthMode(t *testing.T) {
+	for i, tc := range []struct {
+		options ClientOptions
+		auth    string
+		tls     string
+	}{
+		{options: ClientOptions{}, auth: AuthNone, tls: TLSDisabled},
+		{options: ClientOptions{CACert: "ca.pem"}, auth: AuthNone, tls: TLSDisabled},
+		{options: ClientOptions{Cert: "cert.pem", Key: "key.pem"}, auth: AuthClientCertificate, tls: TLSFiles},
+		{options: ClientOptions{SPIFFESocket: "unix:///tmp/agent.sock", Username: "gateway"}, auth: AuthPassword, tls: TLSSPIFFE},
+	} {
+		if a, m := authMode(tc.options), tlsMode(tc.options); a != tc.auth || m != tc.tls {
+			t.Errorf("unexpected modes of the options %d: %s %s", i, a, m)
+		}
+	}
+}
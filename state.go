@@ -0,0 +1,243 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+)
+
+// DefaultImportSpread is the default period the first reads of the subscribers created from an imported
+// state are spread over
+const DefaultImportSpread = 30 * time.Second
+
+// stateVersion is the version of the format of the exported states
+const stateVersion = 1
+
+// ErrBadState is the error returned when the imported state is not valid
+var ErrBadState = fmt.Errorf("unable to import the etcd discovery state")
+
+// State is the discovery cache of a gateway: the hosts of all its subscribers
+type State struct {
+	Version  int           `json:"version"`
+	Prefixes []PrefixState `json:"prefixes"`
+}
+
+// PrefixState is the cached state of a subscriber
+type PrefixState struct {
+	// Key identifies the hosts of the subscriber among the processes sharing them: the endpoints of its
+	// cluster, its prefix and the options decoding its entries. See sharedStateKey.
+	Key         string    `json:"key"`
+	Prefix      string    `json:"prefix"`
+	Hosts       []Host    `json:"hosts"`
+	Revision    int64     `json:"revision"`
+	LastRefresh time.Time `json:"last_refresh"`
+}
+
+var (
+	// importedStates is guarded by the subscribersMutex
+	importedStates = map[string]PrefixState{}
+	// importSpreadPeriod is guarded by the subscribersMutex
+	importSpreadPeriod = DefaultImportSpread
+)
+
+// ExportState writes the state of the subscribers created by the SubscriberFactory, so a new gateway
+// can start with it (see ImportState)
+func ExportState(w io.Writer) error {
+	state := State{Version: stateVersion, Prefixes: []PrefixState{}}
+	subscribersMutex.Lock()
+	for _, sf := range subscribers {
+		s, ok := sf.(*Subscriber)
+		if !ok {
+			continue
+		}
+		hosts, meta, _ := s.HostsWithMeta()
+		state.Prefixes = append(state.Prefixes, PrefixState{
+			Key:         s.stateKey,
+			Prefix:      s.prefix,
+			Hosts:       hosts,
+			Revision:    meta.Revision,
+			LastRefresh: meta.LastRefresh,
+		})
+	}
+	subscribersMutex.Unlock()
+	return json.NewEncoder(w).Encode(state)
+}
+
+// ImportState loads a state written by ExportState. The subscribers later created by the
+// SubscriberFactory for the imported prefixes (of the same cluster and with the same backend options)
+// start serving the imported
+// hosts right away and watching their prefix, while their first read is delayed by a random period
+// up to the spread (DefaultImportSpread if it is not positive), so a gateway coming up during a rolling
+// deploy does not read all its prefixes at once. Every state is used only once.
+func ImportState(r io.Reader, spread time.Duration) error {
+	var state State
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return err
+	}
+	if state.Version != stateVersion {
+		return ErrBadState
+	}
+	if spread <= 0 {
+		spread = DefaultImportSpread
+	}
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	importSpreadPeriod = spread
+	for _, p := range state.Prefixes {
+		if p.Key == "" || p.Prefix == "" {
+			return ErrBadState
+		}
+		importedStates[p.Key] = p
+	}
+	return nil
+}
+
+// newSeededSubscriber returns a subscriber serving the imported hosts, without reading them
+func newSeededSubscriber(ctx context.Context, c Client, prefix string, options BackendOptions, state PrefixState) *Subscriber {
+	s := newSubscriber(ctx, c, prefix, options)
+	s.seeded = true
+	s.update(state.Hosts)
+	s.meta = Meta{LastRefresh: state.LastRefresh, Revision: state.Revision}
+	go s.loop()
+	return s
+}
+
+// importSpread returns a random delay for the first read of a seeded subscriber
+func importSpread() time.Duration {
+	subscribersMutex.Lock()
+	spread := importSpreadPeriod
+	subscribersMutex.Unlock()
+	return time.Duration(rand.Int63n(int64(spread)))
+}
+
+// sharedKey is the serialization of a sharedStateKey. It only holds plain values, so the same prefix read with
+// the same options gets the same key in every process.
+type sharedKey struct {
+	Endpoints           []string          `json:"endpoints,omitempty"`
+	Prefix              string            `json:"prefix"`
+	DefaultScheme       string            `json:"default_scheme,omitempty"`
+	DefaultPort         string            `json:"default_port,omitempty"`
+	KeyLayout           string            `json:"key_layout,omitempty"`
+	Shards              int               `json:"shards,omitempty"`
+	ShardFormat         string            `json:"shard_format,omitempty"`
+	DedupHosts          bool              `json:"dedup_hosts,omitempty"`
+	AllowedCIDRs        []string          `json:"allowed_cidrs,omitempty"`
+	DeniedCIDRs         []string          `json:"denied_cidrs,omitempty"`
+	PortMap             map[string]string `json:"port_map,omitempty"`
+	HostSource          string            `json:"host_source,omitempty"`
+	Filter              string            `json:"filter,omitempty"`
+	EntryFormat         string            `json:"entry_format,omitempty"`
+	ValueEncoding       string            `json:"value_encoding,omitempty"`
+	EntrySchema         string            `json:"entry_schema,omitempty"`
+	LeaseMargin         time.Duration     `json:"lease_margin,omitempty"`
+	MultiValue          bool              `json:"multi_value,omitempty"`
+	MaxValueBytes       int               `json:"max_value_bytes,omitempty"`
+	MaxEntriesPerPrefix int               `json:"max_entries_per_prefix,omitempty"`
+	LimitPolicy         string            `json:"limit_policy,omitempty"`
+}
+
+// sharedStateKey identifies the hosts of a prefix among the processes sharing them (see SetCache and
+// ImportState): the endpoints of the cluster of the client, so the gateways of other clusters sharing the
+// cache do not seed each other, the prefix and the client and backend options changing the hosts decoded
+// from it
+func sharedStateKey(c Client, prefix string, o BackendOptions) string {
+	endpoints, options := clientIdentity(c)
+	options = options.merge(o.Overrides)
+	k := sharedKey{
+		Endpoints:           endpoints,
+		Prefix:              prefix,
+		DefaultScheme:       o.DefaultScheme,
+		DefaultPort:         o.DefaultPort,
+		KeyLayout:           o.KeyLayout,
+		Shards:              o.Shards,
+		ShardFormat:         o.ShardFormat,
+		DedupHosts:          o.DedupHosts,
+		AllowedCIDRs:        cidrStrings(o.AllowedCIDRs),
+		DeniedCIDRs:         cidrStrings(o.DeniedCIDRs),
+		PortMap:             o.PortMap,
+		HostSource:          options.HostSource,
+		Filter:              options.Filter,
+		EntryFormat:         options.EntryFormat,
+		ValueEncoding:       options.ValueEncoding,
+		LeaseMargin:         options.LeaseMargin,
+		MultiValue:          options.MultiValue,
+		MaxValueBytes:       options.MaxValueBytes,
+		MaxEntriesPerPrefix: options.MaxEntriesPerPrefix,
+		LimitPolicy:         options.LimitPolicy,
+	}
+	if options.EntrySchema != nil {
+		k.EntrySchema = options.EntrySchema.canonical()
+	}
+	b, _ := json.Marshal(k)
+	return string(b)
+}
+
+func cidrStrings(networks []net.IPNet) []string {
+	result := make([]string, 0, len(networks))
+	for _, n := range networks {
+		result = append(result, n.String())
+	}
+	return result
+}
+
+// clientIdentity returns the sorted endpoints of the cluster read by the client and its options, if the
+// client reports them
+func clientIdentity(c Client) ([]string, ClientOptions) {
+	ic, ok := c.(interface {
+		identity() ([]string, ClientOptions)
+	})
+	if !ok {
+		return nil, ClientOptions{}
+	}
+	endpoints, options := ic.identity()
+	endpoints = append([]string{}, endpoints...)
+	sort.Strings(endpoints)
+	return endpoints, options
+}
+
+// identity returns the endpoints of the cluster and the options of the client
+func (c *clientv3) identity() ([]string, ClientOptions) {
+	if c.client == nil {
+		return nil, c.options
+	}
+	return c.client.Endpoints(), c.options
+}
+
+// identity returns the endpoints of the cluster and the options of the client
+func (c *client) identity() ([]string, ClientOptions) {
+	return c.machines, c.options
+}
+
+// identity returns the endpoints of the clusters and the options of the first client reporting them, or
+// of the first client if none does
+func (c *MultiClusterClient) identity() ([]string, ClientOptions) {
+	endpoints := []string{}
+	var options *ClientOptions
+	reported := false
+	for _, cl := range c.clients {
+		e, o := clientIdentity(cl)
+		endpoints = append(endpoints, e...)
+		if options == nil || !reported && len(e) > 0 {
+			options, reported = &o, len(e) > 0
+		}
+	}
+	if options == nil {
+		return endpoints, ClientOptions{}
+	}
+	return endpoints, *options
+}
+
+// identity returns the settings of the replayed client, without endpoints
+func (c *ReplayClient) identity() ([]string, ClientOptions) {
+	return nil, ClientOptions{settings: c.settings}
+}
+
+// identity returns the identity of the sharded client
+func (c *ShardedClient) identity() ([]string, ClientOptions) {
+	return clientIdentity(c.Client)
+}
@@ -0,0 +1,109 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestExportState_ImportState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mutex := &sync.Mutex{}
+	reads := 0
+	notify := make(chan struct{})
+	defer close(notify)
+	newClient := func(notify chan struct{}) Client {
+		return dummyRevisionClient{
+			dummyHostsClient: dummyHostsClient{
+				dummyClient: dummyClient{watchPrefix: func(_ string, ch chan struct{}) {
+					ch <- struct{}{}
+					for range notify {
+						ch <- struct{}{}
+					}
+				}},
+				getHosts: func(string) ([]Host, error) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					reads++
+					return []Host{{URL: "10.0.0.1", Metadata: map[string]interface{}{"zone": "eu"}}}, nil
+				},
+			},
+			revision: 42,
+		}
+	}
+	cfg := &config.Backend{
+		Host: []string{"/services/state"},
+		ExtraConfig: config.ExtraConfig{
+			Namespace: map[string]interface{}{"default_scheme": "http"},
+		},
+	}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+	oldCtx, stop := context.WithCancel(ctx)
+	MetaSubscriberFactory(oldCtx, newClient(nil))(cfg)
+
+	buf := &bytes.Buffer{}
+	if err := ExportState(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new gateway
+	stop()
+	<-time.After(10 * time.Millisecond)
+	subscribers = map[string]sd.Subscriber{}
+	mutex.Lock()
+	reads = 0
+	mutex.Unlock()
+	if err := ImportState(buf, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, meta, err := MetaSubscriberFactory(ctx, newClient(notify))(cfg).HostsWithMeta()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].URL != "http://10.0.0.1" || hosts[0].Metadata["zone"] != "eu" {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+	if meta.Revision != 42 || meta.LastRefresh.IsZero() || meta.Stale {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+	<-time.After(20 * time.Millisecond)
+	mutex.Lock()
+	if reads != 0 {
+		t.Errorf("unexpected reads before the spread: %d", reads)
+	}
+	mutex.Unlock()
+
+	// the changes are still watched
+	notify <- struct{}{}
+	<-time.After(20 * time.Millisecond)
+	mutex.Lock()
+	if reads != 1 {
+		t.Errorf("unexpected reads after a change: %d", reads)
+	}
+	mutex.Unlock()
+
+	subscribersMutex.Lock()
+	if len(importedStates) != 0 {
+		t.Errorf("unexpected pending states: %v", importedStates)
+	}
+	subscribersMutex.Unlock()
+}
+
+func TestImportState_ko(t *testing.T) {
+	for _, blob := range []string{`{"version":2}`, `{"version":1,"prefixes":[{"hosts":[]}]}`, `[`} {
+		if err := ImportState(strings.NewReader(blob), 0); err == nil {
+			t.Errorf("error expected for %s", blob)
+		}
+	}
+}
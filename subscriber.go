@@ -2,95 +2,670 @@ package etcd
 
 import (
 	"context"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/devopsfaith/krakend/config"
 	"github.com/devopsfaith/krakend/sd"
 )
 
+// DefaultReadThroughTimeout is the default time the requests wait for the first read of a subscriber
+// without hosts
+const DefaultReadThroughTimeout = time.Second
+
 var (
 	subscribers               = map[string]sd.Subscriber{}
 	subscribersMutex          = &sync.Mutex{}
+	pendingSubscribers        = map[string]*subscriberCall{}
 	fallbackSubscriberFactory = sd.FixedSubscriberFactory
 )
 
 // SubscriberFactory builds a an etcd subscriber SubscriberFactory with the received etcd client
 func SubscriberFactory(ctx context.Context, c Client) sd.SubscriberFactory {
+	f := MetaSubscriberFactory(ctx, c)
 	return func(cfg *config.Backend) sd.Subscriber {
-		if len(cfg.Host) == 0 {
-			return fallbackSubscriberFactory(cfg)
-		}
-		subscribersMutex.Lock()
-		defer subscribersMutex.Unlock()
-		if sf, ok := subscribers[cfg.Host[0]]; ok {
-			return sf
-		}
-		sf, err := NewSubscriber(ctx, c, cfg.Host[0])
+		return f(cfg)
+	}
+}
+
+// MetaSubscriberFactory is the SubscriberFactory returning MetaSubscribers, so the proxies built with
+// it can report when the discovery is degraded. The fixed subscribers created as a fallback are
+// always reported as stale.
+func MetaSubscriberFactory(ctx context.Context, c Client) func(*config.Backend) MetaSubscriber {
+	return func(cfg *config.Backend) MetaSubscriber {
+		sf, err := cachedSubscriber(ctx, c, cfg)
 		if err != nil {
-			return fallbackSubscriberFactory(cfg)
+			return fallbackMetaSubscriber{fallbackSubscriberFactory(cfg)}
 		}
-		subscribers[cfg.Host[0]] = sf
 		return sf
 	}
 }
 
+// subscriberCall is a subscriber being created
+type subscriberCall struct {
+	done chan struct{}
+	s    MetaSubscriber
+	err  error
+}
+
+// cachedSubscriber returns the cached subscriber for the backend, creating it if required. The
+// subscribers of different prefixes are created concurrently, while the concurrent requests for the
+// same one wait for a single creation. The failures are cached for the negative ttl of the backend and
+// the imported states, or the ones stored in the shared cache, are used instead of the initial read.
+func cachedSubscriber(ctx context.Context, c Client, cfg *config.Backend) (MetaSubscriber, error) {
+	if len(cfg.Host) == 0 {
+		return nil, ErrNoPrefix
+	}
+	options, err := parseBackendOptions(cfg.ExtraConfig)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := options.prefix(c, cfg.Host[0])
+	if err != nil {
+		logError(cfg.Host[0], "etcd: unable to watch the prefix", err)
+		return nil, err
+	}
+	key := options.key(prefix)
+
+	subscribersMutex.Lock()
+	if sf, ok := subscribers[key].(MetaSubscriber); ok {
+		subscribersMutex.Unlock()
+		return sf, nil
+	}
+	if err, ok := negativeResult(key, GetClock().Now()); ok {
+		subscribersMutex.Unlock()
+		return nil, err
+	}
+	if call, ok := pendingSubscribers[key]; ok {
+		subscribersMutex.Unlock()
+		<-call.done
+		return call.s, call.err
+	}
+	settings := settingsOf(c)
+	if err := settings.tenantRegistry().acquire(options.Tenant, prefix); err != nil {
+		subscribersMutex.Unlock()
+		addMetric(MetricTenantRejections, 1)
+		logError(prefix, "etcd: unable to watch the prefix", err)
+		return nil, err
+	}
+	call := &subscriberCall{done: make(chan struct{})}
+	pendingSubscribers[key] = call
+	shared := sharedStateKey(c, prefix, options)
+	state, seeded := importedStates[shared]
+	delete(importedStates, shared)
+	subscribersMutex.Unlock()
+	if !seeded {
+		state, seeded = cachedState(settings, shared)
+	}
+
+	scoped := options.scope(c)
+	var sf *Subscriber
+	if seeded {
+		sf = newSeededSubscriber(ctx, scoped, prefix, options, state)
+	} else {
+		sf, err = NewSubscriberWithOptions(ctx, scoped, prefix, options)
+	}
+
+	subscribersMutex.Lock()
+	delete(pendingSubscribers, key)
+	if err == nil {
+		subscribers[key] = sf
+		delete(negativeCache, key)
+		call.s = sf
+		if options.Tenant != "" {
+			go func() {
+				<-ctx.Done()
+				settings.tenantRegistry().release(options.Tenant, prefix)
+			}()
+		}
+	} else {
+		settings.tenantRegistry().release(options.Tenant, prefix)
+		cacheNegative(ctx, scoped, prefix, key, options.NegativeTTL, err)
+	}
+	call.err = err
+	subscribersMutex.Unlock()
+	close(call.done)
+	return call.s, call.err
+}
+
+// NewBackendSubscriber returns the subscriber the SubscriberFactory would create for the backend,
+// applying its etcd options. Unlike the factory, the subscriber is not cached and the errors are
+// returned instead of falling back to a fixed subscriber.
+func NewBackendSubscriber(ctx context.Context, c Client, cfg *config.Backend) (*Subscriber, error) {
+	if len(cfg.Host) == 0 {
+		return nil, ErrNoPrefix
+	}
+	options, err := parseBackendOptions(cfg.ExtraConfig)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := options.prefix(c, cfg.Host[0])
+	if err != nil {
+		return nil, err
+	}
+	return NewSubscriberWithOptions(ctx, options.scope(c), prefix, options)
+}
+
 // Code taken from https://github.com/go-kit/kit/blob/master/sd/etcd/instancer.go
 
 // Subscriber keeps instances stored in a certain etcd keyspace cached in a fixed subscriber. Any kind of
 // change in that keyspace is watched and will update the Subscriber's list of hosts.
 type Subscriber struct {
-	cache  *sd.FixedSubscriber
-	mutex  *sync.RWMutex
-	client Client
-	prefix string
-	ctx    context.Context
+	cache   *sd.FixedSubscriber
+	mutex   *sync.RWMutex
+	client  Client
+	prefix  string
+	ctx     context.Context
+	options BackendOptions
+	// stateKey identifies the hosts of the subscriber in the shared cache and the exported states
+	stateKey string
+	// settings are the settings of the client of the subscriber. See clientSettings.
+	settings *clientSettings
+	grace    *removalGrace
+	churn    *churnTracker
+	// subscriberState holds the state updated by the loop, so the copies of the subscriber (as the
+	// receiver of Hosts) share it
+	*subscriberState
+	// firstRead is closed once the subscriber has read its prefix
+	firstRead     chan struct{}
+	firstReadOnce *sync.Once
+	// readThrough requests the first read, ahead of the delayed one
+	readThrough chan struct{}
+	// local holds the writes of the client not confirmed by its reads yet, applied to the hosts of the
+	// last read (read at lastRevision). See localWrites.
+	local *localWrites
+	// written is signaled when the client writes an entry under the prefix
+	written <-chan struct{}
+	// renewable is signaled when an entry discarded by a read because its lease was expiring could have
+	// been renewed. See ClientOptions.LeaseMargin.
+	renewable <-chan struct{}
+}
+
+// subscriberState is the state of a subscriber updated by its loop, guarded by its mutex
+type subscriberState struct {
+	last  []Host
+	index map[string]Host
+	meta  Meta
+	err   error
+	// belowMin is set while the prefix has less hosts than the min_hosts of the backend
+	belowMin bool
+	// seeded is set when the subscriber starts with an imported state, so the first read is delayed
+	seeded       bool
+	lastRead     []Host
+	lastRevision int64
+	// readThroughExpired is set when the first read was not done in the read through timeout, so the
+	// next requests do not wait for it again
+	readThroughExpired bool
 }
 
 // NewSubscriber returns an etcd subscriber. It will start watching the given
 // prefix for changes, and update the subscribers.
 func NewSubscriber(ctx context.Context, c Client, prefix string) (*Subscriber, error) {
-	s := &Subscriber{
-		client: c,
-		prefix: prefix,
-		cache:  &sd.FixedSubscriber{},
-		ctx:    ctx,
-		mutex:  &sync.RWMutex{},
-	}
+	return NewSubscriberWithOptions(ctx, c, prefix, BackendOptions{})
+}
 
-	instances, err := s.client.GetEntries(s.prefix)
+// NewSubscriberWithOptions returns an etcd subscriber applying the received backend options
+// to the discovered entries. It will start watching the given prefix for changes, and update
+// the subscribers. The initial read is tagged with the correlation id of the context, if any.
+func NewSubscriberWithOptions(ctx context.Context, c Client, prefix string, options BackendOptions) (*Subscriber, error) {
+	s := newSubscriber(ctx, c, prefix, options)
+
+	hosts, header, err := s.read(Correlate(ctx, c))
 	if err != nil {
 		return nil, err
 	}
-	*(s.cache) = sd.FixedSubscriber(instances)
+	s.update(hosts)
+	s.refreshed(header)
+	s.markRead()
 
 	go s.loop()
 
 	return s, nil
 }
 
-// Hosts implements the subscriber interface
+func newSubscriber(ctx context.Context, c Client, prefix string, options BackendOptions) *Subscriber {
+	s := &Subscriber{
+		client:   c,
+		prefix:   prefix,
+		cache:    &sd.FixedSubscriber{},
+		ctx:      ctx,
+		mutex:    &sync.RWMutex{},
+		options:  options,
+		stateKey: sharedStateKey(c, prefix, options),
+		settings: settingsOf(c),
+		churn:    newChurnTracker(prefix, options.ChurnThreshold),
+
+		subscriberState: &subscriberState{index: map[string]Host{}},
+
+		firstRead:     make(chan struct{}),
+		firstReadOnce: &sync.Once{},
+		readThrough:   make(chan struct{}, 1),
+		local:         localWritesOf(c),
+	}
+	s.written = s.local.listen(ctx, prefix)
+	s.renewable = leaseTrackerOf(c).listen(ctx, prefix)
+	if options.RemovalGrace > 0 {
+		s.grace = newRemovalGrace(options.RemovalGrace)
+	}
+	return s
+}
+
+// Hosts implements the subscriber interface. If the subscriber has no hosts because it has not read its
+// prefix yet, the first read is triggered and awaited up to the read through timeout.
 func (s Subscriber) Hosts() ([]string, error) {
+	s.awaitRead()
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 	return s.cache.Hosts()
 }
 
+// Host returns the discovered host with the received url, as returned by Hosts, along with the
+// metadata of its record. It allows the proxy middlewares to implement affinity, routing or billing
+// rules based on the host serving a request.
+func (s *Subscriber) Host(url string) (Host, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	h, ok := s.index[url]
+	return h, ok
+}
+
+// awaitRead triggers the read of the prefix if the subscriber has no hosts and it has not read it yet,
+// waiting for it up to the read through timeout, so the first requests to a cold prefix do not fail.
+// The concurrent calls share the same read. Once it times out (e.g. while etcd is down), the next
+// requests do not wait for it anymore.
+func (s *Subscriber) awaitRead() {
+	if s.firstRead == nil {
+		return
+	}
+	select {
+	case <-s.firstRead:
+		return
+	default:
+	}
+	s.mutex.RLock()
+	wait := len(*s.cache) == 0 && !s.readThroughExpired
+	s.mutex.RUnlock()
+	if !wait {
+		return
+	}
+	select {
+	case s.readThrough <- struct{}{}:
+	default:
+	}
+	timeout := s.options.ReadThroughTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadThroughTimeout
+	}
+	select {
+	case <-s.firstRead:
+	case <-GetClock().After(timeout):
+		s.mutex.Lock()
+		s.readThroughExpired = true
+		s.mutex.Unlock()
+	}
+}
+
+// markRead records the first read of the prefix, releasing the requests waiting for it
+func (s *Subscriber) markRead() {
+	s.firstReadOnce.Do(func() { close(s.firstRead) })
+}
+
+// subscriberLoop is the state of the loop of a subscriber, kept when the loop is restarted after a panic
+type subscriberLoop struct {
+	ch chan struct{}
+	// snapshots receives the initial read of the watches of the clients implementing SnapshotWatcher
+	snapshots    chan WatchSnapshot
+	watching     chan struct{}
+	watchStarted time.Time
+	// the stopped watches, the failed reads and the panics of the loop are retried with the backoff of
+	// the client, set with SetBackoff by default
+	watchRetry *retrier
+	readRetry  *retrier
+	loopRetry  *retrier
+	expire     <-chan time.Time
+	refresh    <-chan time.Time
+	rewatch    <-chan time.Time
+	// skip discards the initial notification of the watch
+	skip bool
+	// resumed is closed once the pause deferring the pending read ends. See Pause.
+	resumed <-chan struct{}
+}
+
 func (s *Subscriber) loop() {
-	ch := make(chan struct{})
-	go s.client.WatchPrefix(s.prefix, ch)
+	l := &subscriberLoop{
+		ch:         make(chan struct{}),
+		snapshots:  make(chan WatchSnapshot),
+		watchRetry: &retrier{settings: s.settings},
+		readRetry:  &retrier{settings: s.settings},
+		loopRetry:  &retrier{settings: s.settings},
+	}
+	s.watch(l)
+	if s.seeded {
+		// the initial notification of the watch is replaced by a delayed read, so the gateways
+		// starting with an imported state do not read all their prefixes at once
+		l.skip = true
+		l.refresh = GetClock().After(importSpread())
+	}
+	for s.run(l) {
+		// the loop panicked, so it is restarted after the backoff, keeping its watch
+		select {
+		case <-GetClock().After(l.loopRetry.next()):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// watch starts the watch of the prefix. The clients implementing SnapshotWatcher send the initial read
+// of the prefix instead of the initial notification. The panics of the watch are recovered, stopping
+// it, so it is restarted after the backoff.
+func (s *Subscriber) watch(l *subscriberLoop) {
+	ch, snapshots, done := l.ch, l.snapshots, make(chan struct{})
+	l.watching, l.watchStarted = done, GetClock().Now()
+	go func() {
+		defer close(done)
+		defer func() { recovered(s.prefix, recover()) }()
+		if sw, ok := s.client.(SnapshotWatcher); ok {
+			sw.WatchPrefixSnapshot(s.prefix, snapshots, ch)
+			return
+		}
+		s.client.WatchPrefix(s.prefix, ch)
+	}()
+}
+
+// readHosts reads the prefix and updates the hosts. The queued reads wait for a slot of the refresh
+// scheduler.
+func (s *Subscriber) readHosts(l *subscriberLoop, queued bool) {
+	release := func() {}
+	if queued {
+		var err error
+		if release, err = s.settings.scheduler().acquire(s.ctx, s.flow(), s.options.refreshWeight()); err != nil {
+			return
+		}
+	}
+	hosts, header, err := s.safeGetEntries()
+	release()
+	s.applyRead(l, hosts, header, err)
+}
+
+// applyRead updates the hosts with the result of a read of the prefix, retrying it after the backoff
+// if it failed
+func (s *Subscriber) applyRead(l *subscriberLoop, hosts []Host, header ResponseHeader, err error) {
+	s.markRead()
+	if err != nil {
+		s.failed(err)
+		if l.refresh == nil {
+			addMetric(MetricReadRetries, 1)
+			l.refresh = GetClock().After(s.options.retryDelay(l.readRetry.next()))
+		}
+		return
+	}
+	l.readRetry.reset()
+	l.loopRetry.reset()
+	s.countRefresh(hosts)
+	l.expire = s.update(hosts)
+	s.refreshed(header)
+}
+
+// run processes the notifications of the watch and the timers of the subscriber until its context is
+// done, returning true if it panicked
+func (s *Subscriber) run(l *subscriberLoop) (panicked bool) {
+	defer func() { panicked = recovered(s.prefix, recover()) }()
 	for {
 		select {
-		case <-ch:
-			instances, err := s.client.GetEntries(s.prefix)
-			if err != nil {
+		case <-l.ch:
+			if l.skip {
+				l.skip = false
+				continue
+			}
+			if s.pause(l) {
+				continue
+			}
+			if wait := s.shedding(); wait > 0 {
+				// the change is read once the load shedding mode ends
+				addMetric(MetricShedReads, 1)
+				if l.refresh == nil {
+					l.refresh = GetClock().After(wait)
+				}
+				continue
+			}
+			if wait := s.settings.tenantRegistry().throttle(s.options.Tenant, GetClock().Now()); wait > 0 {
+				// the change is read once the tenant is below its refresh rate
+				addMetric(MetricTenantThrottled, 1)
+				if l.refresh == nil {
+					l.refresh = GetClock().After(wait)
+				}
+				continue
+			}
+			s.readHosts(l, true)
+
+		case snapshot := <-l.snapshots:
+			if l.skip {
+				l.skip = false
+				continue
+			}
+			if s.pause(l) {
+				continue
+			}
+			if snapshot.Err != nil {
+				s.applyRead(l, nil, ResponseHeader{}, snapshot.Err)
+				continue
+			}
+			s.applyRead(l, s.resolveRead(snapshot.Hosts, snapshot.Header.Revision), snapshot.Header, nil)
+
+		case <-l.resumed:
+			l.resumed = nil
+			if s.pause(l) {
+				continue
+			}
+			s.readHosts(l, true)
+
+		case <-s.written:
+			if s.lastRevision > 0 {
+				l.expire = s.update(s.resolveRead(s.lastRead, s.lastRevision))
+			}
+
+		case <-s.renewable:
+			if s.pause(l) {
+				continue
+			}
+			s.readHosts(l, true)
+
+		case <-l.watching:
+			l.watching = nil
+			if s.ctx.Err() != nil {
+				continue
+			}
+			s.failed(ErrWatchStopped)
+			if GetClock().Now().Sub(l.watchStarted) > l.watchRetry.previous {
+				// the watch was up longer than the last delay, so it is not flapping
+				l.watchRetry.reset()
+			}
+			l.rewatch = GetClock().After(l.watchRetry.next())
+
+		case <-l.rewatch:
+			l.rewatch = nil
+			addMetric(MetricWatchReconnects, 1)
+			s.watch(l)
+			if wait := s.settings.warmRestarter().delay(s.prefix, GetClock().Now()); wait > 0 && !s.options.critical() {
+				// the initial notification of the watch is replaced by a delayed read, so the
+				// prefixes restarted by a mass reconnection are not read all at once
+				addMetric(MetricStaggeredReads, 1)
+				l.skip = true
+				l.refresh = GetClock().After(wait)
+			}
+
+		case <-l.refresh:
+			l.refresh = nil
+			if s.pause(l) {
+				continue
+			}
+			if wait := s.shedding(); wait > 0 {
+				l.refresh = GetClock().After(wait)
+				continue
+			}
+			if wait := s.settings.tenantRegistry().throttle(s.options.Tenant, GetClock().Now()); wait > 0 {
+				l.refresh = GetClock().After(wait)
+				continue
+			}
+			s.readHosts(l, true)
+
+		case <-s.readThrough:
+			select {
+			case <-s.firstRead:
+				continue
+			default:
+			}
+			if s.shedding() > 0 {
 				continue
 			}
-			s.mutex.Lock()
-			*(s.cache) = sd.FixedSubscriber(instances)
-			s.mutex.Unlock()
+			// the read replaces the delayed one
+			l.refresh = nil
+			addMetric(MetricReadThrough, 1)
+			s.readHosts(l, false)
+
+		case <-l.expire:
+			l.expire = s.update(s.last)
 
 		case <-s.ctx.Done():
-			return
+			return false
+		}
+	}
+}
+
+// pause defers the read of the prefix to the end of its pause, returning false if it is not paused
+func (s *Subscriber) pause(l *subscriberLoop) bool {
+	resumed := pauses.paused(s.prefix)
+	if resumed == nil {
+		return false
+	}
+	addMetric(MetricPausedReads, 1)
+	l.resumed = resumed
+	return true
+}
+
+// shedding returns the time remaining until the end of the load shedding mode, or zero if it is not
+// active or the backend is critical
+func (s *Subscriber) shedding() time.Duration {
+	if s.options.critical() {
+		return 0
+	}
+	return s.settings.loadShedder().shedding(GetClock().Now())
+}
+
+// flow returns the flow of the refreshes of the subscriber in the refresh scheduler: its tenant or,
+// without one, its prefix
+func (s *Subscriber) flow() string {
+	if s.options.Tenant != "" {
+		return "tenant:" + s.options.Tenant
+	}
+	return s.prefix
+}
+
+// countRefresh counts the refresh as a change or as a no-op, for the prefix and for all of them, so the
+// noise of the registrators rewriting their entries can be told apart from the real changes
+func (s *Subscriber) countRefresh(hosts []Host) {
+	name := MetricUnchangedRefreshes
+	if (len(hosts) > 0 || len(s.last) > 0) && !reflect.DeepEqual(hosts, s.last) {
+		name = MetricChangedRefreshes
+	}
+	addMetric(name, 1)
+	addMetric(name+"."+s.prefix, 1)
+}
+
+// update stores the received hosts in the cache, along with the ones still in their removal grace
+// period. It returns a channel signaling when the cache must be updated again for expiring them.
+func (s *Subscriber) update(hosts []Host) <-chan time.Time {
+	now := GetClock().Now()
+	instances := hostURLs(hosts)
+	s.churn.track(instances, now)
+	s.last = hosts
+	var next time.Duration
+	if s.grace != nil {
+		instances, next = s.grace.apply(instances, now)
+	}
+
+	s.mutex.Lock()
+	index := make(map[string]Host, len(instances))
+	for _, h := range hosts {
+		index[h.URL] = h
+	}
+	for _, i := range instances {
+		// keep the records of the hosts in their removal grace period
+		if _, ok := index[i]; !ok {
+			index[i] = s.index[i]
+		}
+	}
+	s.index = index
+	*(s.cache) = sd.FixedSubscriber(instances)
+	s.mutex.Unlock()
+	s.countHosts(len(instances))
+
+	if next > 0 {
+		return GetClock().After(next)
+	}
+	return nil
+}
+
+func (s *Subscriber) getEntries() ([]Host, ResponseHeader, error) {
+	return s.read(s.client)
+}
+
+// safeGetEntries reads the prefix like getEntries, turning the panics of the client (e.g. decoding a
+// malformed entry) into ErrPanic
+func (s *Subscriber) safeGetEntries() (hosts []Host, header ResponseHeader, err error) {
+	defer func() {
+		if recovered(s.prefix, recover()) {
+			hosts, header, err = nil, ResponseHeader{}, ErrPanic
+		}
+	}()
+	return s.getEntries()
+}
+
+// read returns the hosts of the prefix read with the received client, applying the backend options and
+// the hooks registered with OnHostsResolved, along with the header of the response. The latency of the
+// read is tracked by the load shedder.
+func (s *Subscriber) read(c Client) ([]Host, ResponseHeader, error) {
+	start := GetClock().Now()
+	hosts, header, err := getHostsWithHeader(c, s.prefix)
+	now := GetClock().Now()
+	s.settings.loadShedder().observe(now.Sub(start), now)
+	if err != nil {
+		return nil, ResponseHeader{}, err
+	}
+	return s.resolveRead(hosts, header.Revision), header, nil
+}
+
+// resolveRead resolves the hosts read at the received revision, along with the writes of the client not
+// confirmed by the read yet
+func (s *Subscriber) resolveRead(hosts []Host, revision int64) []Host {
+	s.lastRead, s.lastRevision = hosts, revision
+	return s.resolve(s.local.apply(s.prefix, hosts, revision))
+}
+
+// resolve applies the backend options and the hooks registered with OnHostsResolved to the hosts read
+func (s *Subscriber) resolve(hosts []Host) []Host {
+	return resolveHosts(s.prefix, s.options, hosts)
+}
+
+// resolveHosts returns the hosts of the top tier read from the prefix, with the backend options and the
+// hooks registered with OnHostsResolved applied
+func resolveHosts(prefix string, options BackendOptions, hosts []Host) []Host {
+	return applyHostsHooks(prefix, options.normalizeHosts(topTier(hosts)))
+}
+
+// LookupHost returns the host with the received url among the ones discovered by the subscribers
+// created by the SubscriberFactory, along with the metadata of its record. See Subscriber.Host.
+func LookupHost(url string) (Host, bool) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for _, sf := range subscribers {
+		if s, ok := sf.(*Subscriber); ok {
+			if h, ok := s.Host(url); ok {
+				return h, true
+			}
 		}
 	}
+	return Host{}, false
 }
@@ -3,6 +3,7 @@ package etcd
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -47,7 +48,7 @@ func TestSubscriberFactory_ko(t *testing.T) {
 		return sd.FixedSubscriberFactory(cfg)
 	}
 
-	conf := config.Backend{Host: []string{"random_etcd_service_name"}}
+	conf := config.Backend{Host: []string{"/random_etcd_service_name"}}
 	SubscriberFactory(ctx, c)(&conf)
 
 	if ops != 1 {
@@ -63,9 +64,10 @@ func TestSubscriberFactory_ok(t *testing.T) {
 		getEntries:  func(string) ([]string, error) { return expectedHosts, nil },
 		watchPrefix: func(string, chan struct{}) {},
 	}
-	conf := config.Backend{Host: []string{"random_etcd_service_name"}}
+	conf := config.Backend{Host: []string{"/random_etcd_service_name"}}
 
 	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
 
 	sf := SubscriberFactory(ctx, c)
 	if len(subscribers) != 0 {
@@ -89,6 +91,89 @@ func TestSubscriberFactory_ok(t *testing.T) {
 	}
 }
 
+func TestSubscriberFactory_backendOptions(t *testing.T) {
+	ctx := context.Background()
+	c := dummyClient{
+		getEntries:  func(string) ([]string, error) { return []string{"10.0.0.1", "https://10.0.0.2:8443"}, nil },
+		watchPrefix: func(string, chan struct{}) {},
+	}
+	conf := config.Backend{
+		Host: []string{"/random_etcd_service_name"},
+		ExtraConfig: config.ExtraConfig{
+			Namespace: map[string]interface{}{
+				"default_scheme": "http",
+				"default_port":   float64(8080),
+			},
+		},
+	}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+
+	hosts, err := SubscriberFactory(ctx, c)(&conf).Hosts()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expectedHosts := []string{"http://10.0.0.1:8080", "https://10.0.0.2:8443"}
+	if !reflect.DeepEqual(hosts, expectedHosts) {
+		t.Errorf("Unexpected hosts. Got: %v, Want: %v\n", hosts, expectedHosts)
+	}
+}
+
+func TestLookupHost(t *testing.T) {
+	ctx := context.Background()
+	c := dummyHostsClient{
+		dummyClient: dummyClient{watchPrefix: func(string, chan struct{}) {}},
+		getHosts: func(string) ([]Host, error) {
+			return []Host{{URL: "10.0.0.1", Metadata: map[string]interface{}{"zone": "eu"}}}, nil
+		},
+	}
+	conf := config.Backend{
+		Host: []string{"/services/metadata"},
+		ExtraConfig: config.ExtraConfig{
+			Namespace: map[string]interface{}{"default_scheme": "http"},
+		},
+	}
+
+	subscribers = map[string]sd.Subscriber{}
+	negativeCache = map[string]negativeEntry{}
+	SubscriberFactory(ctx, c)(&conf)
+
+	h, ok := LookupHost("http://10.0.0.1")
+	if !ok || !reflect.DeepEqual(h.Metadata, map[string]interface{}{"zone": "eu"}) {
+		t.Errorf("unexpected host: %+v, %v", h, ok)
+	}
+	if _, ok := LookupHost("10.0.0.1"); ok {
+		t.Error("the hosts should be looked up by their normalized url")
+	}
+}
+
+func TestNewBackendSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := dummyClient{
+		getEntries:  func(string) ([]string, error) { return []string{"10.0.0.1"}, nil },
+		watchPrefix: func(string, chan struct{}) {},
+	}
+
+	if _, err := NewBackendSubscriber(ctx, c, &config.Backend{}); err != ErrNoPrefix {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	sb, err := NewBackendSubscriber(ctx, c, &config.Backend{
+		Host:        []string{"/random_etcd_service_name"},
+		ExtraConfig: config.ExtraConfig{Namespace: map[string]interface{}{"default_scheme": "http"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, _ := sb.Hosts()
+	if !reflect.DeepEqual(hosts, []string{"http://10.0.0.1"}) {
+		t.Errorf("unexpected hosts: %v", hosts)
+	}
+}
+
 func TestNewSubscriber(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -157,6 +242,150 @@ func TestNewSubscriber_ko(t *testing.T) {
 	}
 }
 
+func TestSubscriber_Hosts_value(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := dummyClient{
+		getEntries:  func(key string) ([]string, error) { return []string{"http://10.0.0.1"}, nil },
+		watchPrefix: func(prefix string, ch chan struct{}) { <-ctx.Done() },
+	}
+	s, err := NewSubscriber(ctx, c, "/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the copies of the subscriber share its state
+	var sb sd.Subscriber = *s
+	s.update([]Host{{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2"}})
+	if hosts, err := sb.Hosts(); err != nil || len(hosts) != 2 {
+		t.Errorf("unexpected hosts: %v %v", hosts, err)
+	}
+}
+
+func TestSubscriber_readThrough(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reads int32
+	release := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(key string) ([]string, error) {
+			atomic.AddInt32(&reads, 1)
+			<-release
+			return []string{"http://10.0.0.1"}, nil
+		},
+		watchPrefix: func(prefix string, ch chan struct{}) { <-ctx.Done() },
+	}
+	before := Metrics()[MetricReadThrough]
+	s := newSeededSubscriber(ctx, c, "/services/api", BackendOptions{ReadThroughTimeout: time.Minute}, PrefixState{})
+
+	results := make(chan []string, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			hosts, _ := s.Hosts()
+			results <- hosts
+		}()
+	}
+	<-time.After(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < 10; i++ {
+		if hosts := <-results; len(hosts) != 1 {
+			t.Errorf("unexpected hosts: %v", hosts)
+		}
+	}
+	if n := atomic.LoadInt32(&reads); n != 1 {
+		t.Errorf("unexpected reads: %d", n)
+	}
+	if v := Metrics()[MetricReadThrough] - before; v != 1 {
+		t.Errorf("unexpected read throughs: %d", v)
+	}
+}
+
+func TestSubscriber_readThroughTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+
+	c := dummyClient{
+		getEntries:  func(key string) ([]string, error) { <-ctx.Done(); return nil, ctx.Err() },
+		watchPrefix: func(prefix string, ch chan struct{}) { <-ctx.Done() },
+	}
+	s := newSeededSubscriber(ctx, c, "/services/api", BackendOptions{}, PrefixState{})
+
+	done := make(chan struct{})
+	go func() {
+		s.Hosts()
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		clock.Advance(DefaultReadThroughTimeout)
+		select {
+		case <-done:
+			// the next requests do not wait for the pending read again
+			next := make(chan struct{})
+			go func() {
+				s.Hosts()
+				close(next)
+			}()
+			select {
+			case <-next:
+			case <-time.After(time.Second):
+				t.Error("the next requests should not wait for the pending read")
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("the request should not wait longer than the read through timeout")
+}
+
+func TestSubscriber_countRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reads := make(chan []string, 3)
+	notify := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(key string) ([]string, error) { return <-reads, nil },
+		watchPrefix: func(prefix string, ch chan struct{}) {
+			for {
+				select {
+				case <-notify:
+					ch <- struct{}{}
+				case <-ctx.Done():
+					return
+				}
+			}
+		},
+	}
+	subscribers = map[string]sd.Subscriber{}
+	before := Metrics()
+	refreshes := func() (int64, int64) {
+		metrics := Metrics()
+		unchanged := MetricUnchangedRefreshes + "./services/refreshes"
+		changed := MetricChangedRefreshes + "./services/refreshes"
+		return metrics[unchanged] - before[unchanged], metrics[changed] - before[changed]
+	}
+	reads <- []string{"http://10.0.0.1"}
+	if _, err := NewSubscriber(ctx, c, "/services/refreshes"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hosts := range [][]string{{"http://10.0.0.1"}, {"http://10.0.0.1"}, {"http://10.0.0.1", "http://10.0.0.2"}} {
+		reads <- hosts
+		notify <- struct{}{}
+	}
+	for i := 0; i < 100; i++ {
+		if unchanged, changed := refreshes(); unchanged == 2 && changed == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	unchanged, changed := refreshes()
+	t.Errorf("unexpected refreshes: %d unchanged, %d changed", unchanged, changed)
+}
+
 type dummyClient struct {
 	getEntries  func(string) ([]string, error)
 	watchPrefix func(string, chan struct{})
@@ -0,0 +1,208 @@
+package etcd
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrTenantQuota is the error wrapped by the TenantQuotaErrors
+var ErrTenantQuota = fmt.Errorf("tenant quota exceeded")
+
+// TenantQuota limits the discovery resources used by the backends of a tenant, so the misconfiguration
+// of a team does not starve the discovery of the others sharing the gateway. The zero values are not
+// limited.
+type TenantQuota struct {
+	// MaxPrefixes is the number of different prefixes the backends of the tenant can watch
+	MaxPrefixes int
+	// MaxWatches is the number of subscribers (and so of watch streams) the tenant can create. The
+	// backends watching the same prefix with different options get different subscribers.
+	MaxWatches int
+	// MaxRefreshRate is the number of reads per second the subscribers of the tenant can do after the
+	// changes notified by their watches. The changes exceeding it are read later.
+	MaxRefreshRate float64
+}
+
+// TenantQuotaError is the error returned by the SubscriberFactory when a backend exceeds the quota of its
+// tenant. The backend gets a fixed subscriber instead.
+type TenantQuotaError struct {
+	Tenant string
+	// Quota is the exceeded quota: "prefixes" or "watches"
+	Quota string
+	Limit int
+}
+
+// Error implements the error interface
+func (e *TenantQuotaError) Error() string {
+	return fmt.Sprintf("%s: the tenant %s reached its limit of %d %s", ErrTenantQuota.Error(), e.Tenant, e.Limit, e.Quota)
+}
+
+// Unwrap returns ErrTenantQuota
+func (*TenantQuotaError) Unwrap() error {
+	return ErrTenantQuota
+}
+
+// tenantState is the quota and the usage of a tenant
+type tenantState struct {
+	quota    TenantQuota
+	prefixes map[string]int
+	watches  int
+	tokens   float64
+	last     time.Time
+}
+
+// tenantRegistry holds the quotas and the usage of the tenants of the subscribers of a client. See
+// clientSettings.
+type tenantRegistry struct {
+	mutex   *sync.Mutex
+	tenants map[string]*tenantState
+}
+
+func newTenantRegistry(quotas map[string]TenantQuota) *tenantRegistry {
+	r := &tenantRegistry{mutex: &sync.Mutex{}, tenants: map[string]*tenantState{}}
+	r.set(quotas)
+	return r
+}
+
+// tenants holds the quotas set with SetTenantQuotas, used by the clients without their own
+var tenants = newTenantRegistry(nil)
+
+// SetTenantQuotas sets the quotas of the tenants declared by the backends with the tenant option. The
+// tenants without a quota are not limited. The usage of the tenants is kept, so the subscribers already
+// created are not affected by a lower quota. The clients created by New with a tenants config keep
+// their own quotas.
+func SetTenantQuotas(quotas map[string]TenantQuota) {
+	tenants.set(quotas)
+}
+
+func (r *tenantRegistry) set(quotas map[string]TenantQuota) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for name, t := range r.tenants {
+		if _, ok := quotas[name]; !ok {
+			t.quota = TenantQuota{}
+		}
+	}
+	for name, q := range quotas {
+		t := r.get(name)
+		t.quota = q
+		t.tokens = 0
+		t.last = time.Time{}
+	}
+}
+
+// parseTenantQuotas parses the tenants config: {"team-a": {"max_prefixes": 20, "max_watches": 40,
+// "max_refresh_rate": 5}}
+func parseTenantQuotas(v interface{}) (map[string]TenantQuota, error) {
+	path := Namespace + ".tenants"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, badConfig(path)
+	}
+	quotas := make(map[string]TenantQuota, len(cfg))
+	for name, o := range cfg {
+		m, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, badConfig(path + "." + name)
+		}
+		var q TenantQuota
+		for key, limit := range map[string]*int{"max_prefixes": &q.MaxPrefixes, "max_watches": &q.MaxWatches} {
+			if o, ok := m[key]; ok {
+				n, ok := o.(float64)
+				if !ok || n < 0 {
+					return nil, badConfig(path + "." + name + "." + key)
+				}
+				*limit = int(n)
+			}
+		}
+		if o, ok := m["max_refresh_rate"]; ok {
+			if q.MaxRefreshRate, ok = o.(float64); !ok || q.MaxRefreshRate < 0 {
+				return nil, badConfig(path + "." + name + ".max_refresh_rate")
+			}
+		}
+		quotas[name] = q
+	}
+	return quotas, nil
+}
+
+// get returns the state of the tenant, creating it if required. It must be called with the mutex locked.
+func (r *tenantRegistry) get(name string) *tenantState {
+	t, ok := r.tenants[name]
+	if !ok {
+		t = &tenantState{prefixes: map[string]int{}}
+		r.tenants[name] = t
+	}
+	return t
+}
+
+// acquire reserves a watch of the prefix for the tenant, returning a TenantQuotaError if it exceeds its
+// quota
+func (r *tenantRegistry) acquire(tenant, prefix string) error {
+	if tenant == "" {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	t := r.get(tenant)
+	if limit := t.quota.MaxWatches; limit > 0 && t.watches >= limit {
+		return &TenantQuotaError{Tenant: tenant, Quota: "watches", Limit: limit}
+	}
+	if _, ok := t.prefixes[prefix]; !ok {
+		if limit := t.quota.MaxPrefixes; limit > 0 && len(t.prefixes) >= limit {
+			return &TenantQuotaError{Tenant: tenant, Quota: "prefixes", Limit: limit}
+		}
+	}
+	t.prefixes[prefix]++
+	t.watches++
+	t.publish(tenant)
+	return nil
+}
+
+// release releases a watch of the prefix reserved with acquire
+func (r *tenantRegistry) release(tenant, prefix string) {
+	if tenant == "" {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	t := r.get(tenant)
+	if t.prefixes[prefix]--; t.prefixes[prefix] <= 0 {
+		delete(t.prefixes, prefix)
+	}
+	t.watches--
+	t.publish(tenant)
+}
+
+// throttle consumes a read of the refresh rate of the tenant, returning the time to wait for the next
+// one if the tenant has exceeded it, or zero
+func (r *tenantRegistry) throttle(tenant string, now time.Time) time.Duration {
+	if tenant == "" {
+		return 0
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	t, ok := r.tenants[tenant]
+	if !ok || t.quota.MaxRefreshRate <= 0 {
+		return 0
+	}
+	rate := t.quota.MaxRefreshRate
+	burst := math.Max(rate, 1)
+	if t.last.IsZero() {
+		t.tokens = burst
+	} else {
+		t.tokens = math.Min(burst, t.tokens+now.Sub(t.last).Seconds()*rate)
+	}
+	t.last = now
+	if t.tokens >= 1 {
+		t.tokens--
+		return 0
+	}
+	return time.Duration((1 - t.tokens) / rate * float64(time.Second))
+}
+
+// publish updates the usage gauges of the tenant. It must be called with the mutex of its registry locked.
+func (t *tenantState) publish(name string) {
+	setMetric(MetricTenantPrefixes+"."+name, int64(len(t.prefixes)))
+	setMetric(MetricTenantWatches+"."+name, int64(t.watches))
+}
@@ -0,0 +1,139 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+	"github.com/devopsfaith/krakend/sd"
+)
+
+func TestSubscriberFactory_tenantQuota(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	subscribers = map[string]sd.Subscriber{}
+	defaults := tenants
+	tenants = newTenantRegistry(nil)
+	defer func() {
+		subscribers = map[string]sd.Subscriber{}
+		tenants = defaults
+	}()
+	SetTenantQuotas(map[string]TenantQuota{"team-a": {MaxPrefixes: 1, MaxWatches: 2}})
+
+	c := dummyClient{
+		getEntries:  func(key string) ([]string, error) { return []string{"http://10.0.0.1"}, nil },
+		watchPrefix: func(prefix string, ch chan struct{}) { <-ctx.Done() },
+	}
+	sf := MetaSubscriberFactory(ctx, c)
+	backend := func(prefix string, extra map[string]interface{}) *config.Backend {
+		cfg := map[string]interface{}{"tenant": "team-a"}
+		for k, v := range extra {
+			cfg[k] = v
+		}
+		return &config.Backend{Host: []string{prefix}, ExtraConfig: config.ExtraConfig{Namespace: cfg}}
+	}
+
+	before := Metrics()[MetricTenantRejections]
+	if _, ok := sf(backend("/services/api", nil)).(*Subscriber); !ok {
+		t.Error("the first prefix should be watched")
+	}
+	if _, ok := sf(backend("/services/api", nil)).(*Subscriber); !ok {
+		t.Error("the cached subscribers should not count against the quota")
+	}
+	if _, ok := sf(backend("/services/users", nil)).(*Subscriber); ok {
+		t.Error("the tenant should not exceed its prefixes")
+	}
+	if _, ok := sf(backend("/services/api", map[string]interface{}{"dedup_hosts": true})).(*Subscriber); !ok {
+		t.Error("the tenant should watch the same prefix with other options")
+	}
+	if _, ok := sf(backend("/services/api", map[string]interface{}{"default_port": 8080.0})).(*Subscriber); ok {
+		t.Error("the tenant should not exceed its watches")
+	}
+	if _, ok := sf(&config.Backend{Host: []string{"/services/users"}}).(*Subscriber); !ok {
+		t.Error("the backends without tenant should not be limited")
+	}
+	if v := Metrics()[MetricTenantRejections] - before; v != 2 {
+		t.Errorf("unexpected rejections: %d", v)
+	}
+	metrics := Metrics()
+	if metrics[MetricTenantPrefixes+".team-a"] != 1 || metrics[MetricTenantWatches+".team-a"] != 2 {
+		t.Errorf("unexpected usage: %d prefixes, %d watches", metrics[MetricTenantPrefixes+".team-a"], metrics[MetricTenantWatches+".team-a"])
+	}
+
+	cancel()
+	for i := 0; i < 100; i++ {
+		if Metrics()[MetricTenantWatches+".team-a"] == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the watches of the tenant were not released")
+}
+
+func TestTenantQuotaError(t *testing.T) {
+	tenants := newTenantRegistry(map[string]TenantQuota{"team-a": {MaxWatches: 1}})
+
+	if err := tenants.acquire("team-a", "/services/api"); err != nil {
+		t.Fatal(err)
+	}
+	err := tenants.acquire("team-a", "/services/api")
+	if !errors.Is(err, ErrTenantQuota) || err.Error() != "tenant quota exceeded: the tenant team-a reached its limit of 1 watches" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	tenants.release("team-a", "/services/api")
+	if err := tenants.acquire("team-a", "/services/api"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestThrottleTenant(t *testing.T) {
+	tenants := newTenantRegistry(map[string]TenantQuota{"team-a": {MaxRefreshRate: 2}})
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if wait := tenants.throttle("team-a", now); wait != 0 {
+			t.Errorf("unexpected wait for the read %d: %v", i, wait)
+		}
+	}
+	if wait := tenants.throttle("team-a", now); wait != 500*time.Millisecond {
+		t.Errorf("unexpected wait: %v", wait)
+	}
+	if wait := tenants.throttle("team-a", now.Add(500*time.Millisecond)); wait != 0 {
+		t.Errorf("unexpected wait: %v", wait)
+	}
+	if wait := tenants.throttle("team-b", now); wait != 0 {
+		t.Errorf("the tenants without quota should not be throttled: %v", wait)
+	}
+}
+
+func TestParseTenantQuotas(t *testing.T) {
+	quotas, err := parseTenantQuotas(map[string]interface{}{
+		"team-a": map[string]interface{}{"max_prefixes": 20.0, "max_watches": 40.0, "max_refresh_rate": 0.5},
+		"team-b": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := quotas["team-a"]; q.MaxPrefixes != 20 || q.MaxWatches != 40 || q.MaxRefreshRate != 0.5 {
+		t.Errorf("unexpected quota: %+v", q)
+	}
+	if q, ok := quotas["team-b"]; !ok || q != (TenantQuota{}) {
+		t.Errorf("unexpected quota: %+v", q)
+	}
+
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: []interface{}{}, path: Namespace + ".tenants"},
+		{cfg: map[string]interface{}{"team-a": 1.0}, path: Namespace + ".tenants.team-a"},
+		{cfg: map[string]interface{}{"team-a": map[string]interface{}{"max_watches": "10"}}, path: Namespace + ".tenants.team-a.max_watches"},
+		{cfg: map[string]interface{}{"team-a": map[string]interface{}{"max_refresh_rate": -1.0}}, path: Namespace + ".tenants.team-a.max_refresh_rate"},
+	} {
+		_, err := parseTenantQuotas(tc.cfg)
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package etcd
+
+// topTier returns the hosts with the lowest priority, so a standby tier is only used when the preferred
+// ones have no hosts left. The hosts in maintenance or with an expiring lease are already discarded, so
+// draining a whole tier fails over to the next one. The failover only happens on an empty tier: the hosts
+// registered but failing their requests are kept, as the health of the backends is not tracked here.
+func topTier(hosts []Host) []Host {
+	if len(hosts) == 0 {
+		return hosts
+	}
+	best := hosts[0].Priority
+	mixed := false
+	for _, h := range hosts[1:] {
+		if h.Priority != best {
+			mixed = true
+		}
+		if h.Priority < best {
+			best = h.Priority
+		}
+	}
+	if !mixed {
+		return hosts
+	}
+	result := make([]Host, 0, len(hosts))
+	for _, h := range hosts {
+		if h.Priority == best {
+			result = append(result, h)
+		}
+	}
+	return result
+}
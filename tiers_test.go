@@ -0,0 +1,84 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTopTier(t *testing.T) {
+	hosts := []Host{{URL: "a", Priority: 10}, {URL: "b", Priority: 20}, {URL: "c", Priority: 10}}
+	if tier := topTier(hosts); !reflect.DeepEqual(hostURLs(tier), []string{"a", "c"}) {
+		t.Errorf("unexpected tier: %v", tier)
+	}
+	if tier := topTier(hosts[1:2]); !reflect.DeepEqual(hostURLs(tier), []string{"b"}) {
+		t.Errorf("unexpected tier: %v", tier)
+	}
+	if tier := topTier(nil); len(tier) != 0 {
+		t.Errorf("unexpected tier: %v", tier)
+	}
+}
+
+func TestDecodeJSON_priority(t *testing.T) {
+	hosts, err := decodeJSON([]byte(`{"host": "10.0.0.1", "port": 8080, "priority": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].Priority != 2 {
+		t.Errorf("unexpected hosts: %+v", hosts)
+	}
+	if _, err := decodeJSON([]byte(`{"host": "10.0.0.1", "priority": 1.5}`)); err == nil {
+		t.Error("expecting an error decoding a non integer priority")
+	}
+}
+
+type dummyHostsClient struct {
+	dummyClient
+	getHosts func(string) ([]Host, error)
+}
+
+func (d dummyHostsClient) GetHosts(prefix string) ([]Host, error) { return d.getHosts(prefix) }
+
+func TestNewSubscriber_failover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mutex := &sync.Mutex{}
+	hosts := []Host{{URL: "primary", Priority: 0}, {URL: "standby", Priority: 1}}
+	notify := make(chan struct{})
+	c := dummyHostsClient{
+		dummyClient: dummyClient{
+			watchPrefix: func(_ string, ch chan struct{}) {
+				for range notify {
+					ch <- struct{}{}
+				}
+			},
+		},
+		getHosts: func(string) ([]Host, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return hosts, nil
+		},
+	}
+
+	s, err := NewSubscriber(ctx, c, "/services/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := s.Hosts(); !reflect.DeepEqual(h, []string{"primary"}) {
+		t.Errorf("unexpected hosts: %v", h)
+	}
+
+	mutex.Lock()
+	hosts = hosts[1:]
+	mutex.Unlock()
+	notify <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+
+	if h, _ := s.Hosts(); !reflect.DeepEqual(h, []string{"standby"}) {
+		t.Errorf("unexpected hosts: %v", h)
+	}
+	close(notify)
+}
@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"sync"
+)
+
+// TLSProvider provides the TLS config of the connections to the cluster, so the client certificates can
+// be fetched and renewed by an external system instead of being baked into the images
+type TLSProvider interface {
+	// TLSConfig returns the TLS config of the connections. The provider can keep renewing the
+	// certificates it returns until the context is canceled.
+	TLSConfig(ctx context.Context) (*tls.Config, error)
+}
+
+// TLSProviderFactory creates a TLSProvider from its config
+type TLSProviderFactory func(cfg map[string]interface{}) (TLSProvider, error)
+
+// TLSProviderVault is the type of the providers issuing the certificates with Vault. See VaultTLSProvider.
+const TLSProviderVault = "vault"
+
+var (
+	tlsProviderFactories = map[string]TLSProviderFactory{
+		TLSProviderVault: newVaultTLSProvider,
+	}
+	tlsProviderFactoriesMutex = &sync.RWMutex{}
+)
+
+// RegisterTLSProviderFactory registers a factory for the TLS providers of the given type, so they can be
+// declared in the config. Registering an existing type replaces it.
+func RegisterTLSProviderFactory(name string, f TLSProviderFactory) {
+	tlsProviderFactoriesMutex.Lock()
+	tlsProviderFactories[name] = f
+	tlsProviderFactoriesMutex.Unlock()
+}
+
+func getTLSProviderFactory(name string) (TLSProviderFactory, bool) {
+	tlsProviderFactoriesMutex.RLock()
+	f, ok := tlsProviderFactories[name]
+	tlsProviderFactoriesMutex.RUnlock()
+	return f, ok
+}
+
+// parseTLSProvider parses the tls_provider config: {"type": "vault", ...}. The paths of the returned
+// ConfigErrors are relative to the client options.
+func parseTLSProvider(v interface{}) (TLSProvider, error) {
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, badConfig("tls_provider")
+	}
+	name, _ := cfg["type"].(string)
+	f, ok := getTLSProviderFactory(name)
+	if !ok {
+		return nil, badConfig("tls_provider.type")
+	}
+	p, err := f(cfg)
+	if err != nil {
+		return nil, withPath("tls_provider", err)
+	}
+	return p, nil
+}
+
+// newTLSConfig returns the TLS config of the connections to the cluster, or nil if the options do not
+// enable TLS. The material comes from the TLSProvider, if any, from the SPIFFE Workload API if the
+// SPIFFESocket is defined (along with the SPIFFEServerID), or from the Cert, Key and CACert files.
+func newTLSConfig(ctx context.Context, options ClientOptions) (*tls.Config, error) {
+	if options.TLSProvider != nil {
+		return options.TLSProvider.TLSConfig(ctx)
+	}
+	if options.SPIFFESocket != "" {
+		if options.SPIFFEServerID == "" {
+			return nil, ErrNoSPIFFEServerID
+		}
+		s := NewWorkloadAPISource(ctx, options.SPIFFESocket)
+		if err := s.Wait(options.DialTimeout); err != nil {
+			return nil, err
+		}
+		return s.TLSConfig(options.SPIFFEServerID), nil
+	}
+
+	if options.Cert == "" || options.Key == "" {
+		return nil, nil
+	}
+	tlsCert, err := tls.LoadX509KeyPair(options.Cert, options.Key)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+	}
+	if caCertCt, err := ioutil.ReadFile(options.CACert); err == nil {
+		caCertPool := x509.NewCertPool()
+		caCertPool.AppendCertsFromPEM(caCertCt)
+		tlsCfg.RootCAs = caCertPool
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,65 @@
+package etcd
+
+import (
+	"bytes"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+// touchWrite returns true if the v3 event rewrote a key with the value it already had, like the
+// heartbeats of the registrators refreshing their entries. The lease is compared too when it matters,
+// since the entries with an expiring lease are discarded (see ClientOptions.LeaseMargin).
+func touchWrite(ev *etcdv3.Event, compareLease bool) bool {
+	if ev.Type != mvccpb.PUT || ev.Kv == nil || ev.PrevKv == nil {
+		return false
+	}
+	if !bytes.Equal(ev.Kv.Value, ev.PrevKv.Value) {
+		return false
+	}
+	return !compareLease || ev.Kv.Lease == ev.PrevKv.Lease
+}
+
+// onlyTouches returns true if all the events of the v3 watch response are touch writes, counting them
+func onlyTouches(resp etcdv3.WatchResponse, compareLease bool) bool {
+	if len(resp.Events) == 0 {
+		return false
+	}
+	for _, ev := range resp.Events {
+		if !touchWrite(ev, compareLease) {
+			return false
+		}
+	}
+	addMetric(MetricIgnoredTouches, int64(len(resp.Events)))
+	return true
+}
+
+// touchResponse returns true if the v2 watch response rewrote a key with the value it already had,
+// counting it
+func touchResponse(resp *etcd.Response) bool {
+	if resp == nil || resp.Node == nil || resp.PrevNode == nil || resp.Node.Dir {
+		return false
+	}
+	switch resp.Action {
+	case "set", "update", "compareAndSwap":
+	default:
+		return false
+	}
+	if resp.Node.Value != resp.PrevNode.Value {
+		return false
+	}
+	addMetric(MetricIgnoredTouches, 1)
+	return true
+}
+
+// watchOptions returns the options of the v3 watches of the prefixes, requesting the previous values of
+// the keys if the touch writes are ignored. The watches are always fragmented, so the servers split the
+// change batches exceeding their max request size instead of failing to send them, and the client
+// reassembles them before delivering the response.
+func watchOptions(options ClientOptions) []etcdv3.OpOption {
+	if !options.IgnoreTouches {
+		return []etcdv3.OpOption{etcdv3.WithPrefix(), etcdv3.WithFragment()}
+	}
+	return []etcdv3.OpOption{etcdv3.WithPrefix(), etcdv3.WithFragment(), etcdv3.WithPrevKV()}
+}
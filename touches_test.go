@@ -0,0 +1,89 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	etcd "github.com/devopsfaith/krakend-etcd/internal/etcdv2"
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func TestTouchWrite(t *testing.T) {
+	kv := func(value string, lease int64) *mvccpb.KeyValue {
+		return &mvccpb.KeyValue{Key: []byte("/services/api/1"), Value: []byte(value), Lease: lease}
+	}
+	for i, tc := range []struct {
+		ev           *etcdv3.Event
+		compareLease bool
+		expected     bool
+	}{
+		{ev: &etcdv3.Event{Type: mvccpb.PUT, Kv: kv("http://10.0.0.1", 1), PrevKv: kv("http://10.0.0.1", 1)}, expected: true},
+		{ev: &etcdv3.Event{Type: mvccpb.PUT, Kv: kv("http://10.0.0.1", 2), PrevKv: kv("http://10.0.0.1", 1)}, expected: true},
+		{ev: &etcdv3.Event{Type: mvccpb.PUT, Kv: kv("http://10.0.0.1", 2), PrevKv: kv("http://10.0.0.1", 1)}, compareLease: true},
+		{ev: &etcdv3.Event{Type: mvccpb.PUT, Kv: kv("http://10.0.0.2", 1), PrevKv: kv("http://10.0.0.1", 1)}},
+		{ev: &etcdv3.Event{Type: mvccpb.PUT, Kv: kv("http://10.0.0.1", 1)}},
+		{ev: &etcdv3.Event{Type: mvccpb.DELETE, Kv: kv("", 0), PrevKv: kv("", 0)}},
+	} {
+		if touchWrite(tc.ev, tc.compareLease) != tc.expected {
+			t.Errorf("unexpected result for the event %d", i)
+		}
+	}
+}
+
+func TestWatchMux_ignoreTouches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := &fakeV3Watcher{ch: make(chan etcdv3.WatchResponse)}
+	m := newWatchMux(ctx, watcher, ClientOptions{WatchRoot: "/services/", IgnoreTouches: true})
+	api := make(chan struct{})
+	go m.watchPrefix("/services/api/", api)
+	<-api
+
+	before := Metrics()[MetricIgnoredTouches]
+	touch := &etcdv3.Event{
+		Type:   mvccpb.PUT,
+		Kv:     &mvccpb.KeyValue{Key: []byte("/services/api/1"), Value: []byte("http://10.0.0.1")},
+		PrevKv: &mvccpb.KeyValue{Key: []byte("/services/api/1"), Value: []byte("http://10.0.0.1")},
+	}
+	watcher.ch <- etcdv3.WatchResponse{Events: []*etcdv3.Event{touch}}
+	select {
+	case <-api:
+		t.Fatal("the touch writes should not be notified")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if v := Metrics()[MetricIgnoredTouches] - before; v != 1 {
+		t.Errorf("unexpected ignored touches: %d", v)
+	}
+
+	watcher.ch <- etcdv3.WatchResponse{Events: []*etcdv3.Event{touch, {
+		Type: mvccpb.PUT,
+		Kv:   &mvccpb.KeyValue{Key: []byte("/services/api/2"), Value: []byte("http://10.0.0.2")},
+	}}}
+	select {
+	case <-api:
+	case <-time.After(time.Second):
+		t.Fatal("the api prefix has not been notified")
+	}
+}
+
+func TestTouchResponse(t *testing.T) {
+	node := func(value string) *etcd.Node { return &etcd.Node{Key: "/services/api/1", Value: value} }
+	for i, tc := range []struct {
+		resp     *etcd.Response
+		expected bool
+	}{
+		{resp: &etcd.Response{Action: "set", Node: node("http://10.0.0.1"), PrevNode: node("http://10.0.0.1")}, expected: true},
+		{resp: &etcd.Response{Action: "update", Node: node("http://10.0.0.1"), PrevNode: node("http://10.0.0.1")}, expected: true},
+		{resp: &etcd.Response{Action: "set", Node: node("http://10.0.0.2"), PrevNode: node("http://10.0.0.1")}},
+		{resp: &etcd.Response{Action: "create", Node: node("http://10.0.0.1")}},
+		{resp: &etcd.Response{Action: "expire", Node: node(""), PrevNode: node("")}},
+		{},
+	} {
+		if touchResponse(tc.resp) != tc.expected {
+			t.Errorf("unexpected result for the response %d", i)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultVaultTimeout is the default timeout of the requests of a VaultTLSProvider
+	DefaultVaultTimeout = 5 * time.Second
+	// DefaultVaultMount is the default mount path of the PKI secrets engine
+	DefaultVaultMount = "pki"
+
+	// vaultRetry is the delay before retrying a failed renewal
+	vaultRetry = 10 * time.Second
+)
+
+// VaultTLSProvider is a TLSProvider issuing the client certificates with the PKI secrets engine of a
+// HashiCorp Vault. The certificates are issued again once two thirds of their validity have elapsed, so
+// the connections never present an expired one.
+type VaultTLSProvider struct {
+	// Address of the Vault server, e.g. "https://vault.example.com:8200"
+	Address string
+	Token   string
+	// Mount is the path of the PKI secrets engine. DefaultVaultMount if empty.
+	Mount      string
+	Role       string
+	CommonName string
+	// TTL requested for the certificates. The default TTL of the role is used if zero.
+	TTL time.Duration
+	// RootCAs verifying the servers. The CA chain of the issued certificates is used if nil.
+	RootCAs *x509.CertPool
+	Client  *http.Client
+
+	mutex   *sync.RWMutex
+	cert    *tls.Certificate
+	issuing *x509.CertPool
+	started bool
+}
+
+// NewVaultTLSProvider returns a VaultTLSProvider issuing the certificates for the common name with the
+// role, authenticated with the token. The timeout is DefaultVaultTimeout if it is not positive.
+func NewVaultTLSProvider(address, token, role, commonName string, timeout time.Duration) *VaultTLSProvider {
+	if timeout <= 0 {
+		timeout = DefaultVaultTimeout
+	}
+	return &VaultTLSProvider{
+		Address:    address,
+		Token:      token,
+		Mount:      DefaultVaultMount,
+		Role:       role,
+		CommonName: commonName,
+		Client:     &http.Client{Timeout: timeout},
+		mutex:      &sync.RWMutex{},
+	}
+}
+
+// TLSConfig implements the TLSProvider interface. The first call issues a certificate and keeps renewing
+// it until the context is canceled. The clients sharing the provider share the certificate too.
+func (p *VaultTLSProvider) TLSConfig(ctx context.Context) (*tls.Config, error) {
+	p.mutex.Lock()
+	if !p.started {
+		cert, pool, err := p.Issue(ctx)
+		if err != nil {
+			p.mutex.Unlock()
+			return nil, err
+		}
+		p.cert, p.issuing, p.started = cert, pool, true
+		go p.renew(ctx, cert.Leaf)
+	}
+	roots := p.RootCAs
+	if roots == nil {
+		roots = p.issuing
+	}
+	p.mutex.Unlock()
+
+	return &tls.Config{
+		RootCAs: roots,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return p.Certificate(), nil
+		},
+	}, nil
+}
+
+// Certificate returns the current certificate, or nil if none has been issued yet
+func (p *VaultTLSProvider) Certificate() *tls.Certificate {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.cert
+}
+
+type vaultIssueRequest struct {
+	CommonName string `json:"common_name"`
+	TTL        string `json:"ttl,omitempty"`
+}
+
+type vaultIssueResponse struct {
+	Data struct {
+		Certificate string   `json:"certificate"`
+		PrivateKey  string   `json:"private_key"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// Issue requests a new certificate to Vault, returning it along with the pool of its issuing CAs
+func (p *VaultTLSProvider) Issue(ctx context.Context) (*tls.Certificate, *x509.CertPool, error) {
+	body := vaultIssueRequest{CommonName: p.CommonName}
+	if p.TTL > 0 {
+		body.TTL = p.TTL.String()
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	mount := p.Mount
+	if mount == "" {
+		mount = DefaultVaultMount
+	}
+	endpoint := strings.TrimRight(p.Address, "/") + "/v1/" + strings.Trim(mount, "/") + "/issue/" + p.Role
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.Token)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var r vaultIssueResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("vault %s answered with status %d: %s", p.Address, resp.StatusCode, strings.Join(r.Errors, ", "))
+	}
+
+	cert, err := tls.X509KeyPair([]byte(r.Data.Certificate), []byte(r.Data.PrivateKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(r.Data.IssuingCA))
+	for _, ca := range r.Data.CAChain {
+		pool.AppendCertsFromPEM([]byte(ca))
+	}
+	return &cert, pool, nil
+}
+
+// renew issues a new certificate once two thirds of the validity of the current one have elapsed, until
+// the context is canceled. The failed renewals are retried while the current certificate is valid.
+func (p *VaultTLSProvider) renew(ctx context.Context, leaf *x509.Certificate) {
+	for {
+		validity := leaf.NotAfter.Sub(leaf.NotBefore)
+		wait := leaf.NotBefore.Add(validity * 2 / 3).Sub(GetClock().Now())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-GetClock().After(wait):
+			}
+			cert, _, err := p.Issue(ctx)
+			if err == nil {
+				p.mutex.Lock()
+				p.cert = cert
+				p.mutex.Unlock()
+				leaf = cert.Leaf
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			getLogger().Warning("etcd: unable to renew the client certificate with vault:", err.Error())
+			wait = Jitter(vaultRetry)
+		}
+	}
+}
+
+// newVaultTLSProvider creates a VaultTLSProvider from its config. The address and the token can be
+// declared with the VAULT_ADDR and VAULT_TOKEN environment variables too, and the token can be read from
+// a file (token_file), so it can be mounted as a secret.
+func newVaultTLSProvider(cfg map[string]interface{}) (TLSProvider, error) {
+	address, _ := cfg["address"].(string)
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, badConfig("address")
+	}
+	token, _ := cfg["token"].(string)
+	if path, ok := cfg["token_file"].(string); ok {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, badConfig("token_file")
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, badConfig("token")
+	}
+	role, err := stringOption(cfg, "role")
+	if err != nil {
+		return nil, err
+	}
+	commonName, err := stringOption(cfg, "common_name")
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewVaultTLSProvider(address, token, role, commonName, timeoutOption(cfg))
+	if mount, ok := cfg["mount"].(string); ok && mount != "" {
+		p.Mount = mount
+	}
+	if o, ok := cfg["ttl"]; ok {
+		if p.TTL, err = parseDuration(o); err != nil {
+			return nil, badConfig("ttl")
+		}
+	}
+	if path, ok := cfg["cacert"].(string); ok {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, badConfig("cacert")
+		}
+		p.RootCAs = x509.NewCertPool()
+		p.RootCAs.AppendCertsFromPEM(b)
+	}
+	return p, nil
+}
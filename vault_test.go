@@ -0,0 +1,148 @@
+package etcd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVaultTLSProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clock := newFakeClock()
+	SetClock(clock)
+	defer SetClock(nil)
+	SetJitter(0)
+	defer SetJitter(DefaultJitter)
+
+	ca := newTestIdentity(t, "ca", nil)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	mutex := &sync.Mutex{}
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/pki-etcd/issue/gateway" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if token := r.Header.Get("X-Vault-Token"); token != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		var req vaultIssueRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CommonName != "krakend.example.com" || req.TTL != "3h0m0s" {
+			t.Errorf("unexpected body: %+v %v", req, err)
+		}
+		mutex.Lock()
+		issued++
+		serial := issued
+		mutex.Unlock()
+
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(serial)),
+			Subject:      pkix.Name{CommonName: req.CommonName},
+			NotBefore:    clock.Now(),
+			NotAfter:     clock.Now().Add(3 * time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca.cert, &key.PublicKey, ca.key)
+		keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+		resp := map[string]interface{}{"data": map[string]interface{}{
+			"certificate": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			"private_key": string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+			"issuing_ca":  string(caPEM),
+		}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	p := NewVaultTLSProvider(server.URL, "bad token", "gateway", "krakend.example.com", 0)
+	p.Mount = "/pki-etcd/"
+	p.TTL = 3 * time.Hour
+	if _, err := p.TLSConfig(ctx); err == nil || err.Error() != "vault "+server.URL+" answered with status 403: permission denied" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	p.Token = "s.token"
+	cfg, err := p.TLSConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.TLSConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := cfg.GetClientCertificate(nil)
+	if err != nil || cert.Leaf.SerialNumber.Int64() != 1 {
+		t.Fatalf("unexpected certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if !cfg.RootCAs.Equal(roots) {
+		t.Error("unexpected root CAs")
+	}
+
+	clock.Advance(time.Hour)
+	if cert, _ := cfg.GetClientCertificate(nil); cert.Leaf.SerialNumber.Int64() != 1 {
+		t.Error("the certificate should not be renewed yet")
+	}
+
+	for i := 0; i < 100; i++ {
+		clock.Advance(time.Hour)
+		if cert, _ := cfg.GetClientCertificate(nil); cert.Leaf.SerialNumber.Int64() == 2 {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if issued != 2 {
+				t.Errorf("unexpected number of certificates issued: %d", issued)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the certificate was not renewed")
+}
+
+func TestParseOptions_tlsProvider(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "vault", path: "tls_provider"},
+		{cfg: map[string]interface{}{"type": "files"}, path: "tls_provider.type"},
+		{cfg: map[string]interface{}{"type": "vault", "address": "http://vault:8200", "token": "s.token"}, path: "tls_provider.role"},
+		{cfg: map[string]interface{}{"type": "vault", "address": "http://vault:8200", "token_file": "unknown"}, path: "tls_provider.token_file"},
+		{cfg: map[string]interface{}{"type": "vault", "address": "http://vault:8200", "token": "s.token", "role": "gateway", "common_name": "krakend", "ttl": true}, path: "tls_provider.ttl"},
+	} {
+		_, err := parseOptionsMap(map[string]interface{}{"tls_provider": tc.cfg})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+
+	options, err := parseOptionsMap(map[string]interface{}{"tls_provider": map[string]interface{}{
+		"type":        "vault",
+		"address":     "http://vault:8200",
+		"token":       "s.token",
+		"role":        "gateway",
+		"common_name": "krakend",
+		"mount":       "pki-etcd",
+		"ttl":         "24h",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := options.TLSProvider.(*VaultTLSProvider)
+	if !ok || p.Mount != "pki-etcd" || p.TTL != 24*time.Hour || p.Client.Timeout != DefaultVaultTimeout {
+		t.Errorf("unexpected provider: %+v", options.TLSProvider)
+	}
+}
@@ -0,0 +1,136 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+// SDName is the value of the sd field of the backends relying on the etcd subscriber
+const SDName = "etcd"
+
+// PrefixReport is the result of resolving the prefix of one or more backends
+type PrefixReport struct {
+	Prefix string
+	Hosts  []string
+	Err    error
+}
+
+// Report contains the results of the verification of every prefix
+type Report []PrefixReport
+
+// Failed returns the reports of the prefixes that could not be resolved or did not contain any entry
+func (r Report) Failed() Report {
+	failed := Report{}
+	for _, p := range r {
+		if p.Err != nil || len(p.Hosts) == 0 {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
+
+// Err returns an error describing all the failed prefixes, or nil if there are none
+func (r Report) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(failed))
+	for i, p := range failed {
+		if p.Err != nil {
+			msgs[i] = fmt.Sprintf("%s: %s", p.Prefix, p.Err.Error())
+			continue
+		}
+		msgs[i] = fmt.Sprintf("%s: no hosts", p.Prefix)
+	}
+	return fmt.Errorf("unable to verify the etcd prefixes: %s", strings.Join(msgs, ", "))
+}
+
+// Verify resolves once every prefix used by the backends of the service config relying on the etcd
+// subscriber, applying their backend options, and reports the hosts found or the error returned for
+// each of them. The prefixes read with the received client are read with a single batch, so they run
+// concurrently under a shared deadline if the client supports it. See GetEntriesBatch. It does not start
+// any watch.
+func Verify(c Client, cfg config.ServiceConfig) Report {
+	report := Report{}
+	batched := map[int]BackendOptions{}
+	prefixes := []string{}
+	backendPrefixes(c, cfg, func(prefix string, options BackendOptions, err error) {
+		if err != nil {
+			report = append(report, PrefixReport{Prefix: prefix, Err: err})
+			return
+		}
+		if !options.scoped() {
+			batched[len(report)] = options
+			prefixes = append(prefixes, prefix)
+			report = append(report, PrefixReport{Prefix: prefix})
+			return
+		}
+		hosts, err := options.scope(c).GetEntries(prefix)
+		report = append(report, PrefixReport{
+			Prefix: prefix,
+			Hosts:  options.normalize(hosts),
+			Err:    err,
+		})
+	})
+
+	entries, errs := readBatch(c, prefixes)
+	for i, options := range batched {
+		prefix := report[i].Prefix
+		if err, ok := errs[prefix]; ok {
+			report[i].Err = err
+			continue
+		}
+		report[i].Hosts = options.normalize(entries[prefix])
+	}
+	return report
+}
+
+// backendPrefixes calls f once for every prefix used by the backends of the service config relying on
+// the etcd subscriber, as rewritten for the client, along with their options. The backends without a
+// prefix or with a bad config are passed with the error.
+func backendPrefixes(c Client, cfg config.ServiceConfig, f func(prefix string, options BackendOptions, err error)) {
+	visited := map[string]struct{}{}
+	for _, e := range cfg.Endpoints {
+		for _, b := range e.Backend {
+			if b.SD != SDName {
+				continue
+			}
+			if len(b.Host) == 0 {
+				f("", BackendOptions{}, ErrNoPrefix)
+				continue
+			}
+			options, err := parseBackendOptions(b.ExtraConfig)
+			if err != nil {
+				f(b.Host[0], options, err)
+				continue
+			}
+			prefix, err := options.prefix(c, b.Host[0])
+			if err != nil {
+				f(b.Host[0], options, err)
+				continue
+			}
+			key := options.key(prefix)
+			if _, ok := visited[key]; ok {
+				continue
+			}
+			visited[key] = struct{}{}
+			f(prefix, options, nil)
+		}
+	}
+}
+
+// NewVerified creates an etcd client with the config extracted from the extra config of the service
+// and verifies every prefix used by its backends before returning it. The client and the report are
+// returned along with the verification error, so the caller can decide to start serving anyway.
+func NewVerified(ctx context.Context, cfg config.ServiceConfig) (Client, Report, error) {
+	c, err := New(ctx, cfg.ExtraConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := Verify(c, cfg)
+	return c, report, report.Err()
+}
@@ -0,0 +1,104 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devopsfaith/krakend/config"
+)
+
+func TestVerify(t *testing.T) {
+	calls := map[string]int{}
+	c := dummyClient{
+		getEntries: func(prefix string) ([]string, error) {
+			calls[prefix]++
+			switch prefix {
+			case "/services/ok":
+				return []string{"10.0.0.1:8080"}, nil
+			case "/services/empty":
+				return []string{}, nil
+			}
+			return nil, fmt.Errorf("random fail")
+		},
+		watchPrefix: func(string, chan struct{}) {},
+	}
+	httpOptions := config.ExtraConfig{Namespace: map[string]interface{}{"default_scheme": "http"}}
+	cfg := config.ServiceConfig{
+		Endpoints: []*config.EndpointConfig{
+			{
+				Backend: []*config.Backend{
+					{SD: SDName, Host: []string{"/services/ok"}, ExtraConfig: httpOptions},
+					{SD: SDName, Host: []string{"/services/empty"}},
+					{Host: []string{"http://static.local"}},
+				},
+			},
+			{
+				Backend: []*config.Backend{
+					{SD: SDName, Host: []string{"/services/ok"}, ExtraConfig: httpOptions},
+					{SD: SDName, Host: []string{"/services/typo"}},
+					{SD: SDName},
+				},
+			},
+		},
+	}
+
+	report := Verify(c, cfg)
+	if len(report) != 4 {
+		t.Fatalf("unexpected report size: %d", len(report))
+	}
+	if calls["/services/ok"] != 1 {
+		t.Errorf("the prefix should be resolved once. calls: %d", calls["/services/ok"])
+	}
+	if !reflect.DeepEqual(report[0].Hosts, []string{"http://10.0.0.1:8080"}) {
+		t.Errorf("unexpected hosts: %v", report[0].Hosts)
+	}
+
+	failed := report.Failed()
+	if len(failed) != 3 {
+		t.Fatalf("unexpected number of failures: %d", len(failed))
+	}
+	if failed[0].Prefix != "/services/empty" || failed[1].Prefix != "/services/typo" || failed[2].Err != ErrNoPrefix {
+		t.Errorf("unexpected failures: %+v", failed)
+	}
+
+	expected := "unable to verify the etcd prefixes: /services/empty: no hosts, /services/typo: random fail, : " + ErrNoPrefix.Error()
+	if err := report.Err(); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := report[:1].Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerify_batch(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	c := batchDummyClient{
+		dummyClient: dummyClient{
+			getEntries: func(prefix string) ([]string, error) {
+				if prefix == "/services/slow" {
+					<-block
+				}
+				return []string{"10.0.0.1:8080"}, nil
+			},
+		},
+		timeout: 50 * time.Millisecond,
+	}
+	httpOptions := config.ExtraConfig{Namespace: map[string]interface{}{"default_scheme": "http"}}
+	cfg := config.ServiceConfig{Endpoints: []*config.EndpointConfig{{Backend: []*config.Backend{
+		{SD: SDName, Host: []string{"/services/ok"}, ExtraConfig: httpOptions},
+		{SD: SDName, Host: []string{"/services/slow"}},
+	}}}}
+
+	report := Verify(c, cfg)
+	if len(report) != 2 || report[0].Err != nil || !reflect.DeepEqual(report[0].Hosts, []string{"http://10.0.0.1:8080"}) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report[1].Prefix != "/services/slow" || report[1].Err != context.DeadlineExceeded {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
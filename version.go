@@ -0,0 +1,136 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// ErrUnsupportedVersion is the error returned when the version of the etcd servers is not supported by
+// the configured client version
+var ErrUnsupportedVersion = fmt.Errorf("unsupported etcd server version")
+
+// compatibleVersions are the ranges of etcd server versions (major.minor) known to be supported by each
+// client version. The v2 API is not served since etcd 3.6.
+var compatibleVersions = map[string][2]string{
+	"v2": {"2.0", "3.5"},
+	"v3": {"3.0", "3.5"},
+}
+
+// Versioner is implemented by the clients able to report the version of the etcd servers
+type Versioner interface {
+	ServerVersion() (string, error)
+}
+
+// VersionSkewError is the ErrUnsupportedVersion returned along with the versions involved, so
+// errors.Is(err, ErrUnsupportedVersion) still holds
+type VersionSkewError struct {
+	ClientVersion string
+	ServerVersion string
+}
+
+// Error implements the error interface
+func (e *VersionSkewError) Error() string {
+	r := compatibleVersions[e.ClientVersion]
+	return fmt.Sprintf("%s: %s with client_version %s (supported: %s - %s)", ErrUnsupportedVersion.Error(), e.ServerVersion, e.ClientVersion, r[0], r[1])
+}
+
+// Unwrap returns ErrUnsupportedVersion
+func (*VersionSkewError) Unwrap() error {
+	return ErrUnsupportedVersion
+}
+
+// checkVersion returns a VersionSkewError if the server version is out of the range supported by the
+// client version
+func checkVersion(clientVersion, serverVersion string) error {
+	r, ok := compatibleVersions[clientVersion]
+	if !ok {
+		return nil
+	}
+	v, ok := parseMinorVersion(serverVersion)
+	if !ok {
+		return &VersionSkewError{ClientVersion: clientVersion, ServerVersion: serverVersion}
+	}
+	lower, _ := parseMinorVersion(r[0])
+	upper, _ := parseMinorVersion(r[1])
+	if v < lower || v > upper {
+		return &VersionSkewError{ClientVersion: clientVersion, ServerVersion: serverVersion}
+	}
+	return nil
+}
+
+// parseMinorVersion returns the major and minor components of a version as a comparable number
+func parseMinorVersion(v string) (int, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil || major < 0 {
+		return 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil || minor < 0 || minor >= 1000 {
+		return 0, false
+	}
+	return major*1000 + minor, true
+}
+
+// verifyVersion compares the version of the servers with the client version. Unsupported combinations
+// are logged, unless strict is set, in which case the error is returned. The clients not implementing
+// Versioner and the servers not answering are not checked.
+func verifyVersion(c Client, clientVersion string, strict bool) error {
+	vc, ok := c.(Versioner)
+	if !ok {
+		return nil
+	}
+	serverVersion, err := vc.ServerVersion()
+	if err != nil {
+		getLogger().Warning("etcd: unable to check the server version:", "client_version="+clientVersion, "error="+err.Error())
+		return nil
+	}
+	err = checkVersion(clientVersion, serverVersion)
+	if err == nil || strict {
+		return err
+	}
+	r := compatibleVersions[clientVersion]
+	getLogger().Warning("etcd: unsupported server version:", "client_version="+clientVersion, "server_version="+serverVersion,
+		"supported="+r[0]+"-"+r[1])
+	return nil
+}
+
+// ServerVersion implements the etcd Versioner interface.
+func (c *client) ServerVersion() (string, error) {
+	if c.etcdClient == nil {
+		return "", ErrNilClient
+	}
+	ctx, cancel := context.WithTimeout(c.requestContext(), c.options.HeaderTimeoutPerRequest)
+	defer cancel()
+	v, err := c.etcdClient.GetVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return v.Server, nil
+}
+
+// ServerVersion implements the etcd Versioner interface. The version of the first endpoint answering
+// is returned.
+func (c *clientv3) ServerVersion() (string, error) {
+	if c.client == nil {
+		return "", ErrNilClient
+	}
+	var err error
+	for _, endpoint := range c.client.Endpoints() {
+		ctx, cancel := context.WithTimeout(c.requestContext(), c.timeout)
+		var resp *etcdv3.StatusResponse
+		resp, err = c.client.Status(ctx, endpoint)
+		cancel()
+		if err == nil {
+			return resp.Version, nil
+		}
+	}
+	return "", err
+}
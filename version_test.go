@@ -0,0 +1,70 @@
+package etcd
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+type dummyVersionClient struct {
+	dummyClient
+	version string
+	err     error
+}
+
+func (d dummyVersionClient) ServerVersion() (string, error) { return d.version, d.err }
+
+func TestCheckVersion(t *testing.T) {
+	for _, tc := range []struct {
+		client, server string
+		ok             bool
+	}{
+		{"v2", "2.3.8", true},
+		{"v2", "3.5.9", true},
+		{"v2", "3.6.0", false},
+		{"v2", "1.9.0", false},
+		{"v3", "3.0.0", true},
+		{"v3", "3.4.27", true},
+		{"v3", "2.3.8", false},
+		{"v3", "4.0.0", false},
+		{"v3", "unknown", false},
+		{"v4", "3.4.0", true},
+	} {
+		err := checkVersion(tc.client, tc.server)
+		if (err == nil) != tc.ok {
+			t.Errorf("unexpected result for %s and %s: %v", tc.client, tc.server, err)
+		}
+		if err != nil && !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("unexpected error for %s and %s: %v", tc.client, tc.server, err)
+		}
+	}
+}
+
+func TestVerifyVersion(t *testing.T) {
+	l := &dummyLogger{mutex: &sync.Mutex{}}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	if err := verifyVersion(dummyVersionClient{version: "3.4.0"}, "v3", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verifyVersion(dummyVersionClient{version: "2.3.8"}, "v3", false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := verifyVersion(dummyVersionClient{version: "2.3.8"}, "v3", true)
+	if se, ok := err.(*VersionSkewError); !ok || se.ServerVersion != "2.3.8" || se.ClientVersion != "v3" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verifyVersion(dummyVersionClient{err: errors.New("unavailable")}, "v3", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := verifyVersion(dummyClient{}, "v3", true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.warnings) != 2 || l.warnings[0] != "client_version=v3" {
+		t.Errorf("unexpected warnings: %v", l.warnings)
+	}
+}
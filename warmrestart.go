@@ -0,0 +1,109 @@
+package etcd
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWarmRestartThreshold is the default number of watches restarted within the warm restart
+// window considered a mass reconnection
+const DefaultWarmRestartThreshold = 10
+
+// warmRestarts tracks the restarts of the watches of the subscribers. Once they reach the threshold
+// within the window, as after a gateway-wide reconnection, the reads of the restarted watches are
+// spread over the window instead of hitting the cluster at once.
+type warmRestarts struct {
+	mutex     *sync.Mutex
+	window    time.Duration
+	threshold int
+	priority  []string
+	restarts  []time.Time
+}
+
+func newWarmRestarts(window time.Duration, threshold int, priority []string) *warmRestarts {
+	w := &warmRestarts{mutex: &sync.Mutex{}}
+	w.set(window, threshold, priority)
+	return w
+}
+
+// warmRestarter tracks the restarts of the subscribers of the clients without their own warm restart
+var warmRestarter = newWarmRestarts(0, 0, nil)
+
+// SetWarmRestart staggers the reads of the subscribers after a mass reconnection: once the watches of
+// threshold subscribers (DefaultWarmRestartThreshold if zero) restart within the window, the reads of
+// the restarted ones are delayed by a random period up to the window. The prefixes starting with any
+// of the priority ones are read right away. A zero window disables it, which is the default. The
+// clients created by New with a warm_restart config track the restarts of their subscribers on their own.
+func SetWarmRestart(window time.Duration, threshold int, priority []string) {
+	warmRestarter.set(window, threshold, priority)
+}
+
+// set replaces the window, the threshold and the priority prefixes, forgetting the restarts tracked
+func (w *warmRestarts) set(window time.Duration, threshold int, priority []string) {
+	if threshold <= 0 {
+		threshold = DefaultWarmRestartThreshold
+	}
+	w.mutex.Lock()
+	w.window = window
+	w.threshold = threshold
+	w.priority = priority
+	w.restarts = nil
+	w.mutex.Unlock()
+}
+
+// parseWarmRestart parses the warm_restart config:
+// {"window": "30s", "threshold": 10, "priority": ["/services/checkout"]}
+func parseWarmRestart(v interface{}) (time.Duration, int, []string, error) {
+	path := Namespace + ".warm_restart"
+	cfg, ok := v.(map[string]interface{})
+	if !ok {
+		return 0, 0, nil, badConfig(path)
+	}
+	window, err := parseDuration(cfg["window"])
+	if err != nil || window <= 0 {
+		return 0, 0, nil, badConfig(path + ".window")
+	}
+	var threshold int
+	if o, ok := cfg["threshold"]; ok {
+		n, ok := o.(float64)
+		if !ok || n < 1 {
+			return 0, 0, nil, badConfig(path + ".threshold")
+		}
+		threshold = int(n)
+	}
+	var priority []string
+	if o, ok := cfg["priority"]; ok {
+		if priority, ok = parsePrefixAllowlist(o); !ok {
+			return 0, 0, nil, badConfig(path + ".priority")
+		}
+	}
+	return window, threshold, priority, nil
+}
+
+// delay records the restart of the watch of the prefix, returning how long its read must be delayed:
+// zero unless the restarts within the window reach the threshold and the prefix has no priority
+func (w *warmRestarts) delay(prefix string, now time.Time) time.Duration {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.window <= 0 {
+		return 0
+	}
+	recent := w.restarts[:0]
+	for _, t := range w.restarts {
+		if now.Sub(t) < w.window {
+			recent = append(recent, t)
+		}
+	}
+	w.restarts = append(recent, now)
+	if len(w.restarts) < w.threshold {
+		return 0
+	}
+	for _, p := range w.priority {
+		if strings.HasPrefix(prefix, p) {
+			return 0
+		}
+	}
+	return time.Duration(rand.Int63n(int64(w.window)))
+}
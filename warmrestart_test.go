@@ -0,0 +1,73 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWarmRestarts_delay(t *testing.T) {
+	SetWarmRestart(time.Minute, 3, []string{"/services/checkout/"})
+	defer SetWarmRestart(0, 0, nil)
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if d := warmRestarter.delay("/services/api/", now); d != 0 {
+			t.Errorf("the restart %d should not be delayed below the threshold: %s", i, d)
+		}
+	}
+	if d := warmRestarter.delay("/services/checkout/", now); d != 0 {
+		t.Errorf("the priority prefixes should not be delayed: %s", d)
+	}
+	for i := 0; i < 10; i++ {
+		if d := warmRestarter.delay("/services/api/", now); d < 0 || d >= time.Minute {
+			t.Errorf("unexpected delay: %s", d)
+		}
+	}
+	// the restarts out of the window are forgotten
+	if d := warmRestarter.delay("/services/api/", now.Add(2*time.Minute)); d != 0 {
+		t.Errorf("the restart after the window should not be delayed: %s", d)
+	}
+}
+
+func TestWarmRestarts_disabled(t *testing.T) {
+	SetWarmRestart(0, 1, nil)
+	if d := warmRestarter.delay("/services/api/", time.Now()); d != 0 {
+		t.Errorf("unexpected delay: %s", d)
+	}
+}
+
+func TestNew_warmRestart(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  interface{}
+		path string
+	}{
+		{cfg: "30s", path: Namespace + ".warm_restart"},
+		{cfg: map[string]interface{}{}, path: Namespace + ".warm_restart.window"},
+		{cfg: map[string]interface{}{"window": "30s", "threshold": 0}, path: Namespace + ".warm_restart.threshold"},
+		{cfg: map[string]interface{}{"window": "30s", "priority": "/services/checkout/"}, path: Namespace + ".warm_restart.priority"},
+	} {
+		_, err := New(context.Background(), map[string]interface{}{
+			Namespace: map[string]interface{}{"machines": []interface{}{"http://127.0.0.1:2379"}, "warm_restart": tc.cfg},
+		})
+		if ce, ok := err.(*ConfigError); !ok || ce.Path != tc.path {
+			t.Errorf("unexpected error for %v: %v", tc.cfg, err)
+		}
+	}
+
+	c, err := New(context.Background(), map[string]interface{}{
+		Namespace: map[string]interface{}{
+			"machines":     []interface{}{"http://127.0.0.1:2379"},
+			"warm_restart": map[string]interface{}{"window": "30s", "priority": []interface{}{"/services/checkout/"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := settingsOf(c).warmRestarter()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.window != 30*time.Second || w.threshold != DefaultWarmRestartThreshold || len(w.priority) != 1 {
+		t.Errorf("unexpected warm restart: %+v", w)
+	}
+}
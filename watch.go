@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// HostsUpdate is a change of the hosts of a watched prefix, or the error of its read
+type HostsUpdate struct {
+	Hosts []string
+	Err   error
+}
+
+// WatchHosts watches the prefix, sending its hosts once read and every time they change until the
+// context is done, when the channel is closed. The failed reads are sent as errors and retried, like
+// the stopped watches, after the backoff set with SetBackoff. As with the subscribers, the watch itself
+// lives as long as the context of the client. See Watch for the iterator version.
+func WatchHosts(ctx context.Context, c Client, prefix string) <-chan HostsUpdate {
+	updates := make(chan HostsUpdate)
+	go func() {
+		defer close(updates)
+		var last []string
+		sent := false
+		newPrefixLoop(c, prefix).run(ctx, func() (bool, error) {
+			hosts, err := c.GetEntries(prefix)
+			if err != nil {
+				return send(ctx, updates, HostsUpdate{Err: err}), err
+			}
+			if sent && reflect.DeepEqual(hosts, last) {
+				return true, nil
+			}
+			last, sent = hosts, true
+			return send(ctx, updates, HostsUpdate{Hosts: hosts}), nil
+		})
+	}()
+	return updates
+}
+
+// send sends the update unless the context is done first, returning false in that case
+func send(ctx context.Context, updates chan<- HostsUpdate, u HostsUpdate) bool {
+	select {
+	case updates <- u:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// prefixLoop reads a prefix every time its watch notifies a change, restarting the watch when it
+// stops and retrying the failed reads after the backoff
+type prefixLoop struct {
+	client     Client
+	prefix     string
+	ch         chan struct{}
+	watchRetry retrier
+	readRetry  retrier
+}
+
+func newPrefixLoop(c Client, prefix string) *prefixLoop {
+	return &prefixLoop{client: c, prefix: prefix, ch: make(chan struct{})}
+}
+
+// run calls read after every notification until the context is done or read returns false
+func (l *prefixLoop) run(ctx context.Context, read func() (bool, error)) {
+	watching := l.watch()
+	var rewatch, refresh <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.ch:
+		case <-refresh:
+			refresh = nil
+		case <-watching:
+			watching = nil
+			rewatch = GetClock().After(l.watchRetry.next())
+			continue
+		case <-rewatch:
+			rewatch = nil
+			addMetric(MetricWatchReconnects, 1)
+			watching = l.watch()
+			continue
+		}
+
+		ok, err := read()
+		if !ok {
+			return
+		}
+		if err == nil {
+			l.readRetry.reset()
+			l.watchRetry.reset()
+			continue
+		}
+		if refresh == nil {
+			addMetric(MetricReadRetries, 1)
+			refresh = GetClock().After(l.readRetry.next())
+		}
+	}
+}
+
+// watch starts the watch of the prefix, returning a channel closed once it stops
+func (l *prefixLoop) watch() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() { recovered(l.prefix, recover()) }()
+		l.client.WatchPrefix(l.prefix, l.ch)
+	}()
+	return done
+}
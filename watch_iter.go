@@ -0,0 +1,28 @@
+//go:build go1.23
+// +build go1.23
+
+package etcd
+
+import (
+	"context"
+	"iter"
+)
+
+// Watch returns an iterator over the hosts of the prefix, yielding them once read and every time they
+// change, along with the errors of the failed reads, until the context is done or the loop stops.
+// It is the range-over-func version of WatchHosts:
+//
+//	for hosts, err := range etcd.Watch(ctx, client, "/services/api/") {
+//		...
+//	}
+func Watch(ctx context.Context, c Client, prefix string) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for u := range WatchHosts(ctx, c, prefix) {
+			if !yield(u.Hosts, u.Err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build go1.23
+// +build go1.23
+
+package etcd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWatch(t *testing.T) {
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) { return []string{"http://10.0.0.1"}, nil },
+		watchPrefix: func(_ string, ch chan struct{}) {
+			ch <- struct{}{}
+		},
+	}
+	updates := 0
+	for hosts, err := range Watch(context.Background(), c, "/services/api/") {
+		if err != nil || len(hosts) != 1 {
+			t.Errorf("unexpected update: %v %v", hosts, err)
+		}
+		updates++
+		break
+	}
+	if updates != 1 {
+		t.Errorf("unexpected updates: %d", updates)
+	}
+}
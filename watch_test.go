@@ -0,0 +1,82 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchHosts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	SetBackoff(ConstantBackoff{Period: time.Millisecond})
+	defer SetBackoff(nil)
+
+	mutex := &sync.Mutex{}
+	responses := []struct {
+		hosts []string
+		err   error
+	}{
+		{hosts: []string{"http://10.0.0.1"}},
+		{hosts: []string{"http://10.0.0.1"}},
+		{err: errors.New("unavailable")},
+		{hosts: []string{"http://10.0.0.1", "http://10.0.0.2"}},
+	}
+	events := make(chan struct{})
+	c := dummyClient{
+		getEntries: func(string) ([]string, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			r := responses[0]
+			if len(responses) > 1 {
+				responses = responses[1:]
+			}
+			return r.hosts, r.err
+		},
+		watchPrefix: func(_ string, ch chan struct{}) {
+			ch <- struct{}{}
+			for range events {
+				ch <- struct{}{}
+			}
+		},
+	}
+
+	updates := WatchHosts(ctx, c, "/services/api/")
+	next := func() HostsUpdate {
+		select {
+		case u := <-updates:
+			return u
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for the update")
+		}
+		return HostsUpdate{}
+	}
+
+	if u := next(); u.Err != nil || !reflect.DeepEqual(u.Hosts, []string{"http://10.0.0.1"}) {
+		t.Errorf("unexpected first update: %+v", u)
+	}
+	// the unchanged read is not sent
+	events <- struct{}{}
+	events <- struct{}{}
+	if u := next(); u.Err == nil {
+		t.Errorf("unexpected update: %+v", u)
+	}
+	// the failed read is retried after the backoff
+	if u := next(); u.Err != nil || len(u.Hosts) != 2 {
+		t.Errorf("unexpected update: %+v", u)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("unexpected update after the cancellation")
+		}
+	case <-time.After(time.Second):
+		t.Error("the updates should be closed once the context is done")
+	}
+}
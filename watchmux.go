@@ -0,0 +1,201 @@
+package etcd
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+)
+
+// watchMux serves the watches of all the prefixes under a root with a single watch range, dispatching
+// every event to the prefixes matching its key. It reduces the number of watchers in the etcd cluster
+// when the gateway watches hundreds of prefixes. The watch range is restarted after the backoff every
+// time it stops, from the last revision seen.
+type watchMux struct {
+	root    string
+	watcher etcdv3.Watcher
+	ctx     context.Context
+	once    *sync.Once
+	mutex   *sync.RWMutex
+	subs    map[string]map[chan struct{}]struct{}
+	options ClientOptions
+}
+
+func newWatchMux(ctx context.Context, watcher etcdv3.Watcher, options ClientOptions) *watchMux {
+	return &watchMux{
+		root:    options.WatchRoot,
+		watcher: watcher,
+		ctx:     ctx,
+		once:    &sync.Once{},
+		mutex:   &sync.RWMutex{},
+		subs:    map[string]map[chan struct{}]struct{}{},
+		options: options,
+	}
+}
+
+// covers returns true if the prefix is under the root of the multiplexed watch
+func (m *watchMux) covers(prefix string) bool {
+	return strings.HasPrefix(prefix, m.root)
+}
+
+// watchPrefix has the same semantics than Client.WatchPrefix, but it relies on the shared watch
+func (m *watchMux) watchPrefix(prefix string, ch chan struct{}) {
+	m.follow(prefix, ch, func() bool {
+		ch <- struct{}{} // make sure caller invokes GetEntries
+		return true
+	})
+}
+
+// follow relays the events of the prefix to the channel, calling initial once the prefix is added to
+// the shared watch, so the changes happening since then are not missed. It returns if initial returns
+// false.
+func (m *watchMux) follow(prefix string, ch chan struct{}, initial func() bool) {
+	notify := make(chan struct{}, 1)
+	m.add(prefix, notify)
+	defer m.remove(prefix, notify)
+
+	if !initial() {
+		return
+	}
+	for {
+		select {
+		case <-notify:
+			select {
+			case ch <- struct{}{}:
+			case <-m.ctx.Done():
+				return
+			}
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *watchMux) add(prefix string, notify chan struct{}) {
+	m.once.Do(func() {
+		wch := m.watcher.Watch(m.ctx, m.root, watchOptions(m.options)...)
+		addMetric(MetricWatchRanges, 1)
+		go m.run(wch)
+	})
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.subs[prefix]; !ok {
+		m.subs[prefix] = map[chan struct{}]struct{}{}
+		addMetric(MetricMuxPrefixes, 1)
+	}
+	m.subs[prefix][notify] = struct{}{}
+}
+
+func (m *watchMux) remove(prefix string, notify chan struct{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.subs[prefix], notify)
+	if len(m.subs[prefix]) == 0 {
+		delete(m.subs, prefix)
+		addMetric(MetricMuxPrefixes, -1)
+	}
+}
+
+// run dispatches the events of the watch range until the context is done, restarting it after the
+// backoff every time it stops. The restarted watches resume from the revision following the last one
+// seen, so no event is missed, unless it was compacted: then all the prefixes are notified, so their
+// subscribers read them again, and the watch starts from the current revision.
+func (m *watchMux) run(wch etcdv3.WatchChan) {
+	var rev int64
+	retry := retrier{settings: m.options.settings}
+	for {
+		for resp := range wch {
+			retry.reset()
+			if resp.CompactRevision > 0 {
+				rev = 0
+				m.dispatchAll()
+				continue
+			}
+			rev = lastRevision(resp, rev)
+			m.handle(resp)
+		}
+		addMetric(MetricWatchRanges, -1)
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-GetClock().After(retry.next()):
+			addMetric(MetricWatchReconnects, 1)
+		}
+		opts := watchOptions(m.options)
+		if rev > 0 {
+			opts = append(opts, etcdv3.WithRev(rev+1))
+		}
+		wch = m.watcher.Watch(m.ctx, m.root, opts...)
+		addMetric(MetricWatchRanges, 1)
+	}
+}
+
+// lastRevision returns the revision of the last event of the response, or the revision of its header if
+// it has no events, like the progress notifications
+func lastRevision(resp etcdv3.WatchResponse, rev int64) int64 {
+	if len(resp.Events) == 0 {
+		if resp.Header.Revision > rev {
+			return resp.Header.Revision
+		}
+		return rev
+	}
+	for _, ev := range resp.Events {
+		if ev != nil && ev.Kv != nil && ev.Kv.ModRevision > rev {
+			rev = ev.Kv.ModRevision
+		}
+	}
+	return rev
+}
+
+// handle dispatches the events of the watch response. The panics are recovered, so a malformed event
+// does not stop the watch of all the prefixes under the root.
+func (m *watchMux) handle(resp etcdv3.WatchResponse) {
+	defer func() { recovered(m.root, recover()) }()
+	if err := resp.Err(); err != nil {
+		countError(err)
+	}
+	for _, ev := range resp.Events {
+		if m.options.IgnoreTouches && touchWrite(ev, m.options.LeaseMargin > 0) {
+			addMetric(MetricIgnoredTouches, 1)
+			continue
+		}
+		if ev.Kv != nil {
+			m.dispatch(string(ev.Kv.Key))
+		}
+	}
+}
+
+// dispatchAll notifies all the prefixes, without blocking
+func (m *watchMux) dispatchAll() {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, chans := range m.subs {
+		for notify := range chans {
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// dispatch notifies all the prefixes matching the key, without blocking. Pending notifications
+// are coalesced, since the subscribers always read the full set of entries.
+func (m *watchMux) dispatch(key string) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for prefix, chans := range m.subs {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		for notify := range chans {
+			select {
+			case notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
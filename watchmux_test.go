@@ -0,0 +1,176 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+func TestWatchMux(t *testing.T) {
+	SetBackoff(ConstantBackoff{Period: time.Millisecond})
+	defer SetBackoff(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := &fakeV3Watcher{ch: make(chan etcdv3.WatchResponse)}
+	m := newWatchMux(ctx, watcher, ClientOptions{WatchRoot: "/services/"})
+
+	if !m.covers("/services/api") || m.covers("/other/api") {
+		t.Error("unexpected coverage of the watch root")
+	}
+
+	api := make(chan struct{})
+	go m.watchPrefix("/services/api/", api)
+	<-api
+	admin := make(chan struct{})
+	go m.watchPrefix("/services/admin/", admin)
+	<-admin
+
+	if n := watcher.watches(); n != 1 {
+		t.Errorf("unexpected number of watch ranges: %d", n)
+	}
+	if v := Metrics()[MetricMuxPrefixes]; v != 2 {
+		t.Errorf("unexpected number of multiplexed prefixes: %d", v)
+	}
+
+	watcher.ch <- etcdv3.WatchResponse{Events: []*etcdv3.Event{{Kv: &mvccpb.KeyValue{Key: []byte("/services/api/1"), ModRevision: 7}}}}
+	select {
+	case <-api:
+	case <-time.After(time.Second):
+		t.Fatal("the api prefix has not been notified")
+	}
+	select {
+	case <-admin:
+		t.Fatal("the admin prefix should not be notified")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the watch range is restarted from the last revision seen once it stops
+	closed := watcher.ch
+	watcher.set(make(chan etcdv3.WatchResponse))
+	close(closed)
+	watcher.ch <- etcdv3.WatchResponse{Events: []*etcdv3.Event{{Kv: &mvccpb.KeyValue{Key: []byte("/services/admin/1"), ModRevision: 9}}}}
+	select {
+	case <-admin:
+	case <-time.After(time.Second):
+		t.Fatal("the admin prefix has not been notified after the restart")
+	}
+	if n := watcher.watches(); n != 2 || !hasOption(watcher.options(1), etcdv3.WithRev(8)) {
+		t.Errorf("unexpected restart: %d watches", n)
+	}
+	if v := Metrics()[MetricMuxPrefixes]; v != 2 {
+		t.Errorf("unexpected number of multiplexed prefixes after the restart: %d", v)
+	}
+
+	// all the prefixes are read again when the events are compacted
+	watcher.ch <- etcdv3.WatchResponse{CompactRevision: 8}
+	for name, ch := range map[string]chan struct{}{"api": api, "admin": admin} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("the %s prefix has not been notified after the compaction", name)
+		}
+	}
+}
+
+func TestWatchMux_largeBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := &fakeV3Watcher{ch: make(chan etcdv3.WatchResponse)}
+	m := newWatchMux(ctx, watcher, ClientOptions{WatchRoot: "/services/"})
+
+	api := make(chan struct{})
+	go m.watchPrefix("/services/api/", api)
+	<-api
+	admin := make(chan struct{})
+	go m.watchPrefix("/services/admin/", admin)
+	<-admin
+
+	// the watch range is fragmented, so the server splits the large change batches
+	if !hasOption(watcher.options(0), etcdv3.WithFragment()) {
+		t.Error("the multiplexed watch should be fragmented")
+	}
+
+	events := []*etcdv3.Event{}
+	for i := 0; i < 10000; i++ {
+		events = append(events, &etcdv3.Event{Kv: &mvccpb.KeyValue{Key: []byte(fmt.Sprintf("/services/api/%d", i))}})
+	}
+	events = append(events, &etcdv3.Event{Kv: &mvccpb.KeyValue{Key: []byte("/services/admin/1")}})
+	watcher.ch <- etcdv3.WatchResponse{Events: events}
+
+	for name, ch := range map[string]chan struct{}{"api": api, "admin": admin} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("the %s prefix has not been notified", name)
+		}
+	}
+}
+
+func TestClientV3_WatchPrefix_fragment(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := &fakeV3Watcher{ch: make(chan etcdv3.WatchResponse)}
+	c := &clientv3{client: &etcdv3.Client{Watcher: watcher}, ctx: ctx}
+	ch := make(chan struct{})
+	go c.WatchPrefix("/services/api/", ch)
+	<-ch
+
+	if n := watcher.watches(); n != 1 || !hasOption(watcher.options(0), etcdv3.WithFragment()) {
+		t.Error("the watches of the prefixes should be fragmented")
+	}
+}
+
+type fakeV3Watcher struct {
+	ch    chan etcdv3.WatchResponse
+	calls int
+	opts  [][]etcdv3.OpOption
+	mutex sync.Mutex
+}
+
+func (w *fakeV3Watcher) Watch(_ context.Context, _ string, opts ...etcdv3.OpOption) etcdv3.WatchChan {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.calls++
+	w.opts = append(w.opts, opts)
+	return w.ch
+}
+
+// set replaces the channel returned by the next watches
+func (w *fakeV3Watcher) set(ch chan etcdv3.WatchResponse) {
+	w.mutex.Lock()
+	w.ch = ch
+	w.mutex.Unlock()
+}
+
+func (w *fakeV3Watcher) watches() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.calls
+}
+
+func (w *fakeV3Watcher) options(i int) []etcdv3.OpOption {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.opts[i]
+}
+
+// hasOption returns true if the options contain one built by the same constructor than opt
+func hasOption(opts []etcdv3.OpOption, opt etcdv3.OpOption) bool {
+	for _, o := range opts {
+		if reflect.ValueOf(o).Pointer() == reflect.ValueOf(opt).Pointer() {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *fakeV3Watcher) Close() error { return nil }
@@ -0,0 +1,43 @@
+package etcd
+
+import "context"
+
+// WatchSnapshot is the first read of a watched prefix, done by the client before starting its watch
+type WatchSnapshot struct {
+	Hosts []Host
+	// Header identifies the cluster member and the revision the hosts were read at
+	Header ResponseHeader
+	// Err is the error of the read. The watch is started anyway, from the latest revision.
+	Err error
+}
+
+// SnapshotWatcher is implemented by the clients able to send the hosts of the watched prefixes along
+// with the initial notification of their watches, so the consumers do not have to read them on their
+// own and can not miss the changes happening between the notification and their read.
+type SnapshotWatcher interface {
+	// WatchPrefixSnapshot is like Client.WatchPrefix, but the initial notification is replaced by the
+	// read of the prefix sent to the snapshot channel. The read is bounded by the request timeout of
+	// the client, and the watch starts right after its revision, so the channel ch is notified of
+	// every later change. Nothing is sent if the watch can not be started.
+	WatchPrefixSnapshot(prefix string, snapshot chan<- WatchSnapshot, ch chan struct{})
+}
+
+// sendSnapshot sends the snapshot unless the context is done first, returning false in that case
+func sendSnapshot(ctx context.Context, snapshot chan<- WatchSnapshot, s WatchSnapshot) bool {
+	select {
+	case snapshot <- s:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// WatchPrefixSnapshot implements the etcd SnapshotWatcher interface.
+func (c *clientv3) WatchPrefixSnapshot(prefix string, snapshot chan<- WatchSnapshot, ch chan struct{}) {
+	c.watchPrefix(prefix, ch, snapshot)
+}
+
+// WatchPrefixSnapshot implements the etcd SnapshotWatcher interface.
+func (c *client) WatchPrefixSnapshot(prefix string, snapshot chan<- WatchSnapshot, ch chan struct{}) {
+	c.watchPrefix(prefix, ch, snapshot)
+}
@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	etcdv3 "github.com/devopsfaith/krakend-etcd/internal/etcdv3"
+	"github.com/devopsfaith/krakend-etcd/internal/mvccpb"
+)
+
+type optionsWatcher struct {
+	ch      chan etcdv3.WatchResponse
+	options chan int
+}
+
+func (w optionsWatcher) Watch(_ context.Context, _ string, opts ...etcdv3.OpOption) etcdv3.WatchChan {
+	w.options <- len(opts)
+	return w.ch
+}
+
+func (optionsWatcher) Close() error { return nil }
+
+func TestClientV3_WatchPrefixSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := optionsWatcher{ch: make(chan etcdv3.WatchResponse), options: make(chan int, 1)}
+	c := &clientv3{
+		client: &etcdv3.Client{
+			KV: fakeGetKV{resp: &etcdv3.GetResponse{
+				Header: &etcdv3.ResponseHeader{Revision: 50},
+				Kvs:    []*mvccpb.KeyValue{{Key: []byte("/services/api/1"), Value: []byte("http://10.0.0.1")}},
+				Count:  1,
+			}},
+			Watcher: w,
+		},
+		ctx:     ctx,
+		timeout: time.Second,
+		limits:  newClientLimits(ClientOptions{}),
+	}
+	snapshots, ch := make(chan WatchSnapshot), make(chan struct{})
+	go c.WatchPrefixSnapshot("/services/api/", snapshots, ch)
+
+	select {
+	case s := <-snapshots:
+		if s.Err != nil || s.Header.Revision != 50 || !reflect.DeepEqual(hostURLs(s.Hosts), []string{"http://10.0.0.1"}) {
+			t.Errorf("unexpected snapshot: %+v", s)
+		}
+	case <-ch:
+		t.Fatal("the initial notification should be replaced by the snapshot")
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the snapshot")
+	}
+	select {
+	case n := <-w.options:
+		// the prefix and the revision to start the watch from
+		if n != len(watchOptions(ClientOptions{}))+1 {
+			t.Errorf("the watch should start after the revision of the snapshot: %d options", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the watch was not started")
+	}
+
+	w.ch <- etcdv3.WatchResponse{}
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Error("the changes should be notified")
+	}
+}
+
+type snapshotClient struct {
+	dummyClient
+	hosts []Host
+}
+
+func (c snapshotClient) WatchPrefixSnapshot(prefix string, snapshot chan<- WatchSnapshot, ch chan struct{}) {
+	snapshot <- WatchSnapshot{Hosts: c.hosts, Header: ResponseHeader{Revision: 10}}
+	c.watchPrefix(prefix, ch)
+}
+
+func TestSubscriber_watchSnapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reads := make(chan string, 10)
+	c := snapshotClient{
+		dummyClient: dummyClient{
+			getEntries: func(prefix string) ([]string, error) {
+				reads <- prefix
+				return nil, nil
+			},
+			watchPrefix: func(string, chan struct{}) { <-ctx.Done() },
+		},
+		hosts: []Host{{URL: "http://10.0.0.1"}},
+	}
+	s := newSubscriber(ctx, c, "/services/snapshot", BackendOptions{})
+	go s.loop()
+
+	select {
+	case <-s.firstRead:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the snapshot")
+	}
+	if hosts, err := s.Hosts(); err != nil || !reflect.DeepEqual(hosts, []string{"http://10.0.0.1"}) {
+		t.Errorf("unexpected hosts: %v %v", hosts, err)
+	}
+	if len(reads) != 0 {
+		t.Errorf("the prefix should not be read: %d reads", len(reads))
+	}
+}
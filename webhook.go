@@ -0,0 +1,85 @@
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// HeaderSignature is the header with the HMAC-SHA256 signature of the body of the webhook requests,
+	// as "sha256=<hex digest>", computed with the secret of the webhook
+	HeaderSignature = "X-Etcd-Signature"
+	// DefaultWebhookTimeout is the default timeout of the webhook requests
+	DefaultWebhookTimeout = 5 * time.Second
+)
+
+// Webhook is a Publisher posting the changes of the discovered hosts to an external system (dashboards,
+// CMDBs, incident bots...). The requests are signed if the secret is not empty.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhook returns a Webhook posting to the url with the received timeout (DefaultWebhookTimeout if
+// it is not positive)
+func NewWebhook(url, secret string, timeout time.Duration) *Webhook {
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &Webhook{URL: url, Secret: secret, Client: &http.Client{Timeout: timeout}}
+}
+
+// Publish implements the Publisher interface, posting the event. It returns an error if it was not
+// accepted with a 2xx status code.
+func (w *Webhook) Publish(e DiscoveryEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, body))
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s answered with status %d", w.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of the body, as sent in the HeaderSignature of the webhook requests
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RegisterWebhook registers the webhook as a publisher. See RegisterPublisher.
+func RegisterWebhook(ctx context.Context, w *Webhook) {
+	RegisterPublisher(ctx, w)
+}
+
+func newWebhookPublisher(cfg map[string]interface{}) (Publisher, error) {
+	url, err := stringOption(cfg, "url")
+	if err != nil {
+		return nil, err
+	}
+	secret, _ := cfg["secret"].(string)
+	return NewWebhook(url, secret, timeoutOption(cfg)), nil
+}
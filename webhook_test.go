@@ -0,0 +1,90 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegisterWebhook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		changeHandlersMutex.Lock()
+		changeHandlers = changeHandlers[:0]
+		changeHandlersMutex.Unlock()
+	}()
+
+	received := make(chan ChangeEvent, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if sig := req.Header.Get(HeaderSignature); sig != Sign("s3cr3t", body) {
+			t.Errorf("unexpected signature: %s", sig)
+		}
+		var e ChangeEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+		}
+		if e.Prefix == "/services/webhook" {
+			received <- e
+		}
+	}))
+	defer srv.Close()
+
+	publishers, err := parsePublishers(map[string]interface{}{
+		"webhook": map[string]interface{}{"url": srv.URL, "secret": "s3cr3t", "timeout": "1s"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(publishers) != 1 {
+		t.Fatalf("unexpected publishers: %v", publishers)
+	}
+	RegisterPublisher(ctx, publishers[0])
+
+	c := newChurnTracker("/services/webhook", 0)
+	now := time.Now()
+	c.track([]string{"a", "b"}, now)
+	c.track([]string{"a", "c", "d"}, now.Add(time.Second))
+
+	select {
+	case e := <-received:
+		expected := ChangeEvent{
+			Prefix:  "/services/webhook",
+			Added:   []string{"c", "d"},
+			Removed: []string{"b"},
+			Hosts:   []string{"a", "c", "d"},
+		}
+		if !reflect.DeepEqual(e, expected) {
+			t.Errorf("unexpected change: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the change was not delivered")
+	}
+
+	select {
+	case e := <-received:
+		t.Errorf("unexpected change: %+v", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWebhook_Publish_ko(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL, "", 0).Publish(DiscoveryEvent{ChangeEvent: ChangeEvent{Prefix: "/services/api"}}); err == nil {
+		t.Error("error expected")
+	}
+	_, err := parsePublishers(map[string]interface{}{"webhook": map[string]interface{}{"secret": "s3cr3t"}})
+	if ce, ok := err.(*ConfigError); !ok || ce.Path != Namespace+".webhook.url" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// decodeYAML decodes the yaml records. In order to avoid adding a yaml library as a dependency, only
+// the subset of the format required by the records is supported: scalar fields and a single level of
+// nested mappings (the metadata and the tls hints), with comments and quoted strings.
+//
+//	host: 10.0.0.1
+//	port: 8080
+//	metadata:
+//	  zone: eu-west-1a
+func decodeYAML(b []byte) ([]Host, error) {
+	doc, err := parseFlatYAML(b)
+	if err != nil {
+		return nil, err
+	}
+
+	r := record{}
+	r.Host, _ = doc["host"].(string)
+	r.Scheme, _ = doc["scheme"].(string)
+	if port, ok := doc["port"].(string); ok {
+		r.Port = json.Number(port)
+	}
+	if priority, ok := doc["priority"].(string); ok {
+		r.Priority = json.Number(priority)
+	}
+	if maintenance, ok := doc["maintenance"].(string); ok {
+		r.Maintenance = maintenance == "true"
+	}
+	if metadata, ok := doc["metadata"].(map[string]interface{}); ok {
+		r.Metadata = metadata
+	}
+	r.TLS = parseHostTLS(doc["tls"])
+
+	h, err := r.toHost()
+	if err != nil {
+		return nil, err
+	}
+	return []Host{h}, nil
+}
+
+func parseFlatYAML(b []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	var nested map[string]interface{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Text()
+		text := strings.TrimSpace(stripYAMLComment(raw))
+		if text == "" || text == "---" {
+			continue
+		}
+
+		i := strings.Index(text, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("yaml: line %d: expecting a key-value pair", line)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		indented := len(raw) > 0 && (raw[0] == ' ' || raw[0] == '\t')
+
+		switch {
+		case indented && nested != nil:
+			nested[key] = unquoteYAML(value)
+		case indented:
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line)
+		case value == "":
+			nested = map[string]interface{}{}
+			doc[key] = nested
+		default:
+			nested = nil
+			doc[key] = unquoteYAML(value)
+		}
+	}
+	return doc, scanner.Err()
+}
+
+func stripYAMLComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}